@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Identificador do formato do patch binário gerado pelo servidor de atualização
+//
+// Formato: "AGDIFF01", tamanho do novo arquivo, tamanho do bloco de controle comprimido e tamanho do bloco
+// de diferenças comprimido (int64 little-endian), seguidos dos três blocos comprimidos com gzip:
+//   - controle: triplas int64 (bytes copiados do antigo somando a diferença, bytes inseridos do bloco extra,
+//     deslocamento da posição no arquivo antigo)
+//   - diferenças: byte novo menos byte antigo de cada byte copiado
+//   - extra: bytes novos inseridos
+const bsdiffMagic = "AGDIFF01"
+
+// Patch com formato inválido ou que não corresponde ao arquivo antigo
+var errInvalidPatch = errors.New("patch binário inválido")
+
+// bspatch aplica o patch gerado pelo servidor de atualização ao arquivo antigo e retorna o novo arquivo
+// O tamanho do novo arquivo declarado no patch precisa ser expectedSize (o tamanho do manifesto assinado),
+// conferido antes de qualquer alocação
+func bspatch(oldData, patch []byte, expectedSize int64) ([]byte, error) {
+	headerSize := len(bsdiffMagic) + 3*8
+	if len(patch) < headerSize || string(patch[:len(bsdiffMagic)]) != bsdiffMagic {
+		return nil, fmt.Errorf("%w: cabeçalho desconhecido", errInvalidPatch)
+	}
+	header := patch[len(bsdiffMagic):headerSize]
+	newSize := int64(binary.LittleEndian.Uint64(header[0:8]))
+	ctrlSize := int64(binary.LittleEndian.Uint64(header[8:16]))
+	diffSize := int64(binary.LittleEndian.Uint64(header[16:24]))
+	body := patch[headerSize:]
+	bodySize := int64(len(body))
+	// Cada tamanho é conferido separadamente, para que a soma não ultrapasse o limite do int64
+	if ctrlSize < 0 || diffSize < 0 || ctrlSize > bodySize || diffSize > bodySize-ctrlSize {
+		return nil, fmt.Errorf("%w: tamanhos inválidos no cabeçalho", errInvalidPatch)
+	}
+	if newSize != expectedSize {
+		return nil, fmt.Errorf("%w: gera %d bytes, esperado %d", errInvalidPatch, newSize, expectedSize)
+	}
+
+	ctrlReader, err := gzip.NewReader(bytes.NewReader(body[:ctrlSize]))
+	if err != nil {
+		return nil, fmt.Errorf("%w: bloco de controle: %v", errInvalidPatch, err)
+	}
+	diffReader, err := gzip.NewReader(bytes.NewReader(body[ctrlSize : ctrlSize+diffSize]))
+	if err != nil {
+		return nil, fmt.Errorf("%w: bloco de diferenças: %v", errInvalidPatch, err)
+	}
+	extraReader, err := gzip.NewReader(bytes.NewReader(body[ctrlSize+diffSize:]))
+	if err != nil {
+		return nil, fmt.Errorf("%w: bloco extra: %v", errInvalidPatch, err)
+	}
+
+	newData := make([]byte, newSize)
+	oldSize := int64(len(oldData))
+	var oldPos, newPos int64
+	var word [8]byte
+	for newPos < newSize {
+		var ctrl [3]int64
+		for i := range ctrl {
+			if _, err := io.ReadFull(ctrlReader, word[:]); err != nil {
+				return nil, fmt.Errorf("%w: bloco de controle: %v", errInvalidPatch, err)
+			}
+			ctrl[i] = int64(binary.LittleEndian.Uint64(word[:]))
+		}
+		copyLength, extraLength, seek := ctrl[0], ctrl[1], ctrl[2]
+		if copyLength < 0 || extraLength < 0 || copyLength > newSize-newPos || extraLength > newSize-newPos-copyLength {
+			return nil, fmt.Errorf("%w: controle fora dos limites", errInvalidPatch)
+		}
+
+		// Copiar do arquivo antigo somando as diferenças
+		if _, err := io.ReadFull(diffReader, newData[newPos:newPos+copyLength]); err != nil {
+			return nil, fmt.Errorf("%w: bloco de diferenças: %v", errInvalidPatch, err)
+		}
+		for i := int64(0); i < copyLength; i++ {
+			if oldPos+i >= 0 && oldPos+i < oldSize {
+				newData[newPos+i] += oldData[oldPos+i]
+			}
+		}
+		newPos += copyLength
+		oldPos += copyLength
+
+		// Inserir os bytes novos
+		if _, err := io.ReadFull(extraReader, newData[newPos:newPos+extraLength]); err != nil {
+			return nil, fmt.Errorf("%w: bloco extra: %v", errInvalidPatch, err)
+		}
+		newPos += extraLength
+		oldPos += seek
+	}
+
+	return newData, nil
+}
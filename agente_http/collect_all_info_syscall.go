@@ -1,22 +1,14 @@
 package main
 
 import (
+	"context"
 	"time"
 )
 
 // collectAllInfoSyscall coleta todas as informações do sistema
 func collectAllInfoSyscall() (SystemInfo, error) {
-	var info SystemInfo
-
-	// Coletar informações do sistema
-	info.Sistema = getSystemInfoSyscall()
-	info.CPU = getCPUInfoSyscall()
-	info.Memoria = getMemoryInfoSyscall()
-	info.Discos = getDiskInfoSyscall()
-	info.GPU = getGPUInfoSyscall()
-	info.Hardware = getHardwareInfoSyscall()
-	info.Rede = getNetworkInfoSyscall()
-	info.Agente = getAgentInfo()
+	// Coletar todas as seções registradas
+	info := collectors.CollectAll(context.Background())
 
 	// Atualizar o cache
 	cachedSystemInfo = info
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+)
+
+// Collector representa uma seção das informações do sistema (cpu, memoria, discos...)
+// O nome da seção é usado como chave no snapshot completo e como endpoint /<nome>
+type Collector interface {
+	Name() string
+	Collect(ctx context.Context) (interface{}, error)
+}
+
+// errInvalidCollectorQuery indica parâmetros de consulta inválidos (respondido com 400 pelo endpoint da seção)
+var errInvalidCollectorQuery = errors.New("parâmetro inválido")
+
+// collectorQueryKey é a chave do contexto que carrega os parâmetros da requisição até o coletor
+type collectorQueryKey struct{}
+
+// withCollectorQuery anexa ao contexto os parâmetros de consulta da requisição (ex: ?top=10)
+func withCollectorQuery(ctx context.Context, query url.Values) context.Context {
+	return context.WithValue(ctx, collectorQueryKey{}, query)
+}
+
+// collectorQuery retorna os parâmetros de consulta anexados ao contexto (vazio no snapshot completo)
+func collectorQuery(ctx context.Context) url.Values {
+	if query, ok := ctx.Value(collectorQueryKey{}).(url.Values); ok {
+		return query
+	}
+	return url.Values{}
+}
+
+// collectorFunc adapta uma função de coleta à interface Collector
+type collectorFunc struct {
+	name    string
+	collect func(ctx context.Context) (interface{}, error)
+}
+
+func (c collectorFunc) Name() string {
+	return c.name
+}
+
+func (c collectorFunc) Collect(ctx context.Context) (interface{}, error) {
+	return c.collect(ctx)
+}
+
+// newCollector cria um Collector a partir de um nome e de uma função de coleta
+func newCollector(name string, collect func(ctx context.Context) (interface{}, error)) Collector {
+	return collectorFunc{name: name, collect: collect}
+}
+
+// CollectorRegistry mantém os coletores registrados, na ordem de registro
+type CollectorRegistry struct {
+	mu         sync.RWMutex
+	collectors []Collector
+}
+
+// Registro usado pelo snapshot completo e pelos endpoints de cada seção
+var collectors = newCollectorRegistry()
+
+// newCollectorRegistry cria um registro de coletores vazio
+func newCollectorRegistry() *CollectorRegistry {
+	return &CollectorRegistry{}
+}
+
+// Register adiciona um coletor ao registro
+func (r *CollectorRegistry) Register(c Collector) error {
+	if c.Name() == "" {
+		return fmt.Errorf("coletor sem nome")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.collectors {
+		if existing.Name() == c.Name() {
+			return fmt.Errorf("coletor já registrado: %s", c.Name())
+		}
+	}
+
+	r.collectors = append(r.collectors, c)
+	return nil
+}
+
+// Get retorna o coletor registrado com o nome informado
+func (r *CollectorRegistry) Get(name string) (Collector, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, c := range r.collectors {
+		if c.Name() == name {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// Collectors retorna uma cópia da lista de coletores registrados
+func (r *CollectorRegistry) Collectors() []Collector {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	list := make([]Collector, len(r.collectors))
+	copy(list, r.collectors)
+	return list
+}
+
+// CollectAll executa todos os coletores e monta o snapshot completo
+// A falha de uma seção não interrompe as demais: a seção recebe apenas o campo "erro"
+func (r *CollectorRegistry) CollectAll(ctx context.Context) SystemInfo {
+	info := make(SystemInfo)
+
+	for _, c := range r.Collectors() {
+		if err := ctx.Err(); err != nil {
+			info[c.Name()] = map[string]interface{}{"erro": err.Error()}
+			continue
+		}
+
+		data, err := c.Collect(ctx)
+		if err != nil {
+			fmt.Printf("Erro ao coletar informações de %s: %v\n", c.Name(), err)
+			info[c.Name()] = map[string]interface{}{"erro": err.Error()}
+			continue
+		}
+
+		info[c.Name()] = data
+	}
+
+	return info
+}
+
+// mustRegisterCollector registra um coletor no registro padrão, abortando em caso de nome duplicado
+// Deve ser chamada a partir de funções init()
+func mustRegisterCollector(c Collector) {
+	if err := collectors.Register(c); err != nil {
+		panic(err)
+	}
+}
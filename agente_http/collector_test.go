@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// fakeCollector é um coletor de teste que retorna os dados ou o erro configurados
+type fakeCollector struct {
+	name string
+	data interface{}
+	err  error
+}
+
+func (c fakeCollector) Name() string {
+	return c.name
+}
+
+func (c fakeCollector) Collect(ctx context.Context) (interface{}, error) {
+	return c.data, c.err
+}
+
+// TestCollectAllIncludesCollectorData verifica que os dados de um coletor registrado entram no snapshot completo
+func TestCollectAllIncludesCollectorData(t *testing.T) {
+	registry := newCollectorRegistry()
+	data := map[string]interface{}{"modelo": "teste", "nucleos": 4}
+	if err := registry.Register(fakeCollector{name: "falso", data: data}); err != nil {
+		t.Fatalf("erro ao registrar coletor: %v", err)
+	}
+
+	info := registry.CollectAll(context.Background())
+
+	got, ok := info["falso"]
+	if !ok {
+		t.Fatalf("seção falso ausente no snapshot: %v", info)
+	}
+	if !reflect.DeepEqual(got, data) {
+		t.Errorf("seção falso = %v, esperado %v", got, data)
+	}
+}
+
+// TestCollectAllRecordsCollectorErrors verifica que o erro de um coletor é registrado na seção dele
+// sem interromper os demais coletores
+func TestCollectAllRecordsCollectorErrors(t *testing.T) {
+	registry := newCollectorRegistry()
+	for _, c := range []Collector{
+		fakeCollector{name: "falha", err: errors.New("sensor indisponível")},
+		fakeCollector{name: "falso", data: "ok"},
+	} {
+		if err := registry.Register(c); err != nil {
+			t.Fatalf("erro ao registrar coletor %s: %v", c.Name(), err)
+		}
+	}
+
+	info := registry.CollectAll(context.Background())
+
+	section, ok := info["falha"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("seção falha = %v, esperado o registro do erro", info["falha"])
+	}
+	if section["erro"] != "sensor indisponível" {
+		t.Errorf("erro da seção falha = %v, esperado %q", section["erro"], "sensor indisponível")
+	}
+	if info["falso"] != "ok" {
+		t.Errorf("seção falso = %v, esperado %q (coleta interrompida pelo erro?)", info["falso"], "ok")
+	}
+}
+
+// TestRegisterRejectsDuplicateCollector verifica que dois coletores não podem usar o mesmo nome
+func TestRegisterRejectsDuplicateCollector(t *testing.T) {
+	registry := newCollectorRegistry()
+	if err := registry.Register(fakeCollector{name: "falso"}); err != nil {
+		t.Fatalf("erro ao registrar coletor: %v", err)
+	}
+	if err := registry.Register(fakeCollector{name: "falso"}); err == nil {
+		t.Error("coletor duplicado aceito")
+	}
+}
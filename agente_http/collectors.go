@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+)
+
+// Seções coletadas por padrão, na mesma ordem do snapshot completo
+// Cada seção nova deve registrar o próprio coletor em uma função init() no seu arquivo
+func init() {
+	mustRegisterCollector(newCollector("sistema", func(ctx context.Context) (interface{}, error) {
+		return getSystemInfoSyscall(), nil
+	}))
+	mustRegisterCollector(newCollector("cpu", func(ctx context.Context) (interface{}, error) {
+		return getCPUInfoSyscall(), nil
+	}))
+	mustRegisterCollector(newCollector("memoria", func(ctx context.Context) (interface{}, error) {
+		return getMemoryInfoSyscall(), nil
+	}))
+	mustRegisterCollector(newCollector("discos", func(ctx context.Context) (interface{}, error) {
+		return getDiskInfoSyscall(), nil
+	}))
+	mustRegisterCollector(newCollector("gpu", func(ctx context.Context) (interface{}, error) {
+		return getGPUInfoSyscall(), nil
+	}))
+	mustRegisterCollector(newCollector("hardware", func(ctx context.Context) (interface{}, error) {
+		return getHardwareInfoSyscall(), nil
+	}))
+	mustRegisterCollector(newCollector("rede", func(ctx context.Context) (interface{}, error) {
+		return getNetworkInfoSyscall(), nil
+	}))
+	mustRegisterCollector(newCollector("agente", func(ctx context.Context) (interface{}, error) {
+		return getAgentInfo(), nil
+	}))
+}
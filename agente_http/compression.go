@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Cabeçalho da resposta que informa a compressão aplicada antes da criptografia
+const payloadEncodingHeader = "X-Payload-Encoding"
+
+// Respostas menores que isso não compensam o cabeçalho do gzip
+const minCompressSize = 512
+
+// acceptsGzip verifica se o cliente aceita gzip no cabeçalho Accept-Encoding (ex: "gzip", "gzip;q=0.8", "*")
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
+
+		// Respeitar "q=0", que recusa explicitamente a codificação
+		if name, value, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(name) == "q" {
+			if q, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil && q == 0 {
+				continue
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// compressPayload comprime os dados com gzip, antes da criptografia, se o cliente aceitar
+// A compressão só é aplicada a clientes que também negociam o formato de criptografia (X-Encryption):
+// clientes Go antigos enviam "Accept-Encoding: gzip" automaticamente, mas não descomprimem o conteúdo criptografado
+func compressPayload(w http.ResponseWriter, r *http.Request, data []byte) ([]byte, error) {
+	w.Header().Add("Vary", "Accept-Encoding")
+
+	if len(data) < minCompressSize || r.Header.Get(encryptionHeader) == "" || !acceptsGzip(r) {
+		return data, nil
+	}
+
+	compressed, err := gzipData(data)
+	if err != nil {
+		return nil, err
+	}
+
+	w.Header().Set(payloadEncodingHeader, "gzip")
+	return compressed, nil
+}
+
+// gzipData comprime os dados com gzip
+func gzipData(data []byte) ([]byte, error) {
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	if _, err := writer.Write(data); err != nil {
+		return nil, fmt.Errorf("erro ao comprimir dados: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("erro ao comprimir dados: %v", err)
+	}
+	return buffer.Bytes(), nil
+}
@@ -0,0 +1,590 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Arquivo de configuração procurado ao lado do executável (outro pode ser indicado com -config ou AGENTE_CONFIG)
+const configFileName = "agente.json"
+
+// Prefixo das variáveis de ambiente (ex: AGENTE_PORTA, AGENTE_SERVIDOR_ATUALIZACAO)
+const configEnvPrefix = "AGENTE_"
+
+// Origens de um valor de configuração, da maior para a menor precedência
+// O banco guarda os valores alterados remotamente pelo commander; o arquivo e os padrões valem enquanto
+// nada foi alterado, e flags e variáveis de ambiente fixam o valor na máquina
+const (
+	configSourceFlag    = "flag"
+	configSourceEnv     = "ambiente"
+	configSourceDB      = "banco"
+	configSourceFile    = "arquivo"
+	configSourceDefault = "padrao"
+)
+
+// configSetting descreve uma configuração do agente
+// key é o nome no arquivo e na tabela config; a flag usa hífens (-servidor-atualizacao) e a variável
+// de ambiente, o prefixo e maiúsculas (AGENTE_SERVIDOR_ATUALIZACAO)
+type configSetting struct {
+	key          string
+	defaultValue string
+	numeric      bool     // Número inteiro positivo
+	allowZero    bool     // Com numeric, aceita também 0 (desativado)
+	url          bool     // Endereço http:// ou https://
+	identifier   bool     // Letras minúsculas, números e hífens
+	choices      []string // Valores aceitos (vazio: qualquer valor)
+	required     bool     // Não pode ser vazia
+	local        bool     // Só pode ser definida na máquina (flag, ambiente ou arquivo), não pelo banco
+	secret       bool     // Valor não é exibido em /config
+	usage        string
+}
+
+var configSettings = []configSetting{
+	{key: "porta", defaultValue: "9999", numeric: true, local: true, usage: "Porta do servidor HTTP do agente"},
+	{key: "endereco", defaultValue: "", local: true, usage: "Endereço IP em que o servidor HTTP escuta (vazio: todas as interfaces)"},
+	{key: "banco", defaultValue: "system_info.db", local: true, usage: "Caminho do banco de dados SQLite (relativo ao diretório do executável)"},
+	{key: "chaves", defaultValue: "keys", local: true, usage: "Diretório das chaves (relativo ao diretório do executável)"},
+	{key: "servidor_atualizacao", defaultValue: "http://10.46.102.245:9991", url: true, required: true, usage: "Endereço do servidor de atualização"},
+	{key: "servidor_coleta", defaultValue: "", url: true, usage: "Endereço do servidor de coleta para onde os snapshots são enviados (vazio: envio desativado)"},
+	{key: "system_info_update_interval", defaultValue: "30", numeric: true, usage: "Intervalo de coleta de informações do sistema (em minutos)"},
+	{key: "update_check_interval", defaultValue: "30", numeric: true, usage: "Intervalo de verificação de atualizações (em minutos)"},
+	{key: "canal_atualizacao", defaultValue: stableUpdateChannel, required: true, identifier: true, usage: "Canal de atualização do agente (ex: stable, beta, pilot)"},
+	{key: "limite_download_kbps", defaultValue: "0", numeric: true, allowZero: true, usage: "Velocidade máxima do download de atualizações, em kbit/s (0: sem limite)"},
+	{key: "aceitar_pre_lancamento", defaultValue: prereleasePolicyChannel, choices: []string{prereleasePolicyChannel, prereleasePolicyAlways, prereleasePolicyNever}, usage: "Instalar versões de pré-lançamento (ex: 1.2.0-rc.1): canal (fora do canal stable), sim ou nao"},
+	{key: "p2p_atualizacao", defaultValue: "nao", choices: []string{"sim", "nao"}, usage: "Compartilhar o executável instalado com os agentes da mesma rede e baixar atualizações deles (sim ou nao)"},
+	{key: "porta_p2p", defaultValue: "9998", numeric: true, local: true, usage: "Porta UDP da procura por pares da rede que têm a atualização"},
+	{key: "token_inscricao", defaultValue: "", local: true, secret: true, usage: "Token de inscrição gerado no servidor de coleta, apresentado no primeiro contato"},
+}
+
+// Valor exibido em /config no lugar das configurações secretas
+const configSecretMask = "********"
+
+// ConfigValue é o valor efetivo de uma configuração e a origem de onde foi lido
+type ConfigValue struct {
+	Valor  string `json:"valor"`
+	Origem string `json:"origem"`
+}
+
+// Motivos de rejeição de uma alteração remota da configuração
+var (
+	errConfigInvalid  = errors.New("configuração inválida")
+	errConfigPinned   = errors.New("configuração fixada na inicialização do agente") // Definida por flag ou variável de ambiente
+	errConfigRevision = errors.New("revisão da configuração diferente da esperada")
+)
+
+// ConfigPatch é o conteúdo do envelope assinado de PATCH /config
+// Apenas os campos informados são alterados; com RevisaoEsperada, a alteração só é aplicada se a revisão atual
+// do agente for a informada (evita sobrescrever uma alteração feita por outro operador)
+type ConfigPatch struct {
+	RevisaoEsperada          *int64  `json:"revisao_esperada,omitempty"`
+	ServidorAtualizacao      *string `json:"servidor_atualizacao,omitempty"`
+	ServidorColeta           *string `json:"servidor_coleta,omitempty"`
+	SystemInfoUpdateInterval *int    `json:"system_info_update_interval,omitempty"`
+	UpdateCheckInterval      *int    `json:"update_check_interval,omitempty"`
+	CanalAtualizacao         *string `json:"canal_atualizacao,omitempty"`
+	AceitarPreLancamento     *string `json:"aceitar_pre_lancamento,omitempty"`
+	LimiteDownloadKbps       *int    `json:"limite_download_kbps,omitempty"`
+	P2PAtualizacao           *string `json:"p2p_atualizacao,omitempty"`
+}
+
+// Valores de cada origem e configuração efetiva
+var (
+	configMutex      sync.RWMutex
+	configLayers     = map[string]map[string]string{}
+	effectiveConfig  = map[string]ConfigValue{}
+	configFilePath   string
+	configFileLoaded bool
+	configRevision   int64 // Incrementada a cada alteração remota
+)
+
+// Ordem de precedência das origens
+var configSourceOrder = []string{configSourceFlag, configSourceEnv, configSourceDB, configSourceFile}
+
+// findConfigSetting retorna a descrição da configuração com o nome informado
+func findConfigSetting(key string) (configSetting, bool) {
+	for _, setting := range configSettings {
+		if setting.key == key {
+			return setting, true
+		}
+	}
+	return configSetting{}, false
+}
+
+// validateConfigValue verifica se o valor é aceito pela configuração
+func validateConfigValue(setting configSetting, value string) error {
+	if setting.required && value == "" {
+		return fmt.Errorf("%w: %s não pode ser vazia", errConfigInvalid, setting.key)
+	}
+	if setting.numeric {
+		number, err := strconv.Atoi(value)
+		if err != nil || number < 0 || (number == 0 && !setting.allowZero) {
+			return fmt.Errorf("%w: %s deve ser um número inteiro positivo: %q", errConfigInvalid, setting.key, value)
+		}
+	}
+	if setting.url && value != "" && !strings.HasPrefix(value, "http://") && !strings.HasPrefix(value, "https://") {
+		return fmt.Errorf("%w: %s deve começar com http:// ou https://: %q", errConfigInvalid, setting.key, value)
+	}
+	if setting.identifier && !isConfigIdentifier(value) {
+		return fmt.Errorf("%w: %s deve ter apenas letras minúsculas, números e hífens: %q", errConfigInvalid, setting.key, value)
+	}
+	if len(setting.choices) > 0 && !slices.Contains(setting.choices, value) {
+		return fmt.Errorf("%w: %s deve ser um destes valores: %s: %q", errConfigInvalid, setting.key, strings.Join(setting.choices, ", "), value)
+	}
+	return nil
+}
+
+// isConfigIdentifier verifica se o valor tem apenas letras minúsculas, números e hífens
+func isConfigIdentifier(value string) bool {
+	for _, c := range value {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// loadConfig lê as flags, as variáveis de ambiente e o arquivo de configuração
+// Os valores do banco são lidos depois, com loadConfigFromDB, porque o caminho do banco vem desta etapa
+func loadConfig(args []string) error {
+	flags := flag.NewFlagSet(filepath.Base(os.Args[0]), flag.ContinueOnError)
+	configPath := flags.String("config", "", "Arquivo de configuração (padrão: "+configFileName+" ao lado do executável)")
+	flagValues := make(map[string]*string)
+	for _, setting := range configSettings {
+		usage := setting.usage
+		if setting.defaultValue != "" {
+			usage += fmt.Sprintf(" (padrão: %s)", setting.defaultValue)
+		}
+		flagValues[setting.key] = flags.String(strings.ReplaceAll(setting.key, "_", "-"), "", usage)
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	layers := map[string]map[string]string{
+		configSourceFlag: {},
+		configSourceEnv:  {},
+		configSourceFile: {},
+		configSourceDB:   {},
+	}
+
+	// Flags informadas na linha de comando
+	flags.Visit(func(f *flag.Flag) {
+		key := strings.ReplaceAll(f.Name, "-", "_")
+		if value, ok := flagValues[key]; ok {
+			layers[configSourceFlag][key] = *value
+		}
+	})
+
+	// Variáveis de ambiente
+	for _, setting := range configSettings {
+		if value, ok := os.LookupEnv(configEnvPrefix + strings.ToUpper(setting.key)); ok {
+			layers[configSourceEnv][setting.key] = value
+		}
+	}
+
+	// Arquivo de configuração: o padrão é opcional, mas um arquivo indicado explicitamente precisa existir
+	path := *configPath
+	explicit := path != ""
+	if !explicit {
+		path = os.Getenv(configEnvPrefix + "CONFIG")
+		explicit = path != ""
+	}
+	if !explicit {
+		path = agentPath(configFileName)
+	}
+	fileValues, found, err := readConfigFile(path)
+	if err != nil {
+		return err
+	}
+	if !found && explicit {
+		return fmt.Errorf("arquivo de configuração não encontrado: %s", path)
+	}
+	layers[configSourceFile] = fileValues
+
+	for source, values := range layers {
+		for key, value := range values {
+			setting, _ := findConfigSetting(key)
+			if err := validateConfigValue(setting, value); err != nil {
+				return fmt.Errorf("origem %s: %v", source, err)
+			}
+		}
+	}
+
+	configMutex.Lock()
+	defer configMutex.Unlock()
+	configLayers = layers
+	configFilePath = path
+	configFileLoaded = found
+	resolveConfigLocked()
+	return nil
+}
+
+// readConfigFile lê o arquivo de configuração JSON (ex: {"porta": 9999, "servidor_atualizacao": "http://..."})
+// Retorna found = false se o arquivo não existe
+func readConfigFile(path string) (map[string]string, bool, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return map[string]string{}, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("erro ao ler arquivo de configuração: %v", err)
+	}
+
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, false, fmt.Errorf("erro ao interpretar arquivo de configuração %s: %v", path, err)
+	}
+
+	values := make(map[string]string)
+	for key, value := range raw {
+		if _, ok := findConfigSetting(key); !ok {
+			return nil, false, fmt.Errorf("configuração desconhecida no arquivo %s: %s", path, key)
+		}
+		switch v := value.(type) {
+		case string:
+			values[key] = v
+		case float64:
+			values[key] = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			return nil, false, fmt.Errorf("valor inválido para %s no arquivo %s", key, path)
+		}
+	}
+
+	return values, true, nil
+}
+
+// loadConfigFromDB lê os valores alterados remotamente, guardados na tabela config
+// Valores inválidos no banco são ignorados, para que o agente continue funcionando com o arquivo ou os padrões
+func loadConfigFromDB() error {
+	stored, err := getConfigValues()
+	if err != nil {
+		return err
+	}
+	revision, err := getConfigRevision()
+	if err != nil {
+		return err
+	}
+
+	values := make(map[string]string)
+	for _, setting := range configSettings {
+		value, ok := stored[setting.key]
+		if !ok || setting.local {
+			continue
+		}
+		if err := validateConfigValue(setting, value); err != nil {
+			fmt.Printf("[config] Ignorando valor do banco: %v\n", err)
+			continue
+		}
+		values[setting.key] = value
+	}
+
+	configMutex.Lock()
+	defer configMutex.Unlock()
+	configLayers[configSourceDB] = values
+	configRevision = revision
+	resolveConfigLocked()
+	return nil
+}
+
+// resolveConfigLocked calcula o valor efetivo de cada configuração pela ordem de precedência
+func resolveConfigLocked() {
+	resolved := make(map[string]ConfigValue)
+	for _, setting := range configSettings {
+		value := ConfigValue{Valor: setting.defaultValue, Origem: configSourceDefault}
+		for _, source := range configSourceOrder {
+			if v, ok := configLayers[source][setting.key]; ok {
+				value = ConfigValue{Valor: v, Origem: source}
+				break
+			}
+		}
+		resolved[setting.key] = value
+	}
+	effectiveConfig = resolved
+}
+
+// configString retorna o valor efetivo de uma configuração
+func configString(key string) string {
+	configMutex.RLock()
+	defer configMutex.RUnlock()
+	return effectiveConfig[key].Valor
+}
+
+// configInt retorna o valor efetivo de uma configuração numérica
+func configInt(key string) int {
+	value, _ := strconv.Atoi(configString(key))
+	return value
+}
+
+// applyRemoteConfig grava no banco, de uma só vez, os valores alterados remotamente, incrementa a revisão
+// da configuração e aplica os valores que mudaram; expectedRevision (opcional) deve ser igual à revisão atual
+// Retorna a nova revisão e as configurações cujo valor efetivo mudou
+func applyRemoteConfig(values map[string]string, expectedRevision *int64) (int64, []string, error) {
+	if len(values) == 0 {
+		return 0, nil, fmt.Errorf("%w: nenhuma configuração informada", errConfigInvalid)
+	}
+	for key, value := range values {
+		setting, ok := findConfigSetting(key)
+		if !ok || setting.local {
+			return 0, nil, fmt.Errorf("%w: %s não pode ser alterada remotamente", errConfigInvalid, key)
+		}
+		if err := validateConfigValue(setting, value); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	configMutex.Lock()
+
+	if expectedRevision != nil && *expectedRevision != configRevision {
+		current := configRevision
+		configMutex.Unlock()
+		return current, nil, fmt.Errorf("%w (esperada %d, atual %d)", errConfigRevision, *expectedRevision, current)
+	}
+	for key := range values {
+		if source := effectiveConfig[key].Origem; source == configSourceFlag || source == configSourceEnv {
+			configMutex.Unlock()
+			return 0, nil, fmt.Errorf("%w (%s definida por %s)", errConfigPinned, key, source)
+		}
+	}
+
+	revision, err := saveRemoteConfig(values)
+	if err != nil {
+		configMutex.Unlock()
+		return 0, nil, err
+	}
+
+	previous := effectiveConfig
+	for key, value := range values {
+		configLayers[configSourceDB][key] = value
+	}
+	configRevision = revision
+	resolveConfigLocked()
+
+	var changed []string
+	for _, setting := range configSettings {
+		if effectiveConfig[setting.key].Valor != previous[setting.key].Valor {
+			changed = append(changed, setting.key)
+		}
+	}
+	configMutex.Unlock()
+
+	applyConfigChanges(changed)
+	return revision, changed, nil
+}
+
+// applyConfigChanges atualiza as variáveis globais das configurações alteradas e sinaliza
+// as goroutines que dependem delas
+func applyConfigChanges(changed []string) {
+	for _, key := range changed {
+		value := configString(key)
+		switch key {
+		case "servidor_atualizacao":
+			updateServerURL = value
+			fmt.Printf("[config] Servidor de atualização alterado para: %s\n", value)
+
+		case "servidor_coleta":
+			// O novo servidor ainda não recebeu nenhum snapshot
+			if err := setLastDeliveredETag(""); err != nil {
+				fmt.Printf("[config] %v\n", err)
+			}
+			ingestServerURL = value
+			select {
+			case ingestServerChanged <- true:
+			default:
+			}
+			if value == "" {
+				fmt.Println("[config] Envio de snapshots desativado")
+			} else {
+				fmt.Printf("[config] Servidor de coleta alterado para: %s\n", value)
+			}
+
+		case "system_info_update_interval":
+			systemInfoUpdateIntervalMinutes = configInt(key)
+			select {
+			case systemInfoIntervalChanged <- true:
+			default:
+			}
+			fmt.Printf("[config] Intervalo de atualização de informações alterado para: %s minutos\n", value)
+
+		case "update_check_interval":
+			updateCheckIntervalMinutes = configInt(key)
+			select {
+			case updateCheckIntervalChanged <- true:
+			default:
+			}
+			fmt.Printf("[config] Intervalo de verificação de atualizações alterado para: %s minutos\n", value)
+		}
+	}
+}
+
+// currentConfigRevision retorna a revisão atual da configuração
+func currentConfigRevision() int64 {
+	configMutex.RLock()
+	defer configMutex.RUnlock()
+	return configRevision
+}
+
+// remoteConfigErrorStatus escolhe o código HTTP para o motivo de rejeição de uma alteração remota
+func remoteConfigErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errConfigInvalid):
+		return http.StatusBadRequest
+	case errors.Is(err, errConfigPinned), errors.Is(err, errConfigRevision):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// agentPath resolve um caminho relativo ao diretório do executável
+// (o agente é iniciado pelo Agendador de Tarefas com o diretório de trabalho em C:\Windows\System32)
+func agentPath(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	exePath, err := os.Executable()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(filepath.Dir(exePath), path)
+}
+
+// agentKeysDir retorna o diretório das chaves
+func agentKeysDir() string {
+	return agentPath(configString("chaves"))
+}
+
+// agentDatabasePath retorna o caminho do banco de dados
+// Com o caminho padrão, um banco criado por versões antigas no diretório de trabalho é movido para junto do executável
+func agentDatabasePath() string {
+	path := agentPath(configString("banco"))
+
+	configMutex.RLock()
+	source := effectiveConfig["banco"].Origem
+	configMutex.RUnlock()
+	if source != configSourceDefault {
+		return path
+	}
+
+	legacyPath, err := filepath.Abs("system_info.db")
+	if err != nil || legacyPath == path {
+		return path
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		return path
+	}
+	if _, err := os.Stat(legacyPath); err != nil {
+		return path
+	}
+
+	if err := os.Rename(legacyPath, path); err != nil {
+		fmt.Printf("[config] Não foi possível mover o banco de %s para %s: %v. Usando o banco antigo.\n", legacyPath, path, err)
+		return legacyPath
+	}
+	fmt.Printf("[config] Banco de dados movido de %s para %s\n", legacyPath, path)
+	return path
+}
+
+// configHandler mostra os valores efetivos da configuração e suas origens (GET /config)
+// ou altera a configuração com um envelope assinado (PATCH /config)
+func configHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPatch {
+		patchConfigHandler(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Método não permitido", http.StatusMethodNotAllowed)
+		return
+	}
+
+	configMutex.RLock()
+	values := make(map[string]ConfigValue, len(effectiveConfig))
+	for key, value := range effectiveConfig {
+		if setting, ok := findConfigSetting(key); ok && setting.secret && value.Valor != "" {
+			value.Valor = configSecretMask
+		}
+		values[key] = value
+	}
+	filePath := configFilePath
+	fileLoaded := configFileLoaded
+	revision := configRevision
+	configMutex.RUnlock()
+
+	precedence := append(append([]string{}, configSourceOrder...), configSourceDefault)
+	writeDataResponse(w, r, map[string]interface{}{
+		"configuracao":       values,
+		"revisao":            revision,
+		"precedencia":        precedence,
+		"arquivo":            filePath,
+		"arquivo_encontrado": fileLoaded,
+	})
+}
+
+// patchConfigHandler aplica as configurações informadas no envelope assinado, todas ou nenhuma
+// Responde 409 se alguma delas foi fixada na inicialização ou se a revisão esperada não confere
+func patchConfigHandler(w http.ResponseWriter, r *http.Request) {
+	payload, ok := readSignedRequest(w, r, http.MethodPatch)
+	if !ok {
+		return
+	}
+
+	// Recusar campos desconhecidos, para que um erro de digitação não seja ignorado silenciosamente
+	var patch ConfigPatch
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&patch); err != nil {
+		http.Error(w, fmt.Sprintf("Erro ao deserializar payload: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	values := make(map[string]string)
+	if patch.ServidorAtualizacao != nil {
+		values["servidor_atualizacao"] = strings.TrimSpace(*patch.ServidorAtualizacao)
+	}
+	if patch.ServidorColeta != nil {
+		values["servidor_coleta"] = strings.TrimSpace(*patch.ServidorColeta)
+	}
+	if patch.SystemInfoUpdateInterval != nil {
+		values["system_info_update_interval"] = strconv.Itoa(*patch.SystemInfoUpdateInterval)
+	}
+	if patch.UpdateCheckInterval != nil {
+		values["update_check_interval"] = strconv.Itoa(*patch.UpdateCheckInterval)
+	}
+	if patch.CanalAtualizacao != nil {
+		values["canal_atualizacao"] = strings.ToLower(strings.TrimSpace(*patch.CanalAtualizacao))
+	}
+	if patch.LimiteDownloadKbps != nil {
+		values["limite_download_kbps"] = strconv.Itoa(*patch.LimiteDownloadKbps)
+	}
+	if patch.P2PAtualizacao != nil {
+		values["p2p_atualizacao"] = strings.ToLower(strings.TrimSpace(*patch.P2PAtualizacao))
+	}
+	if patch.AceitarPreLancamento != nil {
+		values["aceitar_pre_lancamento"] = strings.ToLower(strings.TrimSpace(*patch.AceitarPreLancamento))
+	}
+
+	revision, changed, err := applyRemoteConfig(values, patch.RevisaoEsperada)
+	if err != nil {
+		fmt.Printf("Alteração da configuração recusada: %v\n", err)
+		http.Error(w, err.Error(), remoteConfigErrorStatus(err))
+		return
+	}
+
+	fmt.Printf("Configuração alterada para a revisão %d (%d valores alterados)\n", revision, len(changed))
+	if changed == nil {
+		changed = []string{}
+	}
+	writeDataResponse(w, r, map[string]interface{}{
+		"revisao":   revision,
+		"alteradas": changed,
+	})
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"crypto"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
@@ -18,13 +17,7 @@ import (
 // Função para carregar a chave pública
 func loadPublicKey(path string) (*rsa.PublicKey, error) {
 	// Verificar e remover a chave privada se existir
-	exePath, err := os.Executable()
-	if err != nil {
-		return nil, fmt.Errorf("erro ao obter caminho do executável: %v", err)
-	}
-	
-	exeDir := filepath.Dir(exePath)
-	privateKeyPath := filepath.Join(exeDir, "keys", "private_key.pem")
+	privateKeyPath := filepath.Join(agentKeysDir(), "private_key.pem")
 	if _, err := os.Stat(privateKeyPath); err == nil {
 		// A chave privada existe, vamos removê-la
 		err = os.Remove(privateKeyPath)
@@ -62,29 +55,17 @@ func loadPublicKey(path string) (*rsa.PublicKey, error) {
 	return rsaPub, nil
 }
 
-// Função para criptografar dados com a chave pública
-func encryptWithPublicKey(data []byte) (string, error) {
-	// Obter o diretório do executável
-	exePath, err := os.Executable()
-	if err != nil {
-		return "", fmt.Errorf("erro ao obter caminho do executável: %v", err)
-	}
-	
-	exeDir := filepath.Dir(exePath)
-	// Caminho para a chave pública
-	publicKeyPath := filepath.Join(exeDir, "keys", "public_key.pem")
-	
-	// Verificar se o arquivo existe
-	if _, err := os.Stat(publicKeyPath); os.IsNotExist(err) {
-		return "", fmt.Errorf("arquivo de chave pública não encontrado: %s", publicKeyPath)
-	}
-	
-	// Carregar a chave pública
-	publicKey, err := loadPublicKey(publicKeyPath)
+// loadAgentPublicKey retorna a chave confiável mais recente (usada nos envios ao servidor de coleta)
+func loadAgentPublicKey() (*rsa.PublicKey, error) {
+	key, err := primaryTrustedKey()
 	if err != nil {
-		return "", fmt.Errorf("erro ao carregar chave pública: %v", err)
+		return nil, err
 	}
-	
+	return key.PublicKey, nil
+}
+
+// Função para criptografar dados com a chave pública
+func encryptWithPublicKey(publicKey *rsa.PublicKey, data []byte) (string, error) {
 	// Determinar o tamanho máximo que pode ser criptografado
 	// RSA-2048 pode criptografar no máximo (2048/8) - 42 = 214 bytes por vez com OAEP e SHA-256
 	maxSize := publicKey.Size() - 2*sha256.New().Size() - 2
@@ -127,94 +108,3 @@ func encryptWithPublicKey(data []byte) (string, error) {
 	encoded := base64.StdEncoding.EncodeToString(encryptedChunks)
 	return encoded, nil
 }
-
-// Função para descriptografar dados com a chave pública
-func decryptWithPublicKey(encryptedData string) (string, error) {
-	// Decodificar o base64
-	data, err := base64.StdEncoding.DecodeString(encryptedData)
-	if err != nil {
-		return "", fmt.Errorf("erro ao decodificar base64: %v", err)
-	}
-	
-	// Obter o diretório do executável
-	exePath, err := os.Executable()
-	if err != nil {
-		return "", fmt.Errorf("erro ao obter caminho do executável: %v", err)
-	}
-	
-	exeDir := filepath.Dir(exePath)
-	// Caminho para a chave pública
-	publicKeyPath := filepath.Join(exeDir, "keys", "public_key.pem")
-	
-	// Verificar se o arquivo existe
-	if _, err := os.Stat(publicKeyPath); os.IsNotExist(err) {
-		return "", fmt.Errorf("arquivo de chave pública não encontrado: %s", publicKeyPath)
-	}
-	
-	// Carregar a chave pública
-	publicKey, err := loadPublicKey(publicKeyPath)
-	if err != nil {
-		return "", fmt.Errorf("erro ao carregar chave pública: %v", err)
-	}
-	
-	// Processar os chunks
-	var decryptedData []byte
-	i := 0
-	
-	for i < len(data) {
-		// Ler o tamanho do chunk
-		if i+4 >= len(data) {
-			return "", fmt.Errorf("formato inválido: dados truncados")
-		}
-		
-		chunkLen := binary.BigEndian.Uint32(data[i : i+4])
-		i += 4
-		
-		// Verificar o separador
-		if i >= len(data) || data[i] != ':' {
-			return "", fmt.Errorf("formato inválido: separador não encontrado")
-		}
-		i++
-		
-		// Ler o chunk criptografado
-		if i+int(chunkLen) > len(data) {
-			return "", fmt.Errorf("formato inválido: chunk truncado")
-		}
-		
-		encryptedChunk := data[i : i+int(chunkLen)]
-		i += int(chunkLen)
-		
-		// Verificar o separador
-		if i >= len(data) || data[i] != ':' {
-			return "", fmt.Errorf("formato inválido: separador final não encontrado")
-		}
-		i++
-		
-		// Assumimos que os dados foram assinados com a chave privada do servidor
-		// Vamos verificar se o chunk contém dados originais + assinatura
-		// O formato esperado é: [dados originais][assinatura de 256 bytes]
-		
-		// Verificar se o chunk é grande o suficiente para conter uma assinatura
-		if len(encryptedChunk) <= 256 {
-			return "", fmt.Errorf("chunk muito pequeno para conter assinatura")
-		}
-		
-		// Separar os dados originais e a assinatura
-		originalData := encryptedChunk[:len(encryptedChunk)-256]
-		signature := encryptedChunk[len(encryptedChunk)-256:]
-		
-		// Calcular o hash dos dados originais
-		hashed := sha256.Sum256(originalData)
-		
-		// Verificar a assinatura
-		err = rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, hashed[:], signature)
-		if err != nil {
-			return "", fmt.Errorf("erro ao verificar assinatura: %v", err)
-		}
-		
-		// Se a assinatura for válida, adicionar os dados originais ao resultado
-		decryptedData = append(decryptedData, originalData...)
-	}
-	
-	return string(decryptedData), nil
-}
\ No newline at end of file
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Cabeçalho usado para negociar o formato de criptografia das respostas
+// Na requisição, o cliente lista os formatos aceitos (separados por vírgula, em ordem de preferência);
+// na resposta, o agente informa o formato usado
+const encryptionHeader = "X-Encryption"
+
+// Formatos de criptografia das respostas
+const (
+	encryptionFormatLegacy = "rsa-oaep-chunks" // Blocos RSA-OAEP de até 190 bytes (clientes que não enviam o cabeçalho)
+	encryptionFormatHybrid = "aes-gcm-v1"      // Chave AES-256-GCM aleatória protegida uma única vez com RSA-OAEP
+)
+
+// Identificação do formato híbrido no início dos dados: "AGH" seguido da versão
+// (o formato legado começa com o tamanho do bloco, 0x00000100 para RSA-2048, então não há ambiguidade)
+var hybridMagic = []byte{'A', 'G', 'H', 1}
+
+// encryptHybrid criptografa os dados com uma chave AES-256-GCM aleatória protegida com RSA-OAEP
+// Formato (em base64): "AGH" | versão | tamanho da chave protegida (2 bytes) | chave protegida | nonce (12 bytes) | dados + tag
+// O cabeçalho até a chave protegida é autenticado como dado adicional do GCM
+func encryptHybrid(publicKey *rsa.PublicKey, data []byte) (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", fmt.Errorf("erro ao gerar chave AES: %v", err)
+	}
+
+	wrappedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, publicKey, key, nil)
+	if err != nil {
+		return "", fmt.Errorf("erro ao proteger chave AES: %v", err)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", fmt.Errorf("erro ao criar cifra AES: %v", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", fmt.Errorf("erro ao criar AES-GCM: %v", err)
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("erro ao gerar nonce: %v", err)
+	}
+
+	header := make([]byte, 0, len(hybridMagic)+2+len(wrappedKey))
+	header = append(header, hybridMagic...)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(wrappedKey)))
+	header = append(header, wrappedKey...)
+
+	output := make([]byte, 0, len(header)+len(nonce)+len(data)+gcm.Overhead())
+	output = append(output, header...)
+	output = append(output, nonce...)
+	output = gcm.Seal(output, nonce, data, header)
+
+	return base64.StdEncoding.EncodeToString(output), nil
+}
+
+// negotiateEncryption escolhe o formato de criptografia a partir do cabeçalho da requisição
+// Clientes antigos não enviam o cabeçalho e continuam recebendo o formato legado
+func negotiateEncryption(r *http.Request) string {
+	for _, format := range strings.Split(r.Header.Get(encryptionHeader), ",") {
+		if strings.EqualFold(strings.TrimSpace(format), encryptionFormatHybrid) {
+			return encryptionFormatHybrid
+		}
+	}
+	return encryptionFormatLegacy
+}
+
+// encryptResponse comprime (se negociado) e criptografa os dados no formato negociado com o cliente,
+// com a chave confiável indicada pelo cliente, informando nos cabeçalhos da resposta o formato, a chave usada
+// e a assinatura do agente sobre os dados criptografados
+func encryptResponse(w http.ResponseWriter, r *http.Request, data []byte) (string, error) {
+	format := negotiateEncryption(r)
+
+	data, err := compressPayload(w, r, data)
+	if err != nil {
+		return "", err
+	}
+
+	key, err := responseEncryptionKey(r)
+	if err != nil {
+		return "", fmt.Errorf("erro ao carregar chave pública: %v", err)
+	}
+
+	var encryptedData string
+	if format == encryptionFormatHybrid {
+		encryptedData, err = encryptHybrid(key.PublicKey, data)
+	} else {
+		encryptedData, err = encryptWithPublicKey(key.PublicKey, data)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	w.Header().Set(encryptionHeader, format)
+	w.Header().Set(keyIDHeader, key.ID)
+	setAgentResponseSignature(w, r, []byte(encryptedData))
+	return encryptedData, nil
+}
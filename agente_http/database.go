@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
 	// Replace go-sqlite3 with a pure Go implementation
@@ -13,9 +14,9 @@ import (
 
 var db *sql.DB
 
-func initDatabase() error {
+func initDatabase(path string) error {
 	var err error
-	db, err = sql.Open("sqlite", "./system_info.db")
+	db, err = sql.Open("sqlite", path)
 	if err != nil {
 		return fmt.Errorf("erro ao abrir banco de dados: %v", err)
 	}
@@ -32,6 +33,40 @@ func initDatabase() error {
 		return fmt.Errorf("erro ao criar tabela system_info: %v", err)
 	}
 
+	// Criar tabela de histórico de snapshots (timestamp em segundos Unix)
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS system_info_history (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			info TEXT NOT NULL,
+			etag TEXT NOT NULL,
+			timestamp INTEGER NOT NULL
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("erro ao criar tabela system_info_history: %v", err)
+	}
+
+	_, err = db.Exec("CREATE INDEX IF NOT EXISTS idx_system_info_history_timestamp ON system_info_history (timestamp)")
+	if err != nil {
+		return fmt.Errorf("erro ao criar índice do histórico: %v", err)
+	}
+
+	// Criar fila de envio ao servidor de coleta (payload em JSON comprimido com gzip, criado_em em segundos Unix)
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS outbound_queue (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			tipo TEXT NOT NULL,
+			payload BLOB NOT NULL,
+			etag TEXT NOT NULL DEFAULT '',
+			tamanho INTEGER NOT NULL,
+			criado_em INTEGER NOT NULL,
+			tentativas INTEGER NOT NULL DEFAULT 0
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("erro ao criar tabela outbound_queue: %v", err)
+	}
+
 	// Criar tabela config se não existir
 	_, err = db.Exec(`
 		CREATE TABLE IF NOT EXISTS config (
@@ -43,6 +78,94 @@ func initDatabase() error {
 		return fmt.Errorf("erro ao criar tabela config: %v", err)
 	}
 
+	// Gerar o identificador persistente do agente no primeiro início (mantido mesmo que o MAC mude)
+	agentUUID, err := newUUID()
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("INSERT OR IGNORE INTO config (key, value) VALUES ('agente_uuid', ?)", agentUUID)
+	if err != nil {
+		return fmt.Errorf("erro ao gerar identificador do agente: %v", err)
+	}
+
+	// Criar tabela de nonces já utilizados pelos envelopes assinados (proteção contra repetição)
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS used_nonces (
+			nonce TEXT PRIMARY KEY,
+			expires_at INTEGER NOT NULL
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("erro ao criar tabela used_nonces: %v", err)
+	}
+
+	// Criar tabela das chaves públicas confiáveis (verificação dos envelopes e criptografia das respostas)
+	// aposentar_em é o horário Unix a partir do qual a chave deixa de ser aceita (0: sem aposentadoria prevista)
+	// finalidade separa as chaves de comandos das chaves de release, aceitas apenas nos manifestos de atualização
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS trusted_keys (
+			key_id TEXT PRIMARY KEY,
+			public_key TEXT NOT NULL,
+			origem TEXT NOT NULL,
+			adicionada_em INTEGER NOT NULL,
+			aposentar_em INTEGER NOT NULL DEFAULT 0,
+			finalidade TEXT NOT NULL DEFAULT 'comandos'
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("erro ao criar tabela trusted_keys: %v", err)
+	}
+
+	// Bancos criados antes da separação das chaves de release: as chaves existentes são de comandos
+	var hasKeyPurpose bool
+	err = db.QueryRow("SELECT EXISTS(SELECT 1 FROM pragma_table_info('trusted_keys') WHERE name = 'finalidade')").Scan(&hasKeyPurpose)
+	if err != nil {
+		return fmt.Errorf("erro ao verificar tabela trusted_keys: %v", err)
+	}
+	if !hasKeyPurpose {
+		if _, err = db.Exec("ALTER TABLE trusted_keys ADD COLUMN finalidade TEXT NOT NULL DEFAULT 'comandos'"); err != nil {
+			return fmt.Errorf("erro ao adicionar finalidade às chaves confiáveis: %v", err)
+		}
+	}
+
+	// Criar tabela das versões bloqueadas (atualizações desfeitas por falha na inicialização)
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS blocked_versions (
+			versao TEXT PRIMARY KEY,
+			motivo TEXT NOT NULL,
+			bloqueada_em INTEGER NOT NULL
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("erro ao criar tabela blocked_versions: %v", err)
+	}
+
+	// Criar tabela de jobs de comando
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS command_jobs (
+			id TEXT PRIMARY KEY,
+			comando TEXT NOT NULL,
+			tipo TEXT NOT NULL,
+			status TEXT NOT NULL,
+			codigo_saida INTEGER NOT NULL DEFAULT 0,
+			saida TEXT NOT NULL DEFAULT '',
+			erro TEXT NOT NULL DEFAULT '',
+			timeout_segundos INTEGER NOT NULL,
+			criado_em TEXT NOT NULL,
+			finalizado_em TEXT NOT NULL DEFAULT ''
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("erro ao criar tabela command_jobs: %v", err)
+	}
+
+	// Jobs que estavam em execução quando o agente foi encerrado não têm mais processo associado
+	_, err = db.Exec("UPDATE command_jobs SET status = ?, codigo_saida = -1, finalizado_em = ? WHERE status = ?",
+		jobStatusInterrompido, time.Now().Format(time.RFC3339), jobStatusExecutando)
+	if err != nil {
+		return fmt.Errorf("erro ao marcar jobs interrompidos: %v", err)
+	}
+
 	// Inserir versão inicial se não existir
 	_, err = db.Exec(`
 		INSERT OR IGNORE INTO config (key, value) VALUES ('version', '0.0.1')
@@ -51,28 +174,59 @@ func initDatabase() error {
 		return fmt.Errorf("erro ao inserir versão inicial: %v", err)
 	}
 
-	// Inserir IP de atualização padrão se não existir
+	// Versões antigas gravavam os valores padrão da configuração no banco, o que impediria o arquivo de configuração
+	// de ter efeito: remover uma única vez os valores que ainda são iguais aos padrões antigos
+	// (os valores alterados remotamente continuam no banco)
+	var migrated int
+	err = db.QueryRow("SELECT COUNT(*) FROM config WHERE key = 'config_migrada'").Scan(&migrated)
+	if err != nil {
+		return fmt.Errorf("erro ao verificar migração da configuração: %v", err)
+	}
+	if migrated == 0 {
+		_, err = db.Exec(`
+			DELETE FROM config WHERE
+				(key = 'servidor_atualizacao' AND value = 'http://10.46.102.245:9991') OR
+				(key = 'servidor_coleta' AND value = '') OR
+				(key = 'system_info_update_interval' AND value = '30') OR
+				(key = 'update_check_interval' AND value = '30')
+		`)
+		if err != nil {
+			return fmt.Errorf("erro ao migrar configuração: %v", err)
+		}
+		_, err = db.Exec("INSERT INTO config (key, value) VALUES ('config_migrada', '1')")
+		if err != nil {
+			return fmt.Errorf("erro ao migrar configuração: %v", err)
+		}
+	}
+
+	// Inserir a revisão inicial da configuração se não existir
 	_, err = db.Exec(`
-		INSERT OR IGNORE INTO config (key, value) VALUES ('servidor_atualizacao', 'http://10.46.102.245:9991')
+		INSERT OR IGNORE INTO config (key, value) VALUES ('config_revisao', '0')
 	`)
 	if err != nil {
-		return fmt.Errorf("erro ao inserir IP de atualização padrão: %v", err)
+		return fmt.Errorf("erro ao inserir revisão da configuração: %v", err)
 	}
 
-	// Inserir intervalo de atualização de informações do sistema padrão se não existir
+	// Inserir limites padrão da fila de envio, o ETag do último snapshot entregue e a situação da inscrição se não existirem
 	_, err = db.Exec(`
-		INSERT OR IGNORE INTO config (key, value) VALUES ('system_info_update_interval', '30')
-	`)
+		INSERT OR IGNORE INTO config (key, value) VALUES
+			('queue_max_bytes', ?),
+			('queue_max_age_days', ?),
+			('ultimo_snapshot_enviado', ''),
+			('inscricao_status', '')
+	`, strconv.Itoa(defaultQueueMaxBytes), strconv.Itoa(defaultQueueMaxAgeDays))
 	if err != nil {
-		return fmt.Errorf("erro ao inserir intervalo de atualização padrão: %v", err)
+		return fmt.Errorf("erro ao inserir limites padrão da fila de envio: %v", err)
 	}
 
-	// Inserir intervalo de verificação de atualizações padrão se não existir
+	// Inserir retenção padrão do histórico de snapshots se não existir
 	_, err = db.Exec(`
-		INSERT OR IGNORE INTO config (key, value) VALUES ('update_check_interval', '30')
-	`)
+		INSERT OR IGNORE INTO config (key, value) VALUES
+			('history_max_snapshots', ?),
+			('history_max_age_days', ?)
+	`, strconv.Itoa(defaultHistoryMaxSnapshots), strconv.Itoa(defaultHistoryMaxAgeDays))
 	if err != nil {
-		return fmt.Errorf("erro ao inserir intervalo de verificação de atualizações padrão: %v", err)
+		return fmt.Errorf("erro ao inserir retenção padrão do histórico: %v", err)
 	}
 
 	return nil
@@ -85,7 +239,8 @@ func getCurrentVersion() (string, error) {
 	if err != nil {
 		return "", fmt.Errorf("erro ao obter versão atual: %v", err)
 	}
-	return version, nil
+	// Versões antigas gravavam o conteúdo de version.txt sem remover a quebra de linha
+	return strings.TrimSpace(version), nil
 }
 
 // Função para atualizar a versão do aplicativo
@@ -105,22 +260,29 @@ func closeDatabase() {
 
 // getSystemInfoFromDB obtém as informações do sistema do banco de dados
 func getSystemInfoFromDB() (SystemInfo, error) {
+	info, _, err := getSystemInfoWithETagFromDB()
+	return info, err
+}
+
+// getSystemInfoWithETagFromDB obtém as informações do sistema e o ETag calculado sobre o JSON armazenado
+// Os dois vêm da mesma leitura, para que o ETag corresponda exatamente ao conteúdo retornado
+func getSystemInfoWithETagFromDB() (SystemInfo, string, error) {
 	var info SystemInfo
 	var infoJSON string
 
 	// Obter a linha com ID 1
 	err := db.QueryRow("SELECT info FROM system_info WHERE id = 1").Scan(&infoJSON)
 	if err != nil {
-		return info, err
+		return info, "", err
 	}
 
 	// Deserializar JSON para struct
 	err = json.Unmarshal([]byte(infoJSON), &info)
 	if err != nil {
-		return info, fmt.Errorf("erro ao deserializar JSON: %v", err)
+		return info, "", fmt.Errorf("erro ao deserializar JSON: %v", err)
 	}
 
-	return info, nil
+	return info, snapshotETag([]byte(infoJSON)), nil
 }
 
 // saveSystemInfoToDB salva as informações do sistema no banco de dados
@@ -152,6 +314,16 @@ func saveSystemInfoToDB(info SystemInfo) error {
 		}
 	}
 
+	// Guardar no histórico
+	if err := addSnapshotToHistory(infoJSON, time.Now()); err != nil {
+		return err
+	}
+
+	// Enfileirar para envio ao servidor de coleta
+	if err := enqueueSnapshot(infoJSON, snapshotETag(infoJSON), time.Now()); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -181,93 +353,589 @@ func clearDatabase() error {
 	return nil
 }
 
-// Função para obter o IP do servidor de atualização
-func getUpdateServerIP() (string, error) {
-	var serverIP string
-	err := db.QueryRow("SELECT value FROM config WHERE key = 'servidor_atualizacao'").Scan(&serverIP)
+// getConfigValues obtém todos os valores guardados na tabela config
+func getConfigValues() (map[string]string, error) {
+	rows, err := db.Query("SELECT key, value FROM config")
+	if err != nil {
+		return nil, fmt.Errorf("erro ao obter configuração: %v", err)
+	}
+	defer rows.Close()
+
+	values := make(map[string]string)
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, fmt.Errorf("erro ao ler configuração: %v", err)
+		}
+		values[key] = value
+	}
+	return values, rows.Err()
+}
+
+// saveRemoteConfig grava os valores alterados remotamente e incrementa a revisão da configuração
+// na mesma transação, retornando a nova revisão
+func saveRemoteConfig(values map[string]string) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("erro ao iniciar transação: %v", err)
+	}
+	defer tx.Rollback()
+
+	for key, value := range values {
+		_, err = tx.Exec(`
+			INSERT INTO config (key, value) VALUES (?, ?)
+			ON CONFLICT(key) DO UPDATE SET value = excluded.value
+		`, key, value)
+		if err != nil {
+			return 0, fmt.Errorf("erro ao atualizar configuração %s: %v", key, err)
+		}
+	}
+
+	var revision int64
+	err = tx.QueryRow("SELECT CAST(value AS INTEGER) + 1 FROM config WHERE key = 'config_revisao'").Scan(&revision)
+	if err != nil {
+		return 0, fmt.Errorf("erro ao obter revisão da configuração: %v", err)
+	}
+	_, err = tx.Exec("UPDATE config SET value = ? WHERE key = 'config_revisao'", strconv.FormatInt(revision, 10))
+	if err != nil {
+		return 0, fmt.Errorf("erro ao atualizar revisão da configuração: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("erro ao gravar configuração: %v", err)
+	}
+	return revision, nil
+}
+
+// getConfigRevision obtém a revisão da configuração (incrementada a cada alteração remota)
+func getConfigRevision() (int64, error) {
+	var revision int64
+	err := db.QueryRow("SELECT CAST(value AS INTEGER) FROM config WHERE key = 'config_revisao'").Scan(&revision)
+	if err != nil {
+		return 0, fmt.Errorf("erro ao obter revisão da configuração: %v", err)
+	}
+	return revision, nil
+}
+
+// getAgentUUID obtém o identificador persistente do agente
+func getAgentUUID() (string, error) {
+	var agentUUID string
+	err := db.QueryRow("SELECT value FROM config WHERE key = 'agente_uuid'").Scan(&agentUUID)
+	if err != nil {
+		return "", fmt.Errorf("erro ao obter identificador do agente: %v", err)
+	}
+	return agentUUID, nil
+}
+
+// getLastDeliveredETag obtém o ETag do último snapshot entregue ao servidor de coleta
+func getLastDeliveredETag() (string, error) {
+	var etag string
+	err := db.QueryRow("SELECT value FROM config WHERE key = 'ultimo_snapshot_enviado'").Scan(&etag)
 	if err != nil {
-		return "", fmt.Errorf("erro ao obter IP do servidor de atualização: %v", err)
+		return "", fmt.Errorf("erro ao obter último snapshot enviado: %v", err)
 	}
-	return serverIP, nil
+	return etag, nil
 }
 
-// Função para atualizar o IP do servidor de atualização
-func updateServerIP(newIP string) error {
-	_, err := db.Exec("UPDATE config SET value = ? WHERE key = 'servidor_atualizacao'", newIP)
+// setLastDeliveredETag registra o ETag do último snapshot entregue ao servidor de coleta
+func setLastDeliveredETag(etag string) error {
+	_, err := db.Exec("UPDATE config SET value = ? WHERE key = 'ultimo_snapshot_enviado'", etag)
 	if err != nil {
-		return fmt.Errorf("erro ao atualizar IP do servidor: %v", err)
+		return fmt.Errorf("erro ao registrar último snapshot enviado: %v", err)
 	}
 	return nil
 }
 
-// getSystemInfoUpdateInterval obtém o intervalo de atualização das informações do sistema em minutos
-func getSystemInfoUpdateInterval() (int, error) {
-	var intervalStr string
-	err := db.QueryRow("SELECT value FROM config WHERE key = 'system_info_update_interval'").Scan(&intervalStr)
+// getEnrollmentStatus obtém a situação da inscrição do agente informada pelo servidor de coleta
+func getEnrollmentStatus() (string, error) {
+	var status string
+	err := db.QueryRow("SELECT value FROM config WHERE key = 'inscricao_status'").Scan(&status)
 	if err != nil {
-		return 10, fmt.Errorf("erro ao obter intervalo de atualização: %v", err)
+		return "", fmt.Errorf("erro ao obter situação da inscrição: %v", err)
 	}
+	return status, nil
+}
+
+// setEnrollmentStatus registra a situação da inscrição do agente informada pelo servidor de coleta
+func setEnrollmentStatus(status string) error {
+	_, err := db.Exec("UPDATE config SET value = ? WHERE key = 'inscricao_status'", status)
+	if err != nil {
+		return fmt.Errorf("erro ao registrar situação da inscrição: %v", err)
+	}
+	return nil
+}
+
+// getTrustedKeys obtém as chaves confiáveis ainda não aposentadas, da mais recente à mais antiga
+// As chaves cuja aposentadoria já passou são removidas
+func getTrustedKeys() ([]TrustedKey, error) {
+	now := time.Now().Unix()
+	_, err := db.Exec("DELETE FROM trusted_keys WHERE aposentar_em > 0 AND aposentar_em <= ?", now)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao remover chaves aposentadas: %v", err)
+	}
+
+	rows, err := db.Query(`
+		SELECT key_id, public_key, origem, adicionada_em, aposentar_em, finalidade
+		FROM trusted_keys
+		ORDER BY adicionada_em DESC, key_id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao consultar chaves confiáveis: %v", err)
+	}
+	defer rows.Close()
+
+	var keys []TrustedKey
+	for rows.Next() {
+		var key TrustedKey
+		if err := rows.Scan(&key.ID, &key.PEM, &key.Origem, &key.AdicionadaEm, &key.AposentarEm, &key.Finalidade); err != nil {
+			return nil, fmt.Errorf("erro ao ler chave confiável: %v", err)
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("erro ao iterar chaves confiáveis: %v", err)
+	}
+	return keys, nil
+}
+
+// saveKeyRotation adiciona a nova chave confiável e agenda a aposentadoria das chaves informadas, de uma só vez
+// As chaves aposentadas precisam ter a mesma finalidade da nova chave
+func saveKeyRotation(newKey TrustedKey, retire []string, retireAt int64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("erro ao iniciar transação: %v", err)
+	}
+	defer tx.Rollback()
 
-	// Converter string para inteiro
-	interval, err := strconv.Atoi(intervalStr)
+	_, err = tx.Exec(`
+		INSERT OR IGNORE INTO trusted_keys (key_id, public_key, origem, adicionada_em, aposentar_em, finalidade)
+		VALUES (?, ?, ?, ?, 0, ?)
+	`, newKey.ID, newKey.PEM, newKey.Origem, newKey.AdicionadaEm, newKey.Finalidade)
 	if err != nil {
-		return 10, fmt.Errorf("valor inválido para intervalo de atualização: %v", err)
+		return fmt.Errorf("erro ao adicionar chave confiável: %v", err)
 	}
 
-	// Garantir que o intervalo seja pelo menos 1 minuto
-	if interval < 1 {
-		interval = 1
+	for _, keyID := range retire {
+		// Uma aposentadoria já agendada para antes não é adiada
+		_, err = tx.Exec(`
+			UPDATE trusted_keys SET aposentar_em = ?
+			WHERE key_id = ? AND finalidade = ? AND (aposentar_em = 0 OR aposentar_em > ?)
+		`, retireAt, keyID, newKey.Finalidade, retireAt)
+		if err != nil {
+			return fmt.Errorf("erro ao agendar aposentadoria da chave %s: %v", keyID, err)
+		}
 	}
 
-	return interval, nil
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("erro ao finalizar transação: %v", err)
+	}
+	return nil
 }
 
-// getUpdateCheckInterval obtém o intervalo de verificação de atualizações em minutos
-func getUpdateCheckInterval() (int, error) {
-	var intervalStr string
-	err := db.QueryRow("SELECT value FROM config WHERE key = 'update_check_interval'").Scan(&intervalStr)
+// Retorna false se o nonce já foi utilizado (requisição repetida)
+func consumeNonce(nonce string, expiresAt time.Time) (bool, error) {
+	// Remover nonces de envelopes já expirados, que seriam rejeitados de qualquer forma
+	_, err := db.Exec("DELETE FROM used_nonces WHERE expires_at < ?", time.Now().Unix())
 	if err != nil {
-		return 10, fmt.Errorf("erro ao obter intervalo de verificação de atualizações: %v", err)
+		return false, fmt.Errorf("erro ao remover nonces expirados: %v", err)
 	}
 
-	// Converter string para inteiro
-	interval, err := strconv.Atoi(intervalStr)
+	result, err := db.Exec("INSERT OR IGNORE INTO used_nonces (nonce, expires_at) VALUES (?, ?)", nonce, expiresAt.Unix())
 	if err != nil {
-		return 10, fmt.Errorf("valor inválido para intervalo de verificação de atualizações: %v", err)
+		return false, fmt.Errorf("erro ao registrar nonce: %v", err)
 	}
 
-	// Garantir que o intervalo seja pelo menos 1 minuto
-	if interval < 1 {
-		interval = 1
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("erro ao registrar nonce: %v", err)
 	}
 
-	return interval, nil
+	return rows == 1, nil
 }
 
-// updateSystemInfoInterval atualiza o intervalo de atualização das informações do sistema
-func updateSystemInfoInterval(minutes int) error {
-	if minutes < 1 {
-		minutes = 1 // Garantir que o intervalo seja pelo menos 1 minuto
+// saveCommandJob grava o estado de um job de comando, mantendo apenas os jobs mais recentes
+func saveCommandJob(job *CommandJob) error {
+	_, err := db.Exec(`
+		INSERT OR REPLACE INTO command_jobs
+			(id, comando, tipo, status, codigo_saida, saida, erro, timeout_segundos, criado_em, finalizado_em)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, job.ID, job.Comando, job.Tipo, job.Status, job.CodigoSaida, job.Saida, job.Erro,
+		job.TimeoutSegundos, job.CriadoEm, job.FinalizadoEm)
+	if err != nil {
+		return fmt.Errorf("erro ao salvar job: %v", err)
 	}
 
-	_, err := db.Exec("UPDATE config SET value = ? WHERE key = 'system_info_update_interval'", strconv.Itoa(minutes))
+	// Remover os jobs finalizados mais antigos além do limite
+	_, err = db.Exec(`
+		DELETE FROM command_jobs WHERE status != ? AND id NOT IN (
+			SELECT id FROM command_jobs ORDER BY criado_em DESC LIMIT ?
+		)
+	`, jobStatusExecutando, maxStoredJobs)
 	if err != nil {
-		return fmt.Errorf("erro ao atualizar intervalo de atualização: %v", err)
+		return fmt.Errorf("erro ao remover jobs antigos: %v", err)
 	}
 
 	return nil
 }
 
-// updateCheckInterval atualiza o intervalo de verificação de atualizações
-func updateCheckInterval(minutes int) error {
-	if minutes < 1 {
-		minutes = 1 // Garantir que o intervalo seja pelo menos 1 minuto
+// getCommandJob obtém um job de comando pelo ID (nil se não existir)
+func getCommandJob(id string) (*CommandJob, error) {
+	var job CommandJob
+	err := db.QueryRow(`
+		SELECT id, comando, tipo, status, codigo_saida, saida, erro, timeout_segundos, criado_em, finalizado_em
+		FROM command_jobs WHERE id = ?
+	`, id).Scan(&job.ID, &job.Comando, &job.Tipo, &job.Status, &job.CodigoSaida, &job.Saida, &job.Erro,
+		&job.TimeoutSegundos, &job.CriadoEm, &job.FinalizadoEm)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("erro ao obter job: %v", err)
 	}
 
-	_, err := db.Exec("UPDATE config SET value = ? WHERE key = 'update_check_interval'", strconv.Itoa(minutes))
+	return &job, nil
+}
+
+// listCommandJobs lista os jobs mais recentes, sem a saída dos comandos
+func listCommandJobs(limit int) ([]CommandJob, error) {
+	rows, err := db.Query(`
+		SELECT id, comando, tipo, status, codigo_saida, timeout_segundos, criado_em, finalizado_em
+		FROM command_jobs ORDER BY criado_em DESC LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao listar jobs: %v", err)
+	}
+	defer rows.Close()
+
+	jobs := make([]CommandJob, 0)
+	for rows.Next() {
+		var job CommandJob
+		err := rows.Scan(&job.ID, &job.Comando, &job.Tipo, &job.Status, &job.CodigoSaida,
+			&job.TimeoutSegundos, &job.CriadoEm, &job.FinalizadoEm)
+		if err != nil {
+			return nil, fmt.Errorf("erro ao ler job: %v", err)
+		}
+		jobs = append(jobs, job)
+	}
+
+	return jobs, rows.Err()
+}
+
+// addSnapshotToHistory registra um snapshot no histórico e aplica a retenção configurada
+// Snapshots idênticos ao último registrado não são duplicados
+func addSnapshotToHistory(infoJSON []byte, collectedAt time.Time) error {
+	etag := snapshotETag(infoJSON)
+
+	var lastETag string
+	err := db.QueryRow("SELECT etag FROM system_info_history ORDER BY id DESC LIMIT 1").Scan(&lastETag)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("erro ao consultar último snapshot do histórico: %v", err)
+	}
+	if lastETag == etag {
+		return nil
+	}
+
+	_, err = db.Exec("INSERT INTO system_info_history (info, etag, timestamp) VALUES (?, ?, ?)",
+		string(infoJSON), etag, collectedAt.Unix())
+	if err != nil {
+		return fmt.Errorf("erro ao salvar snapshot no histórico: %v", err)
+	}
+
+	return pruneSnapshotHistory()
+}
+
+// pruneSnapshotHistory remove os snapshots mais antigos que a idade máxima e os que excedem a quantidade máxima
+func pruneSnapshotHistory() error {
+	maxSnapshots, maxAgeDays, err := getHistoryRetention()
+	if err != nil {
+		return err
+	}
+
+	cutoff := time.Now().AddDate(0, 0, -maxAgeDays).Unix()
+	if _, err := db.Exec("DELETE FROM system_info_history WHERE timestamp < ?", cutoff); err != nil {
+		return fmt.Errorf("erro ao remover snapshots antigos: %v", err)
+	}
+
+	_, err = db.Exec(`
+		DELETE FROM system_info_history
+		WHERE id NOT IN (SELECT id FROM system_info_history ORDER BY id DESC LIMIT ?)
+	`, maxSnapshots)
+	if err != nil {
+		return fmt.Errorf("erro ao remover snapshots excedentes: %v", err)
+	}
+
+	return nil
+}
+
+// getHistoryRetention obtém a quantidade máxima de snapshots e a idade máxima em dias do histórico
+func getHistoryRetention() (int, int, error) {
+	var maxSnapshotsStr, maxAgeDaysStr string
+	err := db.QueryRow("SELECT value FROM config WHERE key = 'history_max_snapshots'").Scan(&maxSnapshotsStr)
+	if err != nil {
+		return defaultHistoryMaxSnapshots, defaultHistoryMaxAgeDays, fmt.Errorf("erro ao obter retenção do histórico: %v", err)
+	}
+	err = db.QueryRow("SELECT value FROM config WHERE key = 'history_max_age_days'").Scan(&maxAgeDaysStr)
+	if err != nil {
+		return defaultHistoryMaxSnapshots, defaultHistoryMaxAgeDays, fmt.Errorf("erro ao obter retenção do histórico: %v", err)
+	}
+
+	maxSnapshots, err := strconv.Atoi(maxSnapshotsStr)
+	if err != nil || maxSnapshots < 1 {
+		maxSnapshots = defaultHistoryMaxSnapshots
+	}
+	maxAgeDays, err := strconv.Atoi(maxAgeDaysStr)
+	if err != nil || maxAgeDays < 1 {
+		maxAgeDays = defaultHistoryMaxAgeDays
+	}
+
+	return maxSnapshots, maxAgeDays, nil
+}
+
+// updateHistoryRetention altera a retenção do histórico e remove imediatamente o que ficou fora dela
+func updateHistoryRetention(maxSnapshots, maxAgeDays int) error {
+	_, err := db.Exec("UPDATE config SET value = ? WHERE key = 'history_max_snapshots'", strconv.Itoa(maxSnapshots))
+	if err != nil {
+		return fmt.Errorf("erro ao atualizar quantidade máxima do histórico: %v", err)
+	}
+	_, err = db.Exec("UPDATE config SET value = ? WHERE key = 'history_max_age_days'", strconv.Itoa(maxAgeDays))
+	if err != nil {
+		return fmt.Errorf("erro ao atualizar idade máxima do histórico: %v", err)
+	}
+
+	return pruneSnapshotHistory()
+}
+
+// listSnapshotHistory lista os snapshots mais recentes do histórico, sem o conteúdo
+func listSnapshotHistory(limit int) ([]HistorySnapshot, error) {
+	rows, err := db.Query(`
+		SELECT id, etag, timestamp, length(info) FROM system_info_history
+		ORDER BY id DESC
+		LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao listar histórico: %v", err)
+	}
+	defer rows.Close()
+
+	snapshots := []HistorySnapshot{}
+	for rows.Next() {
+		var snapshot HistorySnapshot
+		var timestamp int64
+		if err := rows.Scan(&snapshot.ID, &snapshot.ETag, &timestamp, &snapshot.TamanhoBytes); err != nil {
+			return nil, fmt.Errorf("erro ao ler histórico: %v", err)
+		}
+		snapshot.ColetadoEm = time.Unix(timestamp, 0).Format(time.RFC3339)
+		snapshots = append(snapshots, snapshot)
+	}
+
+	return snapshots, rows.Err()
+}
+
+// getSnapshotFromHistory obtém um snapshot do histórico pelo ID
+// Retorna nil se o snapshot não existe
+func getSnapshotFromHistory(id int64) (*HistorySnapshot, error) {
+	return querySnapshot("SELECT id, etag, timestamp, info FROM system_info_history WHERE id = ?", id)
+}
+
+// getLatestSnapshot obtém o snapshot mais recente do histórico
+// Retorna nil se o histórico está vazio
+func getLatestSnapshot() (*HistorySnapshot, error) {
+	return querySnapshot("SELECT id, etag, timestamp, info FROM system_info_history ORDER BY id DESC LIMIT 1")
+}
+
+// getSnapshotAt obtém o snapshot vigente no instante informado (o último coletado até ele)
+// Retorna nil se não há snapshot anterior ao instante
+func getSnapshotAt(at time.Time) (*HistorySnapshot, error) {
+	return querySnapshot(`
+		SELECT id, etag, timestamp, info FROM system_info_history
+		WHERE timestamp <= ?
+		ORDER BY timestamp DESC, id DESC
+		LIMIT 1
+	`, at.Unix())
+}
+
+// querySnapshot executa uma consulta que retorna um único snapshot com o conteúdo
+func querySnapshot(query string, args ...interface{}) (*HistorySnapshot, error) {
+	var snapshot HistorySnapshot
+	var timestamp int64
+	var info string
+	err := db.QueryRow(query, args...).Scan(&snapshot.ID, &snapshot.ETag, &timestamp, &info)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("erro ao consultar histórico: %v", err)
+	}
+
+	snapshot.ColetadoEm = time.Unix(timestamp, 0).Format(time.RFC3339)
+	snapshot.TamanhoBytes = len(info)
+	snapshot.Info = json.RawMessage(info)
+	return &snapshot, nil
+}
+
+// insertOutboundItem adiciona um item à fila de envio e aplica os limites de tamanho e idade
+func insertOutboundItem(tipo string, payload []byte, etag string, createdAt time.Time) error {
+	_, err := db.Exec("INSERT INTO outbound_queue (tipo, payload, etag, tamanho, criado_em) VALUES (?, ?, ?, ?, ?)",
+		tipo, payload, etag, len(payload), createdAt.Unix())
 	if err != nil {
-		return fmt.Errorf("erro ao atualizar intervalo de verificação de atualizações: %v", err)
+		return fmt.Errorf("erro ao adicionar item à fila de envio: %v", err)
 	}
 
+	return pruneOutboundQueue()
+}
+
+// getLastQueuedSnapshotETag obtém o ETag do snapshot mais recente aguardando envio
+// Retorna string vazia se não há snapshot na fila
+func getLastQueuedSnapshotETag() (string, error) {
+	var etag string
+	err := db.QueryRow("SELECT etag FROM outbound_queue WHERE tipo = ? ORDER BY id DESC LIMIT 1", outboundSnapshot).Scan(&etag)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("erro ao consultar fila de envio: %v", err)
+	}
+	return etag, nil
+}
+
+// getNextOutboundItem obtém o item mais antigo da fila de envio
+// Retorna nil se a fila está vazia
+func getNextOutboundItem() (*OutboundItem, error) {
+	var item OutboundItem
+	var createdAt int64
+	err := db.QueryRow(`
+		SELECT id, tipo, payload, etag, criado_em, tentativas FROM outbound_queue
+		ORDER BY id
+		LIMIT 1
+	`).Scan(&item.ID, &item.Tipo, &item.Payload, &item.ETag, &createdAt, &item.Tentativas)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("erro ao consultar fila de envio: %v", err)
+	}
+
+	item.CriadoEm = time.Unix(createdAt, 0)
+	return &item, nil
+}
+
+// deleteOutboundItem remove um item entregue (ou descartado) da fila de envio
+func deleteOutboundItem(id int64) error {
+	if _, err := db.Exec("DELETE FROM outbound_queue WHERE id = ?", id); err != nil {
+		return fmt.Errorf("erro ao remover item da fila de envio: %v", err)
+	}
 	return nil
 }
+
+// recordOutboundAttempt registra uma tentativa de entrega que falhou
+func recordOutboundAttempt(id int64) error {
+	if _, err := db.Exec("UPDATE outbound_queue SET tentativas = tentativas + 1 WHERE id = ?", id); err != nil {
+		return fmt.Errorf("erro ao registrar tentativa de envio: %v", err)
+	}
+	return nil
+}
+
+// getOutboundQueueStats retorna a quantidade de itens e o total de bytes da fila de envio
+func getOutboundQueueStats() (int, int64, error) {
+	var count int
+	var size int64
+	err := db.QueryRow("SELECT COUNT(*), COALESCE(SUM(tamanho), 0) FROM outbound_queue").Scan(&count, &size)
+	if err != nil {
+		return 0, 0, fmt.Errorf("erro ao consultar fila de envio: %v", err)
+	}
+	return count, size, nil
+}
+
+// pruneOutboundQueue remove os itens mais antigos que a idade máxima e, se a fila exceder o tamanho
+// máximo, os mais antigos até caber no limite (os itens mais recentes são preservados)
+func pruneOutboundQueue() error {
+	maxBytes, maxAgeDays, err := getOutboundQueueLimits()
+	if err != nil {
+		return err
+	}
+
+	cutoff := time.Now().AddDate(0, 0, -maxAgeDays).Unix()
+	if _, err := db.Exec("DELETE FROM outbound_queue WHERE criado_em < ?", cutoff); err != nil {
+		return fmt.Errorf("erro ao remover itens antigos da fila de envio: %v", err)
+	}
+
+	_, err = db.Exec(`
+		DELETE FROM outbound_queue WHERE id IN (
+			SELECT id FROM (
+				SELECT id, SUM(tamanho) OVER (ORDER BY id DESC) AS acumulado FROM outbound_queue
+			) WHERE acumulado > ?
+		)
+	`, maxBytes)
+	if err != nil {
+		return fmt.Errorf("erro ao remover itens excedentes da fila de envio: %v", err)
+	}
+
+	return nil
+}
+
+// getOutboundQueueLimits obtém o tamanho máximo em bytes e a idade máxima em dias da fila de envio
+func getOutboundQueueLimits() (int, int, error) {
+	var maxBytesStr, maxAgeDaysStr string
+	err := db.QueryRow("SELECT value FROM config WHERE key = 'queue_max_bytes'").Scan(&maxBytesStr)
+	if err != nil {
+		return defaultQueueMaxBytes, defaultQueueMaxAgeDays, fmt.Errorf("erro ao obter limites da fila de envio: %v", err)
+	}
+	err = db.QueryRow("SELECT value FROM config WHERE key = 'queue_max_age_days'").Scan(&maxAgeDaysStr)
+	if err != nil {
+		return defaultQueueMaxBytes, defaultQueueMaxAgeDays, fmt.Errorf("erro ao obter limites da fila de envio: %v", err)
+	}
+
+	maxBytes, err := strconv.Atoi(maxBytesStr)
+	if err != nil || maxBytes < 1 {
+		maxBytes = defaultQueueMaxBytes
+	}
+	maxAgeDays, err := strconv.Atoi(maxAgeDaysStr)
+	if err != nil || maxAgeDays < 1 {
+		maxAgeDays = defaultQueueMaxAgeDays
+	}
+
+	return maxBytes, maxAgeDays, nil
+}
+
+// blockVersion registra a versão como bloqueada: o agente não tenta mais instalá-la
+func blockVersion(version, motivo string) error {
+	_, err := db.Exec(`
+		INSERT OR REPLACE INTO blocked_versions (versao, motivo, bloqueada_em) VALUES (?, ?, ?)
+	`, version, motivo, time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("erro ao bloquear versão %s: %v", version, err)
+	}
+	return nil
+}
+
+// isVersionBlocked verifica se a versão foi bloqueada após uma atualização desfeita
+func isVersionBlocked(version string) (bool, error) {
+	var blocked bool
+	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM blocked_versions WHERE versao = ?)", version).Scan(&blocked)
+	if err != nil {
+		return false, fmt.Errorf("erro ao consultar versões bloqueadas: %v", err)
+	}
+	return blocked, nil
+}
+
+// getBlockedVersions lista as versões bloqueadas, da mais recente à mais antiga
+func getBlockedVersions() ([]string, error) {
+	rows, err := db.Query("SELECT versao FROM blocked_versions ORDER BY bloqueada_em DESC")
+	if err != nil {
+		return nil, fmt.Errorf("erro ao consultar versões bloqueadas: %v", err)
+	}
+	defer rows.Close()
+
+	var versions []string
+	for rows.Next() {
+		var version string
+		if err := rows.Scan(&version); err != nil {
+			return nil, fmt.Errorf("erro ao ler versão bloqueada: %v", err)
+		}
+		versions = append(versions, version)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("erro ao iterar versões bloqueadas: %v", err)
+	}
+	return versions, nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Cabeçalho com a situação da inscrição do agente, enviado pelo servidor de coleta na resposta aos snapshots
+const enrollmentHeader = "X-Agente-Inscricao"
+
+// Situações da inscrição: aprovado (o computador faz parte do inventário) ou pendente (aguardando o administrador)
+const (
+	enrollmentApproved = "aprovado"
+	enrollmentPending  = "pendente"
+)
+
+// Situação da inscrição (carregada do banco de dados na inicialização)
+var (
+	enrollmentStatus      string
+	enrollmentStatusMutex sync.Mutex
+)
+
+// loadEnrollmentStatus carrega a última situação da inscrição informada pelo servidor de coleta
+func loadEnrollmentStatus() error {
+	status, err := getEnrollmentStatus()
+	if err != nil {
+		return err
+	}
+
+	enrollmentStatusMutex.Lock()
+	enrollmentStatus = status
+	enrollmentStatusMutex.Unlock()
+	return nil
+}
+
+// enrollmentToken retorna o token de inscrição a apresentar ao servidor de coleta no snapshot
+// Depois que o servidor aprova a inscrição, o token não é mais enviado
+func enrollmentToken() string {
+	enrollmentStatusMutex.Lock()
+	approved := enrollmentStatus == enrollmentApproved
+	enrollmentStatusMutex.Unlock()
+	if approved {
+		return ""
+	}
+	return configString("token_inscricao")
+}
+
+// recordEnrollmentStatus registra a situação da inscrição informada pelo servidor de coleta
+func recordEnrollmentStatus(status string) {
+	if status != enrollmentApproved && status != enrollmentPending {
+		return
+	}
+
+	enrollmentStatusMutex.Lock()
+	defer enrollmentStatusMutex.Unlock()
+	if status == enrollmentStatus {
+		return
+	}
+
+	if err := setEnrollmentStatus(status); err != nil {
+		fmt.Printf("[inscricao] %v\n", err)
+		return
+	}
+	enrollmentStatus = status
+
+	if status == enrollmentApproved {
+		fmt.Println("[inscricao] Inscrição aprovada pelo servidor de coleta")
+	} else if configString("token_inscricao") == "" {
+		fmt.Println("[inscricao] Inscrição pendente: configure token_inscricao com um token gerado no servidor de coleta ou aguarde a aprovação do administrador")
+	} else {
+		fmt.Println("[inscricao] Inscrição pendente: o token de inscrição foi recusado pelo servidor de coleta (inválido, expirado ou já utilizado)")
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Versão do formato do envelope assinado aceita pelo agente
+const signedEnvelopeVersion = 1
+
+// Limites de validade dos envelopes assinados
+const (
+	maxEnvelopeTTL    = 15 * time.Minute // Validade máxima entre emissão e expiração
+	envelopeClockSkew = 2 * time.Minute  // Tolerância para relógios adiantados no emissor
+	minNonceLength    = 16
+	maxNonceLength    = 128
+)
+
+// SignedEnvelope é o conteúdo assinado exigido por todos os endpoints que alteram o agente
+type SignedEnvelope struct {
+	Versao    int             `json:"versao"`
+	AgenteID  string          `json:"agente_id"`
+	EmitidoEm int64           `json:"emitido_em"` // Unix, em segundos
+	ExpiraEm  int64           `json:"expira_em"`  // Unix, em segundos
+	Nonce     string          `json:"nonce"`
+	Payload   json.RawMessage `json:"payload"`
+}
+
+// SignedRequest é o corpo das requisições assinadas: o envelope serializado e a sua assinatura
+// A assinatura é RSA PKCS#1 v1.5 com SHA-256 sobre o prefixo dos comandos seguido dos bytes do envelope, feita
+// com a chave privada correspondente a uma chave confiável de comandos, identificada em ChaveID
+type SignedRequest struct {
+	Envelope   string `json:"envelope"`           // JSON do SignedEnvelope em base64
+	Assinatura string `json:"assinatura"`         // Assinatura em base64
+	ChaveID    string `json:"chave_id,omitempty"` // Chave que assinou (emissores antigos não informam: todas as chaves ativas são tentadas)
+}
+
+// Motivos de rejeição de um envelope assinado
+var (
+	errEnvelopeFormat      = errors.New("envelope inválido")
+	errEnvelopeVersion     = errors.New("versão do envelope não suportada")
+	errEnvelopeSignature   = errors.New("assinatura do envelope inválida")
+	errEnvelopeTarget      = errors.New("envelope destinado a outro agente")
+	errEnvelopeNotYetValid = errors.New("envelope emitido no futuro")
+	errEnvelopeExpired     = errors.New("envelope expirado")
+	errEnvelopeReplay      = errors.New("nonce já utilizado (requisição repetida)")
+)
+
+// openSignedEnvelope verifica a assinatura, o destino, a validade e o nonce de uma requisição assinada
+// e retorna o payload do envelope. O nonce é consumido apenas se todas as outras verificações passarem
+func openSignedEnvelope(body []byte) (json.RawMessage, error) {
+	var request SignedRequest
+	if err := json.Unmarshal(body, &request); err != nil {
+		return nil, fmt.Errorf("%w: %v", errEnvelopeFormat, err)
+	}
+
+	envelopeBytes, err := base64.StdEncoding.DecodeString(request.Envelope)
+	if err != nil || len(envelopeBytes) == 0 {
+		return nil, fmt.Errorf("%w: envelope não está em base64", errEnvelopeFormat)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(request.Assinatura)
+	if err != nil || len(signature) == 0 {
+		return nil, fmt.Errorf("%w: assinatura não está em base64", errEnvelopeFormat)
+	}
+
+	// Verificar a assinatura antes de interpretar o conteúdo
+	if err := verifyTrustedSignature(keyPurposeCommands, request.ChaveID, withSignaturePrefix(commandSignaturePrefix, envelopeBytes), signature); err != nil {
+		return nil, fmt.Errorf("%w: %v", errEnvelopeSignature, err)
+	}
+
+	var envelope SignedEnvelope
+	if err := json.Unmarshal(envelopeBytes, &envelope); err != nil {
+		return nil, fmt.Errorf("%w: %v", errEnvelopeFormat, err)
+	}
+
+	if envelope.Versao != signedEnvelopeVersion {
+		return nil, fmt.Errorf("%w: %d (esperada %d)", errEnvelopeVersion, envelope.Versao, signedEnvelopeVersion)
+	}
+
+	// Destino
+	agentID := getAgentID()
+	if !strings.EqualFold(envelope.AgenteID, agentID) {
+		return nil, fmt.Errorf("%w: destino %q, este agente é %q", errEnvelopeTarget, envelope.AgenteID, agentID)
+	}
+
+	// Validade
+	issuedAt := time.Unix(envelope.EmitidoEm, 0)
+	expiresAt := time.Unix(envelope.ExpiraEm, 0)
+	if !expiresAt.After(issuedAt) || expiresAt.Sub(issuedAt) > maxEnvelopeTTL {
+		return nil, fmt.Errorf("%w: validade deve ser de no máximo %v", errEnvelopeFormat, maxEnvelopeTTL)
+	}
+
+	now := time.Now()
+	if issuedAt.After(now.Add(envelopeClockSkew)) {
+		return nil, fmt.Errorf("%w: emitido em %s", errEnvelopeNotYetValid, issuedAt.Format(time.RFC3339))
+	}
+	if now.After(expiresAt) {
+		return nil, fmt.Errorf("%w: expirou em %s", errEnvelopeExpired, expiresAt.Format(time.RFC3339))
+	}
+
+	// Nonce
+	if len(envelope.Nonce) < minNonceLength || len(envelope.Nonce) > maxNonceLength {
+		return nil, fmt.Errorf("%w: nonce deve ter entre %d e %d caracteres", errEnvelopeFormat, minNonceLength, maxNonceLength)
+	}
+
+	fresh, err := consumeNonce(envelope.Nonce, expiresAt)
+	if err != nil {
+		return nil, err
+	}
+	if !fresh {
+		return nil, errEnvelopeReplay
+	}
+
+	return envelope.Payload, nil
+}
+
+// envelopeErrorStatus escolhe o código HTTP para o motivo de rejeição do envelope
+func envelopeErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errEnvelopeFormat), errors.Is(err, errEnvelopeVersion):
+		return http.StatusBadRequest
+	case errors.Is(err, errEnvelopeSignature), errors.Is(err, errEnvelopeNotYetValid), errors.Is(err, errEnvelopeExpired):
+		return http.StatusUnauthorized
+	case errors.Is(err, errEnvelopeTarget):
+		return http.StatusForbidden
+	case errors.Is(err, errEnvelopeReplay):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// readSignedPayload lê uma requisição POST assinada e deserializa o payload do envelope em v
+// Em caso de falha, a resposta de erro já é enviada e o retorno é false
+func readSignedPayload(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	payload, ok := readSignedRequest(w, r, http.MethodPost)
+	if !ok {
+		return false
+	}
+
+	// Deserializar o payload
+	if err := json.Unmarshal(payload, v); err != nil {
+		http.Error(w, fmt.Sprintf("Erro ao deserializar payload: %v", err), http.StatusBadRequest)
+		return false
+	}
+
+	return true
+}
+
+// readSignedRequest lê uma requisição assinada com o método informado e retorna o payload do envelope
+// Em caso de falha, a resposta de erro já é enviada e o retorno é false
+func readSignedRequest(w http.ResponseWriter, r *http.Request, method string) (json.RawMessage, bool) {
+	// Apenas aceitar o método esperado
+	if r.Method != method {
+		http.Error(w, "Método não permitido", http.StatusMethodNotAllowed)
+		return nil, false
+	}
+
+	// Ler o corpo da requisição
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Erro ao ler corpo da requisição", http.StatusBadRequest)
+		return nil, false
+	}
+
+	// Verificar se o corpo está vazio
+	if len(body) == 0 {
+		http.Error(w, "Corpo da requisição vazio", http.StatusBadRequest)
+		return nil, false
+	}
+
+	// Abrir o envelope assinado
+	payload, err := openSignedEnvelope(body)
+	if err != nil {
+		fmt.Printf("Requisição rejeitada em %s: %v\n", r.URL.Path, err)
+		http.Error(w, fmt.Sprintf("Requisição rejeitada: %v", err), envelopeErrorStatus(err))
+		return nil, false
+	}
+
+	return payload, true
+}
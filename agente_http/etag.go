@@ -0,0 +1,24 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// snapshotETag calcula o ETag de um snapshot a partir do hash SHA-256 do seu conteúdo
+func snapshotETag(content []byte) string {
+	sum := sha256.Sum256(content)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches verifica se o cabeçalho If-None-Match contém o ETag (aceita listas, "*" e ETags fracos "W/")
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
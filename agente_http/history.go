@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Retenção padrão do histórico de snapshots (configurável pelo endpoint /update-history-retention)
+const (
+	defaultHistoryMaxSnapshots = 1000
+	defaultHistoryMaxAgeDays   = 30
+)
+
+// Limites da listagem do histórico
+const (
+	defaultHistoryListLimit = 50
+	maxHistoryListLimit     = 1000
+)
+
+// HistorySnapshot representa um snapshot das informações do sistema guardado no histórico
+// Info só é preenchido ao consultar um snapshot específico
+type HistorySnapshot struct {
+	ID           int64           `json:"id"`
+	ColetadoEm   string          `json:"coletado_em"`
+	ETag         string          `json:"etag"`
+	TamanhoBytes int             `json:"tamanho_bytes"`
+	Info         json.RawMessage `json:"info,omitempty"`
+}
+
+// SnapshotChanges descreve as seções que mudaram entre o snapshot vigente em "since" e o mais recente
+type SnapshotChanges struct {
+	Desde     string                     `json:"desde"`
+	BaseID    int64                      `json:"base_id,omitempty"`
+	BaseEm    string                     `json:"base_coletado_em,omitempty"`
+	AtualID   int64                      `json:"atual_id"`
+	AtualEm   string                     `json:"atual_coletado_em"`
+	ETag      string                     `json:"etag"`
+	Alteradas map[string]json.RawMessage `json:"alteradas"`
+	Removidas []string                   `json:"removidas"`
+}
+
+// HistoryRetentionPayload é o conteúdo do envelope assinado que altera a retenção do histórico
+type HistoryRetentionPayload struct {
+	MaxSnapshots int `json:"max_snapshots"`
+	MaxDias      int `json:"max_dias"`
+}
+
+// historyHandler lista o histórico de snapshots (GET /history?limite=N)
+// ou retorna um snapshot completo (GET /history?id=N)
+func historyHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	if value := query.Get("id"); value != "" {
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || id <= 0 {
+			http.Error(w, "Parâmetro id inválido", http.StatusBadRequest)
+			return
+		}
+
+		snapshot, err := getSnapshotFromHistory(id)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Erro ao consultar histórico: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if snapshot == nil {
+			http.Error(w, "Snapshot não encontrado", http.StatusNotFound)
+			return
+		}
+
+		writeDataResponse(w, r, snapshot)
+		return
+	}
+
+	limit := defaultHistoryListLimit
+	if value := query.Get("limite"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "Parâmetro limite inválido", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+	if limit > maxHistoryListLimit {
+		limit = maxHistoryListLimit
+	}
+
+	snapshots, err := listSnapshotHistory(limit)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Erro ao listar histórico: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	maxSnapshots, maxAgeDays, err := getHistoryRetention()
+	if err != nil {
+		fmt.Printf("Erro ao obter retenção do histórico: %v\n", err)
+	}
+
+	writeDataResponse(w, r, map[string]interface{}{
+		"snapshots": snapshots,
+		"retencao": HistoryRetentionPayload{
+			MaxSnapshots: maxSnapshots,
+			MaxDias:      maxAgeDays,
+		},
+	})
+}
+
+// changesHandler retorna apenas as seções que mudaram desde um instante (GET /changes?since=...)
+// "since" aceita data no formato RFC 3339 ou segundos Unix
+func changesHandler(w http.ResponseWriter, r *http.Request) {
+	value := r.URL.Query().Get("since")
+	if value == "" {
+		http.Error(w, "Parâmetro since não fornecido", http.StatusBadRequest)
+		return
+	}
+
+	since, err := parseSinceParameter(value)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Parâmetro since inválido: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	current, err := getLatestSnapshot()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Erro ao consultar histórico: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if current == nil {
+		http.Error(w, "Histórico ainda não possui snapshots", http.StatusServiceUnavailable)
+		return
+	}
+
+	base, err := getSnapshotAt(since)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Erro ao consultar histórico: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	changes, err := diffSnapshots(base, current)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Erro ao comparar snapshots: %v", err), http.StatusInternalServerError)
+		return
+	}
+	changes.Desde = since.Format(time.RFC3339)
+
+	writeDataResponse(w, r, changes)
+}
+
+// parseSinceParameter interpreta o parâmetro since como RFC 3339 ou segundos Unix
+func parseSinceParameter(value string) (time.Time, error) {
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// diffSnapshots compara as seções de primeiro nível de dois snapshots
+// Sem snapshot base (since anterior ao histórico), todas as seções atuais são consideradas alteradas
+func diffSnapshots(base, current *HistorySnapshot) (*SnapshotChanges, error) {
+	var currentSections map[string]json.RawMessage
+	if err := json.Unmarshal(current.Info, &currentSections); err != nil {
+		return nil, fmt.Errorf("erro ao ler snapshot %d: %v", current.ID, err)
+	}
+
+	baseSections := map[string]json.RawMessage{}
+	changes := &SnapshotChanges{
+		AtualID:   current.ID,
+		AtualEm:   current.ColetadoEm,
+		ETag:      current.ETag,
+		Alteradas: map[string]json.RawMessage{},
+		Removidas: []string{},
+	}
+
+	if base != nil {
+		if err := json.Unmarshal(base.Info, &baseSections); err != nil {
+			return nil, fmt.Errorf("erro ao ler snapshot %d: %v", base.ID, err)
+		}
+		changes.BaseID = base.ID
+		changes.BaseEm = base.ColetadoEm
+	}
+
+	for name, section := range currentSections {
+		if previous, ok := baseSections[name]; !ok || !sameJSON(previous, section) {
+			changes.Alteradas[name] = section
+		}
+	}
+	for name := range baseSections {
+		if _, ok := currentSections[name]; !ok {
+			changes.Removidas = append(changes.Removidas, name)
+		}
+	}
+	sort.Strings(changes.Removidas)
+
+	return changes, nil
+}
+
+// sameJSON compara dois valores JSON ignorando diferenças de espaçamento
+func sameJSON(a, b json.RawMessage) bool {
+	var compactA, compactB bytes.Buffer
+	if json.Compact(&compactA, a) != nil || json.Compact(&compactB, b) != nil {
+		return bytes.Equal(a, b)
+	}
+	return bytes.Equal(compactA.Bytes(), compactB.Bytes())
+}
+
+// updateHistoryRetentionHandler altera a quantidade máxima e a idade máxima dos snapshots guardados
+func updateHistoryRetentionHandler(w http.ResponseWriter, r *http.Request) {
+	var request HistoryRetentionPayload
+	if !readSignedPayload(w, r, &request) {
+		return
+	}
+
+	if request.MaxSnapshots <= 0 || request.MaxDias <= 0 {
+		http.Error(w, "Retenção inválida", http.StatusBadRequest)
+		return
+	}
+
+	err := updateHistoryRetention(request.MaxSnapshots, request.MaxDias)
+	if err != nil {
+		fmt.Printf("Erro ao atualizar retenção do histórico: %v\n", err)
+		http.Error(w, "Erro ao atualizar retenção do histórico", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "Retenção do histórico alterada para: %d snapshots, %d dias", request.MaxSnapshots, request.MaxDias)
+	fmt.Printf("Retenção do histórico alterada para: %d snapshots, %d dias\n", request.MaxSnapshots, request.MaxDias)
+}
@@ -2,8 +2,11 @@ package main
 
 import (
 	"fmt"
+	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 )
 
 // getAgentInfo obtém as informações do agente a partir do banco de dados
@@ -15,35 +18,108 @@ func getAgentInfo() AgenteInfo {
 		versaoAgente = "desconhecida"
 	}
 
-	// Obter o IP do servidor de atualização
-	servidorAtualizacao, err := getUpdateServerIP()
-	if err != nil {
-		fmt.Printf("Erro ao obter servidor de atualização: %v\n", err)
-		servidorAtualizacao = "desconhecido"
-	}
+	// Servidor de atualização e intervalos da configuração efetiva (ver /config para a origem de cada valor)
+	servidorAtualizacao := configString("servidor_atualizacao")
+	systemInfoUpdateInterval := configInt("system_info_update_interval")
+	updateCheckInterval := configInt("update_check_interval")
 
-	// Obter os intervalos de atualização
-	systemInfoUpdateInterval, err := getSystemInfoUpdateInterval()
-	if err != nil {
-		fmt.Printf("Erro ao obter intervalo de atualização: %v\n", err)
-		systemInfoUpdateInterval = 10
-	}
+	// MAC da interface principal (usado pelo servidor para associar o agente aos registros antigos, identificados pelo MAC)
+	mac, _ := getPrimaryMacAddress()
 
-	updateCheckInterval, err := getUpdateCheckInterval()
+	// Versões que falharam ao iniciar e não serão instaladas novamente
+	versoesBloqueadas, err := getBlockedVersions()
 	if err != nil {
-		fmt.Printf("Erro ao obter intervalo de verificação: %v\n", err)
-		updateCheckInterval = 10
+		fmt.Printf("Erro ao obter versões bloqueadas: %v\n", err)
 	}
 
 	// Criar e retornar o objeto AgenteInfo
 	return AgenteInfo{
+		AgenteID:                 getAgentID(),
+		NumeroSerie:              getHardwareSerial(),
+		MacPrincipal:             strings.ToLower(mac),
 		VersaoAgente:             versaoAgente,
 		ServidorAtualizacao:      servidorAtualizacao,
 		SystemInfoUpdateInterval: fmt.Sprintf("%d", systemInfoUpdateInterval),
 		UpdateCheckInterval:      fmt.Sprintf("%d", updateCheckInterval),
+		CanalAtualizacao:         configString("canal_atualizacao"),
+		RevisaoConfig:            currentConfigRevision(),
+		TokenInscricao:           enrollmentToken(),
+		ChavePublica:             agentPublicKeyString(),
+		VersoesBloqueadas:        versoesBloqueadas,
 	}
 }
 
+// Identificador persistente do agente (carregado do banco de dados na inicialização) e número de série do hardware
+var (
+	agentUUID          string
+	hardwareSerial     string
+	hardwareSerialOnce sync.Once
+)
+
+// Cabeçalhos com o identificador do agente e o número de série do hardware, enviados em todas as respostas
+// e nos envios ao servidor de coleta
+const (
+	agentIDHeader     = "X-Agente-ID"
+	agentSerialHeader = "X-Agente-Serie"
+)
+
+// Números de série genéricos gravados por fabricantes, que não identificam a máquina
+var genericHardwareSerials = []string{
+	"desconhecido", "to be filled by o.e.m.", "default string", "system serial number",
+	"not specified", "not applicable", "none", "0", "00000000", "0123456789",
+}
+
+// getAgentID retorna o identificador do agente, usado pelo servidor para identificar o computador
+// e como destino nos envelopes assinados
+// Antes do banco de dados ser aberto, usa o MAC da interface principal (ou o nome do host)
+func getAgentID() string {
+	if agentUUID != "" {
+		return agentUUID
+	}
+
+	mac, err := getPrimaryMacAddress()
+	if err == nil {
+		return strings.ToLower(mac)
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "desconhecido"
+	}
+	return strings.ToLower(hostname)
+}
+
+// setAgentIdentityHeaders adiciona o identificador do agente e o número de série do hardware aos cabeçalhos
+func setAgentIdentityHeaders(header http.Header) {
+	header.Set(agentIDHeader, getAgentID())
+	if serial := getHardwareSerial(); serial != "" {
+		header.Set(agentSerialHeader, serial)
+	}
+}
+
+// getHardwareSerial retorna o número de série do hardware, coletado uma única vez
+// Números de série genéricos ou desconhecidos são retornados vazios
+func getHardwareSerial() string {
+	hardwareSerialOnce.Do(func() {
+		serial, _ := getHardwareInfoSyscall()["numero_serie"].(string)
+		serial = strings.Map(func(r rune) rune {
+			if r < 0x20 || r > 0x7e {
+				return -1 // Apenas ASCII imprimível (o valor também é enviado em cabeçalho HTTP)
+			}
+			return r
+		}, strings.TrimSpace(serial))
+
+		for _, generic := range genericHardwareSerials {
+			if strings.EqualFold(serial, generic) {
+				serial = ""
+				break
+			}
+		}
+		hardwareSerial = serial
+	})
+	return hardwareSerial
+}
+
 // updateAgentVersion atualiza a versão do agente no banco de dados a partir do arquivo version.txt
 func updateAgentVersion() error {
 	exePath, err := os.Executable()
@@ -66,7 +142,10 @@ func updateAgentVersion() error {
 	}
 
 	// Atualizar a versão no banco de dados
-	version := string(content)
+	version := strings.TrimSpace(string(content))
+	if _, err := parseVersion(version); err != nil {
+		return fmt.Errorf("arquivo de versão inválido: %v", err)
+	}
 	err = updateVersion(version)
 	if err != nil {
 		return fmt.Errorf("erro ao atualizar versão no banco de dados: %v", err)
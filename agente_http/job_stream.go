@@ -0,0 +1,225 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Intervalo dos comentários de keep-alive enviados enquanto o job não produz saída
+const jobStreamKeepAlive = 15 * time.Second
+
+// outputNotifier avisa os leitores de um job sempre que há nova saída
+// Cada aviso fecha o canal atual e cria outro, acordando todos que aguardavam
+type outputNotifier struct {
+	mu sync.Mutex
+	ch chan struct{}
+}
+
+func newOutputNotifier() *outputNotifier {
+	return &outputNotifier{ch: make(chan struct{})}
+}
+
+// wait retorna o canal que será fechado na próxima escrita
+func (n *outputNotifier) wait() <-chan struct{} {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.ch
+}
+
+// broadcast acorda todos os leitores que aguardam nova saída
+func (n *outputNotifier) broadcast() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	close(n.ch)
+	n.ch = make(chan struct{})
+}
+
+// JobOutputChunk é um trecho da saída de um job enviado no streaming
+type JobOutputChunk struct {
+	Fluxo string `json:"fluxo"` // "stdout" ou "stderr"
+	Texto string `json:"texto"`
+}
+
+// jobStreamWriter envia eventos Server-Sent Events, cada um criptografado individualmente
+// e com a assinatura do agente sobre o conteúdo no campo "assinatura" do evento
+type jobStreamWriter struct {
+	w       http.ResponseWriter
+	r       *http.Request
+	flusher http.Flusher
+}
+
+// send envia um evento com o JSON de data (criptografado no formato negociado se encriptado estiver ativo)
+func (s *jobStreamWriter) send(event string, data interface{}) error {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("erro ao serializar evento: %v", err)
+	}
+
+	payload := string(jsonData)
+	if encriptado {
+		payload, err = encryptResponse(s.w, s.r, jsonData)
+		if err != nil {
+			return fmt.Errorf("erro ao criptografar evento: %v", err)
+		}
+	}
+
+	if signature := signAgentResponse(s.r, []byte(payload)); signature != "" {
+		if _, err := fmt.Fprintf(s.w, "assinatura: %s\n", signature); err != nil {
+			return err
+		}
+	}
+	if _, err := fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event, payload); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+// keepAlive envia um comentário para manter a conexão aberta
+func (s *jobStreamWriter) keepAlive() error {
+	if _, err := fmt.Fprint(s.w, ": ping\n\n"); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+// jobStreamHandler transmite a saída de um job à medida que é produzida (?id=<job>)
+// Eventos: "saida" com um JobOutputChunk e, ao final, "fim" com o job (status e código de saída, sem a saída)
+// Jobs já finalizados são transmitidos de uma vez a partir do resultado gravado
+func jobStreamHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "ID do job não fornecido", http.StatusBadRequest)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming não suportado", http.StatusInternalServerError)
+		return
+	}
+
+	runningJobsMutex.Lock()
+	running, isRunning := runningJobs[id]
+	runningJobsMutex.Unlock()
+
+	var job *CommandJob
+	if !isRunning {
+		var err error
+		job, err = getCommandJob(id)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Erro ao consultar job: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if job == nil {
+			http.Error(w, fmt.Sprintf("Job não encontrado: %s", id), http.StatusNotFound)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	if encriptado {
+		// Os eventos são criptografados depois que os cabeçalhos já foram enviados
+		w.Header().Set(encryptionHeader, negotiateEncryption(r))
+	}
+	w.WriteHeader(http.StatusOK)
+
+	stream := &jobStreamWriter{w: w, r: r, flusher: flusher}
+
+	if isRunning {
+		if err := streamRunningJob(r, stream, running); err != nil {
+			fmt.Printf("Streaming do job %s encerrado: %v\n", id, err)
+			return
+		}
+
+		// O resultado é gravado antes de o job sair da lista de execução
+		var err error
+		job, err = getCommandJob(id)
+		if err != nil || job == nil {
+			fmt.Printf("Erro ao consultar job %s após o término: %v\n", id, err)
+			return
+		}
+	} else {
+		// Job já finalizado: enviar a saída gravada
+		if job.Saida != "" {
+			if err := stream.send("saida", JobOutputChunk{Fluxo: "stdout", Texto: job.Saida}); err != nil {
+				return
+			}
+		}
+		if job.Erro != "" {
+			if err := stream.send("saida", JobOutputChunk{Fluxo: "stderr", Texto: job.Erro}); err != nil {
+				return
+			}
+		}
+	}
+
+	// A saída já foi transmitida nos eventos anteriores
+	final := *job
+	final.Saida = ""
+	final.Erro = ""
+	if err := stream.send("fim", final); err != nil {
+		fmt.Printf("Erro ao enviar fim do job %s: %v\n", id, err)
+	}
+}
+
+// streamRunningJob transmite a saída de um job em execução até o seu término ou até o cliente desconectar
+func streamRunningJob(r *http.Request, stream *jobStreamWriter, running *runningJob) error {
+	var stdoutOffset, stderrOffset int
+
+	// flush envia a saída produzida desde a última leitura
+	flush := func() error {
+		if chunk := running.stdout.readFrom(stdoutOffset); len(chunk) > 0 {
+			stdoutOffset += len(chunk)
+			if err := stream.send("saida", JobOutputChunk{Fluxo: "stdout", Texto: decodeCommandOutput(chunk)}); err != nil {
+				return err
+			}
+		}
+		if chunk := running.stderr.readFrom(stderrOffset); len(chunk) > 0 {
+			stderrOffset += len(chunk)
+			if err := stream.send("saida", JobOutputChunk{Fluxo: "stderr", Texto: decodeCommandOutput(chunk)}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	keepAlive := time.NewTicker(jobStreamKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		// Obter o canal antes de ler, para não perder escritas feitas entre a leitura e a espera
+		changed := running.output.wait()
+		if err := flush(); err != nil {
+			return err
+		}
+
+		select {
+		case <-changed:
+		case <-keepAlive.C:
+			if err := stream.keepAlive(); err != nil {
+				return err
+			}
+		case <-running.done:
+			// Enviar o restante, incluindo bytes retidos por estarem no meio de um caractere e o aviso de truncamento
+			if tail := running.stdout.tail(stdoutOffset); tail != "" {
+				if err := stream.send("saida", JobOutputChunk{Fluxo: "stdout", Texto: tail}); err != nil {
+					return err
+				}
+			}
+			if tail := running.stderr.tail(stderrOffset); tail != "" {
+				if err := stream.send("saida", JobOutputChunk{Fluxo: "stderr", Texto: tail}); err != nil {
+					return err
+				}
+			}
+			return nil
+		case <-r.Context().Done():
+			return r.Context().Err()
+		}
+	}
+}
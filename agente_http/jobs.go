@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// Estados de um job de comando
+const (
+	jobStatusExecutando    = "executando"
+	jobStatusConcluido     = "concluido"
+	jobStatusFalhou        = "falhou"
+	jobStatusCancelado     = "cancelado"
+	jobStatusTempoEsgotado = "tempo_esgotado"
+	jobStatusInterrompido  = "interrompido" // O agente foi encerrado durante a execução
+)
+
+// Limites dos jobs de comando
+const (
+	defaultJobTimeoutSeconds = 300
+	maxJobTimeoutSeconds     = 24 * 60 * 60
+	maxJobOutputBytes        = 1024 * 1024 // Por fluxo (saída padrão e saída de erro)
+	maxStoredJobs            = 200
+)
+
+// CommandJob representa um comando executado de forma assíncrona pelo agente
+type CommandJob struct {
+	ID              string `json:"job_id"`
+	Comando         string `json:"comando"`
+	Tipo            string `json:"tipo"`
+	Status          string `json:"status"`
+	CodigoSaida     int    `json:"codigo_saida"`
+	Saida           string `json:"saida"`
+	Erro            string `json:"erro,omitempty"`
+	TimeoutSegundos int    `json:"timeout_segundos"`
+	CriadoEm        string `json:"criado_em"`
+	FinalizadoEm    string `json:"finalizado_em,omitempty"`
+}
+
+// runningJob mantém o processo de um job em execução para permitir o cancelamento e o acompanhamento da saída
+type runningJob struct {
+	cmd       *exec.Cmd
+	stdout    *limitedBuffer
+	stderr    *limitedBuffer
+	output    *outputNotifier
+	done      chan struct{}
+	cancelled bool
+}
+
+// Jobs em execução, indexados pelo ID
+var (
+	runningJobs      = make(map[string]*runningJob)
+	runningJobsMutex sync.Mutex
+)
+
+// limitedBuffer guarda até maxJobOutputBytes e descarta o restante da saída
+// Pode ser lido enquanto o processo escreve, e avisa o notifier a cada escrita
+type limitedBuffer struct {
+	mu        sync.Mutex
+	buf       bytes.Buffer
+	truncated bool
+	notifier  *outputNotifier
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	if remaining := maxJobOutputBytes - b.buf.Len(); remaining < len(p) {
+		b.truncated = true
+		if remaining > 0 {
+			b.buf.Write(p[:remaining])
+		}
+	} else {
+		b.buf.Write(p)
+	}
+	b.mu.Unlock()
+
+	if b.notifier != nil {
+		b.notifier.broadcast()
+	}
+	return len(p), nil
+}
+
+// String retorna a saída convertida para UTF-8, indicando se foi truncada
+func (b *limitedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	output := decodeCommandOutput(b.buf.Bytes())
+	if b.truncated {
+		output += fmt.Sprintf("\n[saída truncada em %d bytes]", maxJobOutputBytes)
+	}
+	return output
+}
+
+// readFrom retorna a saída ainda não lida a partir de offset, sem cortar caracteres ao meio
+func (b *limitedBuffer) readFrom(offset int) []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	data := b.buf.Bytes()
+	if offset >= len(data) {
+		return nil
+	}
+
+	pending := data[offset:]
+	chunk := make([]byte, decodableOutputLength(pending))
+	copy(chunk, pending)
+	return chunk
+}
+
+// tail retorna toda a saída restante a partir de offset, indicando se foi truncada
+// Usado quando o processo já terminou e não haverá mais escritas
+func (b *limitedBuffer) tail(offset int) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var output string
+	if data := b.buf.Bytes(); offset < len(data) {
+		output = decodeCommandOutput(data[offset:])
+	}
+	if b.truncated {
+		output += fmt.Sprintf("\n[saída truncada em %d bytes]", maxJobOutputBytes)
+	}
+	return output
+}
+
+// newJobID gera um identificador aleatório para um job
+func newJobID() (string, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("erro ao gerar ID do job: %v", err)
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// startCommandJob registra e inicia um job de comando em segundo plano
+func startCommandJob(comando, tipo string, timeoutSeconds int) (*CommandJob, error) {
+	if timeoutSeconds <= 0 {
+		timeoutSeconds = defaultJobTimeoutSeconds
+	}
+	if timeoutSeconds > maxJobTimeoutSeconds {
+		timeoutSeconds = maxJobTimeoutSeconds
+	}
+
+	id, err := newJobID()
+	if err != nil {
+		return nil, err
+	}
+
+	job := &CommandJob{
+		ID:              id,
+		Comando:         comando,
+		Tipo:            tipo,
+		Status:          jobStatusExecutando,
+		TimeoutSegundos: timeoutSeconds,
+		CriadoEm:        time.Now().Format(time.RFC3339),
+	}
+
+	output := newOutputNotifier()
+	stdout := &limitedBuffer{notifier: output}
+	stderr := &limitedBuffer{notifier: output}
+	cmd := buildJobCommand(tipo, comando)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	// Não esperar indefinidamente por processos filhos que herdaram a saída após o término do principal
+	cmd.WaitDelay = 5 * time.Second
+
+	if err := cmd.Start(); err != nil {
+		job.Status = jobStatusFalhou
+		job.CodigoSaida = -1
+		job.Erro = fmt.Sprintf("erro ao iniciar comando: %v", err)
+		job.FinalizadoEm = time.Now().Format(time.RFC3339)
+		if err := saveCommandJob(job); err != nil {
+			return nil, err
+		}
+		return job, nil
+	}
+
+	if err := saveCommandJob(job); err != nil {
+		killProcessTree(cmd)
+		cmd.Wait()
+		return nil, err
+	}
+
+	running := &runningJob{cmd: cmd, stdout: stdout, stderr: stderr, output: output, done: make(chan struct{})}
+	runningJobsMutex.Lock()
+	runningJobs[id] = running
+	runningJobsMutex.Unlock()
+
+	// Aguardar o término do processo em segundo plano
+	waitErr := make(chan error, 1)
+	go func() {
+		waitErr <- cmd.Wait()
+	}()
+
+	go func() {
+		timer := time.NewTimer(time.Duration(timeoutSeconds) * time.Second)
+		defer timer.Stop()
+
+		var err error
+		timedOut := false
+		select {
+		case err = <-waitErr:
+		case <-timer.C:
+			timedOut = true
+			killProcessTree(cmd)
+			err = <-waitErr
+		}
+
+		runningJobsMutex.Lock()
+		cancelled := running.cancelled
+		runningJobsMutex.Unlock()
+
+		finished := *job
+		finished.Saida = stdout.String()
+		finished.Erro = stderr.String()
+		finished.FinalizadoEm = time.Now().Format(time.RFC3339)
+
+		switch {
+		case cancelled:
+			finished.Status = jobStatusCancelado
+			finished.CodigoSaida = -1
+		case timedOut:
+			finished.Status = jobStatusTempoEsgotado
+			finished.CodigoSaida = -1
+		case err == nil:
+			finished.Status = jobStatusConcluido
+		default:
+			if exitError, ok := err.(*exec.ExitError); ok {
+				finished.Status = jobStatusConcluido
+				finished.CodigoSaida = exitError.ExitCode()
+			} else {
+				finished.Status = jobStatusFalhou
+				finished.CodigoSaida = -1
+				finished.Erro = fmt.Sprintf("%v\n%s", err, finished.Erro)
+			}
+		}
+
+		if err := saveCommandJob(&finished); err != nil {
+			fmt.Printf("Erro ao salvar resultado do job %s: %v\n", id, err)
+		}
+		fmt.Printf("Job %s finalizado com status %s\n", id, finished.Status)
+
+		// Avisar o servidor de coleta (sem a saída, que pode ser consultada no agente)
+		summary := finished
+		summary.Saida = ""
+		summary.Erro = ""
+		enqueueEvent(eventJobFinished, summary)
+
+		// Retirar da lista de execução só depois de gravar o resultado, para que as consultas vejam o estado final
+		runningJobsMutex.Lock()
+		delete(runningJobs, id)
+		runningJobsMutex.Unlock()
+		close(running.done)
+	}()
+
+	return job, nil
+}
+
+// waitCommandJob aguarda o término de um job por até o tempo informado e retorna o estado atual
+func waitCommandJob(id string, wait time.Duration) (*CommandJob, error) {
+	runningJobsMutex.Lock()
+	running, ok := runningJobs[id]
+	runningJobsMutex.Unlock()
+
+	if ok && wait > 0 {
+		select {
+		case <-running.done:
+		case <-time.After(wait):
+		}
+	}
+
+	return getCommandJob(id)
+}
+
+// cancelCommandJob encerra a árvore de processos de um job em execução e retorna o seu estado final
+// Retorna false se o job não está em execução
+func cancelCommandJob(id string) (*CommandJob, bool, error) {
+	runningJobsMutex.Lock()
+	running, ok := runningJobs[id]
+	if ok {
+		running.cancelled = true
+	}
+	runningJobsMutex.Unlock()
+
+	if !ok {
+		return nil, false, nil
+	}
+
+	killProcessTree(running.cmd)
+	<-running.done
+
+	job, err := getCommandJob(id)
+	return job, true, err
+}
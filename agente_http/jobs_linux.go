@@ -0,0 +1,52 @@
+//go:build linux
+
+package main
+
+import (
+	"os/exec"
+	"syscall"
+	"unicode/utf8"
+)
+
+// buildJobCommand monta o processo de um job ("ps" para o PowerShell, se instalado, e sh para os demais)
+// O processo é iniciado em um novo grupo para que a árvore inteira possa ser encerrada
+func buildJobCommand(tipo, comando string) *exec.Cmd {
+	var cmd *exec.Cmd
+	if tipo == "ps" {
+		cmd = exec.Command("pwsh", "-Command", comando)
+	} else {
+		cmd = exec.Command("sh", "-c", comando)
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	return cmd
+}
+
+// killProcessTree encerra o grupo de processos do job (o processo principal e todos os seus filhos)
+func killProcessTree(cmd *exec.Cmd) {
+	if cmd.Process == nil {
+		return
+	}
+
+	if err := syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL); err != nil {
+		cmd.Process.Kill()
+	}
+}
+
+// decodeCommandOutput converte a saída do comando para texto (no Linux a saída já está em UTF-8)
+func decodeCommandOutput(output []byte) string {
+	return string(output)
+}
+
+// decodableOutputLength retorna quantos bytes da saída podem ser enviados sem cortar um caractere UTF-8 ao meio
+func decodableOutputLength(output []byte) int {
+	// Recuar até o início do último caractere e verificar se ele está completo
+	for i := len(output) - 1; i >= 0 && i >= len(output)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(output[i]) {
+			if utf8.FullRune(output[i:]) {
+				return len(output)
+			}
+			return i
+		}
+	}
+	return len(output)
+}
@@ -0,0 +1,65 @@
+//go:build windows
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/transform"
+)
+
+// buildJobCommand monta o processo de um job ("ps" para PowerShell, qualquer outro valor para o CMD)
+func buildJobCommand(tipo, comando string) *exec.Cmd {
+	if tipo == "ps" {
+		// Comando PowerShell
+		return exec.Command("powershell", "-Command", comando)
+	}
+	// Comando CMD (padrão)
+	return exec.Command("cmd", "/c", comando)
+}
+
+// killProcessTree encerra o processo do job e todos os seus filhos
+func killProcessTree(cmd *exec.Cmd) {
+	if cmd.Process == nil {
+		return
+	}
+
+	// O taskkill com /T encerra a árvore inteira; o Kill garante o processo principal se o taskkill falhar
+	err := exec.Command("taskkill", "/T", "/F", "/PID", fmt.Sprintf("%d", cmd.Process.Pid)).Run()
+	if err != nil {
+		cmd.Process.Kill()
+	}
+}
+
+// decodeCommandOutput converte a saída do CMD/PowerShell para UTF-8
+func decodeCommandOutput(output []byte) string {
+	if len(output) == 0 {
+		return ""
+	}
+
+	// Primeiro tentar com CP850 (geralmente usado em CMD do Windows em português)
+	reader := transform.NewReader(bytes.NewReader(output), charmap.CodePage850.NewDecoder())
+	decoded, err := io.ReadAll(reader)
+	if err == nil {
+		return string(decoded)
+	}
+
+	// Se falhar, tentar com Windows-1252
+	reader = transform.NewReader(bytes.NewReader(output), charmap.Windows1252.NewDecoder())
+	decoded, err = io.ReadAll(reader)
+	if err == nil {
+		return string(decoded)
+	}
+
+	return string(output)
+}
+
+// decodableOutputLength retorna quantos bytes da saída podem ser enviados de uma vez
+// (no CP850 cada byte é um caractere, então qualquer corte é válido)
+func decodableOutputLength(output []byte) int {
+	return len(output)
+}
@@ -2,8 +2,10 @@ package main
 
 import (
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
+	"strconv"
 	"time"
 )
 
@@ -12,7 +14,7 @@ var (
 	cachedSystemInfo    SystemInfo
 	lastUpdateTime      time.Time
 	lastUpdateCheckTime time.Time
-	updateServerURL     string // Servidor de atualização - será carregado do banco de dados
+	updateServerURL     string // Servidor de atualização - carregado da configuração (config.go)
 
 	// Adicionar variáveis para controlar os intervalos
 	systemInfoUpdateIntervalMinutes int
@@ -24,10 +26,18 @@ var (
 )
 
 func main() {
-	port := 9999
+	// Carregar a configuração das flags, variáveis de ambiente e do arquivo agente.json
+	err := loadConfig(os.Args[1:])
+	if err != nil {
+		fmt.Printf("[main] Erro ao carregar configuração: %v\n", err)
+		os.Exit(2)
+	}
+
+	port := configInt("porta")
+	bindAddress := configString("endereco")
 
 	// Verificar se a porta já está em uso (outra instância do agente já está rodando)
-	if isPortInUse(port) {
+	if isPortInUse(bindAddress, port) {
 		fmt.Printf("[main] A porta %d já está em uso. Outra instância do agente já está em execução.\n", port)
 		fmt.Println("[main] Encerrando esta instância...")
 		return
@@ -39,65 +49,80 @@ func main() {
 	systemInfoIntervalChanged = make(chan bool, 1)
 	updateCheckIntervalChanged = make(chan bool, 1)
 
-	// Inicializar o banco de dados SQLite
-	err := initDatabase()
+	// Inicializar o banco de dados SQLite (por padrão ao lado do executável, não no diretório de trabalho)
+	dbPath := agentDatabasePath()
+	err = initDatabase(dbPath)
 	if err != nil {
 		fmt.Printf("[main] Erro ao inicializar banco de dados: %v\n", err)
 		return
 	}
 	defer closeDatabase()
+	healthDatabaseReady.Store(true)
+	fmt.Printf("[main] Banco de dados: %s\n", dbPath)
 
-	// Verificar se há um arquivo version.txt na pasta do executável
-	// e atualizar a versão no banco de dados se necessário
-	updateVersionFromFile()
-
-	// Carregar o IP do servidor de atualização do banco de dados
-	serverIP, err := getUpdateServerIP()
+	// Carregar o identificador persistente do agente
+	agentUUID, err = getAgentUUID()
 	if err != nil {
-		fmt.Printf("[main] Erro ao obter IP do servidor de atualização: %v\n", err)
-		fmt.Println("[main] Usando IP de atualização padrão")
-		// Definir o valor padrão
-		updateServerURL = "http://10.46.102.245:9991"
+		fmt.Printf("[main] Erro ao carregar identificador do agente: %v\n", err)
+		return
+	}
+	fmt.Printf("[main] Identificador do agente: %s\n", agentUUID)
 
-		// Tentar salvar o valor padrão no banco de dados para uso futuro
-		err = updateServerIP(updateServerURL)
-		if err != nil {
-			fmt.Printf("[main] Erro ao salvar IP padrão no banco de dados: %v\n", err)
-		} else {
-			fmt.Println("[main] IP padrão salvo no banco de dados com sucesso")
-		}
-	} else {
-		updateServerURL = serverIP
-		fmt.Printf("[main] Usando servidor de atualização: %s\n", updateServerURL)
+	// Carregar (ou gerar no primeiro início) o par de chaves próprio do agente, usado para assinar as respostas
+	if err := loadAgentSigningKey(); err != nil {
+		fmt.Printf("[main] Erro ao carregar chave do agente: %v\n", err)
+		return
 	}
 
-	// Obter os intervalos de atualização configurados
-	systemInfoUpdateIntervalMinutes, err = getSystemInfoUpdateInterval()
-	if err != nil {
-		fmt.Printf("[main] Erro ao obter intervalo de atualização de informações: %v\n", err)
-		fmt.Println("[main] Usando intervalo padrão de 10 minutos")
-		systemInfoUpdateIntervalMinutes = 10
+	// Carregar as chaves confiáveis (na primeira vez, importadas de public_key.pem)
+	if err := loadTrustedKeys(); err != nil {
+		fmt.Printf("[main] AVISO: %v\n", err)
+		fmt.Println("[main] Por favor, gere as chaves usando o script generate_keys.go")
 	} else {
-		fmt.Printf("[main] Intervalo de atualização de informações: %d minutos\n", systemInfoUpdateIntervalMinutes)
+		fmt.Printf("[main] Chaves confiáveis: %s\n", trustedKeysSummary())
+	}
+
+	// Carregar a situação da inscrição no servidor de coleta
+	if err := loadEnrollmentStatus(); err != nil {
+		fmt.Printf("[main] Erro ao carregar situação da inscrição: %v\n", err)
 	}
 
-	updateCheckIntervalMinutes, err = getUpdateCheckInterval()
+	// Aplicar os valores alterados remotamente, guardados no banco
+	err = loadConfigFromDB()
 	if err != nil {
-		fmt.Printf("[main] Erro ao obter intervalo de verificação de atualizações: %v\n", err)
-		fmt.Println("[main] Usando intervalo padrão de 10 minutos")
-		updateCheckIntervalMinutes = 10
+		fmt.Printf("[main] Erro ao carregar configuração do banco de dados: %v\n", err)
+	}
+
+	// Verificar se há um arquivo version.txt na pasta do executável
+	// e atualizar a versão no banco de dados se necessário
+	updateVersionFromFile()
+
+	// Carregar o servidor de atualização, o servidor de coleta e os intervalos da configuração efetiva
+	updateServerURL = configString("servidor_atualizacao")
+	fmt.Printf("[main] Usando servidor de atualização: %s\n", updateServerURL)
+
+	// Servidor de coleta vazio: envio de snapshots desativado
+	ingestServerURL = configString("servidor_coleta")
+	if ingestServerURL != "" {
+		fmt.Printf("[main] Enviando snapshots para o servidor de coleta: %s\n", ingestServerURL)
 	} else {
-		fmt.Printf("[main] ntervalo de verificação de atualizações: %d minutos\n", updateCheckIntervalMinutes)
+		fmt.Println("[main] Servidor de coleta não configurado. Aguardando consultas do servidor.")
 	}
 
+	systemInfoUpdateIntervalMinutes = configInt("system_info_update_interval")
+	fmt.Printf("[main] Intervalo de atualização de informações: %d minutos\n", systemInfoUpdateIntervalMinutes)
+
+	updateCheckIntervalMinutes = configInt("update_check_interval")
+	fmt.Printf("[main] Intervalo de verificação de atualizações: %d minutos\n", updateCheckIntervalMinutes)
+
 	// Verificar atualizações
 	fmt.Println("[main] Verificando atualizações disponíveis...")
-	updateAvailable, latestVersion, err := checkForUpdates()
+	updateAvailable, manifest, err := checkForUpdates()
 	if err != nil {
 		fmt.Printf("[main] Aviso: Não foi possível verificar atualizações: %v\n", err)
 	} else if updateAvailable {
-		fmt.Printf("[main] Nova versão disponível: %s. Baixando atualização...\n", latestVersion)
-		err = downloadAndUpdate(latestVersion, true) // Passar true para indicar que é verificação inicial
+		fmt.Printf("[main] Nova versão disponível: %s. Baixando atualização...\n", manifest.Versao)
+		err = downloadAndUpdate(manifest, true) // Passar true para indicar que é verificação inicial
 		if err != nil {
 			fmt.Printf("[main] Erro ao baixar atualização: %v\n", err)
 		} else {
@@ -149,8 +174,14 @@ func main() {
 	}
 
 	lastUpdateTime = time.Now()
+	healthCollectionDone.Store(true)
 	fmt.Println("[main] Informações do sistema atualizadas e armazenadas em cache.")
 
+	// Avisar o servidor de coleta que o agente foi iniciado
+	if version, err := getCurrentVersion(); err == nil {
+		enqueueEvent(eventAgentStarted, map[string]string{"versao": version})
+	}
+
 	// Obter endereço IPv4 da máquina
 	ipv4, err := getLocalIPv4()
 	if err != nil {
@@ -161,14 +192,7 @@ func main() {
 	}
 
 	// Verificando se o diretório de chaves existe
-	exePath, err := os.Executable()
-	if err != nil {
-		fmt.Printf("[main] Erro ao obter caminho do executável: %v\n", err)
-		return
-	}
-
-	exeDir := filepath.Dir(exePath)
-	keysDir := filepath.Join(exeDir, "keys")
+	keysDir := agentKeysDir()
 	if _, err := os.Stat(keysDir); os.IsNotExist(err) {
 		err = os.MkdirAll(keysDir, 0700)
 		if err != nil {
@@ -189,21 +213,14 @@ func main() {
 		}
 	}
 
-	// Verificando se a chave pública existe
-	publicKeyPath := filepath.Join(keysDir, "public_key.pem")
-	if _, err := os.Stat(publicKeyPath); os.IsNotExist(err) {
-		fmt.Printf("[main] AVISO: Chave pública não encontrada em %s\n", publicKeyPath)
-		fmt.Println("[main] Por favor, gere as chaves usando o script generate_keys.go")
-	} else {
-		fmt.Printf("[main] Chave pública carregada de: %s\n", publicKeyPath)
-	}
-
 	// Iniciar goroutines para gerenciar atualizações periódicas
 	go manageSystemInfoUpdates()
 	go manageUpdateChecks()
+	go manageSnapshotPush()
+	go startPeerDiscoveryListener()
 
 	// Inicializar o servidor HTTP
-	initHTTPServer(port) // Change to use server package
+	initHTTPServer(net.JoinHostPort(bindAddress, strconv.Itoa(port))) // Change to use server package
 
 	// Aguardar sinal para encerrar o programa
 	waitForShutdown()
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Limites padrão da fila de envio ao servidor de coleta (configuração queue_max_bytes e queue_max_age_days)
+const (
+	defaultQueueMaxBytes   = 10 * 1024 * 1024
+	defaultQueueMaxAgeDays = 7
+)
+
+// Tipos de item da fila de envio
+const (
+	outboundSnapshot = "snapshot"
+	outboundEvent    = "evento"
+)
+
+// Tipos de evento enviados ao servidor de coleta
+const (
+	eventAgentStarted     = "agente_iniciado"
+	eventJobFinished      = "job_finalizado"
+	eventUpdateRolledBack = "atualizacao_desfeita"
+)
+
+// OutboundItem é um snapshot ou evento aguardando entrega ao servidor de coleta
+// Payload é o JSON comprimido com gzip; a criptografia é feita no momento do envio
+type OutboundItem struct {
+	ID         int64
+	Tipo       string
+	Payload    []byte
+	ETag       string
+	CriadoEm   time.Time
+	Tentativas int
+}
+
+// AgentEvent é um evento do agente entregue ao servidor de coleta pela fila de envio
+type AgentEvent struct {
+	Tipo       string      `json:"tipo"`
+	AgenteID   string      `json:"agente_id"`
+	OcorridoEm string      `json:"ocorrido_em"`
+	Dados      interface{} `json:"dados,omitempty"`
+}
+
+// enqueueSnapshot adiciona um snapshot coletado à fila de envio, se o envio estiver ativado
+// Snapshots iguais ao último enfileirado (ou, com a fila vazia, ao último entregue) não são repetidos:
+// nesse caso o agente envia apenas um check-in
+func enqueueSnapshot(infoJSON []byte, etag string, collectedAt time.Time) error {
+	if ingestServerURL == "" {
+		return nil
+	}
+
+	lastETag, err := getLastQueuedSnapshotETag()
+	if err != nil {
+		return err
+	}
+	if lastETag == "" {
+		lastETag, err = getLastDeliveredETag()
+		if err != nil {
+			return err
+		}
+	}
+	if lastETag == etag {
+		return nil
+	}
+
+	payload, err := gzipData(infoJSON)
+	if err != nil {
+		return err
+	}
+	return insertOutboundItem(outboundSnapshot, payload, etag, collectedAt)
+}
+
+// enqueueCurrentSnapshot adiciona o snapshot atual à fila, mesmo que já tenha sido entregue
+// (usado quando o servidor de coleta não o conhece)
+func enqueueCurrentSnapshot() error {
+	var infoJSON string
+	err := db.QueryRow("SELECT info FROM system_info WHERE id = 1").Scan(&infoJSON)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("nenhum snapshot coletado")
+	}
+	if err != nil {
+		return fmt.Errorf("erro ao obter snapshot atual: %v", err)
+	}
+
+	payload, err := gzipData([]byte(infoJSON))
+	if err != nil {
+		return err
+	}
+	return insertOutboundItem(outboundSnapshot, payload, snapshotETag([]byte(infoJSON)), time.Now())
+}
+
+// enqueueEvent adiciona um evento à fila de envio, se o envio estiver ativado
+// Erros são apenas registrados: a perda de um evento não deve interromper quem o gerou
+func enqueueEvent(tipo string, dados interface{}) {
+	if ingestServerURL == "" {
+		return
+	}
+
+	event := AgentEvent{
+		Tipo:       tipo,
+		AgenteID:   getAgentID(),
+		OcorridoEm: time.Now().Format(time.RFC3339),
+		Dados:      dados,
+	}
+
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		fmt.Printf("[push] Erro ao serializar evento %s: %v\n", tipo, err)
+		return
+	}
+	payload, err := gzipData(eventJSON)
+	if err != nil {
+		fmt.Printf("[push] Erro ao comprimir evento %s: %v\n", tipo, err)
+		return
+	}
+	if err := insertOutboundItem(outboundEvent, payload, "", time.Now()); err != nil {
+		fmt.Printf("[push] Erro ao enfileirar evento %s: %v\n", tipo, err)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Quantidade de processos retornada quando o parâmetro top não é informado
+// (top=0 retorna todos os processos)
+const defaultProcessTop = 50
+
+func init() {
+	mustRegisterCollector(newCollector("processos", collectProcessInfo))
+}
+
+// collectProcessInfo monta o inventário de processos aplicando os parâmetros de consulta:
+//   - nome: filtra pelo nome ou caminho do executável (sem diferenciar maiúsculas)
+//   - usuario: filtra pelo usuário dono do processo
+//   - ordem: memoria (padrão), cpu, pid ou nome
+//   - top: quantidade máxima de processos retornados
+func collectProcessInfo(ctx context.Context) (interface{}, error) {
+	query := collectorQuery(ctx)
+
+	top := defaultProcessTop
+	if value := query.Get("top"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			return nil, fmt.Errorf("%w: top=%s", errInvalidCollectorQuery, value)
+		}
+		top = parsed
+	}
+
+	ordem := strings.ToLower(query.Get("ordem"))
+	if ordem == "" {
+		ordem = "memoria"
+	}
+	if ordem != "memoria" && ordem != "cpu" && ordem != "pid" && ordem != "nome" {
+		return nil, fmt.Errorf("%w: ordem=%s (use memoria, cpu, pid ou nome)", errInvalidCollectorQuery, ordem)
+	}
+
+	processos, err := getProcessListSyscall()
+	if err != nil {
+		return nil, fmt.Errorf("erro ao listar processos: %v", err)
+	}
+	total := len(processos)
+
+	// Aplicar os filtros
+	nomeFiltro := strings.ToLower(query.Get("nome"))
+	usuarioFiltro := strings.ToLower(query.Get("usuario"))
+	filtrados := make([]ProcessInfo, 0, len(processos))
+	for _, p := range processos {
+		if nomeFiltro != "" && !strings.Contains(strings.ToLower(p.Nome), nomeFiltro) &&
+			!strings.Contains(strings.ToLower(p.Caminho), nomeFiltro) {
+			continue
+		}
+		if usuarioFiltro != "" && !strings.Contains(strings.ToLower(p.Usuario), usuarioFiltro) {
+			continue
+		}
+		filtrados = append(filtrados, p)
+	}
+
+	// Ordenar e limitar
+	sort.SliceStable(filtrados, func(i, j int) bool {
+		switch ordem {
+		case "cpu":
+			return filtrados[i].TempoCPUSegundos > filtrados[j].TempoCPUSegundos
+		case "pid":
+			return filtrados[i].PID < filtrados[j].PID
+		case "nome":
+			return strings.ToLower(filtrados[i].Nome) < strings.ToLower(filtrados[j].Nome)
+		default:
+			return filtrados[i].MemoriaBytes > filtrados[j].MemoriaBytes
+		}
+	})
+
+	if top > 0 && len(filtrados) > top {
+		filtrados = filtrados[:top]
+	}
+
+	return map[string]interface{}{
+		"total":     total,
+		"exibidos":  len(filtrados),
+		"ordem":     ordem,
+		"processos": filtrados,
+	}, nil
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Agendamento do envio de snapshots ao servidor de coleta
+const (
+	pushMaxInitialDelay = 60 * time.Second // Atraso aleatório do primeiro envio, para os agentes não enviarem juntos após uma queda de energia
+	pushJitterFraction  = 0.1              // Variação aleatória de até 10% do intervalo entre envios
+	pushMinBackoff      = 30 * time.Second // Espera após a primeira falha; dobra a cada falha seguida, até o intervalo de coleta
+	pushRequestTimeout  = 30 * time.Second
+	maxPushResponseSize = 64 * 1024
+)
+
+// Servidor de coleta (carregado da configuração) e sinal de alteração do endereço
+var (
+	ingestServerURL     string
+	ingestServerChanged = make(chan bool, 1)
+)
+
+// errSnapshotUnknown indica que o servidor não tem o snapshot do check-in e precisa recebê-lo completo
+var errSnapshotUnknown = errors.New("servidor de coleta não possui o snapshot atual")
+
+// manageSnapshotPush entrega periodicamente a fila de envio (snapshots e eventos) ao servidor de coleta,
+// no intervalo de coleta de informações com uma variação aleatória; enquanto o servidor estiver fora do ar,
+// os itens continuam na fila e a entrega é tentada novamente com espera exponencial
+func manageSnapshotPush() {
+	delay := randomDuration(pushMaxInitialDelay)
+	failures := 0
+
+	for {
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ingestServerChanged:
+			// Servidor alterado: entregar em breve a fila e o snapshot atual ao novo endereço
+			timer.Stop()
+			failures = 0
+			delay = randomDuration(pushMaxInitialDelay)
+			continue
+		}
+
+		interval := time.Duration(systemInfoUpdateIntervalMinutes) * time.Minute
+		if ingestServerURL == "" {
+			delay = interval
+			continue
+		}
+
+		if err := deliverOutboundQueue(ingestServerURL); err != nil {
+			failures++
+			delay = pushBackoff(failures, interval)
+			count, size, _ := getOutboundQueueStats()
+			fmt.Printf("[push] Erro ao enviar para %s (falha %d): %v. %d itens (%d bytes) na fila; nova tentativa em %s\n",
+				ingestServerURL, failures, err, count, size, delay.Round(time.Second))
+			continue
+		}
+
+		failures = 0
+		delay = jitteredInterval(interval)
+	}
+}
+
+// deliverOutboundQueue entrega os itens da fila ao servidor de coleta, do mais antigo ao mais recente
+// Com a fila vazia, envia apenas um check-in com o ETag do último snapshot entregue
+func deliverOutboundQueue(serverURL string) error {
+	delivered, err := drainOutboundQueue(serverURL)
+	if err != nil || delivered > 0 {
+		return err
+	}
+
+	lastETag, err := getLastDeliveredETag()
+	if err != nil {
+		return err
+	}
+	if lastETag != "" {
+		err := sendCheckin(serverURL, lastETag)
+		if !errors.Is(err, errSnapshotUnknown) {
+			return err
+		}
+	}
+
+	// O servidor não tem o snapshot atual (primeiro envio, servidor alterado ou banco recriado): enviá-lo completo
+	if err := enqueueCurrentSnapshot(); err != nil {
+		return err
+	}
+	_, err = drainOutboundQueue(serverURL)
+	return err
+}
+
+// drainOutboundQueue entrega os itens em ordem até a fila esvaziar ou uma entrega falhar
+// Itens recusados pelo servidor (4xx) são descartados, para não bloquear a fila
+func drainOutboundQueue(serverURL string) (int, error) {
+	delivered := 0
+	for {
+		item, err := getNextOutboundItem()
+		if err != nil {
+			return delivered, err
+		}
+		if item == nil {
+			break
+		}
+
+		status, err := deliverOutboundItem(serverURL, item)
+		if err != nil {
+			if status >= 400 && status < 500 && status != http.StatusRequestTimeout && status != http.StatusTooManyRequests {
+				fmt.Printf("[push] Item %d (%s) recusado pelo servidor e descartado: %v\n", item.ID, item.Tipo, err)
+				if err := deleteOutboundItem(item.ID); err != nil {
+					return delivered, err
+				}
+				continue
+			}
+			if err := recordOutboundAttempt(item.ID); err != nil {
+				fmt.Printf("[push] %v\n", err)
+			}
+			return delivered, err
+		}
+
+		if err := deleteOutboundItem(item.ID); err != nil {
+			return delivered, err
+		}
+		if item.Tipo == outboundSnapshot {
+			if err := setLastDeliveredETag(item.ETag); err != nil {
+				return delivered, err
+			}
+		}
+		delivered++
+	}
+
+	if delivered > 0 {
+		fmt.Printf("[push] %d itens entregues para %s\n", delivered, serverURL)
+	}
+	return delivered, nil
+}
+
+// sendCheckin informa ao servidor que o agente continua ativo e com o mesmo snapshot
+func sendCheckin(serverURL, etag string) error {
+	req, err := http.NewRequest(http.MethodPost, strings.TrimRight(serverURL, "/")+"/agent/checkin", nil)
+	if err != nil {
+		return fmt.Errorf("erro ao criar requisição: %v", err)
+	}
+	req.Header.Set("If-Match", etag)
+	setAgentIdentityHeaders(req.Header)
+	if err := setAgentPushSignature(req, etag, nil); err != nil {
+		return err
+	}
+
+	status, err := doPushRequest(req)
+	if err != nil {
+		return err
+	}
+
+	if status == http.StatusPreconditionFailed {
+		return errSnapshotUnknown
+	}
+	return nil
+}
+
+// deliverOutboundItem envia um item da fila, criptografado no formato híbrido, e retorna o código de status
+// Snapshots vão para /agent/snapshot (com o ETag no cabeçalho) e eventos para /agent/event
+func deliverOutboundItem(serverURL string, item *OutboundItem) (int, error) {
+	publicKey, err := loadAgentPublicKey()
+	if err != nil {
+		return 0, fmt.Errorf("erro ao carregar chave pública: %v", err)
+	}
+	encryptedData, err := encryptHybrid(publicKey, item.Payload)
+	if err != nil {
+		return 0, err
+	}
+
+	path := "/agent/event"
+	if item.Tipo == outboundSnapshot {
+		path = "/agent/snapshot"
+	}
+
+	req, err := http.NewRequest(http.MethodPost, strings.TrimRight(serverURL, "/")+path, bytes.NewBufferString(encryptedData))
+	if err != nil {
+		return 0, fmt.Errorf("erro ao criar requisição: %v", err)
+	}
+	req.Header.Set("Content-Type", "text/plain")
+	req.Header.Set(encryptionHeader, encryptionFormatHybrid)
+	req.Header.Set(payloadEncodingHeader, "gzip")
+	if item.ETag != "" {
+		req.Header.Set("ETag", item.ETag)
+	}
+	setAgentIdentityHeaders(req.Header)
+	if err := setAgentPushSignature(req, item.ETag, []byte(encryptedData)); err != nil {
+		return 0, err
+	}
+
+	return doPushRequest(req)
+}
+
+// doPushRequest executa a requisição ao servidor de coleta e retorna o código de status
+// Respostas 2xx e 412 (snapshot desconhecido no check-in) não são consideradas erro
+func doPushRequest(req *http.Request) (int, error) {
+	client := &http.Client{
+		Timeout: pushRequestTimeout,
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("erro ao conectar ao servidor de coleta: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// Situação da inscrição do agente (informada pelo servidor na resposta aos snapshots)
+	recordEnrollmentStatus(resp.Header.Get(enrollmentHeader))
+
+	if resp.StatusCode/100 == 2 || resp.StatusCode == http.StatusPreconditionFailed {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, maxPushResponseSize))
+		return resp.StatusCode, nil
+	}
+
+	bodyBytes, _ := io.ReadAll(io.LimitReader(resp.Body, maxPushResponseSize))
+	return resp.StatusCode, fmt.Errorf("servidor de coleta retornou código %d: %s", resp.StatusCode, strings.TrimSpace(string(bodyBytes)))
+}
+
+// jitteredInterval retorna o intervalo com uma variação aleatória de até pushJitterFraction para mais ou para menos
+func jitteredInterval(interval time.Duration) time.Duration {
+	jitter := time.Duration(float64(interval) * pushJitterFraction)
+	return interval - jitter + randomDuration(2*jitter)
+}
+
+// pushBackoff calcula a espera após falhas seguidas: dobra a partir de pushMinBackoff, limitada ao intervalo,
+// e sorteia entre a metade e o valor cheio para que os agentes não tentem novamente ao mesmo tempo
+func pushBackoff(failures int, interval time.Duration) time.Duration {
+	backoff := pushMinBackoff
+	for i := 1; i < failures && backoff < interval; i++ {
+		backoff *= 2
+	}
+	if backoff > interval {
+		backoff = interval
+	}
+	return backoff/2 + randomDuration(backoff/2)
+}
+
+// randomDuration sorteia uma duração entre zero e max
+func randomDuration(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(max) + 1))
+}
+
+// updateIngestServerHandler altera o servidor de coleta para onde o agente envia os snapshots
+// Um endereço vazio desativa o envio (o agente continua disponível para a varredura do servidor)
+// Mantido para versões antigas do commander: a alteração equivale a PATCH /config com servidor_coleta
+func updateIngestServerHandler(w http.ResponseWriter, r *http.Request) {
+	// Estrutura para deserializar o payload do envelope assinado
+	type UpdateRequest struct {
+		URL string `json:"url_servidor"`
+	}
+
+	var request UpdateRequest
+	if !readSignedPayload(w, r, &request) {
+		return
+	}
+
+	request.URL = strings.TrimSpace(request.URL)
+
+	// Gravar no banco de dados e aplicar (recusado se o valor foi fixado por flag ou variável de ambiente)
+	_, _, err := applyRemoteConfig(map[string]string{"servidor_coleta": request.URL}, nil)
+	if err != nil {
+		fmt.Printf("Erro ao atualizar servidor de coleta: %v\n", err)
+		http.Error(w, err.Error(), remoteConfigErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	if request.URL == "" {
+		fmt.Fprint(w, "Envio de snapshots desativado")
+		return
+	}
+	fmt.Fprintf(w, "Servidor de coleta alterado para: %s", request.URL)
+}
@@ -1,98 +1,37 @@
 package main
 
 import (
-	"bytes"
-	"crypto"
-	"crypto/rsa"
-	"crypto/sha256"
-	"encoding/base64"
-	"encoding/binary"
-	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
-	"os"
-	"os/exec"
-	"path/filepath"
-	"strings"
+	"strconv"
+	"time"
+)
 
-	"golang.org/x/text/encoding/charmap"
-	"golang.org/x/text/transform"
+// Tempo padrão e máximo que as requisições aguardam o término de um job antes de responder
+const (
+	defaultJobWaitSeconds = 15
+	maxJobWaitSeconds     = 60
 )
 
 // CommandPayload representa o payload para execução de comandos
 type CommandPayload struct {
-	Command string `json:"comando"`
-	Type    string `json:"tipo"`  // "cmd" ou "ps" para PowerShell
+	Command        string `json:"comando"`
+	Type           string `json:"tipo"`                        // "cmd" ou "ps" para PowerShell
+	TimeoutSeconds int    `json:"timeout_segundos,omitempty"`  // Tempo máximo de execução (padrão 300)
+	WaitSeconds    *int   `json:"aguardar_segundos,omitempty"` // Tempo de espera pelo resultado (padrão 15, 0 para não aguardar)
 }
 
-// CommandResult representa o resultado da execução do comando
-type CommandResult struct {
-	Output   string `json:"saida"`
-	ExitCode int    `json:"codigo_saida"`
-	Error    string `json:"erro,omitempty"`
+// JobCancelPayload representa o payload para cancelamento de um job
+type JobCancelPayload struct {
+	JobID string `json:"job_id"`
 }
 
-// commandHandler processa requisições para executar comandos no sistema
+// commandHandler inicia um job de comando e aguarda o resultado por alguns segundos
+// Se o comando não terminar a tempo, a resposta traz o job em execução e o resultado pode ser consultado em /jobs/status
 func commandHandler(w http.ResponseWriter, r *http.Request) {
-	// Verificar se o método é POST
-	if r.Method != http.MethodPost {
-		http.Error(w, "Método não permitido", http.StatusMethodNotAllowed)
-		return
-	}
-
-	// Ler o corpo da requisição
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Erro ao ler corpo da requisição: %v", err), http.StatusBadRequest)
-		return
-	}
-	defer r.Body.Close()
-
-	// Verificar se os dados estão criptografados
+	// Ler e validar o envelope assinado com o comando
 	var payload CommandPayload
-	var decryptedData []byte
-
-	// Tentar descriptografar os dados se estiverem em formato base64
-	if _, err := base64.StdEncoding.DecodeString(string(body)); err == nil {
-		// Obter o diretório do executável
-		exePath, err := os.Executable()
-		if err != nil {
-			errMsg := fmt.Sprintf("Erro ao obter caminho do executável: %v", err)
-			fmt.Println(errMsg)
-			http.Error(w, errMsg, http.StatusInternalServerError)
-			return
-		}
-
-		exeDir := filepath.Dir(exePath)
-		keysDir := filepath.Join(exeDir, "keys")
-		publicKeyPath := filepath.Join(keysDir, "public_key.pem")
-
-		// Verificar se a chave pública existe
-		if _, err := os.Stat(publicKeyPath); os.IsNotExist(err) {
-			errMsg := fmt.Sprintf("Chave pública não encontrada em %s", publicKeyPath)
-			fmt.Println(errMsg)
-			http.Error(w, errMsg, http.StatusInternalServerError)
-			return
-		}
-
-		// Verificar assinatura e extrair dados originais
-		decryptedData, err = verifySignatureAndExtractData(string(body))
-		if err != nil {
-			errMsg := fmt.Sprintf("Erro ao verificar assinatura: %v", err)
-			fmt.Println(errMsg)
-			http.Error(w, errMsg, http.StatusBadRequest)
-			return
-		}
-	} else {
-		// Se não estiver criptografado, usar os dados brutos
-		decryptedData = body
-	}
-
-	// Deserializar o payload JSON
-	err = json.Unmarshal(decryptedData, &payload)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Erro ao deserializar payload: %v", err), http.StatusBadRequest)
+	if !readSignedPayload(w, r, &payload) {
 		return
 	}
 
@@ -102,186 +41,128 @@ func commandHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Executar o comando
-	var cmd *exec.Cmd
-	if payload.Type == "ps" {
-		// Comando PowerShell
-		cmd = exec.Command("powershell", "-Command", payload.Command)
-	} else {
-		// Comando CMD (padrão)
-		cmd = exec.Command("cmd", "/c", payload.Command)
-	}
-
-	// Capturar saída e erro
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-
-	// Executar o comando
-	err = cmd.Run()
-
-	// Converter a saída para UTF-8 corretamente
-	stdoutStr := stdout.String()
-	stderrStr := stderr.String()
-
-	// Tentar diferentes codificações para encontrar a que funciona melhor
-	if stdoutStr != "" {
-		// Primeiro tentar com CP850 (geralmente usado em CMD do Windows em português)
-		reader := transform.NewReader(strings.NewReader(stdoutStr), charmap.CodePage850.NewDecoder())
-		stdoutBytes, err := io.ReadAll(reader)
-		if err == nil {
-			stdoutStr = string(stdoutBytes)
-		} else {
-			// Se falhar, tentar com Windows-1252
-			reader = transform.NewReader(strings.NewReader(stdoutStr), charmap.Windows1252.NewDecoder())
-			stdoutBytes, err = io.ReadAll(reader)
-			if err == nil {
-				stdoutStr = string(stdoutBytes)
-			}
-		}
-	}
-
-	if stderrStr != "" {
-		// Primeiro tentar com CP850
-		reader := transform.NewReader(strings.NewReader(stderrStr), charmap.CodePage850.NewDecoder())
-		stderrBytes, err := io.ReadAll(reader)
-		if err == nil {
-			stderrStr = string(stderrBytes)
-		} else {
-			// Se falhar, tentar com Windows-1252
-			reader = transform.NewReader(strings.NewReader(stderrStr), charmap.Windows1252.NewDecoder())
-			stderrBytes, err = io.ReadAll(reader)
-			if err == nil {
-				stderrStr = string(stderrBytes)
-			}
-		}
+	waitSeconds := defaultJobWaitSeconds
+	if payload.WaitSeconds != nil {
+		waitSeconds = *payload.WaitSeconds
 	}
-
-	// Preparar o resultado
-	result := CommandResult{
-		Output:   stdoutStr,
-		ExitCode: 0,
-		Error:    stderrStr,
+	if waitSeconds < 0 {
+		waitSeconds = 0
 	}
-
-	// Verificar se houve erro na execução
-	if err != nil {
-		if exitError, ok := err.(*exec.ExitError); ok {
-			result.ExitCode = exitError.ExitCode()
-		} else {
-			result.Error = fmt.Sprintf("%v\n%s", err, stderrStr)
-		}
+	if waitSeconds > maxJobWaitSeconds {
+		waitSeconds = maxJobWaitSeconds
 	}
 
-	// Serializar o resultado para JSON
-	jsonResult, err := json.Marshal(result)
+	// Iniciar o job
+	job, err := startCommandJob(payload.Command, payload.Type, payload.TimeoutSeconds)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Erro ao serializar resultado: %v", err), http.StatusInternalServerError)
+		fmt.Printf("Erro ao iniciar job: %v\n", err)
+		http.Error(w, fmt.Sprintf("Erro ao iniciar job: %v", err), http.StatusInternalServerError)
 		return
 	}
+	fmt.Printf("Job %s iniciado: %s\n", job.ID, payload.Command)
 
-	// Verificar se deve criptografar a resposta
-	if encriptado {
-		// Criptografar os dados
-		encryptedData, err := encryptWithPublicKey(jsonResult)
+	// Aguardar o resultado
+	if job.Status == jobStatusExecutando {
+		current, err := waitCommandJob(job.ID, time.Duration(waitSeconds)*time.Second)
 		if err != nil {
-			errMsg := fmt.Sprintf("Erro ao criptografar dados: %v", err)
-			fmt.Println(errMsg)
-			http.Error(w, errMsg, http.StatusInternalServerError)
-			return
+			fmt.Printf("Erro ao consultar job %s: %v\n", job.ID, err)
+		} else if current != nil {
+			job = current
 		}
-
-		// Definir cabeçalhos e enviar resposta
-		w.Header().Set("Content-Type", "text/plain")
-		w.Write([]byte(encryptedData))
-	} else {
-		// Enviar JSON sem criptografia
-		w.Header().Set("Content-Type", "application/json")
-		w.Write(jsonResult)
 	}
+
+	writeDataResponse(w, r, job)
 }
 
-// verifySignatureAndExtractData verifica a assinatura e extrai os dados originais
-func verifySignatureAndExtractData(encryptedData string) ([]byte, error) {
-	// Decodificar o base64
-	data, err := base64.StdEncoding.DecodeString(encryptedData)
-	if err != nil {
-		return nil, fmt.Errorf("erro ao decodificar base64: %v", err)
+// jobStatusHandler retorna o estado e a saída de um job (?id=<job>&aguardar=<segundos>)
+func jobStatusHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "ID do job não fornecido", http.StatusBadRequest)
+		return
 	}
 
-	// Obter o diretório do executável
-	exePath, err := os.Executable()
-	if err != nil {
-		return nil, fmt.Errorf("erro ao obter caminho do executável: %v", err)
+	// Permitir aguardar o término do job antes de responder
+	waitSeconds, _ := strconv.Atoi(r.URL.Query().Get("aguardar"))
+	if waitSeconds < 0 {
+		waitSeconds = 0
 	}
-
-	exeDir := filepath.Dir(exePath)
-	// Caminho para a chave pública
-	publicKeyPath := filepath.Join(exeDir, "keys", "public_key.pem")
-
-	// Verificar se o arquivo existe
-	if _, err := os.Stat(publicKeyPath); os.IsNotExist(err) {
-		return nil, fmt.Errorf("arquivo de chave pública não encontrado: %s", publicKeyPath)
+	if waitSeconds > maxJobWaitSeconds {
+		waitSeconds = maxJobWaitSeconds
 	}
 
-	// Carregar a chave pública
-	publicKey, err := loadPublicKey(publicKeyPath)
+	job, err := waitCommandJob(id, time.Duration(waitSeconds)*time.Second)
 	if err != nil {
-		return nil, fmt.Errorf("erro ao carregar chave pública: %v", err)
+		http.Error(w, fmt.Sprintf("Erro ao consultar job: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if job == nil {
+		http.Error(w, fmt.Sprintf("Job não encontrado: %s", id), http.StatusNotFound)
+		return
 	}
 
-	// Processar os chunks
-	var originalData []byte
-	i := 0
-
-	for i < len(data) {
-		// Ler o tamanho do chunk
-		if i+4 >= len(data) {
-			return nil, fmt.Errorf("formato inválido: dados truncados")
-		}
-
-		chunkLen := binary.BigEndian.Uint32(data[i : i+4])
-		i += 4
+	writeDataResponse(w, r, job)
+}
 
-		// Verificar o separador
-		if i >= len(data) || data[i] != ':' {
-			return nil, fmt.Errorf("formato inválido: separador não encontrado")
+// jobListHandler lista os jobs mais recentes, sem a saída dos comandos (?limite=<n>)
+func jobListHandler(w http.ResponseWriter, r *http.Request) {
+	limit := 20
+	if value := r.URL.Query().Get("limite"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "Parâmetro limite inválido", http.StatusBadRequest)
+			return
 		}
-		i++
+		limit = parsed
+	}
+	if limit > maxStoredJobs {
+		limit = maxStoredJobs
+	}
 
-		// Ler o chunk original + assinatura
-		if i+int(chunkLen) > len(data) {
-			return nil, fmt.Errorf("formato inválido: chunk truncado")
-		}
+	jobs, err := listCommandJobs(limit)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Erro ao listar jobs: %v", err), http.StatusInternalServerError)
+		return
+	}
 
-		signedChunk := data[i : i+int(chunkLen)]
-		i += int(chunkLen)
+	writeDataResponse(w, r, map[string]interface{}{
+		"jobs": jobs,
+	})
+}
 
-		// Verificar o separador final
-		if i >= len(data) || data[i] != ':' {
-			return nil, fmt.Errorf("formato inválido: separador final não encontrado")
-		}
-		i++
+// jobCancelHandler cancela um job em execução, encerrando a árvore de processos
+func jobCancelHandler(w http.ResponseWriter, r *http.Request) {
+	var payload JobCancelPayload
+	if !readSignedPayload(w, r, &payload) {
+		return
+	}
 
-		// Separar os dados originais da assinatura
-		// A assinatura tem tamanho fixo de 256 bytes para RSA-2048
-		if len(signedChunk) <= 256 {
-			return nil, fmt.Errorf("chunk muito pequeno para conter assinatura")
-		}
+	if payload.JobID == "" {
+		http.Error(w, "ID do job não fornecido", http.StatusBadRequest)
+		return
+	}
 
-		originalChunk := signedChunk[:len(signedChunk)-256]
-		signature := signedChunk[len(signedChunk)-256:]
+	job, cancelled, err := cancelCommandJob(payload.JobID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Erro ao cancelar job: %v", err), http.StatusInternalServerError)
+		return
+	}
 
-		// Verificar a assinatura
-		hashed := sha256.Sum256(originalChunk)
-		err = rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, hashed[:], signature)
+	if !cancelled {
+		// Diferenciar job inexistente de job já finalizado
+		existing, err := getCommandJob(payload.JobID)
 		if err != nil {
-			return nil, fmt.Errorf("assinatura inválida: %v", err)
+			http.Error(w, fmt.Sprintf("Erro ao consultar job: %v", err), http.StatusInternalServerError)
+			return
 		}
-
-		// Adicionar os dados originais ao resultado
-		originalData = append(originalData, originalChunk...)
+		if existing == nil {
+			http.Error(w, fmt.Sprintf("Job não encontrado: %s", payload.JobID), http.StatusNotFound)
+			return
+		}
+		http.Error(w, fmt.Sprintf("Job não está em execução (status: %s)", existing.Status), http.StatusConflict)
+		return
 	}
 
-	return originalData, nil
+	fmt.Printf("Job %s cancelado\n", payload.JobID)
+	writeDataResponse(w, r, job)
 }
@@ -14,8 +14,8 @@ var (
 	mux            *http.ServeMux // Adicionar esta linha para definir o multiplexer
 )
 
-// Inicializa o servidor HTTP
-func initHTTPServer(port int) {
+// Inicializa o servidor HTTP no endereço informado (ex: ":9999" ou "10.0.0.5:9999")
+func initHTTPServer(address string) {
 	// Inicializar o multiplexer
 	mux = http.NewServeMux() // Adicionar esta linha para inicializar o multiplexer
 
@@ -23,8 +23,9 @@ func initHTTPServer(port int) {
 	corsMiddleware := func(next http.HandlerFunc) http.HandlerFunc {
 		return func(w http.ResponseWriter, r *http.Request) {
 			w.Header().Set("Access-Control-Allow-Origin", "*")
-			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PATCH, OPTIONS")
 			w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+			setAgentIdentityHeaders(w.Header())
 
 			if r.Method == "OPTIONS" {
 				w.WriteHeader(http.StatusOK)
@@ -42,19 +43,27 @@ func initHTTPServer(port int) {
 	mux.HandleFunc("/update-server", corsMiddleware(updateServerIPHandler))
 	mux.HandleFunc("/update-system-info-interval", corsMiddleware(updateSystemInfoIntervalHandler))
 	mux.HandleFunc("/update-check-interval", corsMiddleware(updateCheckIntervalHandler))
-	mux.HandleFunc("/cpu", corsMiddleware(cpuHandler))
-	mux.HandleFunc("/discos", corsMiddleware(discosHandler))
-	mux.HandleFunc("/gpu", corsMiddleware(gpuHandler))
-	mux.HandleFunc("/hardware", corsMiddleware(hardwareHandler))
-	mux.HandleFunc("/memoria", corsMiddleware(memoriaHandler))
-	mux.HandleFunc("/rede", corsMiddleware(redeHandler))
-	mux.HandleFunc("/sistema", corsMiddleware(sistemaHandler))
-	mux.HandleFunc("/agente", corsMiddleware(agenteHandler))
+	mux.HandleFunc("/update-ingest-server", corsMiddleware(updateIngestServerHandler))
 	mux.HandleFunc("/execute-command", corsMiddleware(commandHandler))
+	mux.HandleFunc("/jobs", corsMiddleware(jobListHandler))
+	mux.HandleFunc("/jobs/status", corsMiddleware(jobStatusHandler))
+	mux.HandleFunc("/jobs/cancel", corsMiddleware(jobCancelHandler))
+	mux.HandleFunc("/jobs/stream", corsMiddleware(jobStreamHandler))
+	mux.HandleFunc("/history", corsMiddleware(historyHandler))
+	mux.HandleFunc("/changes", corsMiddleware(changesHandler))
+	mux.HandleFunc("/update-history-retention", corsMiddleware(updateHistoryRetentionHandler))
+	mux.HandleFunc("/config", corsMiddleware(configHandler))
+	mux.HandleFunc("/keys", corsMiddleware(keysHandler))
+	mux.HandleFunc("/keys/rotate", corsMiddleware(rotateKeysHandler))
+	mux.HandleFunc("/health", corsMiddleware(healthHandler))
+	mux.HandleFunc(peerUpdatePath, peerUpdateHandler)
+
+	// Registrar um endpoint /<seção> para cada coletor (cpu, discos, gpu, hardware, memoria, rede, sistema, agente...)
+	registerCollectorHandlers(mux, collectors, corsMiddleware)
 
 	// Criar o servidor com configurações personalizadas
 	httpServer = &http.Server{
-		Addr:    fmt.Sprintf(":%d", port),
+		Addr:    address,
 		Handler: mux,
 	}
 
@@ -63,7 +72,7 @@ func initHTTPServer(port int) {
 
 	// Iniciar o servidor em uma goroutine
 	go func() {
-		fmt.Printf("Iniciando servidor HTTP na porta %d em todas as interfaces de rede...\n", port)
+		fmt.Printf("Iniciando servidor HTTP em %s...\n", address)
 		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			fmt.Printf("Erro ao iniciar servidor HTTP: %v\n", err)
 		}
@@ -73,6 +82,13 @@ func initHTTPServer(port int) {
 	}()
 }
 
+// registerCollectorHandlers registra no multiplexer um endpoint para cada coletor do registro
+func registerCollectorHandlers(mux *http.ServeMux, registry *CollectorRegistry, middleware func(http.HandlerFunc) http.HandlerFunc) {
+	for _, c := range registry.Collectors() {
+		mux.HandleFunc("/"+c.Name(), middleware(collectorHandler(c)))
+	}
+}
+
 // Encerra o servidor HTTP graciosamente
 func shutdownHTTPServer() {
 	if httpServer != nil {
@@ -89,6 +105,7 @@ func shutdownHTTPServer() {
 
 		// Aguardar sinal de encerramento
 		<-serverShutdown
+		httpServer = nil
 		fmt.Println("Servidor HTTP encerrado com sucesso")
 	}
 }
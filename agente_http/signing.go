@@ -0,0 +1,181 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cabeçalho com a assinatura Ed25519 do corpo da resposta ou do envio, feita com a chave própria do agente
+const agentSignatureHeader = "X-Agente-Assinatura"
+
+// Cabeçalhos dos envios ao servidor de coleta com o horário de emissão (Unix, em segundos) e um nonce de uso único,
+// cobertos pela assinatura para que um envio capturado não possa ser repetido
+const (
+	agentIssuedAtHeader = "X-Agente-Emitido-Em"
+	agentNonceHeader    = "X-Agente-Nonce"
+)
+
+// Prefixo dos dados assinados nos envios ao servidor de coleta, que os distingue das demais assinaturas do agente
+const agentPushSignaturePrefix = "agente-envio-v1"
+
+// Cabeçalho da requisição com o desafio (nonce) do cliente, incluído na assinatura da resposta para que uma resposta
+// capturada não possa ser apresentada como resposta a outra consulta
+const (
+	agentChallengeHeader = "X-Agente-Desafio"
+	maxChallengeLength   = 128
+)
+
+// Prefixo dos dados assinados nas respostas do agente
+const agentResponseSignaturePrefix = "agente-resposta-v1"
+
+// Arquivo da chave privada do agente, gerada no primeiro início e guardada no diretório de chaves
+// A chave pública é enviada ao servidor de coleta no snapshot e registrada na inscrição
+const agentSigningKeyFile = "agente_ed25519.pem"
+
+// Chave privada do agente (carregada na inicialização)
+var agentSigningKey ed25519.PrivateKey
+
+// loadAgentSigningKey carrega a chave privada do agente, gerando um novo par de chaves se ainda não existir
+func loadAgentSigningKey() error {
+	keysDir := agentKeysDir()
+	keyPath := filepath.Join(keysDir, agentSigningKeyFile)
+
+	pemData, err := os.ReadFile(keyPath)
+	if os.IsNotExist(err) {
+		return createAgentSigningKey(keysDir, keyPath)
+	}
+	if err != nil {
+		return fmt.Errorf("erro ao ler chave do agente: %v", err)
+	}
+
+	block, _ := pem.Decode(pemData)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return fmt.Errorf("falha ao decodificar chave do agente PEM: %s", keyPath)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("falha ao analisar chave do agente: %v", err)
+	}
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return fmt.Errorf("chave do agente não é uma chave Ed25519: %s", keyPath)
+	}
+
+	agentSigningKey = privateKey
+	return nil
+}
+
+// createAgentSigningKey gera o par de chaves do agente e grava a chave privada (legível apenas pelo dono do arquivo)
+func createAgentSigningKey(keysDir, keyPath string) error {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return fmt.Errorf("erro ao gerar chave do agente: %v", err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return fmt.Errorf("erro ao serializar chave do agente: %v", err)
+	}
+
+	if err := os.MkdirAll(keysDir, 0700); err != nil {
+		return fmt.Errorf("erro ao criar diretório de chaves: %v", err)
+	}
+	pemData := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(keyPath, pemData, 0600); err != nil {
+		return fmt.Errorf("erro ao gravar chave do agente: %v", err)
+	}
+
+	agentSigningKey = privateKey
+	fmt.Printf("[chaves] Par de chaves do agente gerado: %s\n", keyPath)
+	return nil
+}
+
+// agentPublicKeyString retorna a chave pública do agente em base64 (vazia se a chave não foi carregada)
+func agentPublicKeyString() string {
+	if agentSigningKey == nil {
+		return ""
+	}
+	return base64.StdEncoding.EncodeToString(agentSigningKey.Public().(ed25519.PublicKey))
+}
+
+// signAgentData assina os dados com a chave do agente e retorna a assinatura em base64
+func signAgentData(data []byte) string {
+	if agentSigningKey == nil {
+		return ""
+	}
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(agentSigningKey, data))
+}
+
+// setAgentSignatureHeader adiciona aos cabeçalhos a assinatura dos dados enviados no corpo
+func setAgentSignatureHeader(header http.Header, data []byte) {
+	if signature := signAgentData(data); signature != "" {
+		header.Set(agentSignatureHeader, signature)
+	}
+}
+
+// requestChallenge retorna o desafio informado pelo cliente na requisição (vazio se ausente ou inválido)
+func requestChallenge(r *http.Request) string {
+	challenge := r.Header.Get(agentChallengeHeader)
+	if len(challenge) > maxChallengeLength {
+		return ""
+	}
+	for _, c := range challenge {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && c != '-' && c != '_' {
+			return ""
+		}
+	}
+	return challenge
+}
+
+// agentResponseSignedData monta os dados assinados de uma resposta: o desafio do cliente, o agente e o conteúdo
+func agentResponseSignedData(challenge, agentID string, data []byte) []byte {
+	signed := []byte(agentResponseSignaturePrefix + "\n" + challenge + "\n" + agentID + "\n")
+	return append(signed, data...)
+}
+
+// signAgentResponse assina o conteúdo da resposta à requisição, com o desafio informado pelo cliente
+func signAgentResponse(r *http.Request, data []byte) string {
+	return signAgentData(agentResponseSignedData(requestChallenge(r), getAgentID(), data))
+}
+
+// setAgentResponseSignature adiciona aos cabeçalhos da resposta a assinatura do conteúdo
+// Respostas 304 são assinadas sobre o ETag, para que o cliente confirme que o agente respondeu
+func setAgentResponseSignature(w http.ResponseWriter, r *http.Request, data []byte) {
+	if signature := signAgentResponse(r, data); signature != "" {
+		w.Header().Set(agentSignatureHeader, signature)
+	}
+}
+
+// agentPushSignedData monta os dados assinados de um envio ao servidor de coleta: o caminho, o agente, o ETag,
+// o horário de emissão, o nonce e o SHA-256 do corpo
+func agentPushSignedData(path, agentID, etag, issuedAt, nonce string, body []byte) []byte {
+	sum := sha256.Sum256(body)
+	return []byte(strings.Join([]string{agentPushSignaturePrefix, path, agentID, etag, issuedAt, nonce, hex.EncodeToString(sum[:])}, "\n"))
+}
+
+// setAgentPushSignature assina o envio ao servidor de coleta com o horário de emissão e um nonce novo
+func setAgentPushSignature(req *http.Request, etag string, body []byte) error {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("erro ao gerar nonce: %v", err)
+	}
+	issuedAt := strconv.FormatInt(time.Now().Unix(), 10)
+	nonceHex := hex.EncodeToString(nonce)
+
+	req.Header.Set(agentIssuedAtHeader, issuedAt)
+	req.Header.Set(agentNonceHeader, nonceHex)
+	setAgentSignatureHeader(req.Header, agentPushSignedData(req.URL.Path, getAgentID(), etag, issuedAt, nonceHex, body))
+	return nil
+}
@@ -57,7 +57,7 @@ func createStartupTask() (bool, error) {
 		"action=allow",
 		fmt.Sprintf("program=%s", exePath),
 		"protocol=TCP",
-		fmt.Sprintf("localport=%d", 9999))
+		fmt.Sprintf("localport=%d", configInt("porta")))
 
 	firewallOutput, err := firewallCmd.CombinedOutput()
 	if err != nil {
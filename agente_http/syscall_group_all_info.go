@@ -1,43 +1,21 @@
 package main
 
 import (
+	"context"
 	"fmt"
 )
 
 // getAllSyscallInfo coleta todas as informações do sistema usando syscalls diretos
 func getAllSyscallInfo() map[string]interface{} {
-	// Inicializar as DLLs do Windows
-	err := initWindowsDLLs()
+	// Inicializar o backend de coleta da plataforma (DLLs no Windows, /proc e /sys no Linux)
+	err := initSyscallBackend()
 	if err != nil {
-		fmt.Printf("Erro ao inicializar DLLs: %v\n", err)
+		fmt.Printf("Erro ao inicializar backend de coleta: %v\n", err)
 		return map[string]interface{}{
-			"erro": fmt.Sprintf("Falha ao inicializar DLLs: %v", err),
+			"erro": fmt.Sprintf("Falha ao inicializar backend de coleta: %v", err),
 		}
 	}
 
-	// Criar o mapa de resultado
-	result := make(map[string]interface{})
-
-	// Coletar informações do sistema
-	result["sistema"] = getSystemInfoSyscall()
-
-	// Coletar informações do CPU
-	result["cpu"] = getCPUInfoSyscall()
-
-	// Coletar informações de Hardware
-	result["hardware"] = getHardwareInfoSyscall()
-
-	// Coletar informações de memória
-	result["memoria"] = getMemoryInfoSyscall()
-
-	// Coletar informações da GPU
-	result["gpu"] = getGPUInfoSyscall()
-
-	// Coletar informações de disco
-	result["disco"] = getDiskInfoSyscall()
-
-	// Coletar informações de rede
-	result["rede"] = getNetworkInfoSyscall()
-
-	return result
+	// Coletar todas as seções registradas
+	return collectors.CollectAll(context.Background())
 }
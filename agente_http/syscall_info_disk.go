@@ -1,3 +1,5 @@
+//go:build windows
+
 package main
 
 import (
@@ -693,7 +695,7 @@ func getDiskInfoSyscall() []map[string]interface{} {
 					continue
 				}
 
-				driveLetter := string('A' + i)
+				driveLetter := string(rune('A' + i))
 				diskToLetter[deviceId] = append(diskToLetter[deviceId], driveLetter+":")
 			}
 
@@ -713,7 +715,7 @@ func getDiskInfoSyscall() []map[string]interface{} {
 			continue
 		}
 
-		driveLetter := string('A' + i)
+		driveLetter := string(rune('A' + i))
 		rootPath := driveLetter + ":\\"
 		rootPathPtr, _ := syscall.UTF16PtrFromString(rootPath)
 
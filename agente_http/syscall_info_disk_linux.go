@@ -0,0 +1,304 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// mountEntry representa uma linha do /proc/self/mounts
+type mountEntry struct {
+	device     string
+	mountPoint string
+	fileSystem string
+}
+
+// Dispositivos de bloco que não correspondem a discos físicos
+var virtualBlockPrefixes = []string{"loop", "ram", "zram", "dm-", "md", "sr", "fd", "nbd"}
+
+// Mantém a mesma interface da versão Windows em syscall_info_disk.go
+// Cada disco físico de /sys/block recebe em "letras" os pontos de montagem das suas partições
+func getDiskInfoSyscall() []map[string]interface{} {
+	discos := make([]map[string]interface{}, 0)
+
+	blockDevices, err := os.ReadDir("/sys/block")
+	if err != nil {
+		disk := make(map[string]interface{})
+		disk["modelo"] = "N/A"
+		disk["nome_amigavel"] = "N/A"
+		disk["numero_serie"] = "N/A"
+		disk["status_operacional"] = "N/A"
+		disk["status_saude"] = "N/A"
+		disk["tipo_barramento"] = "N/A"
+		disk["tipo_midia"] = "N/A"
+		disk["versao_firmware"] = "N/A"
+		disk["letras"] = make([]map[string]interface{}, 0)
+		discos = append(discos, disk)
+		return discos
+	}
+
+	// Coletar os discos físicos
+	diskByName := make(map[string]map[string]interface{})
+	for _, entry := range blockDevices {
+		name := entry.Name()
+		if isVirtualBlockDevice(name) {
+			continue
+		}
+
+		diskInfo := getPhysicalDiskInfo(name)
+		diskByName[name] = diskInfo
+		discos = append(discos, diskInfo)
+	}
+
+	// Rótulos e UUIDs dos sistemas de arquivos, indexados pelo dispositivo real
+	labels := readDiskLinks("/dev/disk/by-label")
+	uuids := readDiskLinks("/dev/disk/by-uuid")
+
+	// Associar cada ponto de montagem aos discos físicos que o contêm
+	allLetters := make([]map[string]interface{}, 0)
+	seenMounts := make(map[string]bool)
+
+	for _, mount := range readMounts() {
+		if !strings.HasPrefix(mount.device, "/dev/") || seenMounts[mount.mountPoint] {
+			continue
+		}
+		seenMounts[mount.mountPoint] = true
+
+		realDevice, err := filepath.EvalSymlinks(mount.device)
+		if err != nil {
+			realDevice = mount.device
+		}
+
+		letterInfo := make(map[string]interface{})
+		letterInfo["letra"] = mount.mountPoint
+		letterInfo["sistema_arquivos"] = mount.fileSystem
+
+		if label, ok := labels[realDevice]; ok {
+			letterInfo["rotulo"] = label
+		} else {
+			letterInfo["rotulo"] = "Sem Rótulo"
+		}
+
+		var stat syscall.Statfs_t
+		if err := syscall.Statfs(mount.mountPoint, &stat); err == nil {
+			letterInfo["tamanho_total"] = stat.Blocks * uint64(stat.Bsize)
+		}
+
+		if uuid, ok := uuids[realDevice]; ok {
+			letterInfo["numero_serie_volume"] = uuid
+		}
+
+		allLetters = append(allLetters, letterInfo)
+
+		for _, parent := range resolveParentDisks(filepath.Base(realDevice), 0) {
+			if diskInfo, ok := diskByName[parent]; ok {
+				diskInfo["letras"] = append(diskInfo["letras"].([]map[string]interface{}), letterInfo)
+			}
+		}
+	}
+
+	// Se não temos discos mapeados (ex: contêineres), criar um disco genérico com todos os pontos de montagem
+	if len(discos) == 0 {
+		diskGenerico := make(map[string]interface{})
+		diskGenerico["modelo"] = "Disco Desconhecido"
+		diskGenerico["letras"] = allLetters
+		discos = append(discos, diskGenerico)
+	}
+
+	return discos
+}
+
+// isVirtualBlockDevice indica se o dispositivo de bloco não é um disco físico
+func isVirtualBlockDevice(name string) bool {
+	for _, prefix := range virtualBlockPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// getPhysicalDiskInfo lê modelo, série, firmware, barramento e estado de um disco de /sys/block
+func getPhysicalDiskInfo(name string) map[string]interface{} {
+	blockDir := filepath.Join("/sys/block", name)
+	deviceDir := filepath.Join(blockDir, "device")
+	udev := readUdevProperties(readSysFile(filepath.Join(blockDir, "dev")))
+
+	diskInfo := make(map[string]interface{})
+
+	// Modelo (o fabricante "ATA" genérico dos discos SATA e IDs PCI como os do virtio são omitidos)
+	modelo := readSysFile(filepath.Join(deviceDir, "model"))
+	if vendor := readSysFile(filepath.Join(deviceDir, "vendor")); vendor != "" && vendor != "ATA" && !strings.HasPrefix(vendor, "0x") {
+		modelo = vendor + " " + modelo
+	}
+	if modelo == "" {
+		modelo = strings.ReplaceAll(udev["ID_MODEL"], "_", " ")
+	}
+	if modelo == "" {
+		modelo = "Disco Desconhecido"
+	}
+	diskInfo["modelo"] = strings.TrimSpace(modelo)
+	diskInfo["nome_amigavel"] = strings.TrimSpace(modelo)
+
+	// Número de série (NVMe expõe no /sys, SATA/SCSI apenas via udev)
+	serial := readSysFile(filepath.Join(deviceDir, "serial"))
+	if serial == "" {
+		serial = udev["ID_SERIAL_SHORT"]
+	}
+	if serial != "" {
+		diskInfo["numero_serie"] = serial
+	}
+
+	// Versão do firmware
+	firmware := readSysFile(filepath.Join(deviceDir, "firmware_rev"))
+	if firmware == "" {
+		firmware = readSysFile(filepath.Join(deviceDir, "rev"))
+	}
+	if firmware == "" {
+		firmware = udev["ID_REVISION"]
+	}
+	if firmware != "" {
+		diskInfo["versao_firmware"] = firmware
+	}
+
+	// Tipo de mídia
+	switch readSysFile(filepath.Join(blockDir, "queue", "rotational")) {
+	case "1":
+		diskInfo["tipo_midia"] = "HDD"
+	case "0":
+		diskInfo["tipo_midia"] = "SSD"
+	}
+
+	// Tipo de barramento a partir do caminho do dispositivo no /sys
+	diskInfo["tipo_barramento"] = getDiskBusType(blockDir, udev["ID_BUS"])
+
+	// Estado operacional ("running" para SCSI/SATA, "live" para NVMe)
+	state := readSysFile(filepath.Join(deviceDir, "state"))
+	switch state {
+	case "running", "live":
+		diskInfo["status_operacional"] = "OK"
+		diskInfo["status_saude"] = "Healthy"
+	case "":
+		diskInfo["status_operacional"] = "Desconhecido"
+	default:
+		diskInfo["status_operacional"] = state
+		diskInfo["status_saude"] = "Unhealthy"
+	}
+
+	// Inicializar array de letras
+	diskInfo["letras"] = make([]map[string]interface{}, 0)
+
+	return diskInfo
+}
+
+// getDiskBusType identifica o barramento do disco no mesmo vocabulário do Get-PhysicalDisk
+func getDiskBusType(blockDir string, udevBus string) string {
+	realPath, err := filepath.EvalSymlinks(blockDir)
+	if err != nil {
+		realPath = blockDir
+	}
+
+	switch {
+	case strings.Contains(realPath, "/nvme"):
+		return "NVMe"
+	case strings.Contains(realPath, "/usb"):
+		return "USB"
+	case strings.Contains(realPath, "/mmc"):
+		return "SD"
+	case strings.Contains(realPath, "/virtio"):
+		return "Virtual"
+	case strings.Contains(realPath, "/ata"):
+		return "SATA"
+	case strings.Contains(realPath, "/host") && strings.Contains(realPath, "/target"):
+		return "SAS"
+	case udevBus != "":
+		return strings.ToUpper(udevBus)
+	}
+
+	return "Desconhecido"
+}
+
+// resolveParentDisks encontra os discos físicos que contêm um dispositivo (partição, LVM, RAID ou o próprio disco)
+func resolveParentDisks(name string, depth int) []string {
+	if depth > 8 {
+		return nil
+	}
+
+	sysPath, err := filepath.EvalSymlinks(filepath.Join("/sys/class/block", name))
+	if err != nil {
+		return nil
+	}
+
+	// Partição: o diretório pai é o disco
+	if _, err := os.Stat(filepath.Join(sysPath, "partition")); err == nil {
+		return resolveParentDisks(filepath.Base(filepath.Dir(sysPath)), depth+1)
+	}
+
+	// Device-mapper e RAID: seguir os dispositivos subjacentes
+	slaves, _ := os.ReadDir(filepath.Join(sysPath, "slaves"))
+	if len(slaves) > 0 {
+		var parents []string
+		for _, slave := range slaves {
+			parents = append(parents, resolveParentDisks(slave.Name(), depth+1)...)
+		}
+		return parents
+	}
+
+	return []string{name}
+}
+
+// readMounts lê os sistemas de arquivos montados
+func readMounts() []mountEntry {
+	var mounts []mountEntry
+
+	file, err := os.Open("/proc/self/mounts")
+	if err != nil {
+		return mounts
+	}
+	defer file.Close()
+
+	// Espaços e caracteres especiais são escapados em octal no /proc/self/mounts
+	unescape := strings.NewReplacer(`\040`, " ", `\011`, "\t", `\012`, "\n", `\134`, `\`)
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 {
+			continue
+		}
+		mounts = append(mounts, mountEntry{
+			device:     unescape.Replace(fields[0]),
+			mountPoint: unescape.Replace(fields[1]),
+			fileSystem: fields[2],
+		})
+	}
+
+	return mounts
+}
+
+// readDiskLinks mapeia o dispositivo real para o nome do link em /dev/disk/by-label ou /dev/disk/by-uuid
+func readDiskLinks(dir string) map[string]string {
+	links := make(map[string]string)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return links
+	}
+
+	// O udev escapa espaços nos nomes dos links como \x20
+	unescape := strings.NewReplacer(`\x20`, " ", `\x2f`, "/")
+
+	for _, entry := range entries {
+		target, err := filepath.EvalSymlinks(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		links[target] = unescape.Replace(entry.Name())
+	}
+
+	return links
+}
@@ -0,0 +1,95 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Fabricantes de GPU mais comuns, usados quando o lspci não está disponível
+var gpuVendorNames = map[string]string{
+	"0x10de": "NVIDIA",
+	"0x1002": "AMD",
+	"0x8086": "Intel",
+	"0x1af4": "Red Hat (virtio)",
+	"0x15ad": "VMware",
+	"0x1234": "QEMU",
+	"0x80ee": "VirtualBox",
+}
+
+// Mantém a mesma interface da versão Windows em syscall_info_gpu.go
+func getGPUInfoSyscall() map[string]interface{} {
+	info := make(map[string]interface{})
+	gpus := make([]map[string]interface{}, 0)
+
+	// Cada placa de vídeo aparece como /sys/class/drm/cardN (conectores são cardN-HDMI-A-1 etc.)
+	cardPattern := regexp.MustCompile(`^card[0-9]+$`)
+	cards, _ := os.ReadDir("/sys/class/drm")
+	seen := make(map[string]bool)
+
+	for _, card := range cards {
+		if !cardPattern.MatchString(card.Name()) {
+			continue
+		}
+
+		deviceDir, err := filepath.EvalSymlinks(filepath.Join("/sys/class/drm", card.Name(), "device"))
+		if err != nil || seen[deviceDir] {
+			continue
+		}
+		seen[deviceDir] = true
+
+		gpu := make(map[string]interface{})
+
+		// Driver do kernel em uso
+		driver := ""
+		if driverLink, err := filepath.EvalSymlinks(filepath.Join(deviceDir, "driver")); err == nil {
+			driver = filepath.Base(driverLink)
+			gpu["driver"] = driver
+		}
+
+		// Nome: preferir a descrição do lspci e cair para fabricante + ID do dispositivo
+		nome := getPCIDescription(filepath.Base(deviceDir))
+		if nome == "" {
+			vendorID := readSysFile(filepath.Join(deviceDir, "vendor"))
+			deviceID := readSysFile(filepath.Join(deviceDir, "device"))
+			if vendorName, ok := gpuVendorNames[vendorID]; ok {
+				nome = strings.TrimSpace(vendorName + " " + deviceID)
+			} else if vendorID != "" {
+				nome = strings.TrimSpace(vendorID + ":" + deviceID)
+			} else {
+				nome = driver
+			}
+		}
+		gpu["nome"] = nome
+
+		// Versão do driver: módulos fora da árvore expõem a própria versão, os demais seguem o kernel
+		driverVersion := ""
+		if driver != "" {
+			driverVersion = readSysFile(filepath.Join("/sys/module", driver, "version"))
+		}
+		if driverVersion == "" {
+			driverVersion = getKernelRelease()
+		}
+		gpu["driver_versao"] = driverVersion
+
+		// Adicionar à lista se tiver um nome válido
+		if nome != "" {
+			gpus = append(gpus, gpu)
+		}
+	}
+
+	// Se não encontrou nenhuma GPU, adicionar uma entrada genérica
+	if len(gpus) == 0 {
+		gpu := make(map[string]interface{})
+		gpu["nome"] = "Adaptador de Vídeo Desconhecido"
+		gpu["driver_versao"] = "Desconhecida"
+		gpus = append(gpus, gpu)
+	}
+
+	info["gpus"] = gpus
+
+	return info
+}
@@ -0,0 +1,119 @@
+//go:build linux
+
+package main
+
+import (
+	"strings"
+)
+
+// Mantém a mesma interface da versão Windows em syscall_info_mem.go
+func getMemoryInfoSyscall() map[string]interface{} {
+	info := make(map[string]interface{})
+
+	// Os valores do /proc/meminfo estão em KB
+	meminfo, err := parseKeyValueFile("/proc/meminfo", ":")
+	if err != nil {
+		info["erro"] = err.Error()
+		return info
+	}
+
+	memTotalKB := parseUint64(strings.TrimSuffix(meminfo["MemTotal"], " kB"))
+	swapTotalKB := parseUint64(strings.TrimSuffix(meminfo["SwapTotal"], " kB"))
+
+	// Informações fixas sobre a memória física
+	info["total"] = memTotalKB
+	info["total_mb"] = float64(memTotalKB) / 1024
+	info["total_gb"] = float64(memTotalKB) / 1024 / 1024
+
+	// Memória virtual total (física + swap)
+	virtualTotalKB := memTotalKB + swapTotalKB
+	info["virtual_total"] = virtualTotalKB
+	info["virtual_total_mb"] = float64(virtualTotalKB) / 1024
+	info["virtual_total_gb"] = float64(virtualTotalKB) / 1024 / 1024
+
+	// A área de swap é o equivalente ao arquivo de paginação
+	info["pagefile_total"] = swapTotalKB
+	info["pagefile_total_mb"] = float64(swapTotalKB) / 1024
+	info["pagefile_total_gb"] = float64(swapTotalKB) / 1024 / 1024
+
+	// Obter informações detalhadas sobre os módulos de memória (requer dmidecode e root)
+	memoryModules := getMemoryModulesInfo()
+	if len(memoryModules) > 0 {
+		info["modulos"] = memoryModules
+
+		// Velocidade e tipo do primeiro módulo, como na versão Windows
+		if speed, ok := memoryModules[0]["velocidade_mhz"].(uint64); ok && speed > 0 {
+			info["velocidade_mhz"] = int(speed)
+		}
+		if memoryType, ok := memoryModules[0]["tipo"].(string); ok && memoryType != "" {
+			info["tipo"] = memoryType
+		}
+	}
+
+	return info
+}
+
+// Obtém informações sobre os módulos de memória instalados a partir da tabela SMBIOS tipo 17
+func getMemoryModulesInfo() []map[string]interface{} {
+	var modules []map[string]interface{}
+
+	output, err := executeCommand("dmidecode", "-t", "17")
+	if err != nil {
+		return modules
+	}
+
+	// Cada módulo é um bloco "Memory Device" com linhas "Chave: valor"
+	for _, block := range strings.Split(output, "Memory Device")[1:] {
+		fields := make(map[string]string)
+		for _, line := range strings.Split(block, "\n") {
+			parts := strings.SplitN(strings.TrimSpace(line), ":", 2)
+			if len(parts) == 2 {
+				fields[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+			}
+		}
+
+		// Ignorar slots vazios
+		capacityBytes := parseDmidecodeSize(fields["Size"])
+		if capacityBytes == 0 {
+			continue
+		}
+
+		module := make(map[string]interface{})
+		module["banco"] = fields["Bank Locator"]
+		module["slot"] = fields["Locator"]
+		module["capacidade_bytes"] = capacityBytes
+		module["capacidade_gb"] = float64(capacityBytes) / 1024 / 1024 / 1024
+		module["velocidade_mhz"] = parseUint64(strings.Fields(fields["Speed"] + " 0")[0])
+		module["numero_peca"] = fields["Part Number"]
+		module["fabricante"] = fields["Manufacturer"]
+		if memoryType := fields["Type"]; memoryType != "" && memoryType != "Unknown" {
+			module["tipo"] = memoryType
+		}
+
+		modules = append(modules, module)
+	}
+
+	return modules
+}
+
+// parseDmidecodeSize converte tamanhos do dmidecode ("8 GB", "8192 MB") para bytes
+func parseDmidecodeSize(size string) uint64 {
+	fields := strings.Fields(size)
+	if len(fields) != 2 {
+		return 0
+	}
+
+	value := parseUint64(fields[0])
+	switch fields[1] {
+	case "kB", "KB":
+		return value * 1024
+	case "MB":
+		return value * 1024 * 1024
+	case "GB":
+		return value * 1024 * 1024 * 1024
+	case "TB":
+		return value * 1024 * 1024 * 1024 * 1024
+	}
+
+	return 0
+}
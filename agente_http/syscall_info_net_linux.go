@@ -0,0 +1,159 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Mantém a mesma interface da versão Windows em syscall_info_net.go
+func getNetworkInfoSyscall() map[string]interface{} {
+	info := make(map[string]interface{})
+
+	// Obter interfaces de rede
+	interfaces, err := net.Interfaces()
+	if err == nil {
+		var networkInterfaces []map[string]interface{}
+
+		for _, iface := range interfaces {
+			// Ignorar interfaces de loopback
+			if iface.Flags&net.FlagLoopback != 0 {
+				continue
+			}
+
+			sysDir := filepath.Join("/sys/class/net", iface.Name)
+
+			netInterface := make(map[string]interface{})
+			netInterface["nome"] = iface.Name
+			netInterface["mac"] = iface.HardwareAddr.String()
+			netInterface["descricao"] = getInterfaceDescription(sysDir)
+			netInterface["status"] = getInterfaceStatus(readSysFile(filepath.Join(sysDir, "operstate")))
+			netInterface["velocidade"] = formatLinkSpeed(readSysFile(filepath.Join(sysDir, "speed")))
+
+			// Obter endereços IP
+			var ipv4 []string
+			var ipv6 []string
+
+			addrs, err := iface.Addrs()
+			if err == nil {
+				for _, addr := range addrs {
+					if ipnet, ok := addr.(*net.IPNet); ok {
+						if ip4 := ipnet.IP.To4(); ip4 != nil {
+							ipv4 = append(ipv4, ip4.String())
+						} else {
+							ipv6 = append(ipv6, ipnet.IP.String())
+						}
+					}
+				}
+			}
+
+			netInterface["ipv4"] = ipv4
+			netInterface["ipv6"] = ipv6
+
+			// Só adicionar interfaces que têm pelo menos um endereço IP
+			if len(ipv4) > 0 || len(ipv6) > 0 {
+				networkInterfaces = append(networkInterfaces, netInterface)
+			}
+		}
+
+		info["interfaces"] = networkInterfaces
+	}
+
+	// Obter servidores DNS do resolv.conf; com o systemd-resolved o arquivo aponta só para o stub local
+	dnsServers := readNameservers("/etc/resolv.conf")
+	if len(dnsServers) == 1 && dnsServers[0] == "127.0.0.53" {
+		if upstream := readNameservers("/run/systemd/resolve/resolv.conf"); len(upstream) > 0 {
+			dnsServers = upstream
+		}
+	}
+	if len(dnsServers) > 0 {
+		info["dns_servers"] = dnsServers
+	}
+
+	return info
+}
+
+// getInterfaceDescription descreve o adaptador de rede (modelo PCI, driver ou interface virtual)
+func getInterfaceDescription(sysDir string) string {
+	deviceDir, err := filepath.EvalSymlinks(filepath.Join(sysDir, "device"))
+	if err != nil {
+		return "Interface virtual"
+	}
+
+	if description := getPCIDescription(filepath.Base(deviceDir)); description != "" {
+		return description
+	}
+
+	if driverLink, err := filepath.EvalSymlinks(filepath.Join(deviceDir, "driver")); err == nil {
+		return filepath.Base(driverLink)
+	}
+
+	return "Não disponível"
+}
+
+// getInterfaceStatus converte o operstate do kernel para os nomes usados pelo Get-NetAdapter
+func getInterfaceStatus(operstate string) string {
+	switch operstate {
+	case "up":
+		return "Up"
+	case "down", "lowerlayerdown":
+		return "Disconnected"
+	case "dormant":
+		return "Dormant"
+	case "notpresent":
+		return "Not Present"
+	case "":
+		return "Desconhecido"
+	}
+
+	// Interfaces sem detecção de portadora (ex: túneis) reportam "unknown" mesmo quando ativas
+	return strings.ToUpper(operstate[:1]) + operstate[1:]
+}
+
+// formatLinkSpeed formata a velocidade em Mbps do /sys no mesmo formato do Get-NetAdapter
+func formatLinkSpeed(speed string) string {
+	mbps, err := strconv.Atoi(speed)
+	if err != nil {
+		return "Desconhecido"
+	}
+
+	switch {
+	case mbps <= 0:
+		return "0 bps"
+	case mbps >= 1000 && mbps%1000 == 0:
+		return fmt.Sprintf("%d Gbps", mbps/1000)
+	case mbps >= 1000:
+		return fmt.Sprintf("%.1f Gbps", float64(mbps)/1000)
+	default:
+		return fmt.Sprintf("%d Mbps", mbps)
+	}
+}
+
+// readNameservers lê as linhas "nameserver" de um arquivo no formato do resolv.conf, sem duplicatas
+func readNameservers(path string) []string {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+
+	uniqueDNS := make(map[string]bool)
+	var dnsServers []string
+
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != "nameserver" {
+			continue
+		}
+		if !uniqueDNS[fields[1]] {
+			uniqueDNS[fields[1]] = true
+			dnsServers = append(dnsServers, fields[1])
+		}
+	}
+
+	return dnsServers
+}
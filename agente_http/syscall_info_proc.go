@@ -0,0 +1,158 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// Constantes para CreateToolhelp32Snapshot e OpenProcess
+const (
+	th32csSnapProcess              = 0x00000002
+	processQueryLimitedInformation = 0x00001000
+	invalidHandleValue             = ^uintptr(0)
+)
+
+// Estrutura PROCESSENTRY32W
+type processEntry32 struct {
+	dwSize              uint32
+	cntUsage            uint32
+	th32ProcessID       uint32
+	th32DefaultHeapID   uintptr
+	th32ModuleID        uint32
+	cntThreads          uint32
+	th32ParentProcessID uint32
+	pcPriClassBase      int32
+	dwFlags             uint32
+	szExeFile           [260]uint16
+}
+
+// Estrutura PROCESS_MEMORY_COUNTERS
+type processMemoryCounters struct {
+	cb                         uint32
+	PageFaultCount             uint32
+	PeakWorkingSetSize         uintptr
+	WorkingSetSize             uintptr
+	QuotaPeakPagedPoolUsage    uintptr
+	QuotaPagedPoolUsage        uintptr
+	QuotaPeakNonPagedPoolUsage uintptr
+	QuotaNonPagedPoolUsage     uintptr
+	PagefileUsage              uintptr
+	PeakPagefileUsage          uintptr
+}
+
+// getProcessListSyscall lista os processos em execução usando o snapshot do Toolhelp32
+func getProcessListSyscall() ([]ProcessInfo, error) {
+	// Inicializar as DLLs e procedimentos
+	err := initWindowsDLLs()
+	if err != nil {
+		return nil, err
+	}
+
+	// Verificar se temos os procedimentos necessários
+	if createToolhelp32SnapshotFn == nil || process32FirstFn == nil || process32NextFn == nil {
+		return nil, fmt.Errorf("funções do Toolhelp32 não encontradas")
+	}
+
+	snapshot, _, err := createToolhelp32SnapshotFn.Call(uintptr(th32csSnapProcess), 0)
+	if snapshot == invalidHandleValue {
+		return nil, fmt.Errorf("erro ao criar snapshot de processos: %v", err)
+	}
+	defer syscall.CloseHandle(syscall.Handle(snapshot))
+
+	var entry processEntry32
+	entry.dwSize = uint32(unsafe.Sizeof(entry))
+
+	ret, _, err := process32FirstFn.Call(snapshot, uintptr(unsafe.Pointer(&entry)))
+	if ret == 0 {
+		return nil, fmt.Errorf("erro ao ler o primeiro processo: %v", err)
+	}
+
+	userNames := make(map[string]string)
+	var processos []ProcessInfo
+
+	for ret != 0 {
+		processo := ProcessInfo{
+			PID:    entry.th32ProcessID,
+			PIDPai: entry.th32ParentProcessID,
+			Nome:   syscall.UTF16ToString(entry.szExeFile[:]),
+		}
+
+		// Processos protegidos (ex: System, csrss) não podem ser abertos sem privilégios elevados
+		if entry.th32ProcessID != 0 {
+			fillProcessDetails(&processo, userNames)
+		}
+
+		processos = append(processos, processo)
+
+		ret, _, _ = process32NextFn.Call(snapshot, uintptr(unsafe.Pointer(&entry)))
+	}
+
+	return processos, nil
+}
+
+// fillProcessDetails completa caminho, memória, tempos e dono de um processo
+func fillProcessDetails(processo *ProcessInfo, userNames map[string]string) {
+	handle, err := syscall.OpenProcess(processQueryLimitedInformation, false, processo.PID)
+	if err != nil {
+		return
+	}
+	defer syscall.CloseHandle(handle)
+
+	// Caminho completo do executável
+	if queryFullProcessImageNameFn != nil {
+		var buffer [1024]uint16
+		size := uint32(len(buffer))
+		ret, _, _ := queryFullProcessImageNameFn.Call(
+			uintptr(handle),
+			0,
+			uintptr(unsafe.Pointer(&buffer[0])),
+			uintptr(unsafe.Pointer(&size)),
+		)
+		if ret != 0 {
+			processo.Caminho = syscall.UTF16ToString(buffer[:size])
+		}
+	}
+
+	// Memória em uso (working set)
+	if getProcessMemoryInfoFn != nil {
+		var counters processMemoryCounters
+		counters.cb = uint32(unsafe.Sizeof(counters))
+		ret, _, _ := getProcessMemoryInfoFn.Call(
+			uintptr(handle),
+			uintptr(unsafe.Pointer(&counters)),
+			uintptr(counters.cb),
+		)
+		if ret != 0 {
+			processo.MemoriaBytes = uint64(counters.WorkingSetSize)
+			processo.MemoriaMB = float64(processo.MemoriaBytes) / 1024 / 1024
+		}
+	}
+
+	// Horário de início e tempo de CPU (kernel + usuário, em unidades de 100ns)
+	var creationTime, exitTime, kernelTime, userTime syscall.Filetime
+	if err := syscall.GetProcessTimes(handle, &creationTime, &exitTime, &kernelTime, &userTime); err == nil {
+		processo.Inicio = time.Unix(0, creationTime.Nanoseconds()).Format(time.RFC3339)
+		kernel := uint64(kernelTime.HighDateTime)<<32 | uint64(kernelTime.LowDateTime)
+		user := uint64(userTime.HighDateTime)<<32 | uint64(userTime.LowDateTime)
+		processo.TempoCPUSegundos = float64(kernel+user) / 1e7
+	}
+
+	// Dono do processo a partir do token de acesso
+	var token syscall.Token
+	if err := syscall.OpenProcessToken(handle, syscall.TOKEN_QUERY, &token); err == nil {
+		defer token.Close()
+		if tokenUser, err := token.GetTokenUser(); err == nil {
+			sid, _ := tokenUser.User.Sid.String()
+			if name, ok := userNames[sid]; ok {
+				processo.Usuario = name
+			} else if account, domain, _, err := tokenUser.User.Sid.LookupAccount(""); err == nil {
+				processo.Usuario = domain + "\\" + account
+				userNames[sid] = processo.Usuario
+			}
+		}
+	}
+}
@@ -0,0 +1,122 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Frequência do relógio usada pelo kernel nos tempos do /proc/<pid>/stat (USER_HZ, 100 em todas as arquiteturas suportadas)
+const clockTicksPerSecond = 100
+
+// Mantém a mesma interface da versão Windows em syscall_info_proc.go
+// Percorre /proc/<pid> e lê o stat, o link exe e o dono de cada processo
+func getProcessListSyscall() ([]ProcessInfo, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+
+	bootTime := getBootTime()
+	pageSize := uint64(os.Getpagesize())
+	userNames := make(map[uint32]string)
+
+	processos := make([]ProcessInfo, 0, len(entries))
+	for _, entry := range entries {
+		pid, err := strconv.ParseUint(entry.Name(), 10, 32)
+		if err != nil {
+			continue
+		}
+
+		procDir := filepath.Join("/proc", entry.Name())
+
+		// O processo pode ter terminado entre a listagem e a leitura
+		stat, err := os.ReadFile(filepath.Join(procDir, "stat"))
+		if err != nil {
+			continue
+		}
+
+		// Formato: pid (comm) estado ppid ...; o comm pode conter espaços e parênteses
+		content := string(stat)
+		start := strings.IndexByte(content, '(')
+		end := strings.LastIndexByte(content, ')')
+		if start < 0 || end < start {
+			continue
+		}
+		fields := strings.Fields(content[end+1:])
+		if len(fields) < 22 {
+			continue
+		}
+
+		processo := ProcessInfo{
+			PID:  uint32(pid),
+			Nome: content[start+1 : end],
+		}
+
+		// Campos contados a partir do estado (campo 3 do stat)
+		ppid, _ := strconv.ParseUint(fields[1], 10, 32)
+		processo.PIDPai = uint32(ppid)
+
+		utime := parseUint64(fields[11])
+		stime := parseUint64(fields[12])
+		processo.TempoCPUSegundos = float64(utime+stime) / clockTicksPerSecond
+
+		if !bootTime.IsZero() {
+			startTicks := parseUint64(fields[19])
+			processo.Inicio = bootTime.Add(time.Duration(startTicks) * time.Second / clockTicksPerSecond).Format(time.RFC3339)
+		}
+
+		processo.MemoriaBytes = parseUint64(fields[21]) * pageSize
+		processo.MemoriaMB = float64(processo.MemoriaBytes) / 1024 / 1024
+
+		// Caminho do executável (só legível para processos do mesmo usuário ou como root)
+		if exe, err := os.Readlink(filepath.Join(procDir, "exe")); err == nil {
+			processo.Caminho = strings.TrimSuffix(exe, " (deleted)")
+		}
+
+		// Dono do processo a partir do dono do diretório /proc/<pid>
+		if info, err := os.Stat(procDir); err == nil {
+			if sysStat, ok := info.Sys().(*syscall.Stat_t); ok {
+				processo.Usuario = lookupUserName(sysStat.Uid, userNames)
+			}
+		}
+
+		processos = append(processos, processo)
+	}
+
+	return processos, nil
+}
+
+// getBootTime lê o horário de inicialização do sistema (linha btime do /proc/stat)
+func getBootTime() time.Time {
+	stat, err := parseKeyValueFile("/proc/stat", " ")
+	if err != nil {
+		return time.Time{}
+	}
+
+	btime := parseUint64(stat["btime"])
+	if btime == 0 {
+		return time.Time{}
+	}
+	return time.Unix(int64(btime), 0)
+}
+
+// lookupUserName converte um UID em nome de usuário, guardando o resultado no cache informado
+func lookupUserName(uid uint32, cache map[uint32]string) string {
+	if name, ok := cache[uid]; ok {
+		return name
+	}
+
+	name := strconv.FormatUint(uint64(uid), 10)
+	if u, err := user.LookupId(name); err == nil {
+		name = u.Username
+	}
+	cache[uid] = name
+	return name
+}
@@ -0,0 +1,342 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// Mantém a mesma interface da versão Windows em syscall_GetSystemInfo.go
+func getCPUInfoSyscall() map[string]interface{} {
+	info := make(map[string]interface{})
+
+	info["arquitetura"] = getSystemArchitecture()
+
+	// Ler o primeiro bloco do /proc/cpuinfo e contar os processadores lógicos
+	file, err := os.Open("/proc/cpuinfo")
+	if err != nil {
+		info["erro"] = err.Error()
+		info["nucleos"] = runtime.NumCPU()
+		info["modelo"] = "Desconhecido"
+		info["fabricante"] = "Desconhecido"
+		return info
+	}
+	defer file.Close()
+
+	cpuinfo := make(map[string]string)
+	processors := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		key := strings.TrimSpace(parts[0])
+		value := strings.TrimSpace(parts[1])
+		if key == "processor" {
+			processors++
+		}
+		if _, exists := cpuinfo[key]; !exists {
+			cpuinfo[key] = value
+		}
+	}
+
+	if processors == 0 {
+		processors = runtime.NumCPU()
+	}
+	info["nucleos"] = processors
+
+	// Modelo e fabricante (x86 usa "model name"/"vendor_id"; ARM pode expor apenas "Hardware"/"CPU implementer")
+	modelo := cpuinfo["model name"]
+	if modelo == "" {
+		modelo = cpuinfo["Hardware"]
+	}
+	if modelo == "" {
+		modelo = "Desconhecido"
+	}
+	info["modelo"] = modelo
+
+	fabricante := cpuinfo["vendor_id"]
+	if fabricante == "" {
+		fabricante = cpuinfo["CPU implementer"]
+	}
+	if fabricante == "" {
+		fabricante = "Desconhecido"
+	}
+	info["fabricante"] = fabricante
+
+	// Família, modelo e stepping no mesmo formato do registro do Windows
+	family, familyErr := strconv.Atoi(cpuinfo["cpu family"])
+	model, modelErr := strconv.Atoi(cpuinfo["model"])
+	stepping, steppingErr := strconv.Atoi(cpuinfo["stepping"])
+	if familyErr == nil && modelErr == nil && steppingErr == nil {
+		info["nivel_processador"] = family
+		info["revisao_processador"] = model<<8 | stepping
+
+		prefixo := "x86"
+		if runtime.GOARCH == "amd64" {
+			if fabricante == "AuthenticAMD" {
+				prefixo = "AMD64"
+			} else {
+				prefixo = "Intel64"
+			}
+		}
+		info["identificador"] = fmt.Sprintf("%s Family %d Model %d Stepping %d", prefixo, family, model, stepping)
+	}
+
+	switch runtime.GOARCH {
+	case "amd64":
+		info["tipo_processador"] = 8664
+	case "386":
+		info["tipo_processador"] = 586
+	}
+
+	// Frequência nominal: preferir o cpufreq (kHz) e cair para o "cpu MHz" do cpuinfo
+	var mhz int
+	if maxFreq := parseUint64(readSysFile("/sys/devices/system/cpu/cpu0/cpufreq/cpuinfo_max_freq")); maxFreq > 0 {
+		mhz = int(maxFreq / 1000)
+	} else if cpuMHz, err := strconv.ParseFloat(cpuinfo["cpu MHz"], 64); err == nil {
+		mhz = int(cpuMHz)
+	}
+	if mhz > 0 {
+		info["frequencia_mhz"] = mhz
+		info["frequencia"] = fmt.Sprintf("%.2f GHz", float64(mhz)/1000.0)
+	}
+
+	// Cache L2 e L3 a partir da topologia exposta em /sys
+	cacheDirs, _ := filepath.Glob("/sys/devices/system/cpu/cpu0/cache/index*")
+	for _, dir := range cacheDirs {
+		level := readSysFile(filepath.Join(dir, "level"))
+		sizeKB := parseCacheSizeKB(readSysFile(filepath.Join(dir, "size")))
+		if sizeKB == 0 {
+			continue
+		}
+		switch level {
+		case "2":
+			info["cache_l2"] = fmt.Sprintf("%d KB", sizeKB)
+		case "3":
+			info["cache_l3"] = fmt.Sprintf("%d KB", sizeKB)
+		}
+	}
+
+	return info
+}
+
+// parseCacheSizeKB converte tamanhos como "256K" ou "8M" para KB
+func parseCacheSizeKB(size string) uint64 {
+	size = strings.TrimSpace(size)
+	if strings.HasSuffix(size, "M") {
+		return parseUint64(strings.TrimSuffix(size, "M")) * 1024
+	}
+	return parseUint64(strings.TrimSuffix(size, "K"))
+}
+
+// Mantém a mesma interface da versão Windows em syscall_GetSystemInfo.go
+func getHardwareInfoSyscall() map[string]interface{} {
+	info := make(map[string]interface{})
+
+	// Informações do SMBIOS expostas pelo kernel
+	dmiDir := "/sys/class/dmi/id"
+	info["fabricante"] = readSysFile(filepath.Join(dmiDir, "sys_vendor"))
+	info["modelo"] = readSysFile(filepath.Join(dmiDir, "product_name"))
+	info["versao_bios"] = readSysFile(filepath.Join(dmiDir, "bios_version"))
+	info["data_bios"] = readSysFile(filepath.Join(dmiDir, "bios_date"))
+
+	// O número de série só é legível como root; tentar o dmidecode como alternativa
+	serial := readSysFile(filepath.Join(dmiDir, "product_serial"))
+	if serial == "" {
+		if output, err := executeCommand("dmidecode", "-s", "system-serial-number"); err == nil {
+			serial = strings.TrimSpace(output)
+		}
+	}
+	info["numero_serie"] = serial
+
+	// Máquinas sem SMBIOS (ARM) descrevem o hardware no device-tree
+	if info["modelo"] == "" {
+		info["modelo"] = readSysFile("/proc/device-tree/model")
+	}
+	if info["numero_serie"] == "" {
+		info["numero_serie"] = readSysFile("/proc/device-tree/serial-number")
+	}
+
+	// Adicionar informações básicas se não foram obtidas
+	for _, key := range []string{"fabricante", "modelo", "numero_serie"} {
+		if info[key] == "" {
+			info[key] = "Desconhecido"
+		}
+	}
+	for _, key := range []string{"versao_bios", "data_bios"} {
+		if info[key] == "" {
+			delete(info, key)
+		}
+	}
+
+	return info
+}
+
+// getSystemArchitecture retorna a arquitetura do kernel no mesmo formato da versão Windows
+func getSystemArchitecture() string {
+	machine, err := executeCommand("uname", "-m")
+	if err != nil {
+		machine = runtime.GOARCH
+	}
+
+	switch strings.TrimSpace(machine) {
+	case "x86_64", "amd64":
+		return "x64"
+	case "i386", "i486", "i586", "i686", "386":
+		return "x32"
+	case "aarch64", "arm64":
+		return "ARM64"
+	}
+
+	if strings.HasPrefix(strings.TrimSpace(machine), "arm") {
+		return "ARM"
+	}
+
+	return fmt.Sprintf("Desconhecida (%s)", strings.TrimSpace(machine))
+}
+
+// Mantém a mesma interface da versão Windows em syscall_GetSystemInfo.go
+func getSystemInfoSyscall() map[string]interface{} {
+	info := make(map[string]interface{})
+
+	// Obter nome do host
+	if hostname, err := os.Hostname(); err == nil {
+		info["nome_host"] = hostname
+	}
+
+	// Obter nome e versão da distribuição a partir do os-release
+	osRelease, err := parseKeyValueFile("/etc/os-release", "=")
+	if err != nil {
+		osRelease, _ = parseKeyValueFile("/usr/lib/os-release", "=")
+	}
+
+	nomeSO := osRelease["PRETTY_NAME"]
+	if nomeSO == "" {
+		nomeSO = strings.TrimSpace(osRelease["NAME"] + " " + osRelease["VERSION"])
+	}
+	if nomeSO == "" {
+		nomeSO = "Linux"
+	}
+	info["nome_so"] = nomeSO
+
+	if versionID := osRelease["VERSION_ID"]; versionID != "" {
+		info["build"] = versionID
+	}
+	info["versao_compilacao"] = getKernelRelease()
+
+	// Obter informações adicionais do sistema
+	info["arquitetura"] = getSystemArchitecture()
+
+	// Obter usuário de execução (equivalente ao whoami)
+	if currentUser, err := user.Current(); err == nil {
+		info["usuario_execucao"] = currentUser.Username
+	} else {
+		info["usuario_execucao"] = "Desconhecido"
+	}
+
+	// Obter usuário com sessão aberta (equivalente ao query user)
+	usuarioAtual, err := executeCommand("who")
+	if err == nil {
+		linhas := strings.Split(strings.TrimSpace(usuarioAtual), "\n")
+		if len(linhas) > 0 {
+			campos := strings.Fields(linhas[0])
+			if len(campos) > 0 {
+				info["usuario_atual"] = campos[0]
+			}
+		}
+	}
+
+	// Garantir que usuario_atual sempre tenha um valor
+	if _, ok := info["usuario_atual"]; !ok {
+		if username := os.Getenv("SUDO_USER"); username != "" {
+			info["usuario_atual"] = username
+		} else {
+			info["usuario_atual"] = info["usuario_execucao"]
+		}
+	}
+
+	// Obter informações sobre impressoras
+	info["impressoras"] = getPrinterInfoCUPS()
+
+	return info
+}
+
+// getPrinterInfoCUPS obtém as impressoras configuradas no CUPS usando o lpstat/lpoptions
+func getPrinterInfoCUPS() []map[string]interface{} {
+	var printers []map[string]interface{}
+
+	// Forçar o locale C para que a saída do lpstat tenha formato previsível
+	cmd := exec.Command("lpstat", "-v")
+	cmd.Env = append(os.Environ(), "LC_ALL=C")
+	output, err := cmd.Output()
+	if err != nil {
+		return printers
+	}
+
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		// Formato: "device for NOME: URI"
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "device for ") {
+			continue
+		}
+
+		parts := strings.SplitN(strings.TrimPrefix(line, "device for "), ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		printer := make(map[string]interface{})
+		printer["nome"] = strings.TrimSpace(parts[0])
+		printer["porta"] = strings.TrimSpace(parts[1])
+		printer["compartilhada"] = false
+
+		// Detalhes adicionais da fila
+		options, err := executeCommand("lpoptions", "-p", strings.TrimSpace(parts[0]))
+		if err == nil {
+			if driver := getLpoptionValue(options, "printer-make-and-model"); driver != "" {
+				printer["driver"] = driver
+			}
+			if location := getLpoptionValue(options, "printer-location"); location != "" {
+				printer["localizacao"] = location
+			}
+			printer["compartilhada"] = getLpoptionValue(options, "printer-is-shared") == "true"
+		}
+
+		printers = append(printers, printer)
+	}
+
+	return printers
+}
+
+// getLpoptionValue extrai o valor de uma opção da saída do lpoptions (chave=valor ou chave='valor com espaços')
+func getLpoptionValue(output string, key string) string {
+	idx := strings.Index(output, key+"=")
+	if idx < 0 {
+		return ""
+	}
+
+	rest := output[idx+len(key)+1:]
+	if strings.HasPrefix(rest, "'") {
+		rest = rest[1:]
+		if end := strings.Index(rest, "'"); end >= 0 {
+			return rest[:end]
+		}
+		return rest
+	}
+
+	if end := strings.IndexAny(rest, " \n"); end >= 0 {
+		return rest[:end]
+	}
+	return rest
+}
@@ -0,0 +1,126 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// initSyscallBackend prepara o backend de coleta da plataforma (no Linux, verifica se /proc e /sys estão montados)
+func initSyscallBackend() error {
+	if _, err := os.Stat("/proc/self"); err != nil {
+		return fmt.Errorf("/proc indisponível: %v", err)
+	}
+	if _, err := os.Stat("/sys/class"); err != nil {
+		return fmt.Errorf("/sys indisponível: %v", err)
+	}
+	return nil
+}
+
+// readSysFile lê um arquivo de /proc ou /sys e retorna o conteúdo sem espaços nas pontas ("" em caso de erro)
+func readSysFile(path string) string {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	// Arquivos do device-tree terminam com o caractere nulo
+	return strings.TrimSpace(strings.TrimRight(string(content), "\x00"))
+}
+
+// parseKeyValueFile lê arquivos no formato "chave<sep>valor" (ex: /proc/meminfo, /etc/os-release)
+// Apenas a primeira ocorrência de cada chave é mantida
+func parseKeyValueFile(path string, sep string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(line, sep, 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		key := strings.TrimSpace(parts[0])
+		if _, exists := values[key]; exists {
+			continue
+		}
+		values[key] = strings.Trim(strings.TrimSpace(parts[1]), "\"'")
+	}
+
+	return values, scanner.Err()
+}
+
+// readUdevProperties lê as propriedades que o udev registrou para um dispositivo de bloco ("maior:menor")
+func readUdevProperties(devNumber string) map[string]string {
+	properties := make(map[string]string)
+	if devNumber == "" {
+		return properties
+	}
+
+	content, err := os.ReadFile(filepath.Join("/run/udev/data", "b"+devNumber))
+	if err != nil {
+		return properties
+	}
+
+	for _, line := range strings.Split(string(content), "\n") {
+		// As propriedades são gravadas como "E:CHAVE=valor"
+		if !strings.HasPrefix(line, "E:") {
+			continue
+		}
+		parts := strings.SplitN(line[2:], "=", 2)
+		if len(parts) == 2 {
+			properties[parts[0]] = strings.TrimSpace(parts[1])
+		}
+	}
+
+	return properties
+}
+
+// getPCIDescription obtém "Fabricante Dispositivo" de um slot PCI (ex: 0000:01:00.0) usando o lspci
+func getPCIDescription(slot string) string {
+	if slot == "" {
+		return ""
+	}
+
+	cmd := exec.Command("lspci", "-vmm", "-s", slot)
+	cmd.Env = append(os.Environ(), "LC_ALL=C")
+	output, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+
+	var vendor, device string
+	for _, line := range strings.Split(string(output), "\n") {
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		switch strings.TrimSpace(parts[0]) {
+		case "Vendor":
+			vendor = strings.TrimSpace(parts[1])
+		case "Device":
+			device = strings.TrimSpace(parts[1])
+		}
+	}
+
+	return strings.TrimSpace(vendor + " " + device)
+}
+
+// getKernelRelease retorna a versão do kernel em execução (equivalente a "uname -r")
+func getKernelRelease() string {
+	return readSysFile("/proc/sys/kernel/osrelease")
+}
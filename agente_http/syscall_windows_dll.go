@@ -1,7 +1,8 @@
+//go:build windows
+
 package main
 
 import (
-	"os/exec"
 	"syscall"
 )
 
@@ -15,21 +16,22 @@ var (
 	iphlpapiDLL *syscall.DLL
 
 	// Procedimentos do kernel32.dll
-	getSystemInfoFn            *syscall.Proc
-	getNativeSystemInfoFn      *syscall.Proc
-	getComputerNameExFn        *syscall.Proc
-	getUserNameFn              *syscall.Proc
-	isWow64ProcessFn           *syscall.Proc
-	getCurrentProcessFn        *syscall.Proc
-	getLogicalDrivesFn         *syscall.Proc
-	getDiskFreeSpaceExFn       *syscall.Proc
-	getVolumeInformationFn     *syscall.Proc
-	globalMemoryStatusExFn     *syscall.Proc
-	createToolhelp32SnapshotFn *syscall.Proc
-	process32FirstFn           *syscall.Proc
-	process32NextFn            *syscall.Proc
-	openProcessFn              *syscall.Proc
-	closeHandleFn              *syscall.Proc
+	getSystemInfoFn             *syscall.Proc
+	getNativeSystemInfoFn       *syscall.Proc
+	getComputerNameExFn         *syscall.Proc
+	getUserNameFn               *syscall.Proc
+	isWow64ProcessFn            *syscall.Proc
+	getCurrentProcessFn         *syscall.Proc
+	getLogicalDrivesFn          *syscall.Proc
+	getDiskFreeSpaceExFn        *syscall.Proc
+	getVolumeInformationFn      *syscall.Proc
+	globalMemoryStatusExFn      *syscall.Proc
+	createToolhelp32SnapshotFn  *syscall.Proc
+	process32FirstFn            *syscall.Proc
+	process32NextFn             *syscall.Proc
+	openProcessFn               *syscall.Proc
+	closeHandleFn               *syscall.Proc
+	queryFullProcessImageNameFn *syscall.Proc
 
 	// Procedimentos do ntdll.dll
 	rtlGetVersionFn *syscall.Proc
@@ -104,6 +106,7 @@ func initWindowsDLLs() error {
 		process32NextFn, _ = kernel32DLL.FindProc("Process32NextW")
 		openProcessFn, _ = kernel32DLL.FindProc("OpenProcess")
 		closeHandleFn, _ = kernel32DLL.FindProc("CloseHandle")
+		queryFullProcessImageNameFn, _ = kernel32DLL.FindProc("QueryFullProcessImageNameW")
 	}
 
 	// Carregar ntdll.dll
@@ -158,12 +161,7 @@ func initWindowsDLLs() error {
 	return nil
 }
 
-// Executa um comando do Windows e retorna a saída como string
-func executeCommand(command string, args ...string) (string, error) {
-	cmd := exec.Command(command, args...)
-	output, err := cmd.Output()
-	if err != nil {
-		return "", err
-	}
-	return string(output), nil
+// initSyscallBackend prepara o backend de coleta da plataforma (no Windows, as DLLs do sistema)
+func initSyscallBackend() error {
+	return initWindowsDLLs()
 }
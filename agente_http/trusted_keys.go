@@ -0,0 +1,472 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cabeçalho com os identificadores de chave: na requisição, as chaves que o cliente consegue descriptografar
+// (em ordem de preferência); na resposta, a chave usada pelo agente para criptografar
+const keyIDHeader = "X-Chave-ID"
+
+// Origens de uma chave confiável
+const (
+	trustedKeySourceFile     = "arquivo" // keys/public_key.pem ou keys/release_public_key.pem, importada quando o conjunto está vazio
+	trustedKeySourceRotation = "rotacao" // Adicionada por uma mensagem de rotação assinada por uma chave confiável
+)
+
+// Finalidades de uma chave confiável: as chaves de comandos assinam os envelopes e criptografam as respostas;
+// as chaves de release só são aceitas nos manifestos de atualização
+const (
+	keyPurposeCommands = "comandos"
+	keyPurposeRelease  = "release"
+)
+
+// Arquivos de onde as chaves de cada finalidade são importadas quando o conjunto está vazio
+var trustedKeyFiles = map[string]string{
+	keyPurposeCommands: "public_key.pem",
+	keyPurposeRelease:  "release_public_key.pem",
+}
+
+// Prefixos dos dados assinados, um por formato, para que a assinatura de um formato nunca seja aceita em outro
+const (
+	commandSignaturePrefix    = "agente-comando-v1\n"
+	manifestSignaturePrefix   = "agente-manifesto-v1\n"
+	releaseKeySignaturePrefix = "agente-chave-release-v1\n"
+)
+
+// Carência padrão até a aposentadoria das chaves antigas, após uma rotação
+const defaultKeyRetirementGrace = 72 * time.Hour
+
+// Tamanho mínimo das novas chaves RSA aceitas na rotação
+const minTrustedKeyBits = 2048
+
+// TrustedKey é uma chave pública confiável, usada para verificar os envelopes assinados e criptografar as respostas
+type TrustedKey struct {
+	ID           string
+	PEM          string
+	Origem       string
+	AdicionadaEm int64 // Unix, em segundos
+	AposentarEm  int64 // Unix, em segundos (0: sem aposentadoria prevista)
+	Finalidade   string
+	PublicKey    *rsa.PublicKey
+}
+
+// Conjunto de chaves confiáveis (carregado do banco de dados)
+var (
+	trustedKeys      []TrustedKey
+	trustedKeysMutex sync.RWMutex
+)
+
+// KeyRotation é o conteúdo do envelope assinado de POST /keys/rotate
+// A nova chave só é adicionada se o envelope foi assinado por uma chave confiável; as chaves em Aposentar
+// (por padrão, todas as outras da mesma finalidade) deixam de ser aceitas após a carência
+// Uma nova chave de release precisa também da assinatura de uma chave de release ativa (AssinaturaRelease),
+// para que as chaves de comandos não bastem para trocar as chaves aceitas nos manifestos
+type KeyRotation struct {
+	NovaChave         string   `json:"nova_chave"`           // Chave pública RSA em PEM
+	Finalidade        string   `json:"finalidade,omitempty"` // comandos (padrão) ou release
+	AssinaturaRelease string   `json:"assinatura_release,omitempty"`
+	ChaveReleaseID    string   `json:"chave_release_id,omitempty"`
+	CarenciaHoras     *int     `json:"carencia_horas,omitempty"`
+	Aposentar         []string `json:"aposentar,omitempty"`
+}
+
+// withSignaturePrefix retorna os dados assinados de um formato: o prefixo do formato seguido dos dados
+func withSignaturePrefix(prefix string, data []byte) []byte {
+	return append([]byte(prefix), data...)
+}
+
+// publicKeyID calcula o identificador da chave: os primeiros 8 bytes do SHA-256 da chave em DER, em hexadecimal
+func publicKeyID(publicKey *rsa.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return "", fmt.Errorf("erro ao serializar chave pública: %v", err)
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:8]), nil
+}
+
+// parseTrustedKeyPEM analisa uma chave pública RSA em PEM
+func parseTrustedKeyPEM(pemData string) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(pemData))
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return nil, fmt.Errorf("falha ao decodificar chave pública PEM")
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("falha ao analisar chave pública: %v", err)
+	}
+	rsaPub, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("chave não é uma chave pública RSA")
+	}
+	return rsaPub, nil
+}
+
+// loadTrustedKeys carrega o conjunto de chaves confiáveis do banco de dados
+// Com o conjunto de uma finalidade vazio (primeiro início ou atualização de uma versão antiga), importa a chave
+// do arquivo da finalidade (keys/public_key.pem ou keys/release_public_key.pem); depois disso, o arquivo é ignorado
+// e o conjunto só muda por rotação assinada. Sem chave de release, o agente não instala atualizações
+func loadTrustedKeys() error {
+	keys, err := getTrustedKeys()
+	if err != nil {
+		return err
+	}
+
+	imported := false
+	for _, purpose := range []string{keyPurposeCommands, keyPurposeRelease} {
+		if countKeys(keys, purpose) > 0 {
+			warnUntrustedKeyFile(keys, purpose)
+			continue
+		}
+
+		publicKeyPath := filepath.Join(agentKeysDir(), trustedKeyFiles[purpose])
+		if _, err := os.Stat(publicKeyPath); os.IsNotExist(err) {
+			if purpose == keyPurposeRelease {
+				fmt.Printf("[chaves] Aviso: nenhuma chave de release confiável e %s não encontrada; atualizações desativadas\n", publicKeyPath)
+				continue
+			}
+			return fmt.Errorf("nenhuma chave confiável e chave pública não encontrada em %s", publicKeyPath)
+		}
+		publicKey, err := loadPublicKey(publicKeyPath)
+		if err != nil {
+			return err
+		}
+		key, err := newTrustedKey(publicKey, trustedKeySourceFile, purpose)
+		if err != nil {
+			return err
+		}
+		if other, ok := findKeyIn(keys, key.ID); ok {
+			return fmt.Errorf("chave %s de %s já é confiável para %s; use chaves diferentes para comandos e release", key.ID, publicKeyPath, other.Finalidade)
+		}
+		if err := saveKeyRotation(key, nil, 0); err != nil {
+			return err
+		}
+		fmt.Printf("[chaves] Chave %s (%s) importada de %s\n", key.ID, purpose, publicKeyPath)
+		imported = true
+	}
+
+	if imported {
+		if keys, err = getTrustedKeys(); err != nil {
+			return err
+		}
+	}
+
+	for i := range keys {
+		publicKey, err := parseTrustedKeyPEM(keys[i].PEM)
+		if err != nil {
+			return fmt.Errorf("chave confiável %s inválida: %v", keys[i].ID, err)
+		}
+		keys[i].PublicKey = publicKey
+	}
+
+	trustedKeysMutex.Lock()
+	trustedKeys = keys
+	trustedKeysMutex.Unlock()
+	return nil
+}
+
+// countKeys conta as chaves da finalidade
+func countKeys(keys []TrustedKey, purpose string) int {
+	count := 0
+	for _, key := range keys {
+		if key.Finalidade == purpose {
+			count++
+		}
+	}
+	return count
+}
+
+// findKeyIn procura a chave pelo identificador, em qualquer finalidade
+func findKeyIn(keys []TrustedKey, keyID string) (TrustedKey, bool) {
+	for _, key := range keys {
+		if strings.EqualFold(key.ID, keyID) {
+			return key, true
+		}
+	}
+	return TrustedKey{}, false
+}
+
+// warnUntrustedKeyFile avisa quando o arquivo da finalidade contém uma chave fora do conjunto confiável:
+// o arquivo só é usado na importação inicial, e trocá-lo não altera as chaves aceitas pelo agente
+func warnUntrustedKeyFile(keys []TrustedKey, purpose string) {
+	filename := trustedKeyFiles[purpose]
+	pemData, err := os.ReadFile(filepath.Join(agentKeysDir(), filename))
+	if err != nil {
+		return
+	}
+	publicKey, err := parseTrustedKeyPEM(string(pemData))
+	if err != nil {
+		return
+	}
+	keyID, err := publicKeyID(publicKey)
+	if err != nil {
+		return
+	}
+	for _, key := range keys {
+		if key.ID == keyID && key.Finalidade == purpose {
+			return
+		}
+	}
+	fmt.Printf("[chaves] Aviso: %s contém a chave %s, que não é confiável para %s; use POST /keys/rotate para adicioná-la\n", filename, keyID, purpose)
+}
+
+// newTrustedKey prepara o registro de uma nova chave confiável
+func newTrustedKey(publicKey *rsa.PublicKey, origem, purpose string) (TrustedKey, error) {
+	keyID, err := publicKeyID(publicKey)
+	if err != nil {
+		return TrustedKey{}, err
+	}
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return TrustedKey{}, fmt.Errorf("erro ao serializar chave pública: %v", err)
+	}
+
+	return TrustedKey{
+		ID:           keyID,
+		PEM:          string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})),
+		Origem:       origem,
+		AdicionadaEm: time.Now().Unix(),
+		Finalidade:   purpose,
+		PublicKey:    publicKey,
+	}, nil
+}
+
+// activeKeys retorna as chaves da finalidade ainda aceitas, da mais recente à mais antiga
+func activeKeys(purpose string) []TrustedKey {
+	trustedKeysMutex.RLock()
+	defer trustedKeysMutex.RUnlock()
+
+	now := time.Now().Unix()
+	active := make([]TrustedKey, 0, len(trustedKeys))
+	for _, key := range trustedKeys {
+		if key.Finalidade == purpose && (key.AposentarEm == 0 || key.AposentarEm > now) {
+			active = append(active, key)
+		}
+	}
+	return active
+}
+
+// activeTrustedKeys retorna as chaves de comandos ainda aceitas, da mais recente à mais antiga
+func activeTrustedKeys() []TrustedKey {
+	return activeKeys(keyPurposeCommands)
+}
+
+// findKey procura uma chave da finalidade ainda aceita pelo identificador
+func findKey(purpose, keyID string) (TrustedKey, bool) {
+	return findKeyIn(activeKeys(purpose), keyID)
+}
+
+// findTrustedKey procura uma chave de comandos ainda aceita pelo identificador
+func findTrustedKey(keyID string) (TrustedKey, bool) {
+	return findKey(keyPurposeCommands, keyID)
+}
+
+// primaryTrustedKey retorna a chave confiável mais recente, usada quando o cliente não indica a sua
+func primaryTrustedKey() (TrustedKey, error) {
+	active := activeTrustedKeys()
+	if len(active) == 0 {
+		return TrustedKey{}, fmt.Errorf("nenhuma chave confiável ativa")
+	}
+	return active[0], nil
+}
+
+// responseEncryptionKey escolhe a chave para criptografar a resposta: a primeira chave confiável entre as
+// indicadas pelo cliente no cabeçalho X-Chave-ID ou, se nenhuma for confiável, a chave mais recente
+func responseEncryptionKey(r *http.Request) (TrustedKey, error) {
+	for _, keyID := range strings.Split(r.Header.Get(keyIDHeader), ",") {
+		if key, ok := findTrustedKey(strings.TrimSpace(keyID)); ok {
+			return key, nil
+		}
+	}
+	return primaryTrustedKey()
+}
+
+// keysHandler lista as chaves confiáveis (GET /keys)
+func keysHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Método não permitido", http.StatusMethodNotAllowed)
+		return
+	}
+
+	type keyInfo struct {
+		ID           string `json:"id"`
+		Finalidade   string `json:"finalidade"`
+		Origem       string `json:"origem"`
+		AdicionadaEm string `json:"adicionada_em"`
+		AposentarEm  string `json:"aposentar_em,omitempty"`
+	}
+
+	keys := []keyInfo{}
+	for _, key := range append(activeTrustedKeys(), activeKeys(keyPurposeRelease)...) {
+		info := keyInfo{
+			ID:           key.ID,
+			Finalidade:   key.Finalidade,
+			Origem:       key.Origem,
+			AdicionadaEm: time.Unix(key.AdicionadaEm, 0).Format(time.RFC3339),
+		}
+		if key.AposentarEm > 0 {
+			info.AposentarEm = time.Unix(key.AposentarEm, 0).Format(time.RFC3339)
+		}
+		keys = append(keys, info)
+	}
+
+	writeDataResponse(w, r, map[string]interface{}{
+		"chaves": keys,
+	})
+}
+
+// rotateKeysHandler adiciona uma nova chave confiável (POST /keys/rotate)
+// O envelope precisa estar assinado por uma chave confiável ativa; as chaves antigas continuam aceitas
+// durante a carência, para que o servidor e o commander troquem a chave privada sem interromper o acesso
+func rotateKeysHandler(w http.ResponseWriter, r *http.Request) {
+	var rotation KeyRotation
+	if !readSignedPayload(w, r, &rotation) {
+		return
+	}
+
+	publicKey, err := parseTrustedKeyPEM(rotation.NovaChave)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Nova chave inválida: %v", err), http.StatusBadRequest)
+		return
+	}
+	if publicKey.N.BitLen() < minTrustedKeyBits {
+		http.Error(w, fmt.Sprintf("Nova chave deve ter pelo menos %d bits", minTrustedKeyBits), http.StatusBadRequest)
+		return
+	}
+
+	purpose := rotation.Finalidade
+	if purpose == "" {
+		purpose = keyPurposeCommands
+	}
+	if purpose != keyPurposeCommands && purpose != keyPurposeRelease {
+		http.Error(w, fmt.Sprintf("Finalidade inválida: %s", purpose), http.StatusBadRequest)
+		return
+	}
+	if purpose == keyPurposeRelease {
+		signature, err := base64.StdEncoding.DecodeString(rotation.AssinaturaRelease)
+		if err != nil || len(signature) == 0 {
+			http.Error(w, "Nova chave de release sem assinatura de uma chave de release confiável", http.StatusBadRequest)
+			return
+		}
+		data := withSignaturePrefix(releaseKeySignaturePrefix, []byte(rotation.NovaChave))
+		if err := verifyTrustedSignature(keyPurposeRelease, rotation.ChaveReleaseID, data, signature); err != nil {
+			http.Error(w, fmt.Sprintf("Assinatura da nova chave de release inválida: %v", err), http.StatusUnauthorized)
+			return
+		}
+	}
+
+	grace := defaultKeyRetirementGrace
+	if rotation.CarenciaHoras != nil {
+		if *rotation.CarenciaHoras < 0 {
+			http.Error(w, "Carência inválida", http.StatusBadRequest)
+			return
+		}
+		grace = time.Duration(*rotation.CarenciaHoras) * time.Hour
+	}
+
+	newKey, err := newTrustedKey(publicKey, trustedKeySourceRotation, purpose)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	trustedKeysMutex.RLock()
+	existing, exists := findKeyIn(trustedKeys, newKey.ID)
+	trustedKeysMutex.RUnlock()
+	if exists && existing.Finalidade != purpose {
+		http.Error(w, fmt.Sprintf("Chave %s já é confiável para %s; use chaves diferentes para comandos e release", newKey.ID, existing.Finalidade), http.StatusBadRequest)
+		return
+	}
+
+	// Chaves a aposentar: as informadas ou todas as outras chaves ativas da finalidade (nunca a nova)
+	var retire []string
+	if len(rotation.Aposentar) > 0 {
+		for _, keyID := range rotation.Aposentar {
+			key, ok := findKey(purpose, keyID)
+			if !ok {
+				http.Error(w, fmt.Sprintf("Chave desconhecida ou já aposentada: %s", keyID), http.StatusBadRequest)
+				return
+			}
+			if key.ID != newKey.ID {
+				retire = append(retire, key.ID)
+			}
+		}
+	} else {
+		for _, key := range activeKeys(purpose) {
+			if key.ID != newKey.ID {
+				retire = append(retire, key.ID)
+			}
+		}
+	}
+
+	retireAt := time.Now().Add(grace).Unix()
+	if err := saveKeyRotation(newKey, retire, retireAt); err != nil {
+		fmt.Printf("[chaves] Erro ao registrar rotação: %v\n", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := loadTrustedKeys(); err != nil {
+		fmt.Printf("[chaves] Erro ao recarregar chaves confiáveis: %v\n", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	fmt.Printf("[chaves] Chave %s (%s) adicionada; %d chaves aposentadas em %s\n", newKey.ID, purpose, len(retire),
+		time.Unix(retireAt, 0).Format(time.RFC3339))
+	if retire == nil {
+		retire = []string{}
+	}
+	writeDataResponse(w, r, map[string]interface{}{
+		"chave_id":     newKey.ID,
+		"aposentadas":  retire,
+		"aposentar_em": time.Unix(retireAt, 0).Format(time.RFC3339),
+	})
+}
+
+// verifyTrustedSignature verifica a assinatura RSA PKCS#1 v1.5 com SHA-256 dos dados com a chave confiável
+// da finalidade indicada ou, para emissores antigos que não indicam a chave, com qualquer chave ativa da finalidade
+// Os dados já devem incluir o prefixo do formato (withSignaturePrefix)
+func verifyTrustedSignature(purpose, keyID string, data, signature []byte) error {
+	keys := activeKeys(purpose)
+	if keyID != "" {
+		key, ok := findKey(purpose, keyID)
+		if !ok {
+			return fmt.Errorf("chave %s desconhecida, aposentada ou não é de %s", keyID, purpose)
+		}
+		keys = []TrustedKey{key}
+	}
+
+	hashed := sha256.Sum256(data)
+	for _, key := range keys {
+		if rsa.VerifyPKCS1v15(key.PublicKey, crypto.SHA256, hashed[:], signature) == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("assinatura não confere com nenhuma chave confiável de %s", purpose)
+}
+
+// trustedKeysSummary descreve as chaves ativas para o log
+func trustedKeysSummary() string {
+	var descriptions []string
+	for _, key := range append(activeTrustedKeys(), activeKeys(keyPurposeRelease)...) {
+		description := key.ID + " (" + key.Finalidade + ")"
+		if key.AposentarEm > 0 {
+			description += " (aposentada em " + time.Unix(key.AposentarEm, 0).Format(time.RFC3339) + ")"
+		}
+		descriptions = append(descriptions, description)
+	}
+	return strings.Join(descriptions, ", ")
+}
@@ -2,21 +2,33 @@ package main
 
 // AgenteInfo representa as informações do agente
 type AgenteInfo struct {
-	VersaoAgente             string `json:"versao_agente"`
-	ServidorAtualizacao      string `json:"servidor_atualizacao"`
-	UpdateCheckInterval      string `json:"update_check_interval"`
-	SystemInfoUpdateInterval string `json:"system_info_update_interval"`
+	AgenteID                 string   `json:"agente_id"`    // UUID gerado no primeiro início do agente
+	NumeroSerie              string   `json:"numero_serie"` // Número de série do hardware (vazio se desconhecido)
+	MacPrincipal             string   `json:"mac_principal,omitempty"`
+	VersaoAgente             string   `json:"versao_agente"`
+	ServidorAtualizacao      string   `json:"servidor_atualizacao"`
+	UpdateCheckInterval      string   `json:"update_check_interval"`
+	CanalAtualizacao         string   `json:"canal_atualizacao"` // Canal informado ao servidor de atualização
+	SystemInfoUpdateInterval string   `json:"system_info_update_interval"`
+	RevisaoConfig            int64    `json:"revisao_config"`               // Incrementada a cada alteração remota da configuração
+	TokenInscricao           string   `json:"token_inscricao,omitempty"`    // Apresentado ao servidor de coleta até a inscrição ser aprovada
+	ChavePublica             string   `json:"chave_publica"`                // Chave pública Ed25519 do agente, que assina as respostas
+	VersoesBloqueadas        []string `json:"versoes_bloqueadas,omitempty"` // Versões desfeitas por falha na inicialização
 }
 
-// SystemInfo representa as informações do sistema
-type SystemInfo struct {
-	Sistema   map[string]interface{}   `json:"sistema"`
-	CPU       map[string]interface{}   `json:"cpu"`
-	Memoria   map[string]interface{}   `json:"memoria"`
-	Discos    []map[string]interface{} `json:"discos"`
-	Rede      map[string]interface{}   `json:"rede"`
-	GPU       interface{}              `json:"gpu"`
-	Processos map[string]interface{}   `json:"processos"`
-	Hardware  interface{}              `json:"hardware"`
-	Agente    AgenteInfo               `json:"agente"`
+// SystemInfo representa as informações do sistema, indexadas pelo nome da seção
+// As seções são definidas pelos coletores registrados (ver collectors.go)
+type SystemInfo map[string]interface{}
+
+// ProcessInfo representa um processo em execução
+type ProcessInfo struct {
+	PID              uint32  `json:"pid"`
+	PIDPai           uint32  `json:"pid_pai"`
+	Nome             string  `json:"nome"`
+	Caminho          string  `json:"caminho,omitempty"`
+	Usuario          string  `json:"usuario,omitempty"`
+	MemoriaBytes     uint64  `json:"memoria_bytes"`
+	MemoriaMB        float64 `json:"memoria_mb"`
+	TempoCPUSegundos float64 `json:"tempo_cpu_segundos"`
+	Inicio           string  `json:"inicio,omitempty"`
 }
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Sem patch publicado para o executável atual: a atualização usa o download completo
+var errNoDelta = errors.New("nenhum patch para o executável atual")
+
+// UpdateDelta descreve o patch que transforma o executável de uma versão anterior no executável publicado
+type UpdateDelta struct {
+	Versao     string `json:"versao"`      // Versão de origem
+	BaseSHA256 string `json:"base_sha256"` // SHA-256 do executável de origem
+	URL        string `json:"url"`         // Absoluta ou relativa ao servidor de atualização
+	Tamanho    int64  `json:"tamanho"`
+	SHA256     string `json:"sha256"` // SHA-256 do patch
+}
+
+// downloadDeltaUpdate monta o novo executável em downloadPath aplicando ao executável atual o patch publicado
+// para ele, escolhido pelo SHA-256 do executável (e não pela versão informada)
+// O resultado precisa conferir com o tamanho e o SHA-256 do artefato no manifesto assinado; em caso de erro,
+// o chamador faz o download completo
+func downloadDeltaUpdate(artifact UpdateArtifact, exePath, downloadPath string) error {
+	if len(artifact.Deltas) == 0 {
+		return errNoDelta
+	}
+
+	current, err := os.ReadFile(exePath)
+	if err != nil {
+		return fmt.Errorf("erro ao ler executável atual: %v", err)
+	}
+	sum := sha256.Sum256(current)
+	currentSum := hex.EncodeToString(sum[:])
+
+	var delta *UpdateDelta
+	for i := range artifact.Deltas {
+		if strings.EqualFold(artifact.Deltas[i].BaseSHA256, currentSum) {
+			delta = &artifact.Deltas[i]
+			break
+		}
+	}
+	if delta == nil {
+		return errNoDelta
+	}
+
+	// O patch é baixado e conferido como um artefato, com continuação e limite de banda
+	patchArtifact := UpdateArtifact{URL: delta.URL, Tamanho: delta.Tamanho, SHA256: delta.SHA256}
+	if patchArtifact.URL == "" || patchArtifact.Tamanho <= 0 {
+		return fmt.Errorf("manifesto inválido: patch incompleto para a versão %s", delta.Versao)
+	}
+	patchURL, err := artifactURL(patchArtifact)
+	if err != nil {
+		return err
+	}
+	patchPath := strings.TrimSuffix(downloadPath, ".download") + ".patch"
+
+	logUpdateError(fmt.Sprintf("Baixando patch da versão %s (%d bytes, executável completo: %d bytes) de %s",
+		delta.Versao, delta.Tamanho, artifact.Tamanho, patchURL))
+	if err := downloadArtifact(patchURL, patchPath, patchArtifact); err != nil {
+		return err
+	}
+	defer removeDownload(patchPath)
+	if err := verifyArtifactFile(patchPath, patchArtifact); err != nil {
+		return err
+	}
+
+	patch, err := os.ReadFile(patchPath)
+	if err != nil {
+		return fmt.Errorf("erro ao ler patch: %v", err)
+	}
+	patched, err := bspatch(current, patch, artifact.Tamanho)
+	if err != nil {
+		return err
+	}
+
+	// O resultado substitui um eventual download completo parcial
+	removeDownload(downloadPath)
+	if err := os.WriteFile(downloadPath, patched, 0644); err != nil {
+		return fmt.Errorf("erro ao gravar executável gerado pelo patch: %v", err)
+	}
+	if err := verifyArtifactFile(downloadPath, artifact); err != nil {
+		os.Remove(downloadPath)
+		return err
+	}
+	return nil
+}
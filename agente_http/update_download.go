@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Tentativas de download por verificação de atualização; cada tentativa continua de onde a anterior parou
+const downloadMaxAttempts = 5
+
+// Tempo máximo sem receber dados antes de a tentativa ser abandonada (o download do servidor não tem prazo total)
+const downloadStallTimeout = 60 * time.Second
+
+// Tamanho de cada leitura da resposta, também a granularidade do limite de banda
+const downloadChunkSize = 32 << 10
+
+// Sufixo do arquivo com o estado do download parcial, ao lado do arquivo baixado
+const downloadStateSuffix = ".estado"
+
+// DownloadState identifica o artefato do download parcial, para que ele só seja continuado com o mesmo arquivo
+type DownloadState struct {
+	URL    string `json:"url"`
+	SHA256 string `json:"sha256"`
+	ETag   string `json:"etag,omitempty"`
+}
+
+// downloadArtifact baixa o artefato para path, continuando um download parcial anterior do mesmo artefato
+// com requisições Range; a velocidade é limitada por limite_download_kbps (0: sem limite)
+// O arquivo parcial é mantido em caso de falha, para ser continuado na próxima verificação
+func downloadArtifact(url, path string, artifact UpdateArtifact) error {
+	statePath := path + downloadStateSuffix
+	state := loadDownloadState(statePath)
+	if state.URL != url || !strings.EqualFold(state.SHA256, artifact.SHA256) {
+		// Download parcial de outro artefato (ou inexistente): começar do zero
+		os.Remove(path)
+		state = DownloadState{URL: url, SHA256: artifact.SHA256}
+		saveDownloadState(statePath, state)
+	}
+
+	var lastErr error
+	for attempt := 1; attempt <= downloadMaxAttempts; attempt++ {
+		if attempt > 1 {
+			delay := time.Duration(attempt-1) * 5 * time.Second
+			logUpdateError(fmt.Sprintf("Nova tentativa de download em %v (%d de %d): %v", delay, attempt, downloadMaxAttempts, lastErr))
+			time.Sleep(delay)
+		}
+
+		complete, err := downloadArtifactAttempt(url, path, statePath, artifact, &state, configInt("limite_download_kbps"), 0)
+		if err == nil && complete {
+			os.Remove(statePath)
+			return nil
+		}
+		lastErr = err
+	}
+	return fmt.Errorf("download não concluído após %d tentativas: %v", downloadMaxAttempts, lastErr)
+}
+
+// downloadArtifactAttempt faz uma tentativa de download a partir do tamanho atual do arquivo parcial
+// A velocidade é limitada a limitKbps (0: sem limite) e a tentativa inteira, a deadline (0: sem prazo total);
+// retorna true quando o arquivo atingiu o tamanho do artefato
+func downloadArtifactAttempt(url, path, statePath string, artifact UpdateArtifact, state *DownloadState, limitKbps int, deadline time.Duration) (bool, error) {
+	offset := int64(0)
+	if info, err := os.Stat(path); err == nil {
+		offset = info.Size()
+	}
+	if offset > artifact.Tamanho {
+		os.Remove(path)
+		offset = 0
+	}
+	if offset == artifact.Tamanho {
+		return true, nil
+	}
+
+	// A tentativa é cancelada se nenhum dado chegar dentro do prazo ou se o prazo total acabar
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if deadline > 0 {
+		var cancelDeadline context.CancelFunc
+		ctx, cancelDeadline = context.WithTimeout(ctx, deadline)
+		defer cancelDeadline()
+	}
+	stall := time.AfterFunc(downloadStallTimeout, cancel)
+	defer stall.Stop()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return false, fmt.Errorf("erro ao criar requisição de download: %v", err)
+	}
+	setAgentIdentityHeaders(req.Header)
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		// Se o arquivo mudou no servidor, If-Range faz o servidor enviar o arquivo inteiro
+		if state.ETag != "" {
+			req.Header.Set("If-Range", state.ETag)
+		}
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			ResponseHeaderTimeout: downloadStallTimeout,
+		},
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("erro ao fazer requisição HTTP: %v", err)
+	}
+	defer resp.Body.Close()
+
+	flags := os.O_WRONLY | os.O_CREATE
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		start, err := contentRangeStart(resp.Header.Get("Content-Range"))
+		if err != nil || start != offset {
+			return false, fmt.Errorf("resposta parcial inesperada: Content-Range %q", resp.Header.Get("Content-Range"))
+		}
+		flags |= os.O_APPEND
+		logUpdateError(fmt.Sprintf("Continuando download a partir de %d de %d bytes", offset, artifact.Tamanho))
+	case resp.StatusCode == http.StatusOK:
+		// Servidor sem suporte a Range ou arquivo alterado: recomeçar
+		flags |= os.O_TRUNC
+		offset = 0
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		os.Remove(path)
+		return false, fmt.Errorf("servidor recusou a continuação do download, recomeçando")
+	default:
+		return false, fmt.Errorf("servidor retornou código de status %d", resp.StatusCode)
+	}
+	// Gravar o ETag antes de receber os dados, para que a continuação confira se o arquivo é o mesmo
+	// mesmo que o agente seja encerrado durante o download
+	state.ETag = resp.Header.Get("ETag")
+	saveDownloadState(statePath, *state)
+
+	out, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return false, fmt.Errorf("erro ao criar arquivo: %v", err)
+	}
+	defer out.Close()
+
+	limiter := newBandwidthLimiter(limitKbps)
+	buffer := make([]byte, downloadChunkSize)
+	written := offset
+	for written < artifact.Tamanho {
+		n, readErr := resp.Body.Read(buffer)
+		if n > 0 {
+			if _, err := out.Write(buffer[:n]); err != nil {
+				return false, fmt.Errorf("erro ao salvar arquivo: %v", err)
+			}
+			written += int64(n)
+			// A espera do limite de banda não conta como falta de dados
+			stall.Stop()
+			limiter.wait(n)
+			stall.Reset(downloadStallTimeout)
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return false, fmt.Errorf("download interrompido em %d de %d bytes: prazo de %v esgotado", written, artifact.Tamanho, deadline)
+			}
+			return false, fmt.Errorf("download interrompido em %d de %d bytes: %v", written, artifact.Tamanho, readErr)
+		}
+	}
+
+	if written < artifact.Tamanho {
+		return false, fmt.Errorf("download interrompido em %d de %d bytes", written, artifact.Tamanho)
+	}
+	return true, nil
+}
+
+// contentRangeStart retorna a posição inicial de um cabeçalho Content-Range ("bytes início-fim/total")
+func contentRangeStart(contentRange string) (int64, error) {
+	spec, ok := strings.CutPrefix(contentRange, "bytes ")
+	if !ok {
+		return 0, fmt.Errorf("Content-Range inválido: %q", contentRange)
+	}
+	start, _, ok := strings.Cut(spec, "-")
+	if !ok {
+		return 0, fmt.Errorf("Content-Range inválido: %q", contentRange)
+	}
+	return strconv.ParseInt(start, 10, 64)
+}
+
+// loadDownloadState lê o estado do download parcial (vazio se não existir)
+func loadDownloadState(path string) DownloadState {
+	var state DownloadState
+	if data, err := os.ReadFile(path); err == nil {
+		json.Unmarshal(data, &state)
+	}
+	return state
+}
+
+// saveDownloadState grava o estado do download parcial
+func saveDownloadState(path string, state DownloadState) {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		logUpdateError(fmt.Sprintf("Aviso: Não foi possível gravar o estado do download: %v", err))
+	}
+}
+
+// removeDownload apaga o arquivo baixado e o estado do download
+func removeDownload(path string) {
+	os.Remove(path)
+	os.Remove(path + downloadStateSuffix)
+}
+
+// bandwidthLimiter limita a velocidade média do download, aguardando após cada leitura o tempo necessário
+// para não ultrapassar o limite
+type bandwidthLimiter struct {
+	bytesPerSecond int64
+	start          time.Time
+	total          int64
+}
+
+// newBandwidthLimiter cria o limitador com o limite em kbit/s (0: sem limite)
+func newBandwidthLimiter(kbps int) *bandwidthLimiter {
+	return &bandwidthLimiter{bytesPerSecond: int64(kbps) * 1000 / 8, start: time.Now()}
+}
+
+// wait aguarda o tempo necessário após a leitura de n bytes
+func (l *bandwidthLimiter) wait(n int) {
+	if l.bytesPerSecond <= 0 {
+		return
+	}
+	l.total += int64(n)
+	expected := time.Duration(float64(l.total) / float64(l.bytesPerSecond) * float64(time.Second))
+	if elapsed := time.Since(l.start); expected > elapsed {
+		time.Sleep(expected - elapsed)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Prazo para a nova versão responder saudável após uma atualização; passado o prazo, a versão anterior é restaurada
+const updateHealthDeadline = 3 * time.Minute
+
+// Intervalo entre as consultas ao /health da nova versão
+const updateHealthPollInterval = 2 * time.Second
+
+// Situações informadas em /health
+const (
+	healthStatusOK       = "ok"
+	healthStatusStarting = "iniciando"
+)
+
+// Etapas da inicialização exigidas para o agente se declarar saudável (o servidor HTTP está no ar se /health responde)
+var (
+	healthDatabaseReady  atomic.Bool
+	healthCollectionDone atomic.Bool
+)
+
+// HealthStatus é a resposta de /health, consultada pela versão anterior do agente após uma atualização
+type HealthStatus struct {
+	Status         string `json:"status"`
+	Versao         string `json:"versao"`
+	PID            int    `json:"pid"`
+	Banco          bool   `json:"banco"`
+	PrimeiraColeta bool   `json:"primeira_coleta"`
+}
+
+// healthHandler informa se a inicialização do agente foi concluída (GET /health)
+func healthHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Método não permitido", http.StatusMethodNotAllowed)
+		return
+	}
+
+	status := HealthStatus{
+		Status:         healthStatusStarting,
+		PID:            os.Getpid(),
+		Banco:          healthDatabaseReady.Load(),
+		PrimeiraColeta: healthCollectionDone.Load(),
+	}
+	if status.Banco {
+		status.Versao, _ = getCurrentVersion()
+	}
+	if status.Banco && status.PrimeiraColeta {
+		status.Status = healthStatusOK
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if status.Status != healthStatusOK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(status)
+}
+
+// healthURL retorna o endereço de /health do agente local (endereços curinga são consultados pelo loopback)
+func healthURL() string {
+	host := configString("endereco")
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+	}
+	return "http://" + net.JoinHostPort(host, strconv.Itoa(configInt("porta"))) + "/health"
+}
+
+// awaitUpdateHealth aguarda a nova versão, iniciada em cmd, responder saudável em /health
+// Falha se o processo encerrar, se outro processo responder ou se o prazo passar sem a inicialização ser concluída
+func awaitUpdateHealth(cmd *exec.Cmd, version string) error {
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+
+	client := &http.Client{Timeout: updateHealthPollInterval}
+	url := healthURL()
+	deadline := time.After(updateHealthDeadline)
+	ticker := time.NewTicker(updateHealthPollInterval)
+	defer ticker.Stop()
+
+	lastStatus := "sem resposta"
+	for {
+		select {
+		case err := <-exited:
+			return fmt.Errorf("nova versão encerrou durante a inicialização: %v", err)
+
+		case <-deadline:
+			// Encerrar a nova versão e aguardar o processo terminar, liberando o executável para a restauração
+			cmd.Process.Kill()
+			<-exited
+			return fmt.Errorf("nova versão não ficou saudável em %v (última situação: %s)", updateHealthDeadline, lastStatus)
+
+		case <-ticker.C:
+			resp, err := client.Get(url)
+			if err != nil {
+				continue
+			}
+			var status HealthStatus
+			err = json.NewDecoder(resp.Body).Decode(&status)
+			resp.Body.Close()
+			if err != nil {
+				lastStatus = fmt.Sprintf("resposta inválida: %v", err)
+				continue
+			}
+			if status.PID != cmd.Process.Pid {
+				lastStatus = fmt.Sprintf("porta ocupada pelo processo %d", status.PID)
+				continue
+			}
+
+			lastStatus = fmt.Sprintf("%s (banco: %t, primeira coleta: %t)", status.Status, status.Banco, status.PrimeiraColeta)
+			if status.Status == healthStatusOK && status.Versao == version {
+				return nil
+			}
+		}
+	}
+}
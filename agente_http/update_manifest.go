@@ -0,0 +1,246 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Caminho do manifesto assinado no servidor de atualização
+const updateManifestPath = "/manifest.json"
+
+// Canal padrão, em que versões de pré-lançamento só são instaladas se a política permitir explicitamente
+const stableUpdateChannel = "stable"
+
+// Políticas para versões de pré-lançamento (configuração aceitar_pre_lancamento)
+const (
+	prereleasePolicyChannel = "canal" // Aceitas fora do canal stable
+	prereleasePolicyAlways  = "sim"
+	prereleasePolicyNever   = "nao"
+)
+
+// Tamanho máximo aceito para o manifesto
+const maxUpdateManifestSize = 1 << 20
+
+// Validade máxima aceita para a autorização de reversão, contada de publicado_em
+const maxRollbackValidity = 7 * 24 * time.Hour
+
+// Motivos de recusa de uma atualização
+var (
+	errManifestSignature = errors.New("assinatura do manifesto de atualização inválida")
+	errManifestPlatform  = errors.New("manifesto sem artefato para esta plataforma")
+	errArtifactMismatch  = errors.New("arquivo baixado não confere com o manifesto")
+)
+
+// UpdateArtifact descreve o executável publicado para uma plataforma
+type UpdateArtifact struct {
+	URL     string `json:"url"` // Absoluta ou relativa ao servidor de atualização
+	Tamanho int64  `json:"tamanho"`
+	SHA256  string `json:"sha256"` // Hexadecimal
+	// Patches a partir das versões anteriores, aplicados ao executável atual em vez do download completo
+	Deltas []UpdateDelta `json:"deltas,omitempty"`
+}
+
+// UpdateManifest descreve a versão publicada no servidor de atualização
+// Os artefatos são indexados pela plataforma no formato "sistema/arquitetura" (ex: windows/amd64)
+type UpdateManifest struct {
+	Versao      string                    `json:"versao"`
+	Canal       string                    `json:"canal,omitempty"` // Canal de onde a versão foi publicada
+	PublicadoEm int64                     `json:"publicado_em"`    // Unix, em segundos
+	Notas       string                    `json:"notas,omitempty"`
+	Artefatos   map[string]UpdateArtifact `json:"artefatos"`
+	// Reversão assinada: autoriza os agentes na versão ReversaoDe a instalarem esta versão, anterior à instalada,
+	// até ReversaoExpiraEm (Unix, em segundos)
+	Reversao         bool   `json:"reversao,omitempty"`
+	ReversaoDe       string `json:"reversao_de,omitempty"`
+	ReversaoExpiraEm int64  `json:"reversao_expira_em,omitempty"`
+	MotivoReversao   string `json:"motivo_reversao,omitempty"`
+
+	// Pares da mesma rede que já têm a versão, indicados pelo servidor fora do manifesto assinado
+	Pares []string `json:"-"`
+}
+
+// SignedManifest é o documento servido em /manifest.json: o manifesto serializado e a assinatura da chave de release
+// A assinatura é RSA PKCS#1 v1.5 com SHA-256 sobre o prefixo dos manifestos seguido dos bytes do manifesto e
+// precisa ser de uma chave de release confiável; as chaves de comandos não são aceitas
+type SignedManifest struct {
+	Manifesto  string `json:"manifesto"`  // JSON do UpdateManifest em base64
+	Assinatura string `json:"assinatura"` // Assinatura em base64
+	ChaveID    string `json:"chave_id,omitempty"`
+}
+
+// fetchUpdateManifest baixa o manifesto do servidor de atualização e verifica a assinatura
+// A consulta informa o canal, o identificador e a versão do agente; o servidor decide qual versão este agente
+// deve receber e responde 204 quando não há versão liberada para ele (o manifesto retornado é nil)
+func fetchUpdateManifest(currentVersion string) (*UpdateManifest, error) {
+	query := url.Values{}
+	query.Set("canal", configString("canal_atualizacao"))
+	query.Set("agente_id", getAgentID())
+	query.Set("versao", currentVersion)
+	query.Set("plataforma", runtime.GOOS+"/"+runtime.GOARCH)
+	// Com o compartilhamento ativo, o servidor indica este agente aos pares da mesma rede
+	if p2pEnabled() {
+		if address, network, ok := peerAdvertisement(); ok {
+			query.Set("endereco", address)
+			query.Set("rede", network)
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodGet, updateServerURL+updateManifestPath+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao criar requisição do manifesto: %v", err)
+	}
+	setAgentIdentityHeaders(req.Header)
+
+	client := &http.Client{
+		Timeout: 30 * time.Second,
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao acessar servidor de atualizações: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNoContent {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("servidor retornou código de status %d ao buscar o manifesto", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxUpdateManifestSize))
+	if err != nil {
+		return nil, fmt.Errorf("erro ao ler manifesto: %v", err)
+	}
+
+	manifest, err := openSignedManifest(body)
+	if err != nil {
+		return nil, err
+	}
+	if peers := resp.Header.Get(peersHeader); peers != "" {
+		manifest.Pares = strings.Split(peers, ",")
+	}
+	return manifest, nil
+}
+
+// openSignedManifest verifica a assinatura do manifesto e o interpreta
+func openSignedManifest(body []byte) (*UpdateManifest, error) {
+	var signed SignedManifest
+	if err := json.Unmarshal(body, &signed); err != nil {
+		return nil, fmt.Errorf("manifesto inválido: %v", err)
+	}
+
+	manifestBytes, err := base64.StdEncoding.DecodeString(signed.Manifesto)
+	if err != nil || len(manifestBytes) == 0 {
+		return nil, fmt.Errorf("manifesto inválido: conteúdo não está em base64")
+	}
+	signature, err := base64.StdEncoding.DecodeString(signed.Assinatura)
+	if err != nil || len(signature) == 0 {
+		return nil, fmt.Errorf("manifesto inválido: assinatura não está em base64")
+	}
+
+	// Verificar a assinatura antes de interpretar o conteúdo
+	if err := verifyTrustedSignature(keyPurposeRelease, signed.ChaveID, withSignaturePrefix(manifestSignaturePrefix, manifestBytes), signature); err != nil {
+		return nil, fmt.Errorf("%w: %v", errManifestSignature, err)
+	}
+
+	var manifest UpdateManifest
+	if err := json.Unmarshal(manifestBytes, &manifest); err != nil {
+		return nil, fmt.Errorf("manifesto inválido: %v", err)
+	}
+	if _, err := parseVersion(manifest.Versao); err != nil {
+		return nil, fmt.Errorf("manifesto inválido: %v", err)
+	}
+
+	return &manifest, nil
+}
+
+// checkRollback verifica se a reversão assinada vale para a versão instalada: a versão retirada precisa ser
+// a instalada e a autorização precisa estar dentro da validade, contada da publicação do manifesto
+func (m *UpdateManifest) checkRollback(currentVersion string) error {
+	if !m.Reversao {
+		return fmt.Errorf("versão não foi assinada como reversão")
+	}
+	if m.ReversaoDe == "" {
+		return fmt.Errorf("reversão sem a versão retirada")
+	}
+	comparison, err := compareVersions(m.ReversaoDe, currentVersion)
+	if err != nil {
+		return fmt.Errorf("versão retirada da reversão inválida: %v", err)
+	}
+	if comparison != 0 {
+		return fmt.Errorf("reversão a partir da versão %s, instalada %s", m.ReversaoDe, currentVersion)
+	}
+
+	publishedAt := time.Unix(m.PublicadoEm, 0)
+	expiresAt := time.Unix(m.ReversaoExpiraEm, 0)
+	if m.PublicadoEm <= 0 || !expiresAt.After(publishedAt) || expiresAt.Sub(publishedAt) > maxRollbackValidity {
+		return fmt.Errorf("validade da reversão inválida")
+	}
+	if !time.Now().Before(expiresAt) {
+		return fmt.Errorf("reversão expirada em %s", expiresAt.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// platformArtifact retorna o artefato do manifesto para a plataforma do agente
+func (m *UpdateManifest) platformArtifact() (UpdateArtifact, error) {
+	platform := runtime.GOOS + "/" + runtime.GOARCH
+	artifact, ok := m.Artefatos[platform]
+	if !ok {
+		return UpdateArtifact{}, fmt.Errorf("%w: %s", errManifestPlatform, platform)
+	}
+	if artifact.URL == "" || artifact.Tamanho <= 0 {
+		return UpdateArtifact{}, fmt.Errorf("manifesto inválido: artefato incompleto para %s", platform)
+	}
+	if sum, err := hex.DecodeString(artifact.SHA256); err != nil || len(sum) != sha256.Size {
+		return UpdateArtifact{}, fmt.Errorf("manifesto inválido: SHA-256 inválido para %s", platform)
+	}
+	return artifact, nil
+}
+
+// artifactURL resolve a URL do artefato em relação ao servidor de atualização
+func artifactURL(artifact UpdateArtifact) (string, error) {
+	base, err := url.Parse(strings.TrimRight(updateServerURL, "/") + "/")
+	if err != nil {
+		return "", fmt.Errorf("servidor de atualização inválido: %v", err)
+	}
+	ref, err := url.Parse(artifact.URL)
+	if err != nil {
+		return "", fmt.Errorf("URL do artefato inválida: %v", err)
+	}
+	return base.ResolveReference(ref).String(), nil
+}
+
+// verifyArtifactFile confere o tamanho e o SHA-256 do arquivo baixado com o manifesto
+func verifyArtifactFile(path string, artifact UpdateArtifact) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("erro ao abrir arquivo baixado: %v", err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return fmt.Errorf("erro ao calcular SHA-256 do arquivo baixado: %v", err)
+	}
+
+	if size != artifact.Tamanho {
+		return fmt.Errorf("%w: tamanho %d, esperado %d", errArtifactMismatch, size, artifact.Tamanho)
+	}
+	if sum := hex.EncodeToString(hash.Sum(nil)); !strings.EqualFold(sum, artifact.SHA256) {
+		return fmt.Errorf("%w: SHA-256 %s, esperado %s", errArtifactMismatch, sum, artifact.SHA256)
+	}
+	return nil
+}
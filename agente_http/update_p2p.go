@@ -0,0 +1,340 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Caminho em que o agente serve o próprio executável aos pares da rede (/atualizacoes/<sha256>)
+const peerUpdatePath = "/atualizacoes/"
+
+// Cabeçalho da resposta do manifesto com os pares (ip:porta) da mesma rede que já têm a versão liberada
+const peersHeader = "X-Pares-Atualizacao"
+
+// Tempo de espera pelas ofertas dos pares após a procura por broadcast
+const peerDiscoveryTimeout = 2 * time.Second
+
+// Quantidade máxima de pares tentados antes do download pelo servidor de atualização
+const maxPeerAttempts = 5
+
+// Envios simultâneos do executável aos pares; acima disso, os pares recebem 503 e tentam outro
+const maxPeerUploads = 4
+
+// Prazo total do download de um par: o tempo de conexão mais o tamanho do executável na vazão mínima exigida,
+// para que um par que envia os dados aos poucos não atrase a atualização
+const (
+	peerDownloadBaseTimeout = 30 * time.Second
+	peerMinThroughput       = 128 << 10 // Bytes por segundo
+)
+
+// Tipos de mensagem da procura por broadcast
+const (
+	peerMessageQuery = "procura"
+	peerMessageOffer = "oferta"
+)
+
+// Nenhum par entregou o executável: a atualização usa o servidor de atualização
+var errNoPeers = errors.New("nenhum par com o executável na rede")
+
+// PeerDiscoveryMessage é a mensagem UDP da procura por pares: a procura leva o SHA-256 do executável desejado
+// e a oferta, a porta HTTP de onde ele pode ser baixado
+type PeerDiscoveryMessage struct {
+	Tipo   string `json:"tipo"`
+	SHA256 string `json:"sha256"`
+	Porta  int    `json:"porta,omitempty"`
+}
+
+// SHA-256 do executável em execução, calculado uma única vez (o executável só muda com a reinicialização)
+var (
+	ownExecutablePath string
+	ownExecutableSum  string
+	ownExecutableOnce sync.Once
+	peerUploads       = make(chan struct{}, maxPeerUploads)
+)
+
+// p2pEnabled informa se o agente compartilha atualizações com os pares e baixa atualizações deles
+func p2pEnabled() bool {
+	return configString("p2p_atualizacao") == "sim"
+}
+
+// ownExecutable retorna o caminho e o SHA-256 do executável em execução
+func ownExecutable() (string, string) {
+	ownExecutableOnce.Do(func() {
+		exePath, err := os.Executable()
+		if err != nil {
+			return
+		}
+		exePath, _ = filepath.Abs(exePath)
+		file, err := os.Open(exePath)
+		if err != nil {
+			return
+		}
+		defer file.Close()
+
+		hash := sha256.New()
+		if _, err := io.Copy(hash, file); err != nil {
+			return
+		}
+		ownExecutablePath = exePath
+		ownExecutableSum = hex.EncodeToString(hash.Sum(nil))
+	})
+	return ownExecutablePath, ownExecutableSum
+}
+
+// localIPv4Networks retorna as redes IPv4 das interfaces ativas, exceto loopback
+func localIPv4Networks() []*net.IPNet {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+
+	var networks []*net.IPNet
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipnet, ok := addr.(*net.IPNet); ok && ipnet.IP.To4() != nil {
+				networks = append(networks, &net.IPNet{IP: ipnet.IP.To4(), Mask: ipnet.Mask})
+			}
+		}
+	}
+	return networks
+}
+
+// isLocalPeer verifica se o endereço pertence a uma das redes do agente (ou ao próprio computador)
+func isLocalPeer(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	if ip.IsLoopback() {
+		return true
+	}
+	for _, network := range localIPv4Networks() {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// peerAdvertisement retorna o endereço (ip:porta) e a rede (CIDR) anunciados ao servidor de atualização
+// Usa o endereço configurado em endereco ou, se o servidor escuta em todas as interfaces, a primeira rede local
+func peerAdvertisement() (string, string, bool) {
+	host := configString("endereco")
+	for _, network := range localIPv4Networks() {
+		if ip := net.ParseIP(host); ip != nil && !ip.IsUnspecified() && !network.IP.Equal(ip) {
+			continue
+		}
+		cidr := &net.IPNet{IP: network.IP.Mask(network.Mask), Mask: network.Mask}
+		return net.JoinHostPort(network.IP.String(), strconv.Itoa(configInt("porta"))), cidr.String(), true
+	}
+	return "", "", false
+}
+
+// peerUpdateHandler serve o executável do agente aos pares da rede (GET /atualizacoes/<sha256>)
+// Só é servido o executável em execução, que foi conferido com o manifesto assinado ao ser instalado, e apenas
+// se o SHA-256 pedido for o dele; o par confere o SHA-256 novamente com o seu manifesto
+func peerUpdateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Método não permitido", http.StatusMethodNotAllowed)
+		return
+	}
+	if !p2pEnabled() {
+		http.NotFound(w, r)
+		return
+	}
+	host, _, _ := net.SplitHostPort(r.RemoteAddr)
+	if !isLocalPeer(net.ParseIP(host)) {
+		http.Error(w, "Disponível apenas para a rede local", http.StatusForbidden)
+		return
+	}
+
+	requested := strings.TrimPrefix(r.URL.Path, peerUpdatePath)
+	exePath, sum := ownExecutable()
+	if sum == "" || !strings.EqualFold(requested, sum) {
+		http.NotFound(w, r)
+		return
+	}
+
+	select {
+	case peerUploads <- struct{}{}:
+		defer func() { <-peerUploads }()
+	default:
+		http.Error(w, "Limite de envios simultâneos atingido", http.StatusServiceUnavailable)
+		return
+	}
+
+	file, err := os.Open(exePath)
+	if err != nil {
+		http.Error(w, "Executável indisponível", http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		http.Error(w, "Executável indisponível", http.StatusInternalServerError)
+		return
+	}
+
+	fmt.Printf("Enviando executável ao par %s\n", r.RemoteAddr)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("ETag", `"`+sum+`"`)
+	http.ServeContent(w, r, "", info.ModTime(), file)
+}
+
+// startPeerDiscoveryListener responde às procuras por broadcast dos pares que buscam o executável deste agente
+func startPeerDiscoveryListener() {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{Port: configInt("porta_p2p")})
+	if err != nil {
+		fmt.Printf("Aviso: Não foi possível escutar as procuras de pares: %v\n", err)
+		return
+	}
+	defer conn.Close()
+
+	buffer := make([]byte, 1024)
+	for {
+		n, remote, err := conn.ReadFromUDP(buffer)
+		if err != nil {
+			fmt.Printf("Aviso: Procura de pares encerrada: %v\n", err)
+			return
+		}
+
+		var message PeerDiscoveryMessage
+		if json.Unmarshal(buffer[:n], &message) != nil || message.Tipo != peerMessageQuery {
+			continue
+		}
+		if _, sum := ownExecutable(); !p2pEnabled() || sum == "" || !strings.EqualFold(message.SHA256, sum) || !isLocalPeer(remote.IP) {
+			continue
+		}
+
+		offer, _ := json.Marshal(PeerDiscoveryMessage{Tipo: peerMessageOffer, SHA256: message.SHA256, Porta: configInt("porta")})
+		conn.WriteToUDP(offer, remote)
+	}
+}
+
+// discoverPeers procura por broadcast, em cada rede local, pares com o executável e retorna os endereços (ip:porta)
+func discoverPeers(sum string) []string {
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return nil
+	}
+	defer conn.Close()
+
+	query, _ := json.Marshal(PeerDiscoveryMessage{Tipo: peerMessageQuery, SHA256: sum})
+	port := configInt("porta_p2p")
+	targets := []net.IP{net.IPv4bcast}
+	for _, network := range localIPv4Networks() {
+		broadcast := make(net.IP, len(network.IP))
+		for i := range network.IP {
+			broadcast[i] = network.IP[i] | ^network.Mask[i]
+		}
+		targets = append(targets, broadcast)
+	}
+	for _, target := range targets {
+		conn.WriteToUDP(query, &net.UDPAddr{IP: target, Port: port})
+	}
+
+	var peers []string
+	seen := make(map[string]bool)
+	buffer := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(peerDiscoveryTimeout))
+	for {
+		n, remote, err := conn.ReadFromUDP(buffer)
+		if err != nil {
+			break
+		}
+		var offer PeerDiscoveryMessage
+		if json.Unmarshal(buffer[:n], &offer) != nil || offer.Tipo != peerMessageOffer || !strings.EqualFold(offer.SHA256, sum) {
+			continue
+		}
+		if offer.Porta < 1 || offer.Porta > 65535 || !isLocalPeer(remote.IP) {
+			continue
+		}
+		address := net.JoinHostPort(remote.IP.String(), strconv.Itoa(offer.Porta))
+		if !seen[address] {
+			seen[address] = true
+			peers = append(peers, address)
+		}
+	}
+	return peers
+}
+
+// peerDownloadDeadline retorna o prazo total do download de um par para um executável do tamanho informado
+func peerDownloadDeadline(size int64) time.Duration {
+	return peerDownloadBaseTimeout + time.Duration(size/peerMinThroughput)*time.Second
+}
+
+// downloadFromPeers baixa o executável de um par da rede, indicado pelo servidor de atualização ou encontrado
+// por broadcast, e confere o tamanho e o SHA-256 com o manifesto assinado antes de usá-lo
+// O download de cada par é feito em um arquivo separado e descartado se não conferir, para que um par malicioso
+// não consiga misturar conteúdo ao download do servidor
+func downloadFromPeers(serverPeers []string, downloadPath string, artifact UpdateArtifact) error {
+	if !p2pEnabled() {
+		return errNoPeers
+	}
+
+	var peers []string
+	seen := make(map[string]bool)
+	for _, address := range append(serverPeers, discoverPeers(artifact.SHA256)...) {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil || seen[address] || !isLocalPeer(net.ParseIP(host)) {
+			continue
+		}
+		seen[address] = true
+		peers = append(peers, address)
+	}
+	if len(peers) == 0 {
+		return errNoPeers
+	}
+	if len(peers) > maxPeerAttempts {
+		peers = peers[:maxPeerAttempts]
+	}
+
+	peerPath := strings.TrimSuffix(downloadPath, ".download") + ".par"
+	for _, address := range peers {
+		url := "http://" + address + peerUpdatePath + artifact.SHA256
+		logUpdateError(fmt.Sprintf("Baixando executável do par %s", address))
+
+		removeDownload(peerPath)
+		state := DownloadState{URL: url, SHA256: artifact.SHA256}
+		complete, err := downloadArtifactAttempt(url, peerPath, peerPath+downloadStateSuffix, artifact, &state, 0, peerDownloadDeadline(artifact.Tamanho))
+		if err == nil && !complete {
+			err = fmt.Errorf("download incompleto")
+		}
+		if err == nil {
+			err = verifyArtifactFile(peerPath, artifact)
+		}
+		if err != nil {
+			logUpdateError(fmt.Sprintf("Par %s recusado: %v", address, err))
+			removeDownload(peerPath)
+			continue
+		}
+
+		// O executável do par confere com o manifesto: ele substitui um eventual download parcial do servidor
+		os.Remove(peerPath + downloadStateSuffix)
+		removeDownload(downloadPath)
+		if err := os.Rename(peerPath, downloadPath); err != nil {
+			removeDownload(peerPath)
+			return fmt.Errorf("erro ao mover executável baixado do par: %v", err)
+		}
+		return nil
+	}
+	return errNoPeers
+}
@@ -1,15 +1,12 @@
 package main
 
 import (
+	"errors"
 	"fmt"
-	"io"
 	"math/rand"
-	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"strconv"
-	"strings"
 	"time"
 )
 
@@ -22,12 +19,13 @@ const (
 )
 
 // checkForUpdates verifica se há atualizações disponíveis
-func checkForUpdates() (bool, string, error) {
+// A versão publicada vem do manifesto assinado do servidor de atualização; manifestos sem assinatura válida são recusados
+func checkForUpdates() (bool, *UpdateManifest, error) {
 	// Obter a versão atual
 	currentVersion, err := getCurrentVersion()
 	if err != nil {
 		logUpdateError(fmt.Sprintf("Erro ao obter versão atual: %v", err))
-		return false, "", err
+		return false, nil, err
 	}
 
 	// Verificar se o arquivo de versão local existe e é recente
@@ -39,119 +37,114 @@ func checkForUpdates() (bool, string, error) {
 	if info, err := os.Stat(versionPath); err == nil {
 		if time.Since(info.ModTime()) < 2*time.Minute {
 			logUpdateError("Arquivo version.txt recente encontrado, pulando verificação de atualizações")
-			return false, currentVersion, nil
+			return false, nil, nil
 		}
 	}
 
-	// URL do arquivo de versão
-	versionURL := updateServerURL + "/version.txt"
-
-	// Fazer requisição HTTP para obter a versão mais recente
-	// Adicionar timeout para evitar bloqueio indefinido
-	client := &http.Client{
-		Timeout: 30 * time.Second,
-	}
-	resp, err := client.Get(versionURL)
+	// Baixar e verificar o manifesto
+	manifest, err := fetchUpdateManifest(currentVersion)
 	if err != nil {
-		errMsg := fmt.Sprintf("Erro ao acessar servidor de atualizações: %v", err)
-		logUpdateError(errMsg)
-		return false, "", fmt.Errorf(errMsg)
+		logUpdateError(err.Error())
+		return false, nil, err
 	}
-	defer resp.Body.Close()
-
-	// Verificar o código de status da resposta
-	if resp.StatusCode != http.StatusOK {
-		errMsg := fmt.Sprintf("Servidor retornou código de status %d", resp.StatusCode)
-		logUpdateError(errMsg)
-		return false, "", fmt.Errorf(errMsg)
+	if manifest == nil {
+		logUpdateError(fmt.Sprintf("Nenhuma versão liberada para este agente no canal %s", configString("canal_atualizacao")))
+		return false, nil, nil
 	}
 
-	// Ler o conteúdo da resposta
-	body, err := io.ReadAll(resp.Body)
+	// Comparar versões
+	comparison, err := compareVersions(manifest.Versao, currentVersion)
 	if err != nil {
-		return false, "", fmt.Errorf("erro ao ler resposta do servidor: %v", err)
+		logUpdateError(fmt.Sprintf("Erro ao comparar versões: %v", err))
+		return false, nil, err
+	}
+	if comparison == 0 {
+		return false, manifest, nil
 	}
 
-	// Obter a versão mais recente (remover espaços e quebras de linha)
-	latestVersion := strings.TrimSpace(string(body))
-
-	// Verificar se a versão está no formato esperado (x.y.z)
-	if !isValidVersionFormat(latestVersion) {
-		return false, "", fmt.Errorf("formato de versão inválido: %s", latestVersion)
+	// Instalar uma versão anterior à atual só quando o manifesto assinado a declara como reversão a partir
+	// da versão instalada e dentro da validade
+	if comparison < 0 {
+		if err := manifest.checkRollback(currentVersion); err != nil {
+			logUpdateError(fmt.Sprintf("Versão publicada %s é anterior à atual %s e foi recusada: %v", manifest.Versao, currentVersion, err))
+			return false, manifest, nil
+		}
+		logUpdateError(fmt.Sprintf("Reversão para a versão %s assinada pelo servidor (motivo: %s)", manifest.Versao, manifest.MotivoReversao))
 	}
 
-	// Comparar versões
-	if compareVersions(latestVersion, currentVersion) > 0 {
-		return true, latestVersion, nil
+	if version, _ := parseVersion(manifest.Versao); version.IsPrerelease() && !prereleaseAllowed() {
+		logUpdateError(fmt.Sprintf("Versão %s é de pré-lançamento e não é aceita pela política atual (aceitar_pre_lancamento: %s), ignorando",
+			manifest.Versao, configString("aceitar_pre_lancamento")))
+		return false, manifest, nil
 	}
 
-	return false, currentVersion, nil
+	// Versões que falharam ao iniciar em uma atualização anterior não são instaladas novamente
+	blocked, err := isVersionBlocked(manifest.Versao)
+	if err != nil {
+		return false, nil, err
+	}
+	if blocked {
+		logUpdateError(fmt.Sprintf("Versão %s bloqueada após falha na atualização, ignorando", manifest.Versao))
+		return false, manifest, nil
+	}
+	return true, manifest, nil
 }
 
-// compareVersions compara duas versões no formato x.y.z
-// Retorna:
-// -1 se v1 < v2
-//
-//	0 se v1 == v2
-//	1 se v1 > v2
-func compareVersions(v1, v2 string) int {
-	parts1 := strings.Split(v1, ".")
-	parts2 := strings.Split(v2, ".")
-
-	// Garantir que ambas as versões têm 3 partes
-	if len(parts1) != 3 || len(parts2) != 3 {
-		// Se alguma versão não tiver 3 partes, considerar iguais para evitar atualizações desnecessárias
-		return 0
-	}
-
-	// Comparar cada parte da versão
-	for i := 0; i < 3; i++ {
-		// Converter para inteiros
-		n1, err1 := strconv.Atoi(parts1[i])
-		n2, err2 := strconv.Atoi(parts2[i])
-
-		// Se houver erro na conversão, considerar iguais
-		if err1 != nil || err2 != nil {
-			continue
-		}
-
-		// Comparar os números
-		if n1 < n2 {
-			return -1
-		} else if n1 > n2 {
-			return 1
-		}
+// compareVersions compara duas versões pela precedência do SemVer 2.0
+// Retorna -1 se v1 < v2, 0 se iguais (metadados de build são ignorados) e 1 se v1 > v2
+func compareVersions(v1, v2 string) (int, error) {
+	parsed1, err := parseVersion(v1)
+	if err != nil {
+		return 0, err
 	}
-
-	// Se chegou aqui, as versões são iguais
-	return 0
+	parsed2, err := parseVersion(v2)
+	if err != nil {
+		return 0, err
+	}
+	return parsed1.Compare(parsed2), nil
 }
 
-// isValidVersionFormat verifica se a string está no formato de versão esperado (x.y.z)
+// isValidVersionFormat verifica se a string é uma versão SemVer 2.0 válida
 func isValidVersionFormat(version string) bool {
-	// Verificar se a versão corresponde ao padrão x.y.z onde x, y e z são números
-	parts := strings.Split(version, ".")
-	if len(parts) != 3 {
+	_, err := parseVersion(version)
+	return err == nil
+}
+
+// prereleaseAllowed informa se versões de pré-lançamento podem ser instaladas, conforme a configuração
+// aceitar_pre_lancamento: "sim", "nao" ou "canal" (apenas fora do canal stable)
+func prereleaseAllowed() bool {
+	switch configString("aceitar_pre_lancamento") {
+	case prereleasePolicyAlways:
+		return true
+	case prereleasePolicyNever:
 		return false
+	default:
+		return configString("canal_atualizacao") != stableUpdateChannel
 	}
+}
 
-	// Verificar se cada parte é um número
-	for _, part := range parts {
-		if len(part) == 0 {
-			return false
-		}
-		for _, char := range part {
-			if char < '0' || char > '9' {
-				return false
-			}
-		}
+// downloadAndUpdate baixa e instala a atualização descrita no manifesto
+// O executável é baixado para um arquivo temporário e só substitui o atual se o tamanho e o SHA-256 conferirem
+func downloadAndUpdate(manifest *UpdateManifest, isInitialCheck bool) error {
+	artifact, err := manifest.platformArtifact()
+	if err != nil {
+		logUpdateError(err.Error())
+		return err
+	}
+	downloadURL, err := artifactURL(artifact)
+	if err != nil {
+		logUpdateError(err.Error())
+		return err
+	}
+	previousVersion, err := getCurrentVersion()
+	if err != nil {
+		logUpdateError(err.Error())
+		return err
+	}
+	if manifest.Notas != "" {
+		logUpdateError(fmt.Sprintf("Notas da versão %s: %s", manifest.Versao, manifest.Notas))
 	}
 
-	return true
-}
-
-// downloadAndUpdate baixa e instala a atualização
-func downloadAndUpdate(newVersion string, isInitialCheck bool) error {
 	// Adicionar delay apenas se não for verificação inicial
 	if !isInitialCheck {
 		delaySeconds := time.Duration(MinUpdateDelay + rand.Intn(MaxUpdateDelayAdd)) // Gera um número entre 60 e 180 segundos
@@ -164,7 +157,7 @@ func downloadAndUpdate(newVersion string, isInitialCheck bool) error {
 	if err != nil {
 		errMsg := fmt.Sprintf("Erro ao obter caminho do executável: %v", err)
 		logUpdateError(errMsg)
-		return fmt.Errorf(errMsg)
+		return errors.New(errMsg)
 	}
 
 	// Garantir que temos o caminho absoluto
@@ -172,18 +165,54 @@ func downloadAndUpdate(newVersion string, isInitialCheck bool) error {
 	if err != nil {
 		errMsg := fmt.Sprintf("Erro ao obter caminho absoluto do executável: %v", err)
 		logUpdateError(errMsg)
-		return fmt.Errorf(errMsg)
+		return errors.New(errMsg)
 	}
 
 	// Obter o diretório do executável
 	exeDir := filepath.Dir(exePath)
 	logUpdateError(fmt.Sprintf("Diretório do executável: %s", exeDir))
 
-	// Definir caminhos para os arquivos
-	backupPath := filepath.Join(exeDir, "agente_http.exe~")
-	newExePath := filepath.Join(exeDir, "agente_http.exe")
+	// Definir caminhos para os arquivos a partir do nome do executável em execução
+	// (agente_http.exe no Windows, agente_http no Linux)
+	exeName := filepath.Base(exePath)
+	backupPath := filepath.Join(exeDir, exeName+"~")
+	newExePath := filepath.Join(exeDir, exeName)
+	downloadPath := filepath.Join(exeDir, exeName+".download")
 	versionPath := filepath.Join(exeDir, "version.txt")
 
+	// 1. Montar a nova versão aplicando um patch ao executável atual ou, sem patch aplicável, baixar o executável
+	// completo de um par da rede ou do servidor para o arquivo temporário
+	err = downloadDeltaUpdate(artifact, exePath, downloadPath)
+	if err == nil {
+		logUpdateError(fmt.Sprintf("Versão %s montada a partir do patch do executável atual", manifest.Versao))
+	} else {
+		if !errors.Is(err, errNoDelta) {
+			logUpdateError(fmt.Sprintf("Patch não aplicado (%v), baixando o executável completo", err))
+		}
+
+		// Pares da rede que já instalaram a versão evitam o download pelo link do servidor
+		err = downloadFromPeers(manifest.Pares, downloadPath, artifact)
+		if err == nil {
+			logUpdateError(fmt.Sprintf("Versão %s baixada de um par da rede", manifest.Versao))
+		} else {
+			logUpdateError(fmt.Sprintf("Baixando versão %s do executável de %s", manifest.Versao, downloadURL))
+			// O arquivo parcial é mantido em caso de falha e continuado na próxima verificação
+			err = downloadArtifact(downloadURL, downloadPath, artifact)
+			if err != nil {
+				logUpdateError(fmt.Sprintf("Erro ao baixar nova versão: %v", err))
+				return err
+			}
+		}
+	}
+
+	// 2. Conferir o tamanho e o SHA-256 com o manifesto assinado
+	if err := verifyArtifactFile(downloadPath, artifact); err != nil {
+		logUpdateError(fmt.Sprintf("Atualização recusada: %v", err))
+		removeDownload(downloadPath)
+		return err
+	}
+	logUpdateError(fmt.Sprintf("SHA-256 conferido: %s", artifact.SHA256))
+
 	// Verificar se já existe um backup e removê-lo se necessário
 	if _, err := os.Stat(backupPath); err == nil {
 		logUpdateError("Removendo backup antigo...")
@@ -194,76 +223,87 @@ func downloadAndUpdate(newVersion string, isInitialCheck bool) error {
 		}
 	}
 
-	// 1. Renomear o executável atual para backup
+	// 3. Renomear o executável atual para backup e o arquivo baixado para o seu lugar
 	logUpdateError(fmt.Sprintf("Renomeando executável atual para backup: %s -> %s", exePath, backupPath))
 	err = os.Rename(exePath, backupPath)
 	if err != nil {
 		errMsg := fmt.Sprintf("Erro ao renomear executável atual: %v", err)
 		logUpdateError(errMsg)
-		return fmt.Errorf(errMsg)
+		os.Remove(downloadPath)
+		return errors.New(errMsg)
 	}
-
-	// 2. Baixar a nova versão do executável
-	logUpdateError(fmt.Sprintf("Baixando nova versão do executável de %s", updateServerURL+"/agente_http.exe"))
-	err = downloadFile(updateServerURL+"/agente_http.exe", newExePath)
+	err = os.Rename(downloadPath, newExePath)
 	if err != nil {
 		// Restaurar o executável original em caso de erro
-		logUpdateError(fmt.Sprintf("Erro ao baixar nova versão: %v. Restaurando executável original...", err))
+		logUpdateError(fmt.Sprintf("Erro ao instalar nova versão: %v. Restaurando executável original...", err))
 		os.Rename(backupPath, exePath)
+		os.Remove(downloadPath)
 		return err
 	}
-
-	// 3. Baixar a chave pública atualizada
-	logUpdateError("Baixando chave pública atualizada...")
-	keysDir := filepath.Join(exeDir, "keys")
-	if _, err := os.Stat(keysDir); os.IsNotExist(err) {
-		err = os.MkdirAll(keysDir, 0700)
-		if err != nil {
-			logUpdateError(fmt.Sprintf("Aviso: Não foi possível criar diretório de chaves: %v", err))
-		}
+	if err := os.Chmod(newExePath, 0755); err != nil {
+		logUpdateError(fmt.Sprintf("Aviso: Não foi possível tornar o novo executável executável: %v", err))
 	}
 
-	publicKeyPath := filepath.Join(keysDir, "public_key.pem")
-	err = downloadFile(updateServerURL+"/public_key.pem", publicKeyPath)
+	// Gravar a versão instalada (lida pela nova versão ao iniciar)
+	err = os.WriteFile(versionPath, []byte(manifest.Versao), 0644)
 	if err != nil {
-		logUpdateError(fmt.Sprintf("Aviso: Não foi possível baixar chave pública: %v", err))
-		// Continuar mesmo com erro na chave pública
+		logUpdateError(fmt.Sprintf("Aviso: Não foi possível criar arquivo de versão: %v", err))
 	}
 
-	// 4. Baixar o arquivo version.txt
-	logUpdateError("Baixando arquivo de versão...")
-	err = downloadFile(updateServerURL+"/version.txt", versionPath)
-	if err != nil {
-		logUpdateError(fmt.Sprintf("Aviso: Não foi possível baixar arquivo de versão: %v", err))
-		// Criar o arquivo manualmente com a versão informada
-		err = os.WriteFile(versionPath, []byte(newVersion), 0644)
-		if err != nil {
-			logUpdateError(fmt.Sprintf("Aviso: Não foi possível criar arquivo de versão: %v", err))
-		}
-	}
-
-	// 5. Fechar o servidor HTTP para liberar a porta
+	// 4. Fechar o servidor HTTP para liberar a porta (reaberto se a atualização for desfeita)
 	logUpdateError("Fechando servidor HTTP para liberar a porta...")
-	// Implementado em http_server.go - será chamado antes de iniciar o novo executável
+	serverAddress := ""
+	if httpServer != nil {
+		serverAddress = httpServer.Addr
+		shutdownHTTPServer()
+	}
 
-	// 7. Executar o novo executável
+	// 5. Executar o novo executável e aguardar a confirmação de que iniciou corretamente
 	logUpdateError("Iniciando nova versão do aplicativo...")
-	cmd := exec.Command(newExePath)
+	// A nova versão recebe os mesmos parâmetros de linha de comando (porta, endereço, diretórios...)
+	cmd := exec.Command(newExePath, os.Args[1:]...)
 	cmd.Dir = exeDir
 	err = cmd.Start()
+	if err == nil {
+		logUpdateError(fmt.Sprintf("Aguardando a nova versão ficar saudável (prazo: %v)...", updateHealthDeadline))
+		err = awaitUpdateHealth(cmd, manifest.Versao)
+	}
 	if err != nil {
-		errMsg := fmt.Sprintf("Erro ao iniciar nova versão: %v. Restaurando executável original...", err)
-		logUpdateError(errMsg)
-		os.Rename(backupPath, exePath)
-		return fmt.Errorf(errMsg)
+		logUpdateError(fmt.Sprintf("Falha na atualização para %s: %v. Restaurando executável original...", manifest.Versao, err))
+		rollbackUpdate(exePath, backupPath, newExePath, versionPath, previousVersion)
+		if blockErr := blockVersion(manifest.Versao, err.Error()); blockErr != nil {
+			logUpdateError(fmt.Sprintf("Aviso: %v", blockErr))
+		} else {
+			logUpdateError(fmt.Sprintf("Versão %s bloqueada: não será instalada novamente", manifest.Versao))
+		}
+		enqueueEvent(eventUpdateRolledBack, map[string]string{"versao": manifest.Versao, "versao_atual": previousVersion, "motivo": err.Error()})
+		if serverAddress != "" {
+			initHTTPServer(serverAddress)
+		}
+		return fmt.Errorf("atualização desfeita: %v", err)
 	}
 
-	// 8. Fechar o executável atual (será feito pelo chamador)
+	// 6. Fechar o executável atual (será feito pelo chamador)
 	logUpdateError("Nova versão iniciada com sucesso. Encerrando versão atual...")
 
 	return nil
 }
 
+// rollbackUpdate restaura o executável e o arquivo de versão anteriores após uma atualização que falhou
+func rollbackUpdate(exePath, backupPath, newExePath, versionPath, previousVersion string) {
+	if newExePath != exePath {
+		os.Remove(newExePath)
+	}
+	if err := os.Rename(backupPath, exePath); err != nil {
+		logUpdateError(fmt.Sprintf("Erro ao restaurar executável original: %v", err))
+	}
+
+	// A versão anterior, ao reiniciar, lê o arquivo de versão: ele precisa voltar a indicar a versão instalada
+	if err := os.WriteFile(versionPath, []byte(previousVersion), 0644); err != nil {
+		logUpdateError(fmt.Sprintf("Aviso: Não foi possível restaurar arquivo de versão: %v", err))
+	}
+}
+
 // Função para registrar erros de atualização
 func logUpdateError(message string) error {
 	// Exibir a mensagem no console
@@ -281,38 +321,3 @@ func restartApplication() {
 	// Encerrar o processo atual
 	os.Exit(0)
 }
-
-// downloadFile baixa um arquivo de uma URL e salva no caminho especificado
-func downloadFile(url, filepath string) error {
-	// Criar o cliente HTTP com timeout
-	client := &http.Client{
-		Timeout: 60 * time.Second,
-	}
-
-	// Fazer a requisição HTTP
-	resp, err := client.Get(url)
-	if err != nil {
-		return fmt.Errorf("erro ao fazer requisição HTTP: %v", err)
-	}
-	defer resp.Body.Close()
-
-	// Verificar o código de status
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("servidor retornou código de status %d", resp.StatusCode)
-	}
-
-	// Criar o arquivo de destino
-	out, err := os.Create(filepath)
-	if err != nil {
-		return fmt.Errorf("erro ao criar arquivo: %v", err)
-	}
-	defer out.Close()
-
-	// Copiar o conteúdo da resposta para o arquivo
-	_, err = io.Copy(out, resp.Body)
-	if err != nil {
-		return fmt.Errorf("erro ao salvar arquivo: %v", err)
-	}
-
-	return nil
-}
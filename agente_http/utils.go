@@ -1,9 +1,11 @@
 package main
 
 import (
+	"crypto/rand"
 	"fmt"
 	"net"
 	"os"
+	"os/exec"
 	"os/signal"
 	"path/filepath"
 	"strconv"
@@ -46,10 +48,31 @@ func parseUint64(s string) uint64 {
 	return val
 }
 
-// isPortInUse verifica se a porta especificada já está em uso
-func isPortInUse(port int) bool {
+// Executa um comando do sistema e retorna a saída como string
+func executeCommand(command string, args ...string) (string, error) {
+	cmd := exec.Command(command, args...)
+	output, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	return string(output), nil
+}
+
+// newUUID gera um UUID aleatório (versão 4)
+func newUUID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("erro ao gerar UUID: %v", err)
+	}
+	b[6] = (b[6] & 0x0f) | 0x40 // Versão 4
+	b[8] = (b[8] & 0x3f) | 0x80 // Variante RFC 4122
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
+
+// isPortInUse verifica se a porta especificada já está em uso no endereço (vazio: todas as interfaces)
+func isPortInUse(host string, port int) bool {
 	// Tenta fazer um bind na porta para verificar se está disponível
-	address := fmt.Sprintf(":%d", port)
+	address := net.JoinHostPort(host, strconv.Itoa(port))
 	listener, err := net.Listen("tcp", address)
 
 	// Se não conseguir fazer o bind, a porta está em uso
@@ -173,14 +196,14 @@ func manageUpdateChecks() {
 		case <-ticker.C:
 			// É hora de verificar atualizações
 			fmt.Printf("[manageUpdateChecks] Verificando atualizações disponíveis (intervalo: %d minutos)...\n", updateCheckIntervalMinutes)
-			updateAvailable, latestVersion, err := checkForUpdates()
+			updateAvailable, manifest, err := checkForUpdates()
 			if err != nil {
 				fmt.Printf("Aviso: Não foi possível verificar atualizações: %v\n", err)
 			} else if updateAvailable {
-				fmt.Printf("Nova versão disponível: %s. Baixando atualização...\n", latestVersion)
+				fmt.Printf("Nova versão disponível: %s. Baixando atualização...\n", manifest.Versao)
 				// Executar o download e atualização em uma goroutine separada
-				go func(version string) {
-					err = downloadAndUpdate(version, false) // Passar false para verificações periódicas
+				go func(manifest *UpdateManifest) {
+					err = downloadAndUpdate(manifest, false) // Passar false para verificações periódicas
 					if err != nil {
 						fmt.Printf("Erro ao baixar atualização: %v\n", err)
 					} else {
@@ -188,7 +211,7 @@ func manageUpdateChecks() {
 						// Reiniciar o aplicativo
 						restartApplication()
 					}
-				}(latestVersion)
+				}(manifest)
 
 				// Continuar processando normalmente
 				fmt.Println("Iniciando download da atualização em segundo plano...")
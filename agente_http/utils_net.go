@@ -103,3 +103,31 @@ func getDefaultGateway() (string, error) {
 
 	return "", fmt.Errorf("gateway padrão não encontrado na tabela de rotas")
 }
+
+// getPrimaryMacAddress retorna o MAC da primeira interface ativa, não-loopback e com endereço IPv4
+// É o mesmo critério usado pelo servidor_http para identificar o computador
+func getPrimaryMacAddress() (string, error) {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return "", err
+	}
+
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 || len(iface.HardwareAddr) == 0 {
+			continue
+		}
+
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+
+		for _, addr := range addrs {
+			if ipnet, ok := addr.(*net.IPNet); ok && ipnet.IP.To4() != nil {
+				return iface.HardwareAddr.String(), nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("nenhuma interface de rede ativa encontrada")
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+)
+
+// Cabeçalhos com o identificador do agente e a assinatura Ed25519 do corpo da resposta, feita com a chave própria do agente
+const (
+	agentIDHeader        = "X-Agente-ID"
+	agentSignatureHeader = "X-Agente-Assinatura"
+)
+
+// Cabeçalho das requisições com o desafio (nonce) incluído pelo agente na assinatura da resposta, e prefixo dos
+// dados assinados nas respostas (os mesmos usados pelo agente)
+const (
+	agentChallengeHeader         = "X-Agente-Desafio"
+	agentResponseSignaturePrefix = "agente-resposta-v1"
+)
+
+// Aceitar, com um aviso, respostas de agentes antigos sem chave registrada no banco do servidor (-aceitar-agentes-sem-chave)
+var acceptLegacyAgents = false
+
+// Identificador do agente consultado informado pelo operador (-agente-id); sem ele, o agente esperado é o
+// computador registrado com o IP consultado no banco do servidor de coleta
+var targetAgentID string
+
+// Agentes sem chave registrada já avisados (o aviso é exibido uma vez por agente)
+var unverifiedAgents = make(map[string]bool)
+
+// lookupAgentKey consulta no banco do servidor de coleta (data/computers.db) a chave registrada do agente
+// e se ele consta na lista de revogação. Bancos de versões antigas do servidor não têm as chaves: o agente é desconhecido
+func lookupAgentKey(agentID string) (string, bool, error) {
+	if db == nil {
+		if err := initDatabase(); err != nil {
+			return "", false, err
+		}
+	}
+
+	var hasRevocations, hasKeys bool
+	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = 'agent_revocations')").Scan(&hasRevocations)
+	if err != nil {
+		return "", false, fmt.Errorf("erro ao consultar lista de revogação: %v", err)
+	}
+	if hasRevocations {
+		var revoked bool
+		err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM agent_revocations WHERE agent_id = ?)", agentID).Scan(&revoked)
+		if err != nil {
+			return "", false, fmt.Errorf("erro ao consultar lista de revogação: %v", err)
+		}
+		if revoked {
+			return "", true, nil
+		}
+	}
+
+	err = db.QueryRow("SELECT EXISTS(SELECT 1 FROM pragma_table_info('computers') WHERE name = 'chave_publica')").Scan(&hasKeys)
+	if err != nil {
+		return "", false, fmt.Errorf("erro ao consultar chaves dos agentes: %v", err)
+	}
+	if !hasKeys {
+		return "", false, nil
+	}
+
+	var key sql.NullString
+	err = db.QueryRow("SELECT chave_publica FROM computers WHERE agent_id = ?", agentID).Scan(&key)
+	if err != nil && err != sql.ErrNoRows {
+		return "", false, fmt.Errorf("erro ao consultar chave do agente: %v", err)
+	}
+	return key.String, false, nil
+}
+
+// newAgentChallenge gera o desafio de uma requisição ao agente
+func newAgentChallenge() (string, error) {
+	challenge := make([]byte, 16)
+	if _, err := rand.Read(challenge); err != nil {
+		return "", fmt.Errorf("erro ao gerar desafio: %v", err)
+	}
+	return hex.EncodeToString(challenge), nil
+}
+
+// agentResponseSignedData monta os dados assinados da resposta do agente: o desafio da requisição, o agente e o conteúdo
+func agentResponseSignedData(challenge, agentID string, data []byte) []byte {
+	signed := []byte(agentResponseSignaturePrefix + "\n" + challenge + "\n" + agentID + "\n")
+	return append(signed, data...)
+}
+
+// lookupAgentIDByIP consulta no banco do servidor de coleta o identificador do computador visto por último no IP
+// Retorna vazio se nenhum computador está registrado com o IP
+func lookupAgentIDByIP(ip string) (string, error) {
+	if db == nil {
+		if err := initDatabase(); err != nil {
+			return "", err
+		}
+	}
+
+	var hasAgentID bool
+	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM pragma_table_info('computers') WHERE name = 'agent_id')").Scan(&hasAgentID)
+	if err != nil {
+		return "", fmt.Errorf("erro ao consultar agentes registrados: %v", err)
+	}
+	if !hasAgentID {
+		return "", nil
+	}
+
+	var agentID string
+	err = db.QueryRow(`
+		SELECT agent_id FROM computers
+		WHERE ip_address = ?
+		ORDER BY last_seen DESC
+		LIMIT 1
+	`, ip).Scan(&agentID)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("erro ao consultar agente do IP %s: %v", ip, err)
+	}
+	return agentID, nil
+}
+
+// expectedAgentID retorna o identificador do agente que deve responder no endereço consultado (IP ou IP:porta):
+// o informado com -agente-id ou o do computador registrado com o IP no servidor de coleta
+// A identificação apresentada pelo próprio agente não é usada, para que outro computador no mesmo IP não seja aceito
+func expectedAgentID(agentAddress string) (string, error) {
+	if targetAgentID != "" {
+		return targetAgentID, nil
+	}
+
+	host, _, err := net.SplitHostPort(agentAddress)
+	if err != nil {
+		host = agentAddress
+	}
+	agentID, err := lookupAgentIDByIP(host)
+	if err != nil {
+		return "", err
+	}
+	if agentID == "" {
+		return "", fmt.Errorf("nenhum agente registrado com o IP %s no servidor de coleta (data/computers.db); informe o identificador com -agente-id", host)
+	}
+	return agentID, nil
+}
+
+// verifyAgentSignature verifica a assinatura do agente sobre os dados e o desafio da requisição, com a chave
+// registrada no servidor de coleta
+// Agentes revogados, sem chave registrada ou com assinatura inválida são recusados; agentes sem chave só são
+// aceitos, com um aviso, se -aceitar-agentes-sem-chave tiver sido informado
+func verifyAgentSignature(agentID, challenge string, data []byte, signature string) error {
+	if agentID == "" {
+		return fmt.Errorf("identificador do agente esperado não informado")
+	}
+
+	key, revoked, err := lookupAgentKey(agentID)
+	if err != nil {
+		return err
+	}
+	if revoked {
+		return fmt.Errorf("agente %s revogado", agentID)
+	}
+	if key == "" {
+		if !acceptLegacyAgents {
+			return fmt.Errorf("agente %s sem chave registrada no servidor de coleta", agentID)
+		}
+		if !unverifiedAgents[agentID] {
+			unverifiedAgents[agentID] = true
+			log.Printf("Aviso: agente %s sem chave registrada no servidor de coleta; assinatura não verificada", agentID)
+		}
+		return nil
+	}
+
+	rawKey, err := base64.StdEncoding.DecodeString(key)
+	if err != nil || len(rawKey) != ed25519.PublicKeySize {
+		return fmt.Errorf("chave registrada do agente %s inválida", agentID)
+	}
+	if signature == "" {
+		return fmt.Errorf("resposta do agente %s sem assinatura", agentID)
+	}
+	signatureBytes, err := base64.StdEncoding.DecodeString(signature)
+	signedData := agentResponseSignedData(challenge, agentID, data)
+	if err != nil || !ed25519.Verify(ed25519.PublicKey(rawKey), signedData, signatureBytes) {
+		return fmt.Errorf("assinatura inválida na resposta do agente %s", agentID)
+	}
+	return nil
+}
+
+// verifyAgentResponse verifica a assinatura do corpo da resposta de um agente, com o desafio enviado na requisição,
+// e se quem respondeu é o agente esperado no endereço consultado
+func verifyAgentResponse(resp *http.Response, body []byte) error {
+	agentID, err := respondingAgentID(resp)
+	if err != nil {
+		return err
+	}
+	return verifyAgentSignature(agentID, requestChallenge(resp), body, resp.Header.Get(agentSignatureHeader))
+}
+
+// respondingAgentID retorna o identificador do agente esperado no endereço da requisição, recusando respostas
+// em que o agente se identifica como outro
+func respondingAgentID(resp *http.Response) (string, error) {
+	if resp.Request == nil {
+		return "", fmt.Errorf("requisição da resposta do agente desconhecida")
+	}
+	agentID, err := expectedAgentID(resp.Request.URL.Host)
+	if err != nil {
+		return "", err
+	}
+	if presented := resp.Header.Get(agentIDHeader); presented != "" && presented != agentID {
+		return "", fmt.Errorf("resposta de %s identificada como agente %s, esperado %s", resp.Request.URL.Host, presented, agentID)
+	}
+	return agentID, nil
+}
+
+// requestChallenge retorna o desafio enviado na requisição que originou a resposta
+func requestChallenge(resp *http.Response) string {
+	if resp.Request == nil {
+		return ""
+	}
+	return resp.Request.Header.Get(agentChallengeHeader)
+}
@@ -1,168 +1,167 @@
 package main
 
 import (
-	"crypto/rand"
-	"crypto/rsa"
-	"crypto/sha256"
+	"bytes"
 	"encoding/base64"
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 	"time"
 )
 
-// updateAgentServerIP envia uma requisição para atualizar o IP do servidor em um agente
-func updateAgentServerIP(agentIP, newServerIP string) error {
-	// Verificar se o agentIP inclui a porta
-	if !strings.Contains(agentIP, ":") {
-		agentIP = agentIP + ":9999" // Porta padrão do agente
-	}
+// ConfigPatch é o conteúdo do envelope assinado de PATCH /config no agente
+// Apenas os campos informados são alterados; com RevisaoEsperada, o agente só aplica a alteração
+// se a revisão atual da configuração for a informada
+type ConfigPatch struct {
+	RevisaoEsperada          *int64  `json:"revisao_esperada,omitempty"`
+	ServidorAtualizacao      *string `json:"servidor_atualizacao,omitempty"`
+	ServidorColeta           *string `json:"servidor_coleta,omitempty"`
+	SystemInfoUpdateInterval *int    `json:"system_info_update_interval,omitempty"`
+	UpdateCheckInterval      *int    `json:"update_check_interval,omitempty"`
+	CanalAtualizacao         *string `json:"canal_atualizacao,omitempty"`
+	AceitarPreLancamento     *string `json:"aceitar_pre_lancamento,omitempty"`
+	LimiteDownloadKbps       *int    `json:"limite_download_kbps,omitempty"`
+	P2PAtualizacao           *string `json:"p2p_atualizacao,omitempty"`
+}
 
-	// Verificar se o newServerIP começa com http://
-	if !strings.HasPrefix(newServerIP, "http://") && !strings.HasPrefix(newServerIP, "https://") {
-		newServerIP = "http://" + newServerIP
+// updateAgentConfig altera de uma só vez as configurações informadas no agente (PATCH /config)
+// Retorna a nova revisão da configuração e as configurações cujo valor mudou
+func updateAgentConfig(agentIP string, patch ConfigPatch) (map[string]interface{}, error) {
+	// Enviar o envelope assinado para o agente
+	resp, err := sendSignedRequestMethod(agentIP, http.MethodPatch, "/config", patch)
+	if err != nil {
+		return nil, err
 	}
+	defer resp.Body.Close()
 
-	// Criar o payload
-	type UpdatePayload struct {
-		IP string `json:"ip_servidor"`
+	// Ler a resposta
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao ler resposta: %v", err)
 	}
 
-	payload := UpdatePayload{
-		IP: newServerIP,
+	// Verificar o código de status
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("agente retornou código %d: %s", resp.StatusCode, strings.TrimSpace(string(bodyBytes)))
 	}
 
-	// Serializar para JSON
-	jsonData, err := json.Marshal(payload)
-	if err != nil {
-		return fmt.Errorf("erro ao serializar payload: %v", err)
+	// Verificar a assinatura do agente
+	if err := verifyAgentResponse(resp, bodyBytes); err != nil {
+		return nil, err
 	}
 
-	// Criptografar com a chave privada
-	encryptedData, err := signWithPrivateKey(jsonData)
-	if err != nil {
-		return fmt.Errorf("erro ao criptografar dados: %v", err)
-	}
+	return decryptData(bodyBytes)
+}
 
-	// Enviar a requisição para o agente
-	url := fmt.Sprintf("http://%s/update-server", agentIP)
-	resp, err := http.Post(url, "application/text", strings.NewReader(encryptedData))
-	if err != nil {
-		return fmt.Errorf("erro ao enviar requisição para o agente: %v", err)
+// parseConfigAssignments interpreta a lista "chave=valor,chave=valor" do parâmetro -set
+// Chaves aceitas: servidor_atualizacao, servidor_coleta, system_info_update_interval, update_check_interval
+// canal_atualizacao, aceitar_pre_lancamento, limite_download_kbps e p2p_atualizacao
+func parseConfigAssignments(spec string) (ConfigPatch, error) {
+	var patch ConfigPatch
+	for _, assignment := range strings.Split(spec, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(assignment), "=")
+		if !ok {
+			return patch, fmt.Errorf("formato inválido em %q: use chave=valor", assignment)
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "servidor_atualizacao":
+			serverURL := normalizeServerURL(value)
+			patch.ServidorAtualizacao = &serverURL
+		case "servidor_coleta":
+			serverURL := normalizeServerURL(value)
+			patch.ServidorColeta = &serverURL
+		case "system_info_update_interval", "update_check_interval":
+			minutes, err := strconv.Atoi(value)
+			if err != nil || minutes < 1 {
+				return patch, fmt.Errorf("intervalo inválido para %s: deve ser pelo menos 1 minuto", key)
+			}
+			if key == "system_info_update_interval" {
+				patch.SystemInfoUpdateInterval = &minutes
+			} else {
+				patch.UpdateCheckInterval = &minutes
+			}
+		case "canal_atualizacao":
+			channel := strings.ToLower(value)
+			if channel == "" {
+				return patch, fmt.Errorf("canal de atualização não pode ser vazio")
+			}
+			patch.CanalAtualizacao = &channel
+		case "limite_download_kbps":
+			kbps, err := strconv.Atoi(value)
+			if err != nil || kbps < 0 {
+				return patch, fmt.Errorf("limite inválido para limite_download_kbps: use kbit/s, ou 0 para sem limite")
+			}
+			patch.LimiteDownloadKbps = &kbps
+		case "aceitar_pre_lancamento":
+			policy := strings.ToLower(value)
+			if policy != "canal" && policy != "sim" && policy != "nao" {
+				return patch, fmt.Errorf("valor inválido para aceitar_pre_lancamento: use canal, sim ou nao")
+			}
+			patch.AceitarPreLancamento = &policy
+		case "p2p_atualizacao":
+			enabled := strings.ToLower(value)
+			if enabled != "sim" && enabled != "nao" {
+				return patch, fmt.Errorf("valor inválido para p2p_atualizacao: use sim ou nao")
+			}
+			patch.P2PAtualizacao = &enabled
+		default:
+			return patch, fmt.Errorf("configuração desconhecida: %s", key)
+		}
 	}
-	defer resp.Body.Close()
+	return patch, nil
+}
 
-	// Verificar o código de status
-	if resp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("agente retornou código %d: %s", resp.StatusCode, string(bodyBytes))
+// normalizeServerURL adiciona http:// a um endereço sem esquema (vazio continua vazio)
+func normalizeServerURL(serverURL string) string {
+	if serverURL != "" && !strings.HasPrefix(serverURL, "http://") && !strings.HasPrefix(serverURL, "https://") {
+		return "http://" + serverURL
 	}
+	return serverURL
+}
 
-	return nil
+// updateAgentServerIP altera o servidor de atualização em um agente
+func updateAgentServerIP(agentIP, newServerIP string) error {
+	serverURL := normalizeServerURL(newServerIP)
+	_, err := updateAgentConfig(agentIP, ConfigPatch{ServidorAtualizacao: &serverURL})
+	return err
+}
+
+// updateAgentIngestServer altera o servidor de coleta para onde o agente envia os snapshots
+// Um endereço vazio desativa o envio
+func updateAgentIngestServer(agentIP, serverURL string) error {
+	serverURL = normalizeServerURL(serverURL)
+	_, err := updateAgentConfig(agentIP, ConfigPatch{ServidorColeta: &serverURL})
+	return err
 }
 
 // updateSystemInfoInterval atualiza o intervalo de atualização das informações do sistema em um agente
 func updateSystemInfoInterval(agentIP string, minutes int) error {
-	// Verificar se o agentIP inclui a porta
-	if !strings.Contains(agentIP, ":") {
-		agentIP = agentIP + ":9999" // Porta padrão do agente
-	}
-
 	// Verificar se o intervalo é válido
 	if minutes < 1 {
 		return fmt.Errorf("intervalo inválido: deve ser pelo menos 1 minuto")
 	}
 
-	// Criar o payload
-	type UpdatePayload struct {
-		Intervalo int `json:"intervalo"`
-	}
-
-	payload := UpdatePayload{
-		Intervalo: minutes,
-	}
-
-	// Serializar para JSON
-	jsonData, err := json.Marshal(payload)
-	if err != nil {
-		return fmt.Errorf("erro ao serializar payload: %v", err)
-	}
-
-	// Criptografar com a chave privada
-	encryptedData, err := signWithPrivateKey(jsonData)
-	if err != nil {
-		return fmt.Errorf("erro ao criptografar dados: %v", err)
-	}
-
-	// Enviar a requisição para o agente
-	url := fmt.Sprintf("http://%s/update-system-info-interval", agentIP)
-	resp, err := http.Post(url, "application/text", strings.NewReader(encryptedData))
-	if err != nil {
-		return fmt.Errorf("erro ao enviar requisição para o agente: %v", err)
-	}
-	defer resp.Body.Close()
-
-	// Verificar o código de status
-	if resp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("agente retornou código %d: %s", resp.StatusCode, string(bodyBytes))
-	}
-
-	return nil
+	_, err := updateAgentConfig(agentIP, ConfigPatch{SystemInfoUpdateInterval: &minutes})
+	return err
 }
 
 // updateCheckInterval atualiza o intervalo de verificação de atualizações em um agente
 func updateCheckInterval(agentIP string, minutes int) error {
-	// Verificar se o agentIP inclui a porta
-	if !strings.Contains(agentIP, ":") {
-		agentIP = agentIP + ":9999" // Porta padrão do agente
-	}
-
 	// Verificar se o intervalo é válido
 	if minutes < 1 {
 		return fmt.Errorf("intervalo inválido: deve ser pelo menos 1 minuto")
 	}
 
-	// Criar o payload
-	type UpdatePayload struct {
-		Intervalo int    `json:"intervalo"`
-		Senha     string `json:"senha"`
-	}
-
-	payload := UpdatePayload{
-		Intervalo: minutes,
-	}
-
-	// Serializar para JSON
-	jsonData, err := json.Marshal(payload)
-	if err != nil {
-		return fmt.Errorf("erro ao serializar payload: %v", err)
-	}
-
-	// Criptografar com a chave privada
-	encryptedData, err := signWithPrivateKey(jsonData)
-	if err != nil {
-		return fmt.Errorf("erro ao criptografar dados: %v", err)
-	}
-
-	// Enviar a requisição para o agente
-	url := fmt.Sprintf("http://%s/update-check-interval", agentIP)
-	resp, err := http.Post(url, "application/text", strings.NewReader(encryptedData))
-	if err != nil {
-		return fmt.Errorf("erro ao enviar requisição para o agente: %v", err)
-	}
-	defer resp.Body.Close()
-
-	// Verificar o código de status
-	if resp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("agente retornou código %d: %s", resp.StatusCode, string(bodyBytes))
-	}
-
-	return nil
+	_, err := updateAgentConfig(agentIP, ConfigPatch{UpdateCheckInterval: &minutes})
+	return err
 }
 
 // Aqui você pode adicionar novos comandos para os agentes
@@ -176,14 +175,11 @@ func restartAgent(agentIP string) error {
 func getAgentStatus(agentIP string) (string, error) {
     // Implementação para obter o status do agente
 }
-
-func updateAgentConfig(agentIP string, config map[string]interface{}) error {
-    // Implementação para atualizar a configuração do agente
-}
 */
 
 // getAgentInfo obtém informações detalhadas de um agente
-func getAgentInfo(agentIP string, timeout int, endpoint string) (map[string]interface{}, error) {
+// query contém parâmetros adicionais do endpoint (ex: top e nome em processos) e pode ser nil
+func getAgentInfo(agentIP string, timeout int, endpoint string, query url.Values) (map[string]interface{}, error) {
 	// Verificar se o agentIP inclui a porta
 	if !strings.Contains(agentIP, ":") {
 		agentIP = agentIP + ":9999" // Porta padrão do agente
@@ -194,18 +190,29 @@ func getAgentInfo(agentIP string, timeout int, endpoint string) (map[string]inte
 		Timeout: time.Duration(timeout) * time.Second,
 	}
 
+	// Parâmetros da consulta
+	params := url.Values{}
+	for key, values := range query {
+		params[key] = values
+	}
+	params.Set("encrypt", "true")
+
 	// Construir a URL com base no endpoint
-	var url string
+	var requestURL string
 	if endpoint == "" {
 		// Endpoint principal para todas as informações
-		url = fmt.Sprintf("http://%s?encrypt=true", agentIP)
+		requestURL = fmt.Sprintf("http://%s?%s", agentIP, params.Encode())
 	} else {
 		// Endpoint específico
-		url = fmt.Sprintf("http://%s/%s?encrypt=true", agentIP, endpoint)
+		requestURL = fmt.Sprintf("http://%s/%s?%s", agentIP, endpoint, params.Encode())
 	}
 
 	// Solicitar dados
-	resp, err := client.Get(url)
+	req, err := newAgentRequest(http.MethodGet, requestURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("erro ao conectar com o agente: %v", err)
 	}
@@ -223,6 +230,11 @@ func getAgentInfo(agentIP string, timeout int, endpoint string) (map[string]inte
 		return nil, fmt.Errorf("erro ao ler resposta: %v", err)
 	}
 
+	// Verificar a assinatura do agente
+	if err := verifyAgentResponse(resp, body); err != nil {
+		return nil, err
+	}
+
 	// Verificar se a resposta está criptografada
 	var result map[string]interface{}
 
@@ -250,6 +262,24 @@ func decryptData(encryptedData []byte) (map[string]interface{}, error) {
 		return nil, fmt.Errorf("erro ao decodificar base64: %v", err)
 	}
 
+	// Formato híbrido (AES-GCM): uma única chave protegida com RSA
+	if bytes.HasPrefix(encryptedBytes, hybridMagic) {
+		decryptedData, err := decryptHybrid(encryptedBytes)
+		if err != nil {
+			return nil, err
+		}
+		decryptedData, err = decompressPayload(decryptedData)
+		if err != nil {
+			return nil, err
+		}
+
+		var result map[string]interface{}
+		if err := json.Unmarshal(decryptedData, &result); err != nil {
+			return nil, fmt.Errorf("erro ao converter JSON: %v", err)
+		}
+		return result, nil
+	}
+
 	// Separando os chunks criptografados
 	var chunks [][]byte
 	i := 0
@@ -302,13 +332,7 @@ func decryptData(encryptedData []byte) (map[string]interface{}, error) {
 	} else {
 		// Dados criptografados com OAEP
 		for _, chunk := range chunks {
-			decryptedChunk, err := rsa.DecryptOAEP(
-				sha256.New(),
-				rand.Reader,
-				privateKey,
-				chunk,
-				nil,
-			)
+			decryptedChunk, err := decryptOAEP(chunk)
 			if err != nil {
 				return nil, fmt.Errorf("erro ao descriptografar chunk: %v", err)
 			}
@@ -316,6 +340,12 @@ func decryptData(encryptedData []byte) (map[string]interface{}, error) {
 		}
 	}
 
+	// Descomprimir, se o agente comprimiu os dados antes de criptografar
+	decryptedData, err = decompressPayload(decryptedData)
+	if err != nil {
+		return nil, err
+	}
+
 	// Convertendo para JSON
 	var result map[string]interface{}
 	err = json.Unmarshal(decryptedData, &result)
@@ -326,8 +356,10 @@ func decryptData(encryptedData []byte) (map[string]interface{}, error) {
 	return result, nil
 }
 
-// executeCommand envia um comando para ser executado no agente
-func executeCommand(agentIP, command string, isPowerShell bool) (map[string]interface{}, error) {
+// executeCommand envia um comando para ser executado no agente como um job
+// O agente aguarda o término por alguns segundos; comandos mais longos retornam com status "executando"
+// Com wait=false o agente responde imediatamente, e a saída pode ser acompanhada com streamJobOutput
+func executeCommand(agentIP, command string, isPowerShell bool, timeoutSeconds int, wait bool) (map[string]interface{}, error) {
 	// Verificar se o agentIP inclui a porta
 	if !strings.Contains(agentIP, ":") {
 		agentIP = agentIP + ":9999" // Porta padrão do agente
@@ -335,8 +367,10 @@ func executeCommand(agentIP, command string, isPowerShell bool) (map[string]inte
 
 	// Criar o payload
 	type CommandPayload struct {
-		Command string `json:"comando"`
-		Type    string `json:"tipo"`
+		Command        string `json:"comando"`
+		Type           string `json:"tipo"`
+		TimeoutSeconds int    `json:"timeout_segundos,omitempty"`
+		WaitSeconds    *int   `json:"aguardar_segundos,omitempty"`
 	}
 
 	commandType := "cmd"
@@ -345,27 +379,19 @@ func executeCommand(agentIP, command string, isPowerShell bool) (map[string]inte
 	}
 
 	payload := CommandPayload{
-		Command: command,
-		Type:    commandType,
-	}
-
-	// Serializar para JSON
-	jsonData, err := json.Marshal(payload)
-	if err != nil {
-		return nil, fmt.Errorf("erro ao serializar payload: %v", err)
+		Command:        command,
+		Type:           commandType,
+		TimeoutSeconds: timeoutSeconds,
 	}
-
-	// Criptografar com a chave privada
-	encryptedData, err := signWithPrivateKey(jsonData)
-	if err != nil {
-		return nil, fmt.Errorf("erro ao criptografar dados: %v", err)
+	if !wait {
+		noWait := 0
+		payload.WaitSeconds = &noWait
 	}
 
-	// Enviar a requisição para o agente
-	url := fmt.Sprintf("http://%s/execute-command", agentIP)
-	resp, err := http.Post(url, "application/text", strings.NewReader(encryptedData))
+	// Enviar o envelope assinado para o agente
+	resp, err := sendSignedRequest(agentIP, "/execute-command", payload)
 	if err != nil {
-		return nil, fmt.Errorf("erro ao enviar requisição para o agente: %v", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
@@ -381,6 +407,11 @@ func executeCommand(agentIP, command string, isPowerShell bool) (map[string]inte
 		return nil, fmt.Errorf("erro ao ler resposta: %v", err)
 	}
 
+	// Verificar a assinatura do agente
+	if err := verifyAgentResponse(resp, bodyBytes); err != nil {
+		return nil, err
+	}
+
 	// Verificar se a resposta está criptografada
 	var result map[string]interface{}
 
@@ -403,6 +434,108 @@ func executeCommand(agentIP, command string, isPowerShell bool) (map[string]inte
 	return result, nil
 }
 
+// getJobStatus consulta o estado e a saída de um job no agente
+func getJobStatus(agentIP, jobID string, timeout int) (map[string]interface{}, error) {
+	return getAgentInfo(agentIP, timeout, "jobs/status", url.Values{"id": {jobID}})
+}
+
+// listJobs lista os jobs mais recentes do agente
+func listJobs(agentIP string, timeout int) (map[string]interface{}, error) {
+	return getAgentInfo(agentIP, timeout, "jobs", nil)
+}
+
+// getAgentConfig obtém a configuração efetiva do agente e a origem de cada valor
+func getAgentConfig(agentIP string, timeout int) (map[string]interface{}, error) {
+	return getAgentInfo(agentIP, timeout, "config", nil)
+}
+
+// listHistory lista os snapshots guardados no histórico do agente
+func listHistory(agentIP string, timeout int) (map[string]interface{}, error) {
+	return getAgentInfo(agentIP, timeout, "history", nil)
+}
+
+// getHistorySnapshot obtém um snapshot completo do histórico do agente
+func getHistorySnapshot(agentIP string, id int, timeout int) (map[string]interface{}, error) {
+	return getAgentInfo(agentIP, timeout, "history", url.Values{"id": {strconv.Itoa(id)}})
+}
+
+// getChangesSince obtém as seções das informações do agente que mudaram desde o instante informado
+// (data no formato RFC 3339 ou segundos Unix)
+func getChangesSince(agentIP, since string, timeout int) (map[string]interface{}, error) {
+	return getAgentInfo(agentIP, timeout, "changes", url.Values{"since": {since}})
+}
+
+// updateHistoryRetention altera a retenção do histórico de snapshots em um agente
+func updateHistoryRetention(agentIP string, maxSnapshots, maxDays int) error {
+	// Verificar se o agentIP inclui a porta
+	if !strings.Contains(agentIP, ":") {
+		agentIP = agentIP + ":9999" // Porta padrão do agente
+	}
+
+	// Verificar se a retenção é válida
+	if maxSnapshots < 1 || maxDays < 1 {
+		return fmt.Errorf("retenção inválida: quantidade e idade devem ser pelo menos 1")
+	}
+
+	// Criar o payload
+	type RetentionPayload struct {
+		MaxSnapshots int `json:"max_snapshots"`
+		MaxDias      int `json:"max_dias"`
+	}
+
+	payload := RetentionPayload{
+		MaxSnapshots: maxSnapshots,
+		MaxDias:      maxDays,
+	}
+
+	// Enviar o envelope assinado para o agente
+	resp, err := sendSignedRequest(agentIP, "/update-history-retention", payload)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Verificar o código de status
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("agente retornou código %d: %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	return nil
+}
+
+// cancelJob cancela um job em execução no agente
+func cancelJob(agentIP, jobID string) (map[string]interface{}, error) {
+	type JobCancelPayload struct {
+		JobID string `json:"job_id"`
+	}
+
+	// Enviar o envelope assinado para o agente
+	resp, err := sendSignedRequest(agentIP, "/jobs/cancel", JobCancelPayload{JobID: jobID})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// Ler a resposta
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao ler resposta: %v", err)
+	}
+
+	// Verificar o código de status
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("agente retornou código %d: %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	// Verificar a assinatura do agente
+	if err := verifyAgentResponse(resp, bodyBytes); err != nil {
+		return nil, err
+	}
+
+	return decryptData(bodyBytes)
+}
+
 // getSyscallInfo obtém informações do sistema via syscall direto de um agente
 func getSyscallInfo(agentIP string, timeout int) (map[string]interface{}, error) {
 	// Verificar se o agentIP inclui a porta
@@ -419,7 +552,11 @@ func getSyscallInfo(agentIP string, timeout int) (map[string]interface{}, error)
 	url := fmt.Sprintf("http://%s/syscall-info?encrypt=true", agentIP)
 
 	// Solicitar dados
-	resp, err := client.Get(url)
+	req, err := newAgentRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("erro ao conectar com o agente: %v", err)
 	}
@@ -437,6 +574,11 @@ func getSyscallInfo(agentIP string, timeout int) (map[string]interface{}, error)
 		return nil, fmt.Errorf("erro ao ler resposta: %v", err)
 	}
 
+	// Verificar a assinatura do agente
+	if err := verifyAgentResponse(resp, body); err != nil {
+		return nil, err
+	}
+
 	// Verificar se a resposta está criptografada
 	var result map[string]interface{}
 
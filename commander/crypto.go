@@ -1,21 +1,36 @@
 package main
 
 import (
-	"crypto"
-	"crypto/rand"
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
 	"crypto/rsa"
-	"crypto/sha256"
 	"crypto/x509"
 	"encoding/base64"
 	"encoding/binary"
 	"encoding/pem"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
 	"path/filepath"
 )
 
 var privateKey *rsa.PrivateKey // Chave privada para assinatura
 
+// Cabeçalho usado para negociar o formato de criptografia das respostas dos agentes
+const encryptionHeader = "X-Encryption"
+
+// Formatos aceitos, em ordem de preferência (agentes antigos ignoram o cabeçalho e respondem no formato legado)
+const acceptedEncryptionFormats = "aes-gcm-v1, rsa-oaep-chunks"
+
+// Compressões aceitas (aplicadas pelo agente antes da criptografia)
+const acceptedPayloadEncodings = "gzip"
+
+// Identificação do formato híbrido no início dos dados: "AGH" seguido da versão
+var hybridMagic = []byte{'A', 'G', 'H', 1}
+
 // loadPrivateKey carrega a chave privada RSA de um arquivo PEM
 func loadPrivateKey(path string) (*rsa.PrivateKey, error) {
 	// Verificar se o arquivo existe
@@ -51,50 +66,6 @@ func loadPrivateKey(path string) (*rsa.PrivateKey, error) {
 	return privateKey, nil
 }
 
-// signWithPrivateKey assina dados com a chave privada
-func signWithPrivateKey(data []byte) (string, error) {
-	// Determinar o tamanho máximo que pode ser assinado
-	maxSize := privateKey.Size() - 2*sha256.New().Size() - 2
-	
-	// Dividir os dados em chunks
-	var signedChunks []byte
-	
-	for i := 0; i < len(data); i += maxSize {
-		end := i + maxSize
-		if end > len(data) {
-			end = len(data)
-		}
-		
-		chunk := data[i:end]
-		
-		// Calcular o hash do chunk
-		hashed := sha256.Sum256(chunk)
-		
-		// Assinar o hash
-		signature, err := rsa.SignPKCS1v15(rand.Reader, privateKey, crypto.SHA256, hashed[:])
-		if err != nil {
-			return "", fmt.Errorf("erro ao assinar chunk %d: %v", (i/maxSize)+1, err)
-		}
-		
-		// Adicionar o tamanho do chunk e o separador
-		chunkLen := make([]byte, 4)
-		binary.BigEndian.PutUint32(chunkLen, uint32(len(chunk)+len(signature)))
-		signedChunks = append(signedChunks, chunkLen...)
-		signedChunks = append(signedChunks, ':')
-		
-		// Adicionar o chunk original
-		signedChunks = append(signedChunks, chunk...)
-		
-		// Adicionar a assinatura
-		signedChunks = append(signedChunks, signature...)
-		signedChunks = append(signedChunks, ':')
-	}
-	
-	// Codificar em base64 para transmissão
-	encoded := base64.StdEncoding.EncodeToString(signedChunks)
-	return encoded, nil
-}
-
 // decryptWithPrivateKey descriptografa dados com a chave privada
 func decryptWithPrivateKey(encryptedData string) (string, error) {
 	// Decodificar o base64
@@ -103,6 +74,19 @@ func decryptWithPrivateKey(encryptedData string) (string, error) {
 		return "", fmt.Errorf("erro ao decodificar base64: %v", err)
 	}
 	
+	// Formato híbrido (AES-GCM)
+	if bytes.HasPrefix(data, hybridMagic) {
+		decryptedData, err := decryptHybrid(data)
+		if err != nil {
+			return "", err
+		}
+		decryptedData, err = decompressPayload(decryptedData)
+		if err != nil {
+			return "", err
+		}
+		return string(decryptedData), nil
+	}
+	
 	// Processar os chunks
 	var decryptedData []byte
 	i := 0
@@ -137,13 +121,7 @@ func decryptWithPrivateKey(encryptedData string) (string, error) {
 		i++
 		
 		// Descriptografar o chunk
-		decryptedChunk, err := rsa.DecryptOAEP(
-			sha256.New(),
-			rand.Reader,
-			privateKey,
-			encryptedChunk,
-			nil,
-		)
+		decryptedChunk, err := decryptOAEP(encryptedChunk)
 		if err != nil {
 			return "", fmt.Errorf("erro ao descriptografar chunk: %v", err)
 		}
@@ -152,5 +130,101 @@ func decryptWithPrivateKey(encryptedData string) (string, error) {
 		decryptedData = append(decryptedData, decryptedChunk...)
 	}
 	
+	// Descomprimir, se o agente comprimiu os dados antes de criptografar
+	decryptedData, err = decompressPayload(decryptedData)
+	if err != nil {
+		return "", err
+	}
+	
 	return string(decryptedData), nil
-}
\ No newline at end of file
+}
+
+// newAgentRequest cria uma requisição para um agente informando os formatos de criptografia, as compressões
+// e as chaves aceitos, e o desafio que o agente inclui na assinatura da resposta
+func newAgentRequest(method, url string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao criar requisição: %v", err)
+	}
+	req.Header.Set(encryptionHeader, acceptedEncryptionFormats)
+	req.Header.Set(keyIDHeader, acceptedKeyIDs())
+	req.Header.Set("Accept-Encoding", acceptedPayloadEncodings)
+	challenge, err := newAgentChallenge()
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(agentChallengeHeader, challenge)
+	return req, nil
+}
+
+// decryptHybrid abre os dados no formato híbrido: recupera a chave AES com RSA-OAEP e descriptografa com AES-256-GCM
+// Formato: "AGH" | versão | tamanho da chave protegida (2 bytes) | chave protegida | nonce (12 bytes) | dados + tag
+func decryptHybrid(data []byte) ([]byte, error) {
+	offset := len(hybridMagic)
+	if len(data) < offset+2 {
+		return nil, fmt.Errorf("formato inválido: cabeçalho híbrido incompleto")
+	}
+
+	wrappedKeyLen := int(binary.BigEndian.Uint16(data[offset : offset+2]))
+	offset += 2
+	if len(data) < offset+wrappedKeyLen {
+		return nil, fmt.Errorf("formato inválido: chave protegida incompleta")
+	}
+
+	wrappedKey := data[offset : offset+wrappedKeyLen]
+	offset += wrappedKeyLen
+	header := data[:offset]
+
+	key, err := decryptOAEP(wrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao descriptografar chave AES: %v", err)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao criar cifra AES: %v", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao criar AES-GCM: %v", err)
+	}
+
+	if len(data) < offset+gcm.NonceSize() {
+		return nil, fmt.Errorf("formato inválido: nonce incompleto")
+	}
+	nonce := data[offset : offset+gcm.NonceSize()]
+
+	decryptedData, err := gcm.Open(nil, nonce, data[offset+gcm.NonceSize():], header)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao descriptografar dados (autenticação falhou): %v", err)
+	}
+
+	return decryptedData, nil
+}
+
+// Limite do tamanho descomprimido, para não aceitar conteúdos que expandem sem controle
+const maxDecompressedSize = 64 * 1024 * 1024
+
+// decompressPayload descomprime os dados descriptografados se estiverem em gzip (identificado pelo cabeçalho 0x1f 0x8b)
+// Dados sem compressão (JSON) são retornados sem alteração
+func decompressPayload(data []byte) ([]byte, error) {
+	if len(data) < 2 || data[0] != 0x1f || data[1] != 0x8b {
+		return data, nil
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("erro ao descomprimir dados: %v", err)
+	}
+	defer reader.Close()
+
+	decompressed, err := io.ReadAll(io.LimitReader(reader, maxDecompressedSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("erro ao descomprimir dados: %v", err)
+	}
+	if len(decompressed) > maxDecompressedSize {
+		return nil, fmt.Errorf("dados descomprimidos excedem %d bytes", maxDecompressedSize)
+	}
+
+	return decompressed, nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Versão do formato do envelope assinado enviado aos agentes
+const signedEnvelopeVersion = 1
+
+// Validade dos envelopes emitidos (o agente aceita no máximo 15 minutos)
+const envelopeTTL = 5 * time.Minute
+
+// Timeout em segundos das requisições aos agentes (definido pela flag -timeout)
+var requestTimeout = 20
+
+// SignedEnvelope é o conteúdo assinado exigido pelos endpoints que alteram o agente
+type SignedEnvelope struct {
+	Versao    int             `json:"versao"`
+	AgenteID  string          `json:"agente_id"`
+	EmitidoEm int64           `json:"emitido_em"`
+	ExpiraEm  int64           `json:"expira_em"`
+	Nonce     string          `json:"nonce"`
+	Payload   json.RawMessage `json:"payload"`
+}
+
+// SignedRequest é o corpo das requisições assinadas: o envelope serializado e a sua assinatura
+// ChaveID identifica a chave que assinou, entre as chaves confiáveis do agente
+type SignedRequest struct {
+	Envelope   string `json:"envelope"`
+	Assinatura string `json:"assinatura"`
+	ChaveID    string `json:"chave_id,omitempty"`
+}
+
+// buildSignedRequest monta e assina um envelope destinado a um agente
+func buildSignedRequest(agentID string, payload interface{}) ([]byte, error) {
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao serializar payload: %v", err)
+	}
+
+	// Nonce aleatório de 128 bits
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("erro ao gerar nonce: %v", err)
+	}
+
+	now := time.Now()
+	envelope := SignedEnvelope{
+		Versao:    signedEnvelopeVersion,
+		AgenteID:  agentID,
+		EmitidoEm: now.Unix(),
+		ExpiraEm:  now.Add(envelopeTTL).Unix(),
+		Nonce:     hex.EncodeToString(nonce),
+		Payload:   payloadJSON,
+	}
+
+	envelopeJSON, err := json.Marshal(envelope)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao serializar envelope: %v", err)
+	}
+
+	// Assinar o envelope inteiro com a chave privada, após o prefixo dos comandos
+	hashed := sha256.Sum256(append([]byte(commandSignaturePrefix), envelopeJSON...))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, privateKey, crypto.SHA256, hashed[:])
+	if err != nil {
+		return nil, fmt.Errorf("erro ao assinar envelope: %v", err)
+	}
+
+	return json.Marshal(SignedRequest{
+		Envelope:   base64.StdEncoding.EncodeToString(envelopeJSON),
+		Assinatura: base64.StdEncoding.EncodeToString(signature),
+		ChaveID:    signingKeyID(),
+	})
+}
+
+// sendSignedRequest envia um payload assinado para um endpoint do agente
+func sendSignedRequest(agentIP, endpoint string, payload interface{}) (*http.Response, error) {
+	return sendSignedRequestMethod(agentIP, http.MethodPost, endpoint, payload)
+}
+
+// sendSignedRequestMethod envia um payload assinado para um endpoint do agente com o método informado (ex: PATCH /config)
+func sendSignedRequestMethod(agentIP, method, endpoint string, payload interface{}) (*http.Response, error) {
+	// Verificar se o agentIP inclui a porta
+	if !strings.Contains(agentIP, ":") {
+		agentIP = agentIP + ":9999" // Porta padrão do agente
+	}
+
+	// Destino do envelope: o agente esperado no endereço, não o que o computador no endereço diz ser
+	agentID, err := expectedAgentID(agentIP)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := buildSignedRequest(agentID, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	url := fmt.Sprintf("http://%s%s", agentIP, endpoint)
+	req, err := newAgentRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao enviar requisição para o agente: %v", err)
+	}
+
+	return resp, nil
+}
@@ -5,7 +5,10 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"net/url"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -15,13 +18,38 @@ func main() {
 	getInfo := flag.String("info", "", "Obter informações detalhadas do agente. Opções: tudo, cpu, discos, gpu, hardware, memoria, processos, rede, sistema, agente, info-all")
 	getSyscall := flag.Bool("syscall", false, "Obter informações do sistema via syscall direto")
 	updateIP := flag.String("update-ip", "", "Atualizar o IP do servidor de atualização")
+	ingestServer := flag.String("ingest-server", "", "Servidor de coleta para onde o agente envia os snapshots (ex: 192.168.1.10:9990, ou 'desativar' para voltar a depender da varredura)")
 	sysInfoInterval := flag.Int("sys-interval", 0, "Atualizar intervalo de coleta de informações do sistema (em minutos)")
 	updateInterval := flag.Int("update-interval", 0, "Atualizar intervalo de verificação de atualizações (em minutos)")
 	timeout := flag.Int("timeout", 20, "Timeout em segundos para requisições")
 	cmdCommand := flag.String("cmd", "", "Executar comando CMD no agente")
 	psCommand := flag.String("ps", "", "Executar comando PowerShell no agente")
+	jobTimeout := flag.Int("job-timeout", 0, "Tempo máximo de execução em segundos dos comandos -cmd/-ps (padrão do agente: 300)")
+	jobStatus := flag.String("job-status", "", "Consultar o estado e a saída de um job de comando pelo ID")
+	jobCancel := flag.String("job-cancel", "", "Cancelar um job de comando em execução pelo ID")
+	jobList := flag.Bool("jobs", false, "Listar os jobs de comando mais recentes do agente")
+	stream := flag.Bool("stream", true, "Exibir a saída dos comandos -cmd/-ps à medida que é produzida (use -stream=false para aguardar o resultado)")
+	top := flag.Int("top", -1, "Quantidade máxima de processos retornados com -info processos (0 para todos)")
+	filtro := flag.String("filtro", "", "Filtrar processos pelo nome ou caminho do executável com -info processos")
+	ordem := flag.String("ordem", "", "Ordenação dos processos com -info processos: memoria, cpu, pid ou nome")
+	history := flag.Bool("history", false, "Listar os snapshots guardados no histórico do agente")
+	historyID := flag.Int("history-id", 0, "Obter um snapshot do histórico do agente pelo ID")
+	changesSince := flag.String("changes-since", "", "Obter apenas as seções alteradas desde a data (RFC 3339, ex: 2024-05-01T08:00:00-03:00, ou segundos Unix)")
+	historyMax := flag.Int("history-max", 0, "Alterar a quantidade máxima de snapshots guardados no histórico (use com -history-days)")
+	historyDays := flag.Int("history-days", 0, "Alterar a idade máxima em dias dos snapshots guardados no histórico (use com -history-max)")
+	setConfig := flag.String("set", "", "Alterar de uma só vez configurações do agente (ex: system_info_update_interval=15,servidor_coleta=192.168.1.10:9990)")
+	configRevision := flag.Int64("config-revision", -1, "Com -set, aplicar somente se a revisão atual da configuração do agente for a informada")
+	showConfig := flag.Bool("config", false, "Mostrar a configuração efetiva do agente e a origem de cada valor (flag, ambiente, banco, arquivo ou padrão)")
+	listKeys := flag.Bool("keys", false, "Listar as chaves confiáveis do agente (identificador, origem e aposentadoria)")
+	rotateKey := flag.String("rotate-key", "", "Adicionar uma nova chave confiável no agente a partir do arquivo PEM (chave pública ou privada); a rotação é assinada com a chave atual")
+	graceHours := flag.Int("grace-hours", 72, "Com -rotate-key, horas até a aposentadoria das chaves antigas do agente")
+	releaseKey := flag.String("chave-release", "", "Com -rotate-key, chave privada de release atual (release_private_key.pem): a nova chave passa a ser de release e a rotação é assinada também com ela")
+	flag.StringVar(&targetAgentID, "agente-id", "", "Identificador do agente consultado (padrão: o computador registrado com o IP em data/computers.db)")
+	flag.BoolVar(&acceptLegacyAgents, "aceitar-agentes-sem-chave", false, "Aceitar, com um aviso, respostas sem assinatura de agentes antigos sem chave registrada no servidor de coleta")
 	flag.Parse()
 
+	requestTimeout = *timeout
+
 	// Carregar a chave privada
 	var err error
 	privateKey, err = loadPrivateKey("keys/private_key.pem")
@@ -31,6 +59,11 @@ func main() {
 		log.Println("Chave privada carregada com sucesso")
 	}
 
+	// Carregar as chaves anteriores, mantidas durante a carência de uma rotação
+	if err := loadPreviousKeys(); err != nil {
+		log.Fatalf("Erro: %v", err)
+	}
+
 	// Verificar se é para executar um comando CMD
 	if *agentIP != "" && *cmdCommand != "" {
 		if privateKey == nil {
@@ -38,7 +71,7 @@ func main() {
 		}
 
 		log.Printf("Executando comando CMD no agente %s: %s", *agentIP, *cmdCommand)
-		result, err := executeCommand(*agentIP, *cmdCommand, false)
+		result, err := executeCommand(*agentIP, *cmdCommand, false, *jobTimeout, !*stream)
 		if err != nil {
 			log.Fatalf("Erro ao executar comando: %v", err)
 		}
@@ -47,10 +80,11 @@ func main() {
 		fmt.Println("\n=== RESULTADO DO COMANDO ===")
 		fmt.Printf("Comando: %s\n", *cmdCommand)
 		fmt.Printf("Agente: %s\n", *agentIP)
-		fmt.Printf("Código de saída: %v\n", result["codigo_saida"])
-		fmt.Println("\n--- SAÍDA ---")
-		fmt.Println(result["saida"])
-		fmt.Println("=========================")
+		if *stream && result["status"] == "executando" {
+			followJobOutput(*agentIP, result)
+		} else {
+			printJobResult(*agentIP, result)
+		}
 		return
 	}
 
@@ -61,7 +95,7 @@ func main() {
 		}
 
 		log.Printf("Executando comando PowerShell no agente %s: %s", *agentIP, *psCommand)
-		result, err := executeCommand(*agentIP, *psCommand, true)
+		result, err := executeCommand(*agentIP, *psCommand, true, *jobTimeout, !*stream)
 		if err != nil {
 			log.Fatalf("Erro ao executar comando: %v", err)
 		}
@@ -70,10 +104,273 @@ func main() {
 		fmt.Println("\n=== RESULTADO DO COMANDO POWERSHELL ===")
 		fmt.Printf("Comando: %s\n", *psCommand)
 		fmt.Printf("Agente: %s\n", *agentIP)
-		fmt.Printf("Código de saída: %v\n", result["codigo_saida"])
-		fmt.Println("\n--- SAÍDA ---")
-		fmt.Println(result["saida"])
-		fmt.Println("=========================")
+		if *stream && result["status"] == "executando" {
+			followJobOutput(*agentIP, result)
+		} else {
+			printJobResult(*agentIP, result)
+		}
+		return
+	}
+
+	// Verificar se é para consultar um job
+	if *agentIP != "" && *jobStatus != "" {
+		if privateKey == nil {
+			log.Fatalf("Erro: Chave privada necessária para obter informações criptografadas")
+		}
+
+		result, err := getJobStatus(*agentIP, *jobStatus, *timeout)
+		if err != nil {
+			log.Fatalf("Erro ao consultar job: %v", err)
+		}
+
+		fmt.Println("\n=== JOB ===")
+		fmt.Printf("Comando: %v\n", result["comando"])
+		fmt.Printf("Agente: %s\n", *agentIP)
+		printJobResult(*agentIP, result)
+		return
+	}
+
+	// Verificar se é para cancelar um job
+	if *agentIP != "" && *jobCancel != "" {
+		if privateKey == nil {
+			log.Fatalf("Erro: Chave privada necessária para cancelar jobs")
+		}
+
+		result, err := cancelJob(*agentIP, *jobCancel)
+		if err != nil {
+			log.Fatalf("Erro ao cancelar job: %v", err)
+		}
+
+		log.Printf("Job %s cancelado no agente %s (status: %v)", *jobCancel, *agentIP, result["status"])
+		return
+	}
+
+	// Verificar se é para listar os jobs
+	if *agentIP != "" && *jobList {
+		if privateKey == nil {
+			log.Fatalf("Erro: Chave privada necessária para obter informações criptografadas")
+		}
+
+		result, err := listJobs(*agentIP, *timeout)
+		if err != nil {
+			log.Fatalf("Erro ao listar jobs: %v", err)
+		}
+
+		jobs, _ := result["jobs"].([]interface{})
+		fmt.Printf("%-16s  %-14s  %-6s  %-20s  %s\n", "JOB", "STATUS", "SAÍDA", "CRIADO EM", "COMANDO")
+		for _, item := range jobs {
+			job, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			fmt.Printf("%-16v  %-14v  %-6v  %-20v  %v\n", job["job_id"], job["status"], job["codigo_saida"], job["criado_em"], job["comando"])
+		}
+		return
+	}
+
+	// Verificar se é para mostrar a configuração efetiva do agente
+	if *agentIP != "" && *showConfig {
+		if privateKey == nil {
+			log.Fatalf("Erro: Chave privada necessária para obter informações criptografadas")
+		}
+
+		result, err := getAgentConfig(*agentIP, *timeout)
+		if err != nil {
+			log.Fatalf("Erro ao obter configuração: %v", err)
+		}
+
+		if arquivo, ok := result["arquivo"].(string); ok {
+			encontrado, _ := result["arquivo_encontrado"].(bool)
+			if encontrado {
+				fmt.Printf("Arquivo de configuração: %s\n\n", arquivo)
+			} else {
+				fmt.Printf("Arquivo de configuração: %s (não encontrado)\n\n", arquivo)
+			}
+		}
+		fmt.Printf("Revisão: %v\n\n", result["revisao"])
+		configuracao, _ := result["configuracao"].(map[string]interface{})
+		keys := make([]string, 0, len(configuracao))
+		for key := range configuracao {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		fmt.Printf("%-28s  %-10s  %s\n", "CHAVE", "ORIGEM", "VALOR")
+		for _, key := range keys {
+			value, ok := configuracao[key].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			fmt.Printf("%-28s  %-10v  %v\n", key, value["origem"], value["valor"])
+		}
+		return
+	}
+
+	// Verificar se é para listar o histórico de snapshots
+	if *agentIP != "" && *history {
+		if privateKey == nil {
+			log.Fatalf("Erro: Chave privada necessária para obter informações criptografadas")
+		}
+
+		result, err := listHistory(*agentIP, *timeout)
+		if err != nil {
+			log.Fatalf("Erro ao listar histórico: %v", err)
+		}
+
+		if retencao, ok := result["retencao"].(map[string]interface{}); ok {
+			fmt.Printf("Retenção: %v snapshots, %v dias\n\n", retencao["max_snapshots"], retencao["max_dias"])
+		}
+		snapshots, _ := result["snapshots"].([]interface{})
+		fmt.Printf("%-8s  %-25s  %-10s  %s\n", "ID", "COLETADO EM", "BYTES", "ETAG")
+		for _, item := range snapshots {
+			snapshot, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			fmt.Printf("%-8v  %-25v  %-10v  %v\n", snapshot["id"], snapshot["coletado_em"], snapshot["tamanho_bytes"], snapshot["etag"])
+		}
+		return
+	}
+
+	// Verificar se é para obter um snapshot do histórico
+	if *agentIP != "" && *historyID > 0 {
+		if privateKey == nil {
+			log.Fatalf("Erro: Chave privada necessária para obter informações criptografadas")
+		}
+
+		result, err := getHistorySnapshot(*agentIP, *historyID, *timeout)
+		if err != nil {
+			log.Fatalf("Erro ao obter snapshot do histórico: %v", err)
+		}
+
+		// Exibir o JSON formatado
+		jsonData, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			log.Fatalf("Erro ao formatar JSON: %v", err)
+		}
+		fmt.Println(string(jsonData))
+		return
+	}
+
+	// Verificar se é para obter as alterações desde uma data
+	if *agentIP != "" && *changesSince != "" {
+		if privateKey == nil {
+			log.Fatalf("Erro: Chave privada necessária para obter informações criptografadas")
+		}
+
+		result, err := getChangesSince(*agentIP, *changesSince, *timeout)
+		if err != nil {
+			log.Fatalf("Erro ao obter alterações: %v", err)
+		}
+
+		// Exibir o JSON formatado
+		jsonData, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			log.Fatalf("Erro ao formatar JSON: %v", err)
+		}
+		fmt.Println(string(jsonData))
+		return
+	}
+
+	// Verificar se é para alterar a retenção do histórico
+	if *agentIP != "" && (*historyMax > 0 || *historyDays > 0) {
+		if privateKey == nil {
+			log.Fatalf("Erro: Chave privada necessária para atualizar configurações")
+		}
+		if *historyMax <= 0 || *historyDays <= 0 {
+			log.Fatalf("Erro: Informe -history-max e -history-days juntos")
+		}
+
+		err := updateHistoryRetention(*agentIP, *historyMax, *historyDays)
+		if err != nil {
+			log.Fatalf("Erro ao atualizar retenção do histórico: %v", err)
+		}
+
+		log.Printf("Retenção do histórico atualizada para %d snapshots e %d dias no agente %s", *historyMax, *historyDays, *agentIP)
+		return
+	}
+
+	// Verificar se é para alterar várias configurações do agente de uma só vez
+	if *agentIP != "" && *setConfig != "" {
+		if privateKey == nil {
+			log.Fatalf("Erro: Chave privada necessária para atualizar configurações")
+		}
+
+		patch, err := parseConfigAssignments(*setConfig)
+		if err != nil {
+			log.Fatalf("Erro: %v", err)
+		}
+		if *configRevision >= 0 {
+			patch.RevisaoEsperada = configRevision
+		}
+
+		agentIPs := []string{*agentIP}
+		if *agentIP == "all" {
+			// Obter todos os IPs dos agentes
+			ips, err := getAllAgentIPs()
+			if err != nil {
+				log.Fatalf("Erro ao obter IPs dos agentes: %v", err)
+			}
+			agentIPs = ips
+		}
+
+		for _, ip := range agentIPs {
+			result, err := updateAgentConfig(ip, patch)
+			if err != nil {
+				log.Printf("Erro ao alterar configuração do agente %s: %v", ip, err)
+				continue
+			}
+			log.Printf("Configuração do agente %s alterada (revisão %v, alteradas: %v)", ip, result["revisao"], result["alteradas"])
+		}
+		return
+	}
+
+	// Verificar se é para listar as chaves confiáveis do agente
+	if *agentIP != "" && *listKeys {
+		result, err := getAgentInfo(*agentIP, *timeout, "keys", nil)
+		if err != nil {
+			log.Fatalf("Erro ao listar chaves do agente: %v", err)
+		}
+
+		chaves, _ := result["chaves"].([]interface{})
+		fmt.Printf("Chaves confiáveis do agente %s: %d\n", *agentIP, len(chaves))
+		for _, item := range chaves {
+			chave, _ := item.(map[string]interface{})
+			aposentadoria := "sem aposentadoria prevista"
+			if aposentarEm, ok := chave["aposentar_em"].(string); ok && aposentarEm != "" {
+				aposentadoria = "aposentada em " + aposentarEm
+			}
+			fmt.Printf("  %v  %-8v  %-8v  adicionada em %v  %s\n", chave["id"], chave["finalidade"], chave["origem"], chave["adicionada_em"], aposentadoria)
+		}
+		return
+	}
+
+	// Verificar se é para adicionar uma nova chave confiável no agente
+	if *agentIP != "" && *rotateKey != "" {
+		if privateKey == nil {
+			log.Fatalf("Erro: Chave privada necessária para rotacionar chaves")
+		}
+		if *graceHours < 0 {
+			log.Fatalf("Erro: carência inválida: %d", *graceHours)
+		}
+
+		agentIPs := []string{*agentIP}
+		if *agentIP == "all" {
+			// Obter todos os IPs dos agentes
+			ips, err := getAllAgentIPs()
+			if err != nil {
+				log.Fatalf("Erro ao obter IPs dos agentes: %v", err)
+			}
+			agentIPs = ips
+		}
+
+		for _, ip := range agentIPs {
+			result, err := rotateAgentKey(ip, *rotateKey, *releaseKey, *graceHours)
+			if err != nil {
+				log.Printf("Erro ao rotacionar chave do agente %s: %v", ip, err)
+				continue
+			}
+			log.Printf("Chave %v adicionada no agente %s (chaves %v aposentadas em %v)", result["chave_id"], ip, result["aposentadas"], result["aposentar_em"])
+		}
 		return
 	}
 
@@ -111,6 +408,42 @@ func main() {
 		return
 	}
 
+	// Verificar se é para alterar o servidor de coleta
+	if *agentIP != "" && *ingestServer != "" {
+		if privateKey == nil {
+			log.Fatalf("Erro: Chave privada necessária para atualizar configurações")
+		}
+
+		serverURL := *ingestServer
+		if serverURL == "desativar" {
+			serverURL = ""
+		}
+
+		agentIPs := []string{*agentIP}
+		if *agentIP == "all" {
+			// Obter todos os IPs dos agentes
+			ips, err := getAllAgentIPs()
+			if err != nil {
+				log.Fatalf("Erro ao obter IPs dos agentes: %v", err)
+			}
+			agentIPs = ips
+		}
+
+		for _, ip := range agentIPs {
+			err := updateAgentIngestServer(ip, serverURL)
+			if err != nil {
+				log.Printf("Erro ao alterar servidor de coleta do agente %s: %v", ip, err)
+				continue
+			}
+			if serverURL == "" {
+				log.Printf("Envio de snapshots desativado no agente %s", ip)
+			} else {
+				log.Printf("Agente %s enviando snapshots para %s", ip, serverURL)
+			}
+		}
+		return
+	}
+
 	// Verificar se é para atualizar o intervalo de coleta de informações do sistema
 	if *agentIP != "" && *sysInfoInterval > 0 {
 		if privateKey == nil {
@@ -212,7 +545,7 @@ func main() {
 		// Se for "tudo" ou vazio, consultar o endpoint principal
 		if endpoint == "tudo" || endpoint == "" {
 			log.Printf("Consultando todas as informações do agente em %s...", *agentIP)
-			info, err := getAgentInfo(*agentIP, *timeout, "")
+			info, err := getAgentInfo(*agentIP, *timeout, "", nil)
 			if err != nil {
 				log.Fatalf("Erro ao obter informações do agente: %v", err)
 			}
@@ -240,9 +573,23 @@ func main() {
 			log.Fatalf("Endpoint inválido: %s. Opções válidas: tudo, cpu, discos, gpu, hardware, memoria, processos, rede, sistema, agente, info-all", endpoint)
 		}
 
+		// Parâmetros do inventário de processos
+		query := url.Values{}
+		if endpoint == "processos" {
+			if *top >= 0 {
+				query.Set("top", strconv.Itoa(*top))
+			}
+			if *filtro != "" {
+				query.Set("nome", *filtro)
+			}
+			if *ordem != "" {
+				query.Set("ordem", *ordem)
+			}
+		}
+
 		// Consultar o endpoint específico
 		log.Printf("Consultando informações de %s do agente em %s...", endpoint, *agentIP)
-		info, err := getAgentInfo(*agentIP, *timeout, endpoint)
+		info, err := getAgentInfo(*agentIP, *timeout, endpoint, query)
 		if err != nil {
 			log.Fatalf("Erro ao obter informações de %s do agente: %v", endpoint, err)
 		}
@@ -260,3 +607,54 @@ func main() {
 	flag.Usage()
 	os.Exit(1)
 }
+
+// printJobResult exibe o estado e a saída de um job de comando
+func printJobResult(agentIP string, result map[string]interface{}) {
+	fmt.Printf("Job: %v\n", result["job_id"])
+	fmt.Printf("Status: %v\n", result["status"])
+
+	// Comandos longos continuam em execução no agente
+	if result["status"] == "executando" {
+		fmt.Println("\nO comando ainda está em execução. Consulte o resultado com:")
+		fmt.Printf("  commander -agent %s -job-status %v\n", agentIP, result["job_id"])
+		fmt.Println("=========================")
+		return
+	}
+
+	fmt.Printf("Código de saída: %v\n", result["codigo_saida"])
+	fmt.Println("\n--- SAÍDA ---")
+	fmt.Println(result["saida"])
+	if erro, ok := result["erro"].(string); ok && erro != "" {
+		fmt.Println("\n--- ERRO ---")
+		fmt.Println(erro)
+	}
+	fmt.Println("=========================")
+}
+
+// followJobOutput exibe a saída de um job em execução à medida que é produzida e, ao final, o código de saída
+func followJobOutput(agentIP string, job map[string]interface{}) {
+	jobID := fmt.Sprint(job["job_id"])
+	fmt.Printf("Job: %s\n", jobID)
+	fmt.Println("\n--- SAÍDA ---")
+
+	result, err := streamJobOutput(agentIP, jobID, func(fluxo, texto string) {
+		if fluxo == "stderr" {
+			fmt.Fprint(os.Stderr, texto)
+		} else {
+			fmt.Print(texto)
+		}
+	})
+	if err != nil {
+		// O job continua no agente mesmo sem o streaming
+		log.Printf("Erro ao acompanhar a saída do job: %v", err)
+		fmt.Println("\nConsulte o resultado com:")
+		fmt.Printf("  commander -agent %s -job-status %s\n", agentIP, jobID)
+		fmt.Println("=========================")
+		return
+	}
+
+	fmt.Println("\n--- FIM ---")
+	fmt.Printf("Status: %v\n", result["status"])
+	fmt.Printf("Código de saída: %v\n", result["codigo_saida"])
+	fmt.Println("=========================")
+}
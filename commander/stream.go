@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// streamJobOutput acompanha a saída de um job pelo endpoint /jobs/stream do agente
+// onOutput é chamado para cada trecho recebido ("stdout" ou "stderr"); o retorno é o job final
+// com status e código de saída
+func streamJobOutput(agentIP, jobID string, onOutput func(fluxo, texto string)) (map[string]interface{}, error) {
+	// Verificar se o agentIP inclui a porta
+	if !strings.Contains(agentIP, ":") {
+		agentIP = agentIP + ":9999" // Porta padrão do agente
+	}
+
+	// Sem timeout total: o streaming dura o tempo do comando. Apenas a conexão e o início da resposta são limitados
+	client := &http.Client{
+		Transport: &http.Transport{
+			ResponseHeaderTimeout: time.Duration(requestTimeout) * time.Second,
+		},
+	}
+
+	requestURL := fmt.Sprintf("http://%s/jobs/stream?%s", agentIP, url.Values{"id": {jobID}}.Encode())
+	req, err := newAgentRequest(http.MethodGet, requestURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao conectar ao streaming do job: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("agente retornou código %d: %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	// Ler os eventos Server-Sent Events (linhas "event:" e "data:" terminadas por uma linha em branco)
+	reader := bufio.NewReader(resp.Body)
+	// Cada evento traz a assinatura do agente sobre o conteúdo no campo "assinatura"
+	agentID, err := respondingAgentID(resp)
+	if err != nil {
+		return nil, err
+	}
+	var event, signature string
+	var data strings.Builder
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			if err == io.EOF {
+				return nil, fmt.Errorf("conexão encerrada antes do término do job")
+			}
+			return nil, fmt.Errorf("erro ao ler streaming do job: %v", err)
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		switch {
+		case strings.HasPrefix(line, ":"):
+			// Comentário de keep-alive
+		case strings.HasPrefix(line, "assinatura:"):
+			signature = strings.TrimSpace(strings.TrimPrefix(line, "assinatura:"))
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data.WriteString(strings.TrimSpace(strings.TrimPrefix(line, "data:")))
+		case line == "" && data.Len() > 0:
+			if err := verifyAgentSignature(agentID, requestChallenge(resp), []byte(data.String()), signature); err != nil {
+				return nil, err
+			}
+			result, err := decodeStreamEvent([]byte(data.String()))
+			if err != nil {
+				return nil, err
+			}
+
+			switch event {
+			case "saida":
+				fluxo, _ := result["fluxo"].(string)
+				texto, _ := result["texto"].(string)
+				onOutput(fluxo, texto)
+			case "fim":
+				return result, nil
+			}
+
+			event = ""
+			signature = ""
+			data.Reset()
+		}
+	}
+}
+
+// decodeStreamEvent descriptografa o conteúdo de um evento (ou o lê diretamente se não estiver criptografado)
+func decodeStreamEvent(data []byte) (map[string]interface{}, error) {
+	result, err := decryptData(data)
+	if err == nil {
+		return result, nil
+	}
+
+	if jsonErr := json.Unmarshal(data, &result); jsonErr != nil {
+		return nil, fmt.Errorf("erro ao descriptografar evento do streaming: %v", err)
+	}
+	return result, nil
+}
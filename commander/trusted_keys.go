@@ -0,0 +1,181 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Cabeçalho com os identificadores das chaves que o commander consegue descriptografar, em ordem de preferência
+// (o agente responde com a chave usada no mesmo cabeçalho)
+const keyIDHeader = "X-Chave-ID"
+
+// Diretório com as chaves privadas anteriores, mantidas durante a carência de uma rotação de chaves
+const previousKeysDir = "keys/anteriores"
+
+// Chaves privadas anteriores (agentes que ainda não receberam a rotação continuam criptografando com elas)
+var previousKeys []*rsa.PrivateKey
+
+// Finalidade das chaves de release no agente, aceitas apenas nos manifestos de atualização
+const keyPurposeRelease = "release"
+
+// Prefixos dos dados assinados para o agente, um por formato (os mesmos do agente)
+const (
+	commandSignaturePrefix    = "agente-comando-v1\n"
+	releaseKeySignaturePrefix = "agente-chave-release-v1\n"
+)
+
+// KeyRotation é o conteúdo do envelope assinado de POST /keys/rotate no agente
+// Uma nova chave de release leva também a assinatura de uma chave de release confiável no agente
+type KeyRotation struct {
+	NovaChave         string   `json:"nova_chave"`
+	Finalidade        string   `json:"finalidade,omitempty"`
+	AssinaturaRelease string   `json:"assinatura_release,omitempty"`
+	ChaveReleaseID    string   `json:"chave_release_id,omitempty"`
+	CarenciaHoras     *int     `json:"carencia_horas,omitempty"`
+	Aposentar         []string `json:"aposentar,omitempty"`
+}
+
+// publicKeyID calcula o identificador da chave, o mesmo usado pelos agentes:
+// os primeiros 8 bytes do SHA-256 da chave pública em DER, em hexadecimal
+func publicKeyID(publicKey *rsa.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return "", fmt.Errorf("erro ao serializar chave pública: %v", err)
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:8]), nil
+}
+
+// loadPreviousKeys carrega as chaves privadas de keys/anteriores/*.pem (o diretório é opcional)
+func loadPreviousKeys() error {
+	paths, err := filepath.Glob(filepath.Join(previousKeysDir, "*.pem"))
+	if err != nil {
+		return fmt.Errorf("erro ao listar chaves anteriores: %v", err)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		key, err := loadPrivateKey(path)
+		if err != nil {
+			return fmt.Errorf("erro ao carregar chave anterior %s: %v", path, err)
+		}
+		previousKeys = append(previousKeys, key)
+	}
+	return nil
+}
+
+// allPrivateKeys retorna a chave privada atual seguida das chaves anteriores
+func allPrivateKeys() []*rsa.PrivateKey {
+	return append([]*rsa.PrivateKey{privateKey}, previousKeys...)
+}
+
+// acceptedKeyIDs retorna os identificadores das chaves privadas disponíveis, para o cabeçalho X-Chave-ID
+func acceptedKeyIDs() string {
+	var ids []string
+	for _, key := range allPrivateKeys() {
+		if id, err := publicKeyID(&key.PublicKey); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return strings.Join(ids, ", ")
+}
+
+// signingKeyID retorna o identificador da chave privada atual, informado nos envelopes assinados
+func signingKeyID() string {
+	id, _ := publicKeyID(&privateKey.PublicKey)
+	return id
+}
+
+// decryptOAEP descriptografa um bloco RSA-OAEP com a chave atual ou, se falhar, com as chaves anteriores
+func decryptOAEP(ciphertext []byte) ([]byte, error) {
+	var lastErr error
+	for _, key := range allPrivateKeys() {
+		plaintext, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, key, ciphertext, nil)
+		if err == nil {
+			return plaintext, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// rotateAgentKey adiciona uma nova chave confiável no agente (POST /keys/rotate), assinando com a chave atual
+// Com releaseKeyPath (chave privada de release atual), a nova chave é de release e é assinada também com ela
+// As demais chaves da mesma finalidade no agente são aposentadas após a carência informada
+func rotateAgentKey(agentIP, newKeyPath, releaseKeyPath string, graceHours int) (map[string]interface{}, error) {
+	pemData, err := os.ReadFile(newKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao ler nova chave pública: %v", err)
+	}
+
+	// Aceitar também a chave privada: a chave pública é extraída dela
+	if block, _ := pem.Decode(pemData); block != nil && block.Type == "RSA PRIVATE KEY" {
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("falha ao analisar nova chave: %v", err)
+		}
+		der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("erro ao serializar nova chave pública: %v", err)
+		}
+		pemData = pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	}
+
+	rotation := KeyRotation{NovaChave: string(pemData), CarenciaHoras: &graceHours}
+	if releaseKeyPath != "" {
+		releaseKey, err := loadPrivateKey(releaseKeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("erro ao carregar chave de release: %v", err)
+		}
+		releaseKeyID, err := publicKeyID(&releaseKey.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		hashed := sha256.Sum256([]byte(releaseKeySignaturePrefix + rotation.NovaChave))
+		signature, err := rsa.SignPKCS1v15(rand.Reader, releaseKey, crypto.SHA256, hashed[:])
+		if err != nil {
+			return nil, fmt.Errorf("erro ao assinar nova chave de release: %v", err)
+		}
+		rotation.Finalidade = keyPurposeRelease
+		rotation.AssinaturaRelease = base64.StdEncoding.EncodeToString(signature)
+		rotation.ChaveReleaseID = releaseKeyID
+	}
+
+	// Enviar o envelope assinado para o agente
+	resp, err := sendSignedRequest(agentIP, "/keys/rotate", rotation)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// Ler a resposta
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao ler resposta: %v", err)
+	}
+
+	// Verificar o código de status
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("agente retornou código %d: %s", resp.StatusCode, strings.TrimSpace(string(bodyBytes)))
+	}
+
+	// Verificar a assinatura do agente
+	if err := verifyAgentResponse(resp, bodyBytes); err != nil {
+		return nil, err
+	}
+
+	return decryptData(bodyBytes)
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Identificador do formato do patch binário gerado por bsdiff (o mesmo aplicado pelo agente)
+//
+// Formato: "AGDIFF01", tamanho do novo arquivo, tamanho do bloco de controle comprimido e tamanho do bloco
+// de diferenças comprimido (int64 little-endian), seguidos dos três blocos comprimidos com gzip:
+//   - controle: triplas int64 (bytes copiados do antigo somando a diferença, bytes inseridos do bloco extra,
+//     deslocamento da posição no arquivo antigo)
+//   - diferenças: byte novo menos byte antigo de cada byte copiado
+//   - extra: bytes novos inseridos
+const bsdiffMagic = "AGDIFF01"
+
+// bsdiff gera o patch que transforma oldData em newData, com o algoritmo de Colin Percival:
+// ordenação de sufixos do arquivo antigo (qsufsort) e trechos aproximados, cujas diferenças são quase todas zero
+// em executáveis recompilados (endereços deslocados) e comprimem bem
+func bsdiff(oldData, newData []byte) ([]byte, error) {
+	suffixes := qsufsort(oldData)
+
+	var ctrl, diff, extra bytes.Buffer
+	ctrlWriter := gzip.NewWriter(&ctrl)
+	diffWriter := gzip.NewWriter(&diff)
+	extraWriter := gzip.NewWriter(&extra)
+
+	oldSize, newSize := len(oldData), len(newData)
+	var scan, length, pos, lastScan, lastPos, lastOffset int
+	var word [8]byte
+	diffBuffer := make([]byte, 0, 4096)
+
+	for scan < newSize {
+		oldScore := 0
+		scan += length
+		for scsc := scan; scan < newSize; scan++ {
+			pos, length = suffixSearch(suffixes, oldData, newData[scan:], 0, oldSize)
+
+			for ; scsc < scan+length; scsc++ {
+				if scsc+lastOffset < oldSize && oldData[scsc+lastOffset] == newData[scsc] {
+					oldScore++
+				}
+			}
+			if (length == oldScore && length != 0) || length > oldScore+8 {
+				break
+			}
+			if scan+lastOffset < oldSize && oldData[scan+lastOffset] == newData[scan] {
+				oldScore--
+			}
+		}
+
+		if length == oldScore && scan != newSize {
+			continue
+		}
+
+		// Estender o trecho anterior para a frente e o novo trecho para trás enquanto mais da metade dos bytes conferir
+		score, bestScore, lenForward := 0, 0, 0
+		for i := 0; lastScan+i < scan && lastPos+i < oldSize; {
+			if oldData[lastPos+i] == newData[lastScan+i] {
+				score++
+			}
+			i++
+			if score*2-i > bestScore*2-lenForward {
+				bestScore, lenForward = score, i
+			}
+		}
+
+		lenBack := 0
+		if scan < newSize {
+			score, bestScore = 0, 0
+			for i := 1; scan >= lastScan+i && pos >= i; i++ {
+				if oldData[pos-i] == newData[scan-i] {
+					score++
+				}
+				if score*2-i > bestScore*2-lenBack {
+					bestScore, lenBack = score, i
+				}
+			}
+		}
+
+		// Dividir a sobreposição entre as duas extensões no ponto que maximiza os bytes iguais
+		if lastScan+lenForward > scan-lenBack {
+			overlap := (lastScan + lenForward) - (scan - lenBack)
+			score, bestScore, lenSplit := 0, 0, 0
+			for i := 0; i < overlap; i++ {
+				if newData[lastScan+lenForward-overlap+i] == oldData[lastPos+lenForward-overlap+i] {
+					score++
+				}
+				if newData[scan-lenBack+i] == oldData[pos-lenBack+i] {
+					score--
+				}
+				if score > bestScore {
+					bestScore, lenSplit = score, i+1
+				}
+			}
+			lenForward += lenSplit - overlap
+			lenBack -= lenSplit
+		}
+
+		diffBuffer = diffBuffer[:0]
+		for i := 0; i < lenForward; i++ {
+			diffBuffer = append(diffBuffer, newData[lastScan+i]-oldData[lastPos+i])
+		}
+		if _, err := diffWriter.Write(diffBuffer); err != nil {
+			return nil, fmt.Errorf("erro ao gravar diferenças: %v", err)
+		}
+		extraLength := (scan - lenBack) - (lastScan + lenForward)
+		if _, err := extraWriter.Write(newData[lastScan+lenForward : lastScan+lenForward+extraLength]); err != nil {
+			return nil, fmt.Errorf("erro ao gravar bloco extra: %v", err)
+		}
+
+		for _, value := range []int{lenForward, extraLength, (pos - lenBack) - (lastPos + lenForward)} {
+			binary.LittleEndian.PutUint64(word[:], uint64(int64(value)))
+			if _, err := ctrlWriter.Write(word[:]); err != nil {
+				return nil, fmt.Errorf("erro ao gravar controle: %v", err)
+			}
+		}
+
+		lastScan = scan - lenBack
+		lastPos = pos - lenBack
+		lastOffset = pos - scan
+	}
+
+	for _, writer := range []*gzip.Writer{ctrlWriter, diffWriter, extraWriter} {
+		if err := writer.Close(); err != nil {
+			return nil, fmt.Errorf("erro ao comprimir patch: %v", err)
+		}
+	}
+
+	var patch bytes.Buffer
+	patch.WriteString(bsdiffMagic)
+	for _, value := range []int{newSize, ctrl.Len(), diff.Len()} {
+		binary.LittleEndian.PutUint64(word[:], uint64(int64(value)))
+		patch.Write(word[:])
+	}
+	for _, block := range []*bytes.Buffer{&ctrl, &diff, &extra} {
+		if _, err := io.Copy(&patch, block); err != nil {
+			return nil, err
+		}
+	}
+	return patch.Bytes(), nil
+}
+
+// suffixSearch procura, por busca binária no vetor de sufixos, o trecho do arquivo antigo com o maior prefixo
+// em comum com target; retorna a posição no arquivo antigo e o tamanho do prefixo
+func suffixSearch(suffixes []int32, oldData, target []byte, start, end int) (int, int) {
+	for end-start >= 2 {
+		middle := start + (end-start)/2
+		suffix := oldData[suffixes[middle]:]
+		if bytes.Compare(suffix[:min(len(suffix), len(target))], target[:min(len(suffix), len(target))]) < 0 {
+			start = middle
+		} else {
+			end = middle
+		}
+	}
+
+	startLength := matchLength(oldData[suffixes[start]:], target)
+	endLength := matchLength(oldData[suffixes[end]:], target)
+	if startLength > endLength {
+		return int(suffixes[start]), startLength
+	}
+	return int(suffixes[end]), endLength
+}
+
+// matchLength retorna o tamanho do prefixo comum
+func matchLength(a, b []byte) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
+
+// qsufsort ordena os sufixos de data pelo método de Larsson e Sadakane (duplicação de prefixos)
+// Retorna o vetor de sufixos com len(data)+1 posições, incluindo o sufixo vazio
+func qsufsort(data []byte) []int32 {
+	size := len(data)
+	index := make([]int32, size+1)
+	value := make([]int32, size+1)
+
+	// Ordenar pelo primeiro byte (contagem por balde)
+	var buckets [256]int32
+	for _, b := range data {
+		buckets[b]++
+	}
+	for i := 1; i < 256; i++ {
+		buckets[i] += buckets[i-1]
+	}
+	for i := 255; i > 0; i-- {
+		buckets[i] = buckets[i-1]
+	}
+	buckets[0] = 0
+
+	for i, b := range data {
+		buckets[b]++
+		index[buckets[b]] = int32(i)
+	}
+	index[0] = int32(size)
+	for i, b := range data {
+		value[i] = buckets[b]
+	}
+	value[size] = 0
+	for i := 1; i < 256; i++ {
+		if buckets[i] == buckets[i-1]+1 {
+			index[buckets[i]] = -1
+		}
+	}
+	index[0] = -1
+
+	// Dobrar o tamanho do prefixo ordenado até todos os grupos terem um único sufixo
+	for h := int32(1); index[0] != -int32(size+1); h += h {
+		length := int32(0)
+		i := int32(0)
+		for i < int32(size+1) {
+			if index[i] < 0 {
+				length -= index[i]
+				i -= index[i]
+				continue
+			}
+			if length != 0 {
+				index[i-length] = -length
+			}
+			length = value[index[i]] + 1 - i
+			suffixSplit(index, value, i, length, h)
+			i += length
+			length = 0
+		}
+		if length != 0 {
+			index[i-length] = -length
+		}
+	}
+
+	for i := 0; i < size+1; i++ {
+		index[value[i]] = int32(i)
+	}
+	return index
+}
+
+// suffixSplit ordena o grupo de sufixos index[start:start+length] pela posição h do prefixo (ternary quicksort)
+func suffixSplit(index, value []int32, start, length, h int32) {
+	if length < 16 {
+		for k := start; k < start+length; {
+			j := int32(1)
+			x := value[index[k]+h]
+			for i := int32(1); k+i < start+length; i++ {
+				if value[index[k+i]+h] < x {
+					x = value[index[k+i]+h]
+					j = 0
+				}
+				if value[index[k+i]+h] == x {
+					index[k+j], index[k+i] = index[k+i], index[k+j]
+					j++
+				}
+			}
+			for i := int32(0); i < j; i++ {
+				value[index[k+i]] = k + j - 1
+			}
+			if j == 1 {
+				index[k] = -1
+			}
+			k += j
+		}
+		return
+	}
+
+	x := value[index[start+length/2]+h]
+	var jj, kk int32
+	for i := start; i < start+length; i++ {
+		if value[index[i]+h] < x {
+			jj++
+		}
+		if value[index[i]+h] == x {
+			kk++
+		}
+	}
+	jj += start
+	kk += jj
+
+	i, j, k := start, int32(0), int32(0)
+	for i < jj {
+		switch v := value[index[i]+h]; {
+		case v < x:
+			i++
+		case v == x:
+			index[i], index[jj+j] = index[jj+j], index[i]
+			j++
+		default:
+			index[i], index[kk+k] = index[kk+k], index[i]
+			k++
+		}
+	}
+	for jj+j < kk {
+		if value[index[jj+j]+h] == x {
+			j++
+		} else {
+			index[jj+j], index[kk+k] = index[kk+k], index[jj+j]
+			k++
+		}
+	}
+
+	if jj > start {
+		suffixSplit(index, value, start, jj-start, h)
+	}
+	for i := int32(0); i < kk-jj; i++ {
+		value[index[jj+i]] = kk - 1
+	}
+	if jj == kk-1 {
+		index[jj] = -1
+	}
+	if start+length > kk {
+		suffixSplit(index, value, kk, start+length-kk, h)
+	}
+}
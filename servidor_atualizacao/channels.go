@@ -0,0 +1,188 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Canal dos agentes que não informam canal; é publicado na raiz do diretório do servidor
+const defaultChannel = "stable"
+
+// Diretório com uma pasta por canal (canais/beta, canais/pilot), cada uma com seu version.txt, notas.txt e executáveis
+const channelsDir = "canais"
+
+// Cabeçalho com o identificador do agente, usado quando a consulta não informa agente_id
+const agentIDHeader = "X-Agente-ID"
+
+// Arquivo opcional com o percentual de liberação e o canal de recuo de cada canal
+const channelsConfigFile = "canais.json"
+
+// ChannelConfig descreve a liberação da versão publicada em um canal
+// Com Percentual abaixo de 100, apenas essa fração dos agentes recebe a versão do canal (canário);
+// os demais recebem a versão do canal de Recuo, ou nenhuma se o canal não tiver recuo
+type ChannelConfig struct {
+	Percentual int    `json:"percentual"`
+	Recuo      string `json:"recuo,omitempty"`
+}
+
+// Canais conhecidos sem configuração em canais.json: cada um recua para o canal mais estável seguinte
+var defaultChannels = map[string]ChannelConfig{
+	"stable": {Percentual: 100},
+	"beta":   {Percentual: 100, Recuo: "stable"},
+	"pilot":  {Percentual: 100, Recuo: "beta"},
+}
+
+// ChannelRelease é a versão que um agente deve receber: o canal de onde ela sai e o manifesto assinado
+type ChannelRelease struct {
+	Canal    string
+	Versao   string
+	Manifest []byte
+}
+
+// isValidChannelName verifica se o nome do canal tem apenas letras minúsculas, números e hífens
+func isValidChannelName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// channelDir retorna o diretório com os arquivos publicados no canal
+func channelDir(root, channel string) string {
+	if channel == defaultChannel {
+		return root
+	}
+	return filepath.Join(root, channelsDir, channel)
+}
+
+// channelURLPrefix retorna o prefixo das URLs dos arquivos publicados no canal
+func channelURLPrefix(channel string) string {
+	if channel == defaultChannel {
+		return "/"
+	}
+	return "/" + channelsDir + "/" + channel + "/"
+}
+
+// loadChannels lê a configuração dos canais: os canais padrão, as pastas em canais/ e o arquivo canais.json
+// Pastas sem configuração recuam para o canal stable
+func loadChannels(root string) (map[string]ChannelConfig, error) {
+	channels := make(map[string]ChannelConfig)
+	for name, config := range defaultChannels {
+		channels[name] = config
+	}
+
+	entries, err := os.ReadDir(filepath.Join(root, channelsDir))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("erro ao listar canais: %v", err)
+	}
+	for _, entry := range entries {
+		if _, known := channels[entry.Name()]; entry.IsDir() && !known && isValidChannelName(entry.Name()) {
+			channels[entry.Name()] = ChannelConfig{Percentual: 100, Recuo: defaultChannel}
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(root, channelsConfigFile))
+	if os.IsNotExist(err) {
+		return channels, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("erro ao ler %s: %v", channelsConfigFile, err)
+	}
+
+	// Campos omitidos mantêm o valor padrão do canal (percentual 100 para canais novos)
+	var configured map[string]json.RawMessage
+	if err := json.Unmarshal(data, &configured); err != nil {
+		return nil, fmt.Errorf("erro ao interpretar %s: %v", channelsConfigFile, err)
+	}
+	for name, raw := range configured {
+		if !isValidChannelName(name) {
+			return nil, fmt.Errorf("%s: nome de canal inválido: %q", channelsConfigFile, name)
+		}
+		config, ok := channels[name]
+		if !ok {
+			config = ChannelConfig{Percentual: 100, Recuo: defaultChannel}
+		}
+		if err := json.Unmarshal(raw, &config); err != nil {
+			return nil, fmt.Errorf("%s: configuração do canal %s inválida: %v", channelsConfigFile, name, err)
+		}
+		if config.Percentual < 0 || config.Percentual > 100 {
+			return nil, fmt.Errorf("%s: percentual do canal %s deve estar entre 0 e 100", channelsConfigFile, name)
+		}
+		channels[name] = config
+	}
+	for name, config := range channels {
+		if _, ok := channels[config.Recuo]; config.Recuo != "" && !ok {
+			return nil, fmt.Errorf("%s: canal %s recua para o canal desconhecido %s", channelsConfigFile, name, config.Recuo)
+		}
+	}
+	return channels, nil
+}
+
+// rolloutBucket distribui os agentes em 100 faixas, de forma estável para o mesmo agente e a mesma versão
+// Incluir o canal e a versão faz cada liberação escolher um grupo diferente de agentes como canário
+func rolloutBucket(channel, version, agentID string) int {
+	sum := sha256.Sum256([]byte(channel + ":" + version + ":" + strings.ToLower(agentID)))
+	return int(binary.BigEndian.Uint64(sum[:8]) % 100)
+}
+
+// inRollout verifica se o agente está entre os que recebem a versão do canal
+// Agentes sem identificador só recebem versões liberadas para todos
+func inRollout(config ChannelConfig, channel, version, agentID string) bool {
+	if config.Percentual >= 100 {
+		return true
+	}
+	if agentID == "" || config.Percentual <= 0 {
+		return false
+	}
+	return rolloutBucket(channel, version, agentID) < config.Percentual
+}
+
+// resolveRelease decide qual versão o agente deve receber, partindo do canal informado por ele
+// Canais sem versão publicada ou fora do percentual de liberação para o agente recuam para o canal seguinte;
+// retorna nil se nenhum canal tiver versão liberada para o agente
+func resolveRelease(root, channel, agentID string) (*ChannelRelease, error) {
+	channels, err := loadChannels(root)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := channels[channel]; !ok {
+		channel = defaultChannel
+	}
+
+	visited := make(map[string]bool)
+	for channel != "" && !visited[channel] {
+		visited[channel] = true
+		config := channels[channel]
+
+		signed, version, err := getSignedManifest(root, channel)
+		if err == nil && inRollout(config, channel, version, agentID) {
+			return &ChannelRelease{Canal: channel, Versao: version, Manifest: signed}, nil
+		}
+		if err != nil && channel == defaultChannel {
+			return nil, err
+		}
+		channel = config.Recuo
+	}
+	return nil, nil
+}
+
+// channelNames retorna os nomes dos canais em ordem alfabética
+func channelNames(channels map[string]ChannelConfig) []string {
+	names := make([]string, 0, len(channels))
+	for name := range channels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
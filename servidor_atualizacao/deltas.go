@@ -0,0 +1,280 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Diretório, dentro de cada canal, com os executáveis das versões anteriores (anteriores/<versão>/<arquivo>)
+// A versão publicada é arquivada automaticamente, servindo de origem dos patches quando for substituída
+const previousReleasesDir = "anteriores"
+
+// Diretório com os patches gerados, compartilhado entre os canais; o nome identifica os executáveis de origem
+// e de destino pelo SHA-256 (<origem>-<destino>.patch)
+const deltasDir = "deltas"
+
+// Quantidade de versões anteriores para as quais são gerados patches (flag -delta-versoes; 0 desativa)
+var deltaVersions int
+
+// UpdateDelta descreve o patch que transforma o executável de uma versão anterior no executável publicado
+type UpdateDelta struct {
+	Versao     string `json:"versao"`      // Versão de origem
+	BaseSHA256 string `json:"base_sha256"` // SHA-256 do executável de origem
+	URL        string `json:"url"`
+	Tamanho    int64  `json:"tamanho"`
+	SHA256     string `json:"sha256"` // SHA-256 do patch
+}
+
+// deltaJob é a geração de um patch, feita em segundo plano
+type deltaJob struct {
+	basePath   string
+	targetPath string
+	patchPath  string
+}
+
+// Patches aguardando geração, para não enfileirar o mesmo patch duas vezes
+var (
+	deltaQueue        = make(chan deltaJob, 64)
+	pendingDeltas     = make(map[string]bool)
+	pendingDeltasLock sync.Mutex
+	deltaWorkerOnce   sync.Once
+)
+
+// Hash dos arquivos publicados, refeito quando o tamanho ou a data de modificação mudam
+type cachedHash struct {
+	size  int64
+	sum   string
+	stamp string
+}
+
+var (
+	cachedHashes      = make(map[string]cachedHash)
+	cachedHashesMutex sync.Mutex
+)
+
+// hashFileCached calcula o tamanho e o SHA-256 do arquivo, reaproveitando o cálculo anterior se ele não mudou
+func hashFileCached(path string) (int64, string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, "", err
+	}
+	stamp := fmt.Sprintf("%d:%d", info.Size(), info.ModTime().UnixNano())
+
+	cachedHashesMutex.Lock()
+	defer cachedHashesMutex.Unlock()
+	if cached, ok := cachedHashes[path]; ok && cached.stamp == stamp {
+		return cached.size, cached.sum, nil
+	}
+
+	size, sum, err := hashFile(path)
+	if err != nil {
+		return 0, "", err
+	}
+	cachedHashes[path] = cachedHash{size: size, sum: sum, stamp: stamp}
+	return size, sum, nil
+}
+
+// archiveRelease guarda uma cópia do executável publicado em anteriores/<versão>/, atualizando-a se a versão
+// foi republicada com outro conteúdo
+func archiveRelease(dir, version, filename, sum string) error {
+	archivedPath := filepath.Join(dir, previousReleasesDir, version, filename)
+	if _, archivedSum, err := hashFileCached(archivedPath); err == nil && archivedSum == sum {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(archivedPath), 0755); err != nil {
+		return fmt.Errorf("erro ao criar diretório de versões anteriores: %v", err)
+	}
+	source, err := os.Open(filepath.Join(dir, filename))
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	tempPath := archivedPath + ".tmp"
+	target, err := os.Create(tempPath)
+	if err != nil {
+		return fmt.Errorf("erro ao arquivar %s: %v", filename, err)
+	}
+	_, err = io.Copy(target, source)
+	if closeErr := target.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("erro ao arquivar %s: %v", filename, err)
+	}
+	if err := os.Rename(tempPath, archivedPath); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("erro ao arquivar %s: %v", filename, err)
+	}
+	log.Printf("Executável %s da versão %s arquivado em %s", filename, version, filepath.Dir(archivedPath))
+	return nil
+}
+
+// previousReleasePaths retorna os executáveis arquivados das versões anteriores à publicada, da mais recente
+// para a mais antiga, limitados a deltaVersions versões
+func previousReleasePaths(dir, filename, currentVersion string) map[string]string {
+	current, err := parseVersion(currentVersion)
+	if err != nil || deltaVersions <= 0 {
+		return nil
+	}
+	entries, err := os.ReadDir(filepath.Join(dir, previousReleasesDir))
+	if err != nil {
+		return nil
+	}
+
+	type previousRelease struct {
+		version Version
+		name    string
+	}
+	var releases []previousRelease
+	for _, entry := range entries {
+		version, err := parseVersion(entry.Name())
+		if err != nil || !entry.IsDir() || version.Compare(current) >= 0 {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(dir, previousReleasesDir, entry.Name(), filename)); err != nil {
+			continue
+		}
+		releases = append(releases, previousRelease{version: version, name: entry.Name()})
+	}
+	sort.Slice(releases, func(i, j int) bool { return releases[i].version.Compare(releases[j].version) > 0 })
+	if len(releases) > deltaVersions {
+		releases = releases[:deltaVersions]
+	}
+
+	paths := make(map[string]string, len(releases))
+	for _, release := range releases {
+		paths[release.name] = filepath.Join(dir, previousReleasesDir, release.name, filename)
+	}
+	return paths
+}
+
+// releaseDeltas retorna os patches já gerados das versões anteriores para o executável publicado e
+// enfileira a geração dos que faltam (incluídos no manifesto quando ficarem prontos)
+func releaseDeltas(root, dir, filename, version string, size int64, sum string) []UpdateDelta {
+	var deltas []UpdateDelta
+	for previousVersion, basePath := range previousReleasePaths(dir, filename, version) {
+		_, baseSum, err := hashFileCached(basePath)
+		if err != nil || baseSum == sum {
+			continue
+		}
+
+		name := baseSum[:16] + "-" + sum[:16] + ".patch"
+		patchPath := filepath.Join(root, deltasDir, name)
+		patchSize, patchSum, err := hashFileCached(patchPath)
+		if os.IsNotExist(err) {
+			enqueueDelta(deltaJob{basePath: basePath, targetPath: filepath.Join(dir, filename), patchPath: patchPath})
+			continue
+		}
+		if err != nil {
+			log.Printf("Aviso: patch %s indisponível: %v", name, err)
+			continue
+		}
+
+		// Patches maiores que o executável não trazem economia
+		if patchSize >= size {
+			continue
+		}
+		deltas = append(deltas, UpdateDelta{
+			Versao:     previousVersion,
+			BaseSHA256: baseSum,
+			URL:        "/" + deltasDir + "/" + name,
+			Tamanho:    patchSize,
+			SHA256:     patchSum,
+		})
+	}
+	sort.Slice(deltas, func(i, j int) bool { return deltas[i].Versao < deltas[j].Versao })
+	return deltas
+}
+
+// enqueueDelta agenda a geração do patch, se ela ainda não estiver agendada
+func enqueueDelta(job deltaJob) {
+	deltaWorkerOnce.Do(func() {
+		go deltaWorker()
+	})
+
+	pendingDeltasLock.Lock()
+	defer pendingDeltasLock.Unlock()
+	if pendingDeltas[job.patchPath] {
+		return
+	}
+	select {
+	case deltaQueue <- job:
+		pendingDeltas[job.patchPath] = true
+	default:
+		// Fila cheia: o patch é agendado novamente na próxima montagem do manifesto
+	}
+}
+
+// deltaWorker gera os patches agendados, um de cada vez (a geração usa memória proporcional ao executável)
+func deltaWorker() {
+	for job := range deltaQueue {
+		if err := generateDelta(job); err != nil {
+			log.Printf("Erro ao gerar patch %s: %v", filepath.Base(job.patchPath), err)
+		}
+		pendingDeltasLock.Lock()
+		delete(pendingDeltas, job.patchPath)
+		pendingDeltasLock.Unlock()
+	}
+}
+
+// generateDelta gera o patch e o grava no diretório de patches
+func generateDelta(job deltaJob) error {
+	started := time.Now()
+	baseData, err := os.ReadFile(job.basePath)
+	if err != nil {
+		return fmt.Errorf("erro ao ler executável de origem: %v", err)
+	}
+	targetData, err := os.ReadFile(job.targetPath)
+	if err != nil {
+		return fmt.Errorf("erro ao ler executável de destino: %v", err)
+	}
+
+	patch, err := bsdiff(baseData, targetData)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(job.patchPath), 0755); err != nil {
+		return fmt.Errorf("erro ao criar diretório de patches: %v", err)
+	}
+	tempPath := job.patchPath + ".tmp"
+	if err := os.WriteFile(tempPath, patch, 0644); err != nil {
+		return fmt.Errorf("erro ao gravar patch: %v", err)
+	}
+	if err := os.Rename(tempPath, job.patchPath); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("erro ao gravar patch: %v", err)
+	}
+
+	log.Printf("Patch %s gerado em %v: %d bytes (executável: %d bytes)",
+		filepath.Base(job.patchPath), time.Since(started).Round(time.Millisecond), len(patch), len(targetData))
+	return nil
+}
+
+// isDeltaPath verifica se o caminho é de um patch gerado (/deltas/<origem>-<destino>.patch)
+func isDeltaPath(urlPath string) bool {
+	name, ok := strings.CutPrefix(urlPath, "/"+deltasDir+"/")
+	if !ok {
+		return false
+	}
+	name, ok = strings.CutSuffix(name, ".patch")
+	if !ok || name == "" {
+		return false
+	}
+	for _, c := range name {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') && c != '-' {
+			return false
+		}
+	}
+	return true
+}
@@ -3,28 +3,57 @@ package main
 import (
 	"log"
 	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
 )
 
 // fileServerHandler é o manipulador personalizado para servir apenas os arquivos necessários
-func fileServerHandler(fileServer http.Handler) http.HandlerFunc {
+func fileServerHandler(dir string, fileServer http.Handler) http.HandlerFunc {
 	// Lista de arquivos permitidos
 	allowedFiles := map[string]bool{
-		"/agente_http.exe": true,
-		"/version.txt":     true,
-		"/public_key.pem":  true,
+		"/agente_http.exe":         true,
+		"/agente_http_linux_amd64": true,
+		"/version.txt":             true,
+		"/public_key.pem":          true,
 	}
 
 	return func(w http.ResponseWriter, r *http.Request) {
 		path := r.URL.Path
 
 		// Verificar se o arquivo solicitado está na lista de permitidos
-		if !allowedFiles[path] && path != "/" {
+		if !allowedFiles[path] && !isChannelFile(path) && !isDeltaPath(path) && path != "/" {
 			// Arquivo não permitido, retornar 404
 			http.NotFound(w, r)
 			log.Printf("Acesso negado: %s de %s", path, r.RemoteAddr)
 			return
 		}
 
+		// Executáveis e patches: ETag e Range, para que downloads interrompidos sejam continuados e caches intermediários
+		// revalidem o arquivo em vez de baixá-lo de novo; o prazo de escrita é o do download, não o das demais respostas
+		if isArtifactPath(path) || isDeltaPath(path) {
+			etag, err := fileETag(filepath.Join(dir, filepath.FromSlash(strings.TrimPrefix(path, "/"))))
+			if err != nil {
+				http.NotFound(w, r)
+				return
+			}
+			w.Header().Set("ETag", etag)
+			w.Header().Set("Accept-Ranges", "bytes")
+			w.Header().Set("Cache-Control", "no-cache")
+			if err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(downloadTimeout)); err != nil {
+				log.Printf("Aviso: não foi possível ajustar o prazo do download: %v", err)
+			}
+
+			if rangeHeader := r.Header.Get("Range"); rangeHeader != "" {
+				log.Printf("Download do agente: %s (%s, continuação %s)", r.RemoteAddr, path, rangeHeader)
+			} else {
+				log.Printf("Download do agente: %s (%s)", r.RemoteAddr, path)
+			}
+			fileServer.ServeHTTP(w, r)
+			return
+		}
+
 		// Adicionar cabeçalhos para evitar cache
 		w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
 		w.Header().Set("Pragma", "no-cache")
@@ -46,10 +75,8 @@ func fileServerHandler(fileServer http.Handler) http.HandlerFunc {
 			return
 		}
 
-		// Registrar download de arquivos importantes
-		if path == "/agente_http.exe" {
-			log.Printf("Download do agente: %s", r.RemoteAddr)
-		} else if path == "/version.txt" {
+		// Registrar verificações de versão
+		if strings.HasSuffix(path, "/version.txt") {
 			log.Printf("Verificação de versão: %s", r.RemoteAddr)
 		}
 
@@ -57,3 +84,46 @@ func fileServerHandler(fileServer http.Handler) http.HandlerFunc {
 		fileServer.ServeHTTP(w, r)
 	}
 }
+
+// isChannelFile verifica se o caminho é o version.txt ou um executável publicado em um canal (/canais/<nome>/<arquivo>)
+func isChannelFile(path string) bool {
+	rest, ok := strings.CutPrefix(path, "/"+channelsDir+"/")
+	if !ok {
+		return false
+	}
+	channel, filename, ok := strings.Cut(rest, "/")
+	if !ok || !isValidChannelName(channel) {
+		return false
+	}
+	if filename == "version.txt" {
+		return true
+	}
+	for _, artifact := range releaseArtifacts {
+		if filename == artifact {
+			return true
+		}
+	}
+	return false
+}
+
+// isArtifactPath verifica se o caminho é de um executável publicado, na raiz ou em um canal
+func isArtifactPath(urlPath string) bool {
+	if urlPath != "/"+path.Base(urlPath) && !isChannelFile(urlPath) {
+		return false
+	}
+	for _, artifact := range releaseArtifacts {
+		if path.Base(urlPath) == artifact {
+			return true
+		}
+	}
+	return false
+}
+
+// fileETag retorna o ETag do arquivo: o SHA-256 do conteúdo, o mesmo informado no manifesto
+func fileETag(filePath string) (string, error) {
+	_, sum, err := hashFileCached(filePath)
+	if err != nil {
+		return "", err
+	}
+	return `"` + sum + `"`, nil
+}
@@ -12,11 +12,12 @@ import (
 
 // Configurações do servidor
 var (
-	port         int
-	readTimeout  time.Duration
-	writeTimeout time.Duration
-	idleTimeout  time.Duration
-	maxHeaderMB  int
+	port            int
+	readTimeout     time.Duration
+	writeTimeout    time.Duration
+	idleTimeout     time.Duration
+	downloadTimeout time.Duration // Prazo de escrita do download de um executável, maior para links lentos
+	maxHeaderMB     int
 )
 
 func main() {
@@ -24,6 +25,8 @@ func main() {
 	flag.IntVar(&port, "port", 9991, "Porta do servidor HTTP")
 	flag.DurationVar(&readTimeout, "read-timeout", 10*time.Second, "Timeout para leitura de requisições")
 	flag.DurationVar(&writeTimeout, "write-timeout", 30*time.Second, "Timeout para escrita de respostas")
+	flag.DurationVar(&downloadTimeout, "download-timeout", 2*time.Hour, "Timeout para o download de um executável")
+	flag.IntVar(&deltaVersions, "delta-versoes", 3, "Quantidade de versões anteriores para as quais são gerados patches binários (0 desativa)")
 	flag.DurationVar(&idleTimeout, "idle-timeout", 120*time.Second, "Timeout para conexões ociosas")
 	flag.IntVar(&maxHeaderMB, "max-header", 1, "Tamanho máximo do cabeçalho em MB")
 	flag.Parse()
@@ -38,7 +41,8 @@ func main() {
 	fileServer := http.FileServer(http.Dir(currentDir))
 
 	// Registrar handlers
-	http.HandleFunc("/", fileServerHandler(fileServer))
+	http.HandleFunc("/", fileServerHandler(currentDir, fileServer))
+	http.HandleFunc("/manifest.json", manifestHandler(currentDir))
 
 	// Configurar o servidor HTTP com timeouts e limites
 	server := &http.Server{
@@ -64,6 +68,20 @@ func main() {
 	// Verificar e exibir arquivos importantes
 	checkImportantFiles(currentDir)
 
+	// Assinar o manifesto da versão publicada em cada canal
+	channels, err := loadChannels(currentDir)
+	if err != nil {
+		log.Printf("AVISO: Configuração dos canais inválida: %v", err)
+	}
+	for _, channel := range channelNames(channels) {
+		config := channels[channel]
+		if _, version, err := getSignedManifest(currentDir, channel); err != nil {
+			log.Printf("AVISO: Manifesto do canal %s indisponível: %v", channel, err)
+		} else {
+			log.Printf("Canal %s: versão %s liberada para %d%% dos agentes (recuo: %q)", channel, version, config.Percentual, config.Recuo)
+		}
+	}
+
 	// Iniciar rotina para limpar recursos periodicamente
 	go cleanupResources()
 
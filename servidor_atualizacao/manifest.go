@@ -0,0 +1,335 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Executáveis publicados por plataforma ("sistema/arquitetura", como em runtime.GOOS e runtime.GOARCH)
+// Plataformas sem o arquivo no diretório do servidor ficam fora do manifesto
+var releaseArtifacts = map[string]string{
+	"windows/amd64": "agente_http.exe",
+	"linux/amd64":   "agente_http_linux_amd64",
+}
+
+// Arquivo opcional com as notas da versão, incluídas no manifesto
+const releaseNotesFile = "notas.txt"
+
+// Arquivo que marca a versão publicada como reversão: a primeira linha é a versão retirada, da qual os agentes
+// voltam, e as demais, o motivo; sem ele, os agentes recusam versões anteriores à instalada
+const releaseRollbackFile = "reversao.txt"
+
+// Validade da autorização de reversão no manifesto; o manifesto é assinado novamente na metade da validade
+const rollbackValidity = 72 * time.Hour
+
+// UpdateArtifact descreve o executável publicado para uma plataforma
+type UpdateArtifact struct {
+	URL     string `json:"url"`
+	Tamanho int64  `json:"tamanho"`
+	SHA256  string `json:"sha256"`
+	// Patches a partir das versões anteriores; o agente aplica o patch do seu executável e confere o SHA-256 acima
+	Deltas []UpdateDelta `json:"deltas,omitempty"`
+}
+
+// UpdateManifest descreve a versão publicada: versão, artefatos por plataforma e notas da versão
+type UpdateManifest struct {
+	Versao      string                    `json:"versao"`
+	Canal       string                    `json:"canal"`
+	PublicadoEm int64                     `json:"publicado_em"`
+	Notas       string                    `json:"notas,omitempty"`
+	Artefatos   map[string]UpdateArtifact `json:"artefatos"`
+	// Reversão: autoriza os agentes na versão ReversaoDe a instalarem esta versão, anterior à instalada,
+	// até ReversaoExpiraEm (Unix, em segundos)
+	Reversao         bool   `json:"reversao,omitempty"`
+	ReversaoDe       string `json:"reversao_de,omitempty"`
+	ReversaoExpiraEm int64  `json:"reversao_expira_em,omitempty"`
+	MotivoReversao   string `json:"motivo_reversao,omitempty"`
+}
+
+// Chave privada de release, separada da chave dos comandos: os agentes só a aceitam nos manifestos
+const releaseKeyFile = "release_private_key.pem"
+
+// Prefixo dos dados assinados dos manifestos, que impede o uso da assinatura em outro formato
+const manifestSignaturePrefix = "agente-manifesto-v1\n"
+
+// SignedManifest é o documento servido em /manifest.json: o manifesto serializado e a assinatura da chave de release
+// (RSA PKCS#1 v1.5 com SHA-256 sobre o prefixo dos manifestos seguido dos bytes do manifesto, com keys/release_private_key.pem)
+type SignedManifest struct {
+	Manifesto  string `json:"manifesto"`
+	Assinatura string `json:"assinatura"`
+	ChaveID    string `json:"chave_id"`
+}
+
+// cachedManifest é o manifesto assinado de um canal e o estado dos arquivos de onde foi montado
+type cachedManifest struct {
+	signed  []byte
+	version string
+	stamp   string
+	renewAt time.Time // Zero se o manifesto não expira
+}
+
+// Manifestos assinados em cache por canal, refeitos quando algum dos arquivos publicados no canal muda
+var (
+	cachedManifests     = make(map[string]*cachedManifest)
+	cachedManifestMutex sync.Mutex
+)
+
+// loadReleaseKey carrega a chave privada de release do diretório keys
+func loadReleaseKey(dir string) (*rsa.PrivateKey, error) {
+	pemData, err := os.ReadFile(filepath.Join(dir, "keys", releaseKeyFile))
+	if err != nil {
+		return nil, fmt.Errorf("erro ao ler chave de release: %v", err)
+	}
+	block, _ := pem.Decode(pemData)
+	if block == nil || block.Type != "RSA PRIVATE KEY" {
+		return nil, fmt.Errorf("falha ao decodificar chave de release PEM")
+	}
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("falha ao analisar chave de release: %v", err)
+	}
+	return key, nil
+}
+
+// publicKeyID calcula o identificador da chave, o mesmo usado pelos agentes:
+// os primeiros 8 bytes do SHA-256 da chave pública em DER, em hexadecimal
+func publicKeyID(publicKey *rsa.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return "", fmt.Errorf("erro ao serializar chave pública: %v", err)
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:8]), nil
+}
+
+// releaseFilesStamp identifica o estado dos arquivos publicados no canal e da chave de release
+// (tamanho e data de modificação)
+func releaseFilesStamp(root, channel string) string {
+	dir := channelDir(root, channel)
+	files := []string{filepath.Join(dir, "version.txt"), filepath.Join(dir, releaseNotesFile), filepath.Join(dir, releaseRollbackFile), filepath.Join(root, "keys", releaseKeyFile),
+		filepath.Join(dir, previousReleasesDir), filepath.Join(root, deltasDir)}
+	for _, filename := range releaseArtifacts {
+		files = append(files, filepath.Join(dir, filename))
+	}
+	sort.Strings(files)
+
+	var stamp strings.Builder
+	for _, path := range files {
+		if info, err := os.Stat(path); err == nil {
+			fmt.Fprintf(&stamp, "%s:%d:%d;", path, info.Size(), info.ModTime().UnixNano())
+		}
+	}
+	return stamp.String()
+}
+
+// hashFile calcula o tamanho e o SHA-256 do arquivo
+func hashFile(path string) (int64, string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return 0, "", fmt.Errorf("erro ao calcular SHA-256 de %s: %v", path, err)
+	}
+	return size, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// readRollback lê o arquivo de reversão do canal: a versão retirada e o motivo
+func readRollback(dir, version string) (string, string, error) {
+	data, err := os.ReadFile(filepath.Join(dir, releaseRollbackFile))
+	if err != nil {
+		return "", "", err
+	}
+
+	from, reason, _ := strings.Cut(strings.TrimSpace(string(data)), "\n")
+	from = strings.TrimSpace(from)
+	fromVersion, err := parseVersion(from)
+	if err != nil {
+		return "", "", fmt.Errorf("%s: a primeira linha precisa ser a versão retirada: %v", releaseRollbackFile, err)
+	}
+	publishedVersion, _ := parseVersion(version)
+	if publishedVersion.Compare(fromVersion) >= 0 {
+		return "", "", fmt.Errorf("%s: a versão retirada %s não é posterior à publicada %s", releaseRollbackFile, from, version)
+	}
+	return from, strings.TrimSpace(reason), nil
+}
+
+// buildSignedManifest monta o manifesto a partir dos arquivos publicados no canal e o assina com a chave de release
+func buildSignedManifest(root, channel string) ([]byte, UpdateManifest, error) {
+	dir := channelDir(root, channel)
+	versionData, err := os.ReadFile(filepath.Join(dir, "version.txt"))
+	if err != nil {
+		return nil, UpdateManifest{}, fmt.Errorf("erro ao ler version.txt: %v", err)
+	}
+
+	version := strings.TrimSpace(string(versionData))
+	if _, err := parseVersion(version); err != nil {
+		return nil, UpdateManifest{}, fmt.Errorf("version.txt: %v", err)
+	}
+
+	manifest := UpdateManifest{
+		Versao:      version,
+		Canal:       channel,
+		PublicadoEm: time.Now().Unix(),
+		Artefatos:   make(map[string]UpdateArtifact),
+	}
+	if notes, err := os.ReadFile(filepath.Join(dir, releaseNotesFile)); err == nil {
+		manifest.Notas = strings.TrimSpace(string(notes))
+	}
+	from, reason, err := readRollback(dir, version)
+	if err == nil {
+		manifest.Reversao = true
+		manifest.ReversaoDe = from
+		manifest.ReversaoExpiraEm = manifest.PublicadoEm + int64(rollbackValidity/time.Second)
+		manifest.MotivoReversao = reason
+	} else if !os.IsNotExist(err) {
+		return nil, UpdateManifest{}, err
+	}
+
+	for platform, filename := range releaseArtifacts {
+		size, sum, err := hashFileCached(filepath.Join(dir, filename))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, UpdateManifest{}, err
+		}
+		if err := archiveRelease(dir, version, filename, sum); err != nil {
+			log.Printf("Aviso: %v", err)
+		}
+		manifest.Artefatos[platform] = UpdateArtifact{
+			URL:     channelURLPrefix(channel) + filename,
+			Tamanho: size,
+			SHA256:  sum,
+			Deltas:  releaseDeltas(root, dir, filename, version, size, sum),
+		}
+	}
+	if len(manifest.Artefatos) == 0 {
+		return nil, UpdateManifest{}, fmt.Errorf("nenhum executável publicado")
+	}
+
+	key, err := loadReleaseKey(root)
+	if err != nil {
+		return nil, UpdateManifest{}, err
+	}
+	keyID, err := publicKeyID(&key.PublicKey)
+	if err != nil {
+		return nil, UpdateManifest{}, err
+	}
+
+	manifestJSON, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, UpdateManifest{}, fmt.Errorf("erro ao serializar manifesto: %v", err)
+	}
+	hashed := sha256.Sum256(append([]byte(manifestSignaturePrefix), manifestJSON...))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hashed[:])
+	if err != nil {
+		return nil, UpdateManifest{}, fmt.Errorf("erro ao assinar manifesto: %v", err)
+	}
+
+	signed, err := json.MarshalIndent(SignedManifest{
+		Manifesto:  base64.StdEncoding.EncodeToString(manifestJSON),
+		Assinatura: base64.StdEncoding.EncodeToString(signature),
+		ChaveID:    keyID,
+	}, "", "  ")
+	if err != nil {
+		return nil, UpdateManifest{}, fmt.Errorf("erro ao serializar manifesto assinado: %v", err)
+	}
+	return signed, manifest, nil
+}
+
+// getSignedManifest retorna o manifesto assinado do canal, refazendo-o se algum arquivo publicado mudou
+// ou se a autorização de reversão do manifesto está perto de expirar
+func getSignedManifest(root, channel string) ([]byte, string, error) {
+	cachedManifestMutex.Lock()
+	defer cachedManifestMutex.Unlock()
+
+	stamp := releaseFilesStamp(root, channel)
+	if cached := cachedManifests[channel]; cached != nil && stamp == cached.stamp &&
+		(cached.renewAt.IsZero() || time.Now().Before(cached.renewAt)) {
+		return cached.signed, cached.version, nil
+	}
+
+	signed, manifest, err := buildSignedManifest(root, channel)
+	if err != nil {
+		delete(cachedManifests, channel)
+		return nil, "", err
+	}
+
+	cached := &cachedManifest{signed: signed, version: manifest.Versao, stamp: stamp}
+	if manifest.Reversao {
+		cached.renewAt = time.Unix(manifest.PublicadoEm, 0).Add(rollbackValidity / 2)
+	}
+	cachedManifests[channel] = cached
+	log.Printf("Manifesto da versão %s assinado (canal %s)", manifest.Versao, channel)
+	return signed, manifest.Versao, nil
+}
+
+// manifestHandler serve o manifesto assinado da versão que o agente deve receber (/manifest.json)
+// O agente informa o canal (canal), o identificador (agente_id ou o cabeçalho X-Agente-ID) e a versão atual (versao);
+// responde 204 quando nenhum canal tem versão liberada para o agente
+// Agentes que compartilham atualizações informam também a plataforma, o endereço e a rede, e recebem em
+// X-Pares-Atualizacao os pares da mesma rede que já têm a versão liberada
+func manifestHandler(root string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		channel := strings.ToLower(strings.TrimSpace(query.Get("canal")))
+		if channel == "" {
+			channel = defaultChannel
+		}
+		agentID := strings.TrimSpace(query.Get("agente_id"))
+		if agentID == "" {
+			agentID = strings.TrimSpace(r.Header.Get(agentIDHeader))
+		}
+		currentVersion := query.Get("versao")
+
+		w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+
+		// Agentes que compartilham o executável instalado informam o endereço e a rede
+		registerPeer(agentID, query)
+
+		release, err := resolveRelease(root, channel, agentID)
+		if err != nil {
+			log.Printf("Erro ao gerar manifesto: %v", err)
+			http.Error(w, "Manifesto indisponível", http.StatusServiceUnavailable)
+			return
+		}
+		if release == nil {
+			log.Printf("Verificação de versão (manifesto): %s, agente %q, canal %s, versão %s: nenhuma versão liberada",
+				r.RemoteAddr, agentID, channel, currentVersion)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		peers := findPeers(agentID, release.Versao, query.Get("plataforma"), query.Get("rede"))
+		if len(peers) > 0 {
+			w.Header().Set(peersHeader, strings.Join(peers, ","))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		log.Printf("Verificação de versão (manifesto): %s, agente %q, canal %s, versão %s: recebe %s do canal %s (%d pares na rede)",
+			r.RemoteAddr, agentID, channel, currentVersion, release.Versao, release.Canal, len(peers))
+		w.Write(release.Manifest)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"math/rand"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cabeçalho da resposta do manifesto com os pares (ip:porta) da mesma rede que já têm a versão liberada
+// Os pares não fazem parte do manifesto assinado: o agente confere o SHA-256 do que receber deles
+const peersHeader = "X-Pares-Atualizacao"
+
+// Tempo sem consultas após o qual um agente deixa de ser indicado como par
+const peerExpiration = 2 * time.Hour
+
+// Quantidade máxima de pares indicados em cada resposta
+const maxPeersPerResponse = 5
+
+// updatePeer é um agente que compartilha o executável instalado com os agentes da sua rede
+type updatePeer struct {
+	version  string
+	platform string
+	address  string // ip:porta do servidor HTTP do agente
+	network  *net.IPNet
+	seen     time.Time
+}
+
+// Agentes que compartilham atualizações, pelo identificador
+var (
+	updatePeers      = make(map[string]updatePeer)
+	updatePeersMutex sync.Mutex
+)
+
+// registerPeer registra o agente como par, com a versão instalada e o endereço e a rede informados na consulta
+// (versao, plataforma, endereco e rede); agentes que não informam endereço deixam de ser indicados
+func registerPeer(agentID string, query url.Values) {
+	if agentID == "" {
+		return
+	}
+
+	updatePeersMutex.Lock()
+	defer updatePeersMutex.Unlock()
+
+	address := query.Get("endereco")
+	network := parsePeerNetwork(query.Get("rede"))
+	host, _, err := net.SplitHostPort(address)
+	ip := net.ParseIP(host)
+	if address == "" || err != nil || ip == nil || network == nil || !network.Contains(ip) {
+		delete(updatePeers, agentID)
+		return
+	}
+
+	updatePeers[agentID] = updatePeer{
+		version:  query.Get("versao"),
+		platform: query.Get("plataforma"),
+		address:  address,
+		network:  network,
+		seen:     time.Now(),
+	}
+}
+
+// findPeers retorna, em ordem aleatória, pares da mesma rede e plataforma do agente que já têm a versão informada
+func findPeers(agentID, version, platform, network string) []string {
+	requesterNetwork := parsePeerNetwork(network)
+	if requesterNetwork == nil || platform == "" {
+		return nil
+	}
+
+	updatePeersMutex.Lock()
+	defer updatePeersMutex.Unlock()
+
+	var addresses []string
+	for id, peer := range updatePeers {
+		if time.Since(peer.seen) > peerExpiration {
+			delete(updatePeers, id)
+			continue
+		}
+		if id == agentID || peer.version != version || peer.platform != platform || peer.network.String() != requesterNetwork.String() {
+			continue
+		}
+		addresses = append(addresses, peer.address)
+	}
+
+	rand.Shuffle(len(addresses), func(i, j int) { addresses[i], addresses[j] = addresses[j], addresses[i] })
+	if len(addresses) > maxPeersPerResponse {
+		addresses = addresses[:maxPeersPerResponse]
+	}
+	return addresses
+}
+
+// parsePeerNetwork interpreta a rede IPv4 informada pelo agente (ex: 10.1.2.0/24), recusando redes muito amplas
+func parsePeerNetwork(cidr string) *net.IPNet {
+	_, network, err := net.ParseCIDR(strings.TrimSpace(cidr))
+	if err != nil || network.IP.To4() == nil {
+		return nil
+	}
+	if ones, _ := network.Mask.Size(); ones < 16 {
+		return nil
+	}
+	return network
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version é uma versão no formato SemVer 2.0 (maior.menor.correção[-pré-lançamento][+build])
+type Version struct {
+	Major      uint64
+	Minor      uint64
+	Patch      uint64
+	Prerelease []string // Identificadores separados por ponto (ex: rc.1); vazio em versões de lançamento
+	Build      string   // Metadados de build, ignorados na comparação
+}
+
+// parseVersion interpreta uma versão SemVer 2.0
+// Versões com apenas maior ou maior.menor (ex: 1.10) são aceitas como maior.menor.0, como no agente
+func parseVersion(s string) (Version, error) {
+	var v Version
+	rest := s
+
+	if i := strings.IndexByte(rest, '+'); i >= 0 {
+		v.Build = rest[i+1:]
+		rest = rest[:i]
+		if err := validateVersionIdentifiers(v.Build, false); err != nil {
+			return Version{}, fmt.Errorf("versão inválida %q: metadados de build: %v", s, err)
+		}
+	}
+	if i := strings.IndexByte(rest, '-'); i >= 0 {
+		prerelease := rest[i+1:]
+		rest = rest[:i]
+		if err := validateVersionIdentifiers(prerelease, true); err != nil {
+			return Version{}, fmt.Errorf("versão inválida %q: pré-lançamento: %v", s, err)
+		}
+		v.Prerelease = strings.Split(prerelease, ".")
+	}
+
+	parts := strings.Split(rest, ".")
+	if len(parts) > 3 {
+		return Version{}, fmt.Errorf("versão inválida %q: esperado maior.menor.correção", s)
+	}
+	numbers := make([]uint64, 3)
+	for i, part := range parts {
+		if !isNumericIdentifier(part) {
+			return Version{}, fmt.Errorf("versão inválida %q: %q não é um número", s, part)
+		}
+		if len(part) > 1 && part[0] == '0' {
+			return Version{}, fmt.Errorf("versão inválida %q: %q tem zeros à esquerda", s, part)
+		}
+		number, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			return Version{}, fmt.Errorf("versão inválida %q: %v", s, err)
+		}
+		numbers[i] = number
+	}
+	v.Major, v.Minor, v.Patch = numbers[0], numbers[1], numbers[2]
+	return v, nil
+}
+
+// validateVersionIdentifiers verifica os identificadores separados por ponto do pré-lançamento ou do build
+// Identificadores numéricos do pré-lançamento não podem ter zeros à esquerda
+func validateVersionIdentifiers(s string, prerelease bool) error {
+	for _, identifier := range strings.Split(s, ".") {
+		if identifier == "" {
+			return fmt.Errorf("identificador vazio")
+		}
+		for _, c := range identifier {
+			if (c < '0' || c > '9') && (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && c != '-' {
+				return fmt.Errorf("caractere inválido em %q", identifier)
+			}
+		}
+		if prerelease && isNumericIdentifier(identifier) && len(identifier) > 1 && identifier[0] == '0' {
+			return fmt.Errorf("%q tem zeros à esquerda", identifier)
+		}
+	}
+	return nil
+}
+
+// isNumericIdentifier verifica se o identificador tem apenas dígitos
+func isNumericIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// IsPrerelease informa se a versão é de pré-lançamento
+func (v Version) IsPrerelease() bool {
+	return len(v.Prerelease) > 0
+}
+
+// Compare compara as versões pela precedência do SemVer 2.0, ignorando os metadados de build
+// Retorna -1 se v < other, 0 se iguais e 1 se v > other
+func (v Version) Compare(other Version) int {
+	for _, pair := range [][2]uint64{{v.Major, other.Major}, {v.Minor, other.Minor}, {v.Patch, other.Patch}} {
+		if pair[0] != pair[1] {
+			if pair[0] < pair[1] {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	// Uma versão de lançamento tem precedência sobre os pré-lançamentos da mesma versão
+	switch {
+	case !v.IsPrerelease() && !other.IsPrerelease():
+		return 0
+	case !v.IsPrerelease():
+		return 1
+	case !other.IsPrerelease():
+		return -1
+	}
+
+	for i := 0; i < len(v.Prerelease) && i < len(other.Prerelease); i++ {
+		if c := comparePrereleaseIdentifiers(v.Prerelease[i], other.Prerelease[i]); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case len(v.Prerelease) < len(other.Prerelease):
+		return -1
+	case len(v.Prerelease) > len(other.Prerelease):
+		return 1
+	}
+	return 0
+}
+
+// comparePrereleaseIdentifiers compara identificadores de pré-lançamento: numéricos pelo valor, os demais
+// em ordem ASCII, e numéricos têm precedência menor que alfanuméricos
+func comparePrereleaseIdentifiers(a, b string) int {
+	aNumeric, bNumeric := isNumericIdentifier(a), isNumericIdentifier(b)
+	switch {
+	case aNumeric && bNumeric:
+		if len(a) != len(b) {
+			if len(a) < len(b) {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a, b)
+	case aNumeric:
+		return -1
+	case bNumeric:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cabeçalhos com o identificador do agente e a assinatura Ed25519 do corpo, feita com a chave própria do agente
+const (
+	agentIDHeader        = "X-Agente-ID"
+	agentSignatureHeader = "X-Agente-Assinatura"
+)
+
+// Cabeçalhos dos envios dos agentes com o horário de emissão (Unix, em segundos) e um nonce de uso único,
+// cobertos pela assinatura para que um envio capturado não possa ser repetido
+const (
+	agentIssuedAtHeader = "X-Agente-Emitido-Em"
+	agentNonceHeader    = "X-Agente-Nonce"
+)
+
+// Prefixo dos dados assinados nos envios dos agentes (o mesmo usado pelo agente)
+const agentPushSignaturePrefix = "agente-envio-v1"
+
+// Cabeçalho das consultas aos agentes com o desafio (nonce) incluído pelo agente na assinatura da resposta,
+// e prefixo dos dados assinados nas respostas (os mesmos usados pelo agente)
+const (
+	agentChallengeHeader         = "X-Agente-Desafio"
+	agentResponseSignaturePrefix = "agente-resposta-v1"
+)
+
+// Limites dos envios assinados: diferença máxima entre o horário de emissão e o do servidor, em qualquer sentido,
+// e tamanho aceito do nonce
+const (
+	pushSignatureMaxAge = 5 * time.Minute
+	minPushNonceLength  = 16
+	maxPushNonceLength  = 128
+)
+
+// Motivos de recusa de um envio ou resposta de agente
+var (
+	errAgentRevoked     = errors.New("agente revogado")
+	errAgentKeyRevoked  = errors.New("chave do agente revogada")
+	errAgentKeyMismatch = errors.New("chave do agente diferente da registrada")
+	errAgentKeyInvalid  = errors.New("chave do agente inválida")
+	errSignatureMissing = errors.New("assinatura do agente ausente")
+	errSignatureInvalid = errors.New("assinatura do agente inválida")
+	errAgentIDMissing   = errors.New("identificador do agente ausente")
+	errAgentKeyMissing  = errors.New("agente sem chave registrada")
+	errSignatureExpired = errors.New("envio do agente expirado ou emitido no futuro")
+	errSignatureReplay  = errors.New("nonce já utilizado (envio repetido)")
+)
+
+// Lista de revogação: agentes e chaves que não são mais aceitos (o agente precisa de um novo UUID, chave e token)
+const createAgentRevocationsTable = `
+	CREATE TABLE IF NOT EXISTS agent_revocations (
+		agent_id TEXT PRIMARY KEY,
+		chave_publica TEXT,
+		motivo TEXT,
+		revogado_em TIMESTAMP
+	)
+`
+
+// Aceitar, sem assinatura, agentes que ainda não têm chave (versões antigas do agente, -aceitar-agentes-sem-chave)
+var acceptLegacyAgents = false
+
+// Nonces dos envios já recebidos de cada agente, guardados até o horário de emissão sair da janela aceita
+const createAgentNoncesTable = `
+	CREATE TABLE IF NOT EXISTS agent_nonces (
+		agent_id TEXT,
+		nonce TEXT,
+		expira_em INTEGER,
+		PRIMARY KEY (agent_id, nonce)
+	)
+`
+
+// parseAgentPublicKey decodifica a chave pública Ed25519 do agente (base64)
+func parseAgentPublicKey(encoded string) (ed25519.PublicKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(raw) != ed25519.PublicKeySize {
+		return nil, errAgentKeyInvalid
+	}
+	return ed25519.PublicKey(raw), nil
+}
+
+// agentKeyFingerprint retorna a impressão digital da chave pública (SHA-256, primeiros 8 bytes em hexadecimal)
+func agentKeyFingerprint(encoded string) string {
+	if encoded == "" {
+		return "-"
+	}
+	sum := sha256.Sum256([]byte(encoded))
+	return hex.EncodeToString(sum[:8])
+}
+
+// extractAgentPublicKey retorna a chave pública apresentada pelo agente no snapshot
+func extractAgentPublicKey(info map[string]interface{}) string {
+	agente, ok := info["agente"].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	key, _ := agente["chave_publica"].(string)
+	return strings.TrimSpace(key)
+}
+
+// getAgentPublicKey retorna a chave pública registrada do agente (vazia se o agente ainda não registrou uma chave)
+func getAgentPublicKey(agentID string) (string, error) {
+	var key sql.NullString
+	err := db.QueryRow("SELECT chave_publica FROM computers WHERE agent_id = ?", agentID).Scan(&key)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("erro ao consultar chave do agente: %v", err)
+	}
+	return key.String, nil
+}
+
+// checkAgentRevocation verifica se o agente ou a chave constam na lista de revogação
+func checkAgentRevocation(agentID, publicKey string) error {
+	var revoked bool
+	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM agent_revocations WHERE agent_id = ?)", agentID).Scan(&revoked)
+	if err != nil {
+		return fmt.Errorf("erro ao consultar lista de revogação: %v", err)
+	}
+	if revoked {
+		return errAgentRevoked
+	}
+
+	if publicKey == "" {
+		return nil
+	}
+	err = db.QueryRow("SELECT EXISTS(SELECT 1 FROM agent_revocations WHERE chave_publica = ?)", publicKey).Scan(&revoked)
+	if err != nil {
+		return fmt.Errorf("erro ao consultar lista de revogação: %v", err)
+	}
+	if revoked {
+		return errAgentKeyRevoked
+	}
+	return nil
+}
+
+// authenticateAgent verifica a assinatura dos dados enviados pelo agente
+// A assinatura é verificada com a chave registrada do agente ou, se ainda não houver uma, com a chave apresentada
+// no snapshot (que é registrada ao salvá-lo). Agentes antigos, sem chave, só são aceitos com -aceitar-agentes-sem-chave
+// Retorna true se a assinatura foi verificada (false para agentes sem chave aceitos)
+func authenticateAgent(agentID, presentedKey string, data []byte, signature string) (bool, error) {
+	if agentID == "" {
+		return false, errAgentIDMissing
+	}
+	if err := checkAgentRevocation(agentID, presentedKey); err != nil {
+		return false, err
+	}
+
+	registeredKey, err := getAgentPublicKey(agentID)
+	if err != nil {
+		return false, err
+	}
+	if registeredKey != "" && presentedKey != "" && presentedKey != registeredKey {
+		return false, errAgentKeyMismatch
+	}
+
+	key := registeredKey
+	if key == "" {
+		key = presentedKey
+	}
+	if key == "" {
+		if acceptLegacyAgents {
+			return false, nil
+		}
+		return false, errAgentKeyMissing
+	}
+
+	publicKey, err := parseAgentPublicKey(key)
+	if err != nil {
+		return false, err
+	}
+	if signature == "" {
+		return false, errSignatureMissing
+	}
+	signatureBytes, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil || !ed25519.Verify(publicKey, data, signatureBytes) {
+		return false, errSignatureInvalid
+	}
+	return true, nil
+}
+
+// agentPushSignedData monta os dados assinados de um envio do agente: o caminho, o agente, o ETag,
+// o horário de emissão, o nonce e o SHA-256 do corpo
+func agentPushSignedData(path, agentID, etag, issuedAt, nonce string, body []byte) []byte {
+	sum := sha256.Sum256(body)
+	return []byte(strings.Join([]string{agentPushSignaturePrefix, path, agentID, etag, issuedAt, nonce, hex.EncodeToString(sum[:])}, "\n"))
+}
+
+// newAgentChallenge gera o desafio de uma consulta ao agente
+func newAgentChallenge() (string, error) {
+	challenge := make([]byte, 16)
+	if _, err := rand.Read(challenge); err != nil {
+		return "", fmt.Errorf("erro ao gerar desafio: %v", err)
+	}
+	return hex.EncodeToString(challenge), nil
+}
+
+// agentResponseSignedData monta os dados assinados da resposta do agente: o desafio da consulta, o agente e o conteúdo
+func agentResponseSignedData(challenge, agentID string, data []byte) []byte {
+	signed := []byte(agentResponseSignaturePrefix + "\n" + challenge + "\n" + agentID + "\n")
+	return append(signed, data...)
+}
+
+// authenticateAgentPush verifica a assinatura de um envio do agente ao servidor de coleta, o horário de emissão
+// e o nonce, que é consumido apenas se as demais verificações passarem
+// Retorna true se o envio foi assinado, e portanto não pode ser uma repetição de um envio capturado
+func authenticateAgentPush(r *http.Request, agentID, presentedKey, etag string, body []byte) (bool, error) {
+	issuedAt := r.Header.Get(agentIssuedAtHeader)
+	nonce := r.Header.Get(agentNonceHeader)
+	data := agentPushSignedData(r.URL.Path, agentID, etag, issuedAt, nonce, body)
+
+	verified, err := authenticateAgent(agentID, presentedKey, data, r.Header.Get(agentSignatureHeader))
+	if err != nil || !verified {
+		return false, err
+	}
+
+	seconds, err := strconv.ParseInt(issuedAt, 10, 64)
+	if err != nil {
+		return false, errSignatureExpired
+	}
+	issued := time.Unix(seconds, 0)
+	if time.Since(issued) > pushSignatureMaxAge || time.Until(issued) > pushSignatureMaxAge {
+		return false, errSignatureExpired
+	}
+	if len(nonce) < minPushNonceLength || len(nonce) > maxPushNonceLength {
+		return false, errSignatureInvalid
+	}
+
+	fresh, err := consumeAgentNonce(agentID, nonce, issued.Add(pushSignatureMaxAge))
+	if err != nil {
+		return false, err
+	}
+	if !fresh {
+		return false, errSignatureReplay
+	}
+	return true, nil
+}
+
+// consumeAgentNonce registra o nonce do envio do agente, guardado até expiresAt
+// Retorna false se o agente já usou o nonce (envio repetido)
+func consumeAgentNonce(agentID, nonce string, expiresAt time.Time) (bool, error) {
+	// Remover nonces fora da janela aceita, cujos envios seriam recusados de qualquer forma
+	if _, err := db.Exec("DELETE FROM agent_nonces WHERE expira_em < ?", time.Now().Unix()); err != nil {
+		return false, fmt.Errorf("erro ao remover nonces expirados: %v", err)
+	}
+
+	result, err := db.Exec("INSERT OR IGNORE INTO agent_nonces (agent_id, nonce, expira_em) VALUES (?, ?, ?)",
+		agentID, nonce, expiresAt.Unix())
+	if err != nil {
+		return false, fmt.Errorf("erro ao registrar nonce: %v", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("erro ao registrar nonce: %v", err)
+	}
+	return rows > 0, nil
+}
+
+// isAgentAuthError verifica se o erro é uma recusa de autenticação do agente (e não uma falha do servidor)
+func isAgentAuthError(err error) bool {
+	for _, authErr := range []error{errAgentRevoked, errAgentKeyRevoked, errAgentKeyMismatch, errAgentKeyInvalid,
+		errAgentIDMissing, errAgentKeyMissing, errSignatureMissing, errSignatureInvalid, errSignatureExpired, errSignatureReplay} {
+		if errors.Is(err, authErr) {
+			return true
+		}
+	}
+	return false
+}
+
+// revokeAgent inclui o agente e a chave registrada na lista de revogação e o retira do inventário
+func revokeAgent(agentID, motivo string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("erro ao iniciar transação: %v", err)
+	}
+	defer tx.Rollback()
+
+	var key sql.NullString
+	err = tx.QueryRow("SELECT chave_publica FROM computers WHERE agent_id = ?", agentID).Scan(&key)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("computador não encontrado: %s", agentID)
+	}
+	if err != nil {
+		return fmt.Errorf("erro ao consultar chave do agente: %v", err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT OR REPLACE INTO agent_revocations (agent_id, chave_publica, motivo, revogado_em)
+		VALUES (?, ?, ?, ?)
+	`, agentID, key.String, motivo, time.Now())
+	if err != nil {
+		return fmt.Errorf("erro ao revogar agente: %v", err)
+	}
+
+	if _, err := tx.Exec("UPDATE computers SET inscricao = ? WHERE agent_id = ?", enrollmentRevoked, agentID); err != nil {
+		return fmt.Errorf("erro ao revogar agente: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("erro ao finalizar transação: %v", err)
+	}
+	return nil
+}
+
+// AgentRevocation descreve um agente revogado
+type AgentRevocation struct {
+	AgentID      string
+	ChavePublica string
+	Motivo       string
+	RevogadoEm   time.Time
+}
+
+// listAgentRevocations lista os agentes revogados, do mais recente ao mais antigo
+func listAgentRevocations() ([]AgentRevocation, error) {
+	rows, err := db.Query(`
+		SELECT agent_id, COALESCE(chave_publica, ''), COALESCE(motivo, ''), revogado_em
+		FROM agent_revocations
+		ORDER BY revogado_em DESC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao consultar lista de revogação: %v", err)
+	}
+	defer rows.Close()
+
+	var revocations []AgentRevocation
+	for rows.Next() {
+		var revocation AgentRevocation
+		if err := rows.Scan(&revocation.AgentID, &revocation.ChavePublica, &revocation.Motivo, &revocation.RevogadoEm); err != nil {
+			return nil, fmt.Errorf("erro ao ler lista de revogação: %v", err)
+		}
+		revocations = append(revocations, revocation)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("erro ao iterar lista de revogação: %v", err)
+	}
+	return revocations, nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Cabeçalho com os identificadores das chaves que o servidor consegue descriptografar, em ordem de preferência
+// (o agente responde com a chave usada no mesmo cabeçalho)
+const keyIDHeader = "X-Chave-ID"
+
+// Diretório com as chaves privadas anteriores, mantidas durante a carência de uma rotação de chaves
+// (agentes que ainda não receberam a nova chave continuam criptografando com a anterior)
+const previousKeysDir = "anteriores"
+
+// Chaves privadas anteriores, carregadas uma única vez
+var (
+	cachedPreviousKeys      []*rsa.PrivateKey
+	cachedPreviousKeysOnce  sync.Once
+	cachedPreviousKeysError error
+)
+
+// publicKeyID calcula o identificador da chave, o mesmo usado pelos agentes:
+// os primeiros 8 bytes do SHA-256 da chave pública em DER, em hexadecimal
+func publicKeyID(publicKey *rsa.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return "", fmt.Errorf("erro ao serializar chave pública: %v", err)
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:8]), nil
+}
+
+// loadPreviousPrivateKeys lê as chaves privadas de keys/anteriores/*.pem (o diretório é opcional)
+func loadPreviousPrivateKeys() ([]*rsa.PrivateKey, error) {
+	currentDir, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("erro ao obter diretório atual: %v", err)
+	}
+
+	paths, err := filepath.Glob(filepath.Join(currentDir, "keys", previousKeysDir, "*.pem"))
+	if err != nil {
+		return nil, fmt.Errorf("erro ao listar chaves anteriores: %v", err)
+	}
+	sort.Strings(paths)
+
+	var keys []*rsa.PrivateKey
+	for _, path := range paths {
+		pemData, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("erro ao ler chave anterior %s: %v", path, err)
+		}
+		block, _ := pem.Decode(pemData)
+		if block == nil {
+			return nil, fmt.Errorf("falha ao decodificar chave anterior PEM: %s", path)
+		}
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("falha ao analisar chave anterior %s: %v", path, err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// getPrivateKeys retorna a chave privada atual seguida das chaves anteriores
+func getPrivateKeys() ([]*rsa.PrivateKey, error) {
+	privateKey, err := getPrivateKey()
+	if err != nil {
+		return nil, err
+	}
+
+	cachedPreviousKeysOnce.Do(func() {
+		cachedPreviousKeys, cachedPreviousKeysError = loadPreviousPrivateKeys()
+	})
+	if cachedPreviousKeysError != nil {
+		return nil, cachedPreviousKeysError
+	}
+
+	return append([]*rsa.PrivateKey{privateKey}, cachedPreviousKeys...), nil
+}
+
+// acceptedKeyIDs retorna os identificadores das chaves privadas disponíveis, para o cabeçalho X-Chave-ID
+func acceptedKeyIDs() string {
+	keys, err := getPrivateKeys()
+	if err != nil {
+		return ""
+	}
+
+	var ids []string
+	for _, key := range keys {
+		if id, err := publicKeyID(&key.PublicKey); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return strings.Join(ids, ", ")
+}
@@ -1,6 +1,10 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
@@ -10,9 +14,29 @@ import (
 	"encoding/json"
 	"encoding/pem"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sync"
+)
+
+// Cabeçalho usado para negociar o formato de criptografia com os agentes
+const encryptionHeader = "X-Encryption"
+
+// Formatos aceitos, em ordem de preferência (agentes antigos ignoram o cabeçalho e respondem no formato legado)
+const acceptedEncryptionFormats = "aes-gcm-v1, rsa-oaep-chunks"
+
+// Compressões aceitas (aplicadas pelo agente antes da criptografia)
+const acceptedPayloadEncodings = "gzip"
+
+// Identificação do formato híbrido no início dos dados: "AGH" seguido da versão
+var hybridMagic = []byte{'A', 'G', 'H', 1}
+
+// Chave privada carregada uma única vez, na primeira descriptografia
+var (
+	cachedPrivateKey      *rsa.PrivateKey
+	cachedPrivateKeyMutex sync.Mutex
 )
 
 // Função para processar dados que podem estar criptografados ou não
@@ -24,43 +48,150 @@ func processData(data []byte) (map[string]interface{}, error) {
 		// Se conseguiu decodificar como JSON, retorna o resultado
 		return result, nil
 	}
-	
+
 	// Se não conseguiu decodificar como JSON, tenta descriptografar
 	return decryptData(data)
 }
 
-// Função para descriptografar dados usando a chave privada
-func decryptData(encryptedData []byte) (map[string]interface{}, error) {
-	// Decodificando de base64
-	encryptedBytes, err := base64.StdEncoding.DecodeString(string(encryptedData))
+// getPrivateKey retorna a chave privada do diretório keys, lendo o arquivo apenas na primeira chamada
+func getPrivateKey() (*rsa.PrivateKey, error) {
+	cachedPrivateKeyMutex.Lock()
+	defer cachedPrivateKeyMutex.Unlock()
+
+	if cachedPrivateKey != nil {
+		return cachedPrivateKey, nil
+	}
+
+	privateKey, err := loadPrivateKeyFromDisk()
 	if err != nil {
-		return nil, fmt.Errorf("erro ao decodificar base64: %v", err)
+		return nil, err
 	}
-	
-	// Carregando a chave privada
+
+	cachedPrivateKey = privateKey
+	return cachedPrivateKey, nil
+}
+
+// loadPrivateKeyFromDisk lê e analisa a chave privada do diretório keys
+func loadPrivateKeyFromDisk() (*rsa.PrivateKey, error) {
 	currentDir, err := os.Getwd()
 	if err != nil {
 		return nil, fmt.Errorf("erro ao obter diretório atual: %v", err)
 	}
-	
+
 	keysDir := filepath.Join(currentDir, "keys")
 	privateKeyPath := filepath.Join(keysDir, "private_key.pem")
-	
+
 	privateKeyBytes, err := ioutil.ReadFile(privateKeyPath)
 	if err != nil {
 		return nil, fmt.Errorf("erro ao ler arquivo de chave privada: %v", err)
 	}
-	
+
 	block, _ := pem.Decode(privateKeyBytes)
 	if block == nil {
 		return nil, fmt.Errorf("falha ao decodificar chave privada PEM")
 	}
-	
+
 	privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
 	if err != nil {
 		return nil, fmt.Errorf("falha ao analisar chave privada: %v", err)
 	}
-	
+
+	return privateKey, nil
+}
+
+// Função para descriptografar dados usando a chave privada
+// Aceita o formato híbrido (AES-GCM) e o formato legado em blocos RSA
+func decryptData(encryptedData []byte) (map[string]interface{}, error) {
+	// Decodificando de base64
+	encryptedBytes, err := base64.StdEncoding.DecodeString(string(encryptedData))
+	if err != nil {
+		return nil, fmt.Errorf("erro ao decodificar base64: %v", err)
+	}
+
+	privateKeys, err := getPrivateKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	// Tentar a chave atual e, em seguida, as anteriores (agentes ainda não atualizados após uma rotação)
+	var decryptedData []byte
+	for _, privateKey := range privateKeys {
+		if bytes.HasPrefix(encryptedBytes, hybridMagic) {
+			decryptedData, err = decryptHybrid(privateKey, encryptedBytes)
+		} else {
+			decryptedData, err = decryptLegacyChunks(privateKey, encryptedBytes)
+		}
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Descomprimir, se o agente comprimiu os dados antes de criptografar
+	decryptedData, err = decompressPayload(decryptedData)
+	if err != nil {
+		return nil, err
+	}
+
+	// Convertendo para JSON
+	var result map[string]interface{}
+	err = json.Unmarshal(decryptedData, &result)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao converter JSON: %v", err)
+	}
+
+	return result, nil
+}
+
+// decryptHybrid abre os dados no formato híbrido: recupera a chave AES com RSA-OAEP e descriptografa com AES-256-GCM
+func decryptHybrid(privateKey *rsa.PrivateKey, encryptedBytes []byte) ([]byte, error) {
+	offset := len(hybridMagic)
+	if len(encryptedBytes) < offset+2 {
+		return nil, fmt.Errorf("formato inválido: cabeçalho híbrido incompleto")
+	}
+
+	wrappedKeyLen := int(binary.BigEndian.Uint16(encryptedBytes[offset : offset+2]))
+	offset += 2
+	if len(encryptedBytes) < offset+wrappedKeyLen {
+		return nil, fmt.Errorf("formato inválido: chave protegida incompleta")
+	}
+
+	wrappedKey := encryptedBytes[offset : offset+wrappedKeyLen]
+	offset += wrappedKeyLen
+	header := encryptedBytes[:offset]
+
+	key, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, privateKey, wrappedKey, nil)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao descriptografar chave AES: %v", err)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao criar cifra AES: %v", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao criar AES-GCM: %v", err)
+	}
+
+	if len(encryptedBytes) < offset+gcm.NonceSize() {
+		return nil, fmt.Errorf("formato inválido: nonce incompleto")
+	}
+	nonce := encryptedBytes[offset : offset+gcm.NonceSize()]
+	ciphertext := encryptedBytes[offset+gcm.NonceSize():]
+
+	decryptedData, err := gcm.Open(nil, nonce, ciphertext, header)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao descriptografar dados (autenticação falhou): %v", err)
+	}
+
+	return decryptedData, nil
+}
+
+// decryptLegacyChunks abre os dados no formato legado: blocos RSA-OAEP no formato [tamanho]:[bloco]:
+func decryptLegacyChunks(privateKey *rsa.PrivateKey, encryptedBytes []byte) ([]byte, error) {
 	// Separando os chunks criptografados
 	var chunks [][]byte
 	i := 0
@@ -69,32 +200,32 @@ func decryptData(encryptedData []byte) (map[string]interface{}, error) {
 		if i+4 >= len(encryptedBytes) {
 			return nil, fmt.Errorf("formato inválido: tamanho do chunk não encontrado")
 		}
-		
+
 		chunkLen := binary.BigEndian.Uint32(encryptedBytes[i : i+4])
 		i += 4
-		
+
 		// Pulando o separador ':'
 		if i >= len(encryptedBytes) || encryptedBytes[i] != ':' {
 			return nil, fmt.Errorf("formato inválido: separador não encontrado")
 		}
 		i++
-		
+
 		// Lendo o chunk
 		if i+int(chunkLen) > len(encryptedBytes) {
 			return nil, fmt.Errorf("formato inválido: chunk incompleto")
 		}
-		
+
 		chunk := encryptedBytes[i : i+int(chunkLen)]
 		chunks = append(chunks, chunk)
 		i += int(chunkLen)
-		
+
 		// Pulando o separador ':'
 		if i >= len(encryptedBytes) || encryptedBytes[i] != ':' {
 			return nil, fmt.Errorf("formato inválido: separador não encontrado após chunk")
 		}
 		i++
 	}
-	
+
 	// Descriptografando cada chunk
 	var decryptedData []byte
 	for _, chunk := range chunks {
@@ -110,13 +241,33 @@ func decryptData(encryptedData []byte) (map[string]interface{}, error) {
 		}
 		decryptedData = append(decryptedData, decryptedChunk...)
 	}
-	
-	// Convertendo para JSON
-	var result map[string]interface{}
-	err = json.Unmarshal(decryptedData, &result)
+
+	return decryptedData, nil
+}
+
+// Limite do tamanho descomprimido, para não aceitar conteúdos que expandem sem controle
+const maxDecompressedSize = 64 * 1024 * 1024
+
+// decompressPayload descomprime os dados descriptografados se estiverem em gzip (identificado pelo cabeçalho 0x1f 0x8b)
+// Dados sem compressão (JSON) são retornados sem alteração
+func decompressPayload(data []byte) ([]byte, error) {
+	if len(data) < 2 || data[0] != 0x1f || data[1] != 0x8b {
+		return data, nil
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(data))
 	if err != nil {
-		return nil, fmt.Errorf("erro ao converter JSON: %v", err)
+		return nil, fmt.Errorf("erro ao descomprimir dados: %v", err)
 	}
-	
-	return result, nil
-}
\ No newline at end of file
+	defer reader.Close()
+
+	decompressed, err := io.ReadAll(io.LimitReader(reader, maxDecompressedSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("erro ao descomprimir dados: %v", err)
+	}
+	if len(decompressed) > maxDecompressedSize {
+		return nil, fmt.Errorf("dados descomprimidos excedem %d bytes", maxDecompressedSize)
+	}
+
+	return decompressed, nil
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+// Resposta de agente usada como amostra nos benchmarks
+const benchmarkSamplePath = "json.txt"
+
+// Quantidade de agentes usada para estimar o tempo de descriptografia de uma varredura completa
+const benchmarkScanAgents = 254
+
+// loadBenchmarkSample lê a amostra e a chave privada do diretório keys; sem elas, o benchmark é ignorado
+func loadBenchmarkSample(b *testing.B) ([]byte, *rsa.PublicKey) {
+	b.Helper()
+	sample, err := os.ReadFile(benchmarkSamplePath)
+	if err != nil {
+		b.Skipf("amostra indisponível: %v", err)
+	}
+	privateKey, err := getPrivateKey()
+	if err != nil {
+		b.Skipf("chave privada indisponível: %v", err)
+	}
+	return sample, &privateKey.PublicKey
+}
+
+// reportScanTime informa o tempo estimado de descriptografia de uma varredura completa
+func reportScanTime(b *testing.B) {
+	perOp := float64(b.Elapsed()) / float64(b.N)
+	b.ReportMetric(perOp*benchmarkScanAgents/float64(time.Millisecond), "ms/varredura")
+}
+
+// BenchmarkEncryptLegacy mede a criptografia em blocos RSA-OAEP dos agentes antigos
+func BenchmarkEncryptLegacy(b *testing.B) {
+	sample, publicKey := loadBenchmarkSample(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := encryptLegacyChunks(publicKey, sample); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkEncryptHybrid mede a criptografia no formato híbrido dos agentes
+func BenchmarkEncryptHybrid(b *testing.B) {
+	sample, publicKey := loadBenchmarkSample(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := encryptHybrid(publicKey, sample); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkDecryptLegacyDiskKey mede a descriptografia legada lendo a chave do disco a cada resposta,
+// como o servidor fazia antes do cache da chave
+func BenchmarkDecryptLegacyDiskKey(b *testing.B) {
+	sample, publicKey := loadBenchmarkSample(b)
+	legacy, err := encryptLegacyChunks(publicKey, sample)
+	if err != nil {
+		b.Fatal(err)
+	}
+	encryptedBytes, _ := base64.StdEncoding.DecodeString(legacy)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		key, err := loadPrivateKeyFromDisk()
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := decryptLegacyChunks(key, encryptedBytes); err != nil {
+			b.Fatal(err)
+		}
+	}
+	reportScanTime(b)
+}
+
+// BenchmarkDecryptLegacy mede a descriptografia legada com a chave em cache
+func BenchmarkDecryptLegacy(b *testing.B) {
+	sample, publicKey := loadBenchmarkSample(b)
+	legacy, err := encryptLegacyChunks(publicKey, sample)
+	if err != nil {
+		b.Fatal(err)
+	}
+	benchmarkDecryptData(b, legacy)
+}
+
+// BenchmarkDecryptHybrid mede a descriptografia no formato híbrido
+func BenchmarkDecryptHybrid(b *testing.B) {
+	sample, publicKey := loadBenchmarkSample(b)
+	hybrid, err := encryptHybrid(publicKey, sample)
+	if err != nil {
+		b.Fatal(err)
+	}
+	benchmarkDecryptData(b, hybrid)
+}
+
+// BenchmarkDecryptHybridGzip mede a descriptografia no formato híbrido com a amostra comprimida
+func BenchmarkDecryptHybridGzip(b *testing.B) {
+	sample, publicKey := loadBenchmarkSample(b)
+	compressed, err := gzipSample(sample)
+	if err != nil {
+		b.Fatal(err)
+	}
+	hybridGzip, err := encryptHybrid(publicKey, compressed)
+	if err != nil {
+		b.Fatal(err)
+	}
+	benchmarkDecryptData(b, hybridGzip)
+}
+
+// benchmarkDecryptData mede decryptData com os dados criptografados, conferindo antes que são lidos
+func benchmarkDecryptData(b *testing.B, encrypted string) {
+	b.Helper()
+	if _, err := decryptData([]byte(encrypted)); err != nil {
+		b.Fatalf("amostra não pôde ser descriptografada: %v", err)
+	}
+	b.SetBytes(int64(len(encrypted)))
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := decryptData([]byte(encrypted)); err != nil {
+			b.Fatal(err)
+		}
+	}
+	reportScanTime(b)
+}
+
+// gzipSample comprime a amostra como os agentes fazem antes de criptografar
+func gzipSample(data []byte) ([]byte, error) {
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	if _, err := writer.Write(data); err != nil {
+		return nil, fmt.Errorf("erro ao comprimir amostra: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("erro ao comprimir amostra: %v", err)
+	}
+	return buffer.Bytes(), nil
+}
+
+// encryptLegacyChunks reproduz a criptografia em blocos RSA-OAEP dos agentes antigos
+func encryptLegacyChunks(publicKey *rsa.PublicKey, data []byte) (string, error) {
+	maxSize := publicKey.Size() - 2*sha256.New().Size() - 2
+
+	var encryptedChunks []byte
+	for i := 0; i < len(data); i += maxSize {
+		end := i + maxSize
+		if end > len(data) {
+			end = len(data)
+		}
+
+		encryptedChunk, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, publicKey, data[i:end], nil)
+		if err != nil {
+			return "", fmt.Errorf("erro ao criptografar chunk: %v", err)
+		}
+
+		encryptedChunks = binary.BigEndian.AppendUint32(encryptedChunks, uint32(len(encryptedChunk)))
+		encryptedChunks = append(encryptedChunks, ':')
+		encryptedChunks = append(encryptedChunks, encryptedChunk...)
+		encryptedChunks = append(encryptedChunks, ':')
+	}
+
+	return base64.StdEncoding.EncodeToString(encryptedChunks), nil
+}
+
+// encryptHybrid reproduz a criptografia no formato híbrido dos agentes (aes-gcm-v1)
+func encryptHybrid(publicKey *rsa.PublicKey, data []byte) (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", fmt.Errorf("erro ao gerar chave AES: %v", err)
+	}
+
+	wrappedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, publicKey, key, nil)
+	if err != nil {
+		return "", fmt.Errorf("erro ao proteger chave AES: %v", err)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", fmt.Errorf("erro ao criar cifra AES: %v", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", fmt.Errorf("erro ao criar AES-GCM: %v", err)
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("erro ao gerar nonce: %v", err)
+	}
+
+	header := append([]byte{}, hybridMagic...)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(wrappedKey)))
+	header = append(header, wrappedKey...)
+
+	output := append(append([]byte{}, header...), nonce...)
+	output = gcm.Seal(output, nonce, data, header)
+
+	return base64.StdEncoding.EncodeToString(output), nil
+}
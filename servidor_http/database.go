@@ -59,47 +59,384 @@ func initDatabase() error {
 	return nil
 }
 
+// Tabela principal de computadores, identificados pelo UUID do agente
+// (registros de agentes antigos, sem UUID, usam um identificador provisório: ver legacyComputerID)
+const createComputersTable = `
+	CREATE TABLE IF NOT EXISTS computers (
+		agent_id TEXT PRIMARY KEY,
+		mac_address TEXT,
+		numero_serie TEXT,
+		hostname TEXT,
+		ip_address TEXT,
+		os_name TEXT,
+		cpu_model TEXT,
+		ram_total INTEGER,
+		agent_version TEXT,
+		servidor_atualizacao TEXT,
+		system_info_update_interval INTEGER,
+		update_check_interval INTEGER,
+		last_seen TIMESTAMP,
+		first_seen TIMESTAMP,
+		etag TEXT,
+		inscricao TEXT DEFAULT 'pendente',
+		chave_publica TEXT
+	)
+`
+
+// Tabela para armazenar os dados completos em JSON do último snapshot de cada computador
+const createComputerDataTable = `
+	CREATE TABLE IF NOT EXISTS computer_data (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		agent_id TEXT,
+		data_json TEXT,
+		timestamp TIMESTAMP,
+		FOREIGN KEY (agent_id) REFERENCES computers(agent_id)
+	)
+`
+
+// Tabela com os registros provisórios unidos a um agente, guardados com o último snapshot de cada um
+// (o registro do agente fica com os dados atuais; o histórico do provisório não é descartado)
+const createLegacyComputersArchiveTable = `
+	CREATE TABLE IF NOT EXISTS computers_arquivados (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		legacy_id TEXT,
+		agent_id TEXT,
+		mac_address TEXT,
+		numero_serie TEXT,
+		hostname TEXT,
+		ip_address TEXT,
+		first_seen TIMESTAMP,
+		last_seen TIMESTAMP,
+		inscricao TEXT,
+		chave_publica TEXT,
+		data_json TEXT,
+		data_timestamp TIMESTAMP,
+		arquivado_em TIMESTAMP
+	)
+`
+
 // Cria as tabelas necessárias no banco de dados
 func createTables(db *sql.DB) error {
-	// Tabela principal de computadores
-	_, err := db.Exec(`
-		CREATE TABLE IF NOT EXISTS computers (
-			mac_address TEXT PRIMARY KEY,
-			hostname TEXT,
-			ip_address TEXT,
-			os_name TEXT,
-			cpu_model TEXT,
-			ram_total INTEGER,
-			agent_version TEXT,
-			servidor_atualizacao TEXT,
-			system_info_update_interval INTEGER,
-			update_check_interval INTEGER,
-			last_seen TIMESTAMP,
-			first_seen TIMESTAMP
-		)
-	`)
+	_, err := db.Exec(createComputersTable)
 	if err != nil {
 		return fmt.Errorf("erro ao criar tabela computers: %v", err)
 	}
 
-	// Tabela para armazenar o histórico de dados completos em JSON
+	_, err = db.Exec(createComputerDataTable)
+	if err != nil {
+		return fmt.Errorf("erro ao criar tabela computer_data: %v", err)
+	}
+
+	// Tabela de eventos enviados pelos agentes (início do agente, término de jobs, ...)
 	_, err = db.Exec(`
-		CREATE TABLE IF NOT EXISTS computer_data (
+		CREATE TABLE IF NOT EXISTS agent_events (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			mac_address TEXT,
-			data_json TEXT,
-			timestamp TIMESTAMP,
-			FOREIGN KEY (mac_address) REFERENCES computers(mac_address)
+			agent_id TEXT,
+			ip_address TEXT,
+			tipo TEXT,
+			dados_json TEXT,
+			ocorrido_em TIMESTAMP,
+			recebido_em TIMESTAMP
 		)
 	`)
 	if err != nil {
-		return fmt.Errorf("erro ao criar tabela computer_data: %v", err)
+		return fmt.Errorf("erro ao criar tabela agent_events: %v", err)
+	}
+
+	// ETag do último snapshot recebido de cada computador (bancos antigos não têm a coluna)
+	if err := ensureColumn(db, "computers", "etag", "TEXT"); err != nil {
+		return err
+	}
+
+	// Situação da inscrição de cada computador; os computadores de bancos antigos já faziam parte do inventário
+	if err := ensureColumn(db, "computers", "inscricao", "TEXT DEFAULT 'aprovado'"); err != nil {
+		return err
+	}
+
+	// Tokens de inscrição gerados pelo administrador (-gerar-token)
+	if _, err := db.Exec(createEnrollmentTokensTable); err != nil {
+		return fmt.Errorf("erro ao criar tabela enrollment_tokens: %v", err)
+	}
+
+	// Chave pública própria de cada agente, registrada na inscrição, e lista de revogação
+	if err := ensureColumn(db, "computers", "chave_publica", "TEXT"); err != nil {
+		return err
+	}
+	if _, err := db.Exec(createAgentRevocationsTable); err != nil {
+		return fmt.Errorf("erro ao criar tabela agent_revocations: %v", err)
+	}
+	if _, err := db.Exec(createAgentNoncesTable); err != nil {
+		return fmt.Errorf("erro ao criar tabela agent_nonces: %v", err)
+	}
+	if _, err := db.Exec(createLegacyComputersArchiveTable); err != nil {
+		return fmt.Errorf("erro ao criar tabela computers_arquivados: %v", err)
+	}
+
+	// Bancos antigos identificam os computadores pelo MAC
+	migrated, err := hasColumn(db, "computers", "agent_id")
+	if err != nil {
+		return err
+	}
+	if !migrated {
+		if err := migrateComputersToAgentID(db); err != nil {
+			return err
+		}
+	}
+
+	_, err = db.Exec(`
+		CREATE INDEX IF NOT EXISTS idx_computers_mac ON computers(mac_address);
+		CREATE INDEX IF NOT EXISTS idx_computer_data_agent ON computer_data(agent_id);
+	`)
+	if err != nil {
+		return fmt.Errorf("erro ao criar índices: %v", err)
 	}
 
 	return nil
 }
 
-// Extrai o MAC da primeira interface de rede ativa
+// migrateComputersToAgentID converte as tabelas identificadas pelo MAC para a identificação pelo agente
+// Registros do mesmo hardware (mesmo número de série) criados pela troca de interface de rede são unidos,
+// mantendo os dados do mais recente; cada registro recebe um identificador provisório, substituído pelo UUID
+// quando o agente atualizado enviar o primeiro snapshot
+func migrateComputersToAgentID(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("erro ao iniciar migração: %v", err)
+	}
+	defer tx.Rollback()
+
+	for _, statement := range []string{
+		"ALTER TABLE computers RENAME TO computers_mac",
+		"ALTER TABLE computer_data RENAME TO computer_data_mac",
+		createComputersTable,
+		createComputerDataTable,
+	} {
+		if _, err := tx.Exec(statement); err != nil {
+			return fmt.Errorf("erro ao migrar tabela computers: %v", err)
+		}
+	}
+
+	// Ler os registros antigos (do mais recente ao mais antigo) antes de inserir os novos
+	type legacyComputer struct {
+		mac    string
+		serial string
+	}
+	rows, err := tx.Query(`
+		SELECT c.mac_address,
+			(SELECT d.data_json FROM computer_data_mac d WHERE d.mac_address = c.mac_address
+			 ORDER BY d.timestamp DESC LIMIT 1)
+		FROM computers_mac c
+		ORDER BY c.last_seen DESC
+	`)
+	if err != nil {
+		return fmt.Errorf("erro ao ler computadores para migração: %v", err)
+	}
+	var legacy []legacyComputer
+	for rows.Next() {
+		var mac string
+		var dataJSON sql.NullString
+		if err := rows.Scan(&mac, &dataJSON); err != nil {
+			rows.Close()
+			return fmt.Errorf("erro ao ler computadores para migração: %v", err)
+		}
+
+		computer := legacyComputer{mac: mac}
+		var info map[string]interface{}
+		if dataJSON.Valid && json.Unmarshal([]byte(dataJSON.String), &info) == nil {
+			if hardware, ok := info["hardware"].(map[string]interface{}); ok {
+				serial, _ := hardware["numero_serie"].(string)
+				computer.serial = normalizeHardwareSerial(serial)
+			}
+		}
+		legacy = append(legacy, computer)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("erro ao ler computadores para migração: %v", err)
+	}
+
+	merged := 0
+	migrated := make(map[string]bool)
+	for _, computer := range legacy {
+		agentID := legacyComputerID(computer.serial, computer.mac)
+
+		if migrated[agentID] {
+			// Mesmo hardware com outro MAC: manter o registro mais recente e a primeira vez em que foi visto
+			_, err = tx.Exec(`
+				UPDATE computers SET first_seen = (SELECT first_seen FROM computers_mac WHERE mac_address = ?)
+				WHERE agent_id = ? AND (first_seen IS NULL OR first_seen > (SELECT first_seen FROM computers_mac WHERE mac_address = ?))
+			`, computer.mac, agentID, computer.mac)
+			if err != nil {
+				return fmt.Errorf("erro ao unir computador %s: %v", computer.mac, err)
+			}
+			merged++
+			continue
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO computers
+			(agent_id, mac_address, numero_serie, hostname, ip_address, os_name, cpu_model, ram_total,
+			 agent_version, servidor_atualizacao, system_info_update_interval, update_check_interval,
+			 last_seen, first_seen, etag, inscricao)
+			SELECT ?, mac_address, ?, hostname, ip_address, os_name, cpu_model, ram_total,
+				agent_version, servidor_atualizacao, system_info_update_interval, update_check_interval,
+				last_seen, first_seen, etag, inscricao
+			FROM computers_mac WHERE mac_address = ?
+		`, agentID, computer.serial, computer.mac)
+		if err != nil {
+			return fmt.Errorf("erro ao migrar computador %s: %v", computer.mac, err)
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO computer_data (agent_id, data_json, timestamp)
+			SELECT ?, data_json, timestamp FROM computer_data_mac WHERE mac_address = ?
+			ORDER BY timestamp DESC LIMIT 1
+		`, agentID, computer.mac)
+		if err != nil {
+			return fmt.Errorf("erro ao migrar dados do computador %s: %v", computer.mac, err)
+		}
+		migrated[agentID] = true
+	}
+
+	for _, statement := range []string{"DROP TABLE computer_data_mac", "DROP TABLE computers_mac"} {
+		if _, err := tx.Exec(statement); err != nil {
+			return fmt.Errorf("erro ao migrar tabela computers: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("erro ao finalizar migração: %v", err)
+	}
+
+	fmt.Printf("Banco de dados migrado para a identificação pelo agente: %d computadores (%d registros duplicados unidos)\n",
+		len(migrated), merged)
+	return nil
+}
+
+// ensureColumn adiciona uma coluna a uma tabela existente, se ela ainda não existir
+func ensureColumn(db *sql.DB, table, column, definition string) error {
+	exists, err := hasColumn(db, table, column)
+	if err != nil || exists {
+		return err
+	}
+
+	if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)); err != nil {
+		return fmt.Errorf("erro ao adicionar coluna %s em %s: %v", column, table, err)
+	}
+	return nil
+}
+
+// hasColumn verifica se a tabela possui a coluna
+func hasColumn(db *sql.DB, table, column string) (bool, error) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, fmt.Errorf("erro ao consultar colunas de %s: %v", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, columnType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultValue, &pk); err != nil {
+			return false, fmt.Errorf("erro ao ler colunas de %s: %v", table, err)
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return false, fmt.Errorf("erro ao ler colunas de %s: %v", table, err)
+	}
+	return false, nil
+}
+
+// Números de série genéricos gravados por fabricantes, que não identificam a máquina
+var genericHardwareSerials = []string{
+	"desconhecido", "to be filled by o.e.m.", "default string", "system serial number",
+	"not specified", "not applicable", "none", "0", "00000000", "0123456789",
+}
+
+// normalizeHardwareSerial retorna o número de série sem espaços, ou vazio se for genérico ou desconhecido
+func normalizeHardwareSerial(serial string) string {
+	serial = strings.TrimSpace(serial)
+	for _, generic := range genericHardwareSerials {
+		if strings.EqualFold(serial, generic) {
+			return ""
+		}
+	}
+	return serial
+}
+
+// legacyComputerID retorna o identificador provisório de um computador cujo agente não envia UUID
+// (versões antigas): o número de série do hardware ou, na falta dele, o MAC
+func legacyComputerID(serial, mac string) string {
+	if serial != "" {
+		return "serie:" + serial
+	}
+	if mac != "" {
+		return "mac:" + strings.ToLower(mac)
+	}
+	return ""
+}
+
+// isAgentUUID verifica se o identificador enviado pelo agente é um UUID (agentes antigos enviam o MAC)
+func isAgentUUID(id string) bool {
+	if len(id) != 36 {
+		return false
+	}
+	for i, r := range id {
+		switch {
+		case i == 8 || i == 13 || i == 18 || i == 23:
+			if r != '-' {
+				return false
+			}
+		case !strings.ContainsRune("0123456789abcdefABCDEF", r):
+			return false
+		}
+	}
+	return true
+}
+
+// identifyComputer extrai a identificação do computador de um snapshot: o UUID do agente (ou um identificador
+// provisório para agentes antigos), o MAC da interface principal e o número de série do hardware
+func identifyComputer(info map[string]interface{}) (string, string, string, error) {
+	var agentID, mac, serial string
+
+	if agente, ok := info["agente"].(map[string]interface{}); ok {
+		if id, ok := agente["agente_id"].(string); ok && isAgentUUID(id) {
+			agentID = strings.ToLower(id)
+		}
+		if value, ok := agente["numero_serie"].(string); ok {
+			serial = normalizeHardwareSerial(value)
+		}
+		if value, ok := agente["mac_principal"].(string); ok {
+			mac = strings.ToLower(value)
+		}
+	}
+
+	if serial == "" {
+		if hardware, ok := info["hardware"].(map[string]interface{}); ok {
+			value, _ := hardware["numero_serie"].(string)
+			serial = normalizeHardwareSerial(value)
+		}
+	}
+	if mac == "" {
+		if value, err := extractPrimaryMacAddress(info); err == nil {
+			mac = strings.ToLower(value)
+		}
+	}
+
+	if agentID == "" {
+		agentID = legacyComputerID(serial, mac)
+	}
+	if agentID == "" {
+		return "", "", "", fmt.Errorf("snapshot sem identificador do agente, número de série ou MAC")
+	}
+	return agentID, mac, serial, nil
+}
+
+// Extrai o MAC da primeira interface de rede ativa (ou, se nenhuma estiver ativa, da primeira com MAC)
 func extractPrimaryMacAddress(info map[string]interface{}) (string, error) {
 	// Verificar se existe informação de rede
 	redeInfo, ok := info["rede"].(map[string]interface{})
@@ -113,46 +450,129 @@ func extractPrimaryMacAddress(info map[string]interface{}) (string, error) {
 		return "", fmt.Errorf("interfaces de rede não encontradas")
 	}
 
-	// Procurar pela primeira interface com status "Up"
+	// Procurar pela primeira interface com status "Up" (o status pode vir entre aspas, ex: "\"Up\"")
+	var fallback string
 	for _, iface := range interfaces {
 		ifaceMap, ok := iface.(map[string]interface{})
 		if !ok {
 			continue
 		}
 
-		// Verificar status
-		status, ok := ifaceMap["status"].(string)
-		if !ok {
+		mac, ok := ifaceMap["mac"].(string)
+		if !ok || mac == "" || mac == "00:00:00:00:00:00" {
 			continue
 		}
 
-		// Verificar se está ativa (status contém "Up")
-		if strings.Contains(status, "Up") {
-			// Obter MAC address
-			mac, ok := ifaceMap["mac"].(string)
-			if !ok || mac == "" {
-				continue
-			}
+		status, _ := ifaceMap["status"].(string)
+		if strings.EqualFold(strings.Trim(strings.TrimSpace(status), `"`), "up") {
 			return mac, nil
 		}
+		if fallback == "" {
+			fallback = mac
+		}
 	}
 
-	return "", fmt.Errorf("nenhuma interface de rede ativa encontrada")
+	if fallback != "" {
+		return fallback, nil
+	}
+	return "", fmt.Errorf("nenhuma interface de rede com MAC encontrada")
 }
 
-// Salva ou atualiza informações do computador no banco de dados
-func saveComputerInfo(info map[string]interface{}, ip string) error {
-	// Extrair MAC address primário
-	macAddress, err := extractPrimaryMacAddress(info)
-	if err != nil {
-		return fmt.Errorf("erro ao extrair MAC address: %v", err)
+// claimLegacyComputer associa ao UUID do agente os registros provisórios do mesmo computador
+// (criados pela migração ou por versões antigas do agente), identificados pelo número de série ou pelo MAC
+// Número de série e MAC são informados pelo próprio agente e não provam a identidade: sem a confirmação do
+// administrador (confirmed), só são associados os registros provisórios com a mesma chave pública do agente
+// O primeiro registro encontrado passa a usar o UUID, sem manter a situação da inscrição nem a chave do registro
+// antigo (a situação é a do agente, definida por quem chama); os demais são arquivados em computers_arquivados
+func claimLegacyComputer(tx *sql.Tx, agentID, serial, mac, publicKey string, confirmed bool) error {
+	var candidates []string
+	if serial != "" {
+		candidates = append(candidates, legacyComputerID(serial, ""))
+	}
+	if mac != "" {
+		candidates = append(candidates, legacyComputerID("", mac))
+	}
+
+	for _, legacyID := range candidates {
+		var legacyKey sql.NullString
+		err := tx.QueryRow("SELECT chave_publica FROM computers WHERE agent_id = ?", legacyID).Scan(&legacyKey)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("erro ao consultar registro %s: %v", legacyID, err)
+		}
+		if !confirmed && (legacyKey.String == "" || legacyKey.String != publicKey) {
+			continue
+		}
+
+		var exists bool
+		err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM computers WHERE agent_id = ?)", agentID).Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("erro ao verificar existência do computador: %v", err)
+		}
+
+		if !exists {
+			_, err := tx.Exec("UPDATE computers SET agent_id = ?, inscricao = ?, chave_publica = ? WHERE agent_id = ?",
+				agentID, enrollmentPending, publicKey, legacyID)
+			if err != nil {
+				return fmt.Errorf("erro ao associar registro %s ao agente: %v", legacyID, err)
+			}
+			if _, err := tx.Exec("UPDATE computer_data SET agent_id = ? WHERE agent_id = ?", agentID, legacyID); err != nil {
+				return fmt.Errorf("erro ao associar registro %s ao agente: %v", legacyID, err)
+			}
+			fmt.Printf("Registro %s associado ao agente %s\n", legacyID, agentID)
+			continue
+		}
+
+		// O agente já tem registro: manter a primeira vez em que o computador foi visto e arquivar o provisório
+		// com os seus dados
+		_, err = tx.Exec(`
+			UPDATE computers SET first_seen = (SELECT first_seen FROM computers WHERE agent_id = ?)
+			WHERE agent_id = ? AND (first_seen IS NULL OR first_seen > (SELECT first_seen FROM computers WHERE agent_id = ?))
+		`, legacyID, agentID, legacyID)
+		if err != nil {
+			return fmt.Errorf("erro ao unir registro %s ao agente: %v", legacyID, err)
+		}
+		_, err = tx.Exec(`
+			INSERT INTO computers_arquivados
+			(legacy_id, agent_id, mac_address, numero_serie, hostname, ip_address, first_seen, last_seen,
+			 inscricao, chave_publica, data_json, data_timestamp, arquivado_em)
+			SELECT c.agent_id, ?, c.mac_address, c.numero_serie, c.hostname, c.ip_address, c.first_seen, c.last_seen,
+				c.inscricao, c.chave_publica, d.data_json, d.timestamp, ?
+			FROM computers c LEFT JOIN computer_data d ON d.agent_id = c.agent_id
+			WHERE c.agent_id = ?
+		`, agentID, time.Now(), legacyID)
+		if err != nil {
+			return fmt.Errorf("erro ao arquivar registro %s: %v", legacyID, err)
+		}
+		if _, err := tx.Exec("DELETE FROM computer_data WHERE agent_id = ?", legacyID); err != nil {
+			return fmt.Errorf("erro ao unir registro %s ao agente: %v", legacyID, err)
+		}
+		if _, err := tx.Exec("DELETE FROM computers WHERE agent_id = ?", legacyID); err != nil {
+			return fmt.Errorf("erro ao unir registro %s ao agente: %v", legacyID, err)
+		}
+		fmt.Printf("Registro %s unido ao agente %s (arquivado em computers_arquivados)\n", legacyID, agentID)
 	}
+	return nil
+}
 
-	// Verificar se o MAC é válido
-	if macAddress == "" {
-		return fmt.Errorf("MAC address inválido ou vazio")
+// Salva ou atualiza informações do computador no banco de dados, junto com o ETag do snapshot (se informado)
+// O IP de um computador já conhecido só é alterado se updateIP for true (snapshot com assinatura verificada,
+// que não pode ser a repetição de um snapshot capturado)
+// Retorna a situação da inscrição do computador (aprovado ou pendente)
+func saveComputerInfo(info map[string]interface{}, ip, etag string, updateIP bool) (string, error) {
+	// Identificar o computador pelo UUID do agente (MAC e número de série são guardados como informação)
+	agentID, macAddress, serial, err := identifyComputer(info)
+	if err != nil {
+		return "", err
 	}
 
+	// Token de inscrição apresentado pelo agente (não é guardado com os dados do computador)
+	// e chave pública do agente, registrada no primeiro snapshot (a assinatura é verificada antes, em authenticateAgent)
+	token := extractEnrollmentToken(info)
+	publicKey := extractAgentPublicKey(info)
+
 	// Extrair outros dados
 	var hostname, osName, cpuModel, agentVersion, servidorAtualizacao string
 	var ramTotal float64
@@ -238,7 +658,7 @@ func saveComputerInfo(info map[string]interface{}, ip string) error {
 	// Verificar se o computador já existe usando uma transação para garantir consistência
 	tx, err := db.Begin()
 	if err != nil {
-		return fmt.Errorf("erro ao iniciar transação: %v", err)
+		return "", fmt.Errorf("erro ao iniciar transação: %v", err)
 	}
 	defer func() {
 		if err != nil {
@@ -246,51 +666,67 @@ func saveComputerInfo(info map[string]interface{}, ip string) error {
 		}
 	}()
 
+	// Situação da inscrição: aprovado se já estava aprovado ou se apresentou um token válido
+	// (a situação de registros antigos do mesmo computador não é considerada: um novo UUID começa pendente)
+	status, err := resolveEnrollment(tx, agentID, token)
+	if err != nil {
+		return "", err
+	}
+
+	// Agente com UUID aprovado: assumir os registros antigos do mesmo computador registrados com a mesma chave
+	// pública (os demais só com a confirmação do administrador, em -aprovar)
+	if status == enrollmentApproved && isAgentUUID(agentID) {
+		if err = claimLegacyComputer(tx, agentID, serial, macAddress, publicKey, false); err != nil {
+			return "", err
+		}
+	}
+
 	var exists bool
-	err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM computers WHERE mac_address = ?)", macAddress).Scan(&exists)
+	err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM computers WHERE agent_id = ?)", agentID).Scan(&exists)
 	if err != nil {
-		return fmt.Errorf("erro ao verificar existência do computador: %v", err)
+		return "", fmt.Errorf("erro ao verificar existência do computador: %v", err)
 	}
 
 	if exists {
 		// Atualizar registro existente
 		_, err = tx.Exec(`
 			UPDATE computers 
-			SET hostname = ?, ip_address = ?, os_name = ?, cpu_model = ?, 
-				ram_total = ?, agent_version = ?, last_seen = ?,
-				servidor_atualizacao = ?, system_info_update_interval = ?, update_check_interval = ?
-			WHERE mac_address = ?
-		`, hostname, ip, osName, cpuModel, ramTotal, agentVersion, now,
-			servidorAtualizacao, systemInfoUpdateInterval, updateCheckInterval, macAddress)
+			SET mac_address = ?, numero_serie = ?, hostname = ?, ip_address = CASE WHEN ? THEN ? ELSE ip_address END,
+				os_name = ?, cpu_model = ?, ram_total = ?, agent_version = ?, last_seen = ?,
+				servidor_atualizacao = ?, system_info_update_interval = ?, update_check_interval = ?,
+				etag = ?, inscricao = ?, chave_publica = COALESCE(NULLIF(chave_publica, ''), ?)
+			WHERE agent_id = ?
+		`, macAddress, serial, hostname, updateIP, ip, osName, cpuModel, ramTotal, agentVersion, now,
+			servidorAtualizacao, systemInfoUpdateInterval, updateCheckInterval, etag, status, publicKey, agentID)
 		if err != nil {
-			return fmt.Errorf("erro ao atualizar computador: %v", err)
+			return "", fmt.Errorf("erro ao atualizar computador: %v", err)
 		}
 	} else {
 		// Inserir novo registro
 		_, err = tx.Exec(`
 			INSERT INTO computers 
-			(mac_address, hostname, ip_address, os_name, cpu_model, ram_total,  
+			(agent_id, mac_address, numero_serie, hostname, ip_address, os_name, cpu_model, ram_total,  
 			 agent_version, last_seen, first_seen, servidor_atualizacao, 
-			 system_info_update_interval, update_check_interval)
-			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-		`, macAddress, hostname, ip, osName, cpuModel, ramTotal,
-			agentVersion, now, now, servidorAtualizacao, systemInfoUpdateInterval, updateCheckInterval)
+			 system_info_update_interval, update_check_interval, etag, inscricao, chave_publica)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, agentID, macAddress, serial, hostname, ip, osName, cpuModel, ramTotal,
+			agentVersion, now, now, servidorAtualizacao, systemInfoUpdateInterval, updateCheckInterval, etag, status, publicKey)
 		if err != nil {
-			return fmt.Errorf("erro ao inserir computador: %v", err)
+			return "", fmt.Errorf("erro ao inserir computador: %v", err)
 		}
 	}
 
 	// Salvar dados completos em JSON
 	jsonData, err := json.Marshal(info)
 	if err != nil {
-		return fmt.Errorf("erro ao serializar dados JSON: %v", err)
+		return "", fmt.Errorf("erro ao serializar dados JSON: %v", err)
 	}
 
-	// Verificar se já existe um registro na tabela computer_data para este MAC
+	// Verificar se já existe um registro na tabela computer_data para este computador
 	var dataExists bool
-	err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM computer_data WHERE mac_address = ?)", macAddress).Scan(&dataExists)
+	err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM computer_data WHERE agent_id = ?)", agentID).Scan(&dataExists)
 	if err != nil {
-		return fmt.Errorf("erro ao verificar existência de dados do computador: %v", err)
+		return "", fmt.Errorf("erro ao verificar existência de dados do computador: %v", err)
 	}
 
 	if dataExists {
@@ -298,39 +734,116 @@ func saveComputerInfo(info map[string]interface{}, ip string) error {
 		_, err = tx.Exec(`
 			UPDATE computer_data 
 			SET data_json = ?, timestamp = ?
-			WHERE mac_address = ?
-		`, string(jsonData), now, macAddress)
+			WHERE agent_id = ?
+		`, string(jsonData), now, agentID)
 		if err != nil {
-			return fmt.Errorf("erro ao atualizar dados JSON: %v", err)
+			return "", fmt.Errorf("erro ao atualizar dados JSON: %v", err)
 		}
 	} else {
 		// Inserir novo registro
 		_, err = tx.Exec(`
-			INSERT INTO computer_data (mac_address, data_json, timestamp)
+			INSERT INTO computer_data (agent_id, data_json, timestamp)
 			VALUES (?, ?, ?)
-		`, macAddress, string(jsonData), now)
+		`, agentID, string(jsonData), now)
 		if err != nil {
-			return fmt.Errorf("erro ao salvar dados JSON: %v", err)
+			return "", fmt.Errorf("erro ao salvar dados JSON: %v", err)
 		}
 	}
 
 	// Commit da transação
 	if err = tx.Commit(); err != nil {
-		return fmt.Errorf("erro ao finalizar transação: %v", err)
+		return "", fmt.Errorf("erro ao finalizar transação: %v", err)
+	}
+
+	return status, nil
+}
+
+// getComputerETagByIP retorna o identificador e o ETag do último snapshot do computador visto neste IP
+// Retorna strings vazias se o IP não é conhecido
+func getComputerETagByIP(ip string) (string, string, error) {
+	var agentID string
+	var etag sql.NullString
+	err := db.QueryRow(`
+		SELECT agent_id, etag FROM computers
+		WHERE ip_address = ?
+		ORDER BY last_seen DESC
+		LIMIT 1
+	`, ip).Scan(&agentID, &etag)
+	if err == sql.ErrNoRows {
+		return "", "", nil
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("erro ao consultar ETag do computador: %v", err)
+	}
+
+	return agentID, etag.String, nil
+}
+
+// touchComputer registra que o computador respondeu sem alterações, atualizando apenas last_seen
+func touchComputer(agentID string) error {
+	_, err := db.Exec("UPDATE computers SET last_seen = ? WHERE agent_id = ?", time.Now(), agentID)
+	if err != nil {
+		return fmt.Errorf("erro ao atualizar last_seen: %v", err)
+	}
+	return nil
+}
+
+// touchComputerByETag registra o check-in de um agente que enviou apenas o ETag do snapshot,
+// atualizando last_seen e, se updateIP for true (check-in com assinatura verificada), o IP do computador
+// Retorna false se o computador não tem o ETag (o snapshot precisa ser enviado completo)
+func touchComputerByETag(etag, ip, agentID string, updateIP bool) (bool, error) {
+	result, err := db.Exec(`
+		UPDATE computers SET last_seen = ?, ip_address = CASE WHEN ? THEN ? ELSE ip_address END
+		WHERE etag = ? AND agent_id = ?
+	`, time.Now(), updateIP, ip, etag, agentID)
+	if err != nil {
+		return false, fmt.Errorf("erro ao registrar check-in: %v", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("erro ao registrar check-in: %v", err)
+	}
+	return rows > 0, nil
+}
+
+// saveAgentEvent salva um evento enviado por um agente
+func saveAgentEvent(agentID, ip, tipo string, dados interface{}, ocorridoEm time.Time) error {
+	dadosJSON, err := json.Marshal(dados)
+	if err != nil {
+		return fmt.Errorf("erro ao serializar dados do evento: %v", err)
 	}
 
+	_, err = db.Exec(`
+		INSERT INTO agent_events (agent_id, ip_address, tipo, dados_json, ocorrido_em, recebido_em)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, agentID, ip, tipo, string(dadosJSON), ocorridoEm, time.Now())
+	if err != nil {
+		return fmt.Errorf("erro ao salvar evento: %v", err)
+	}
 	return nil
 }
 
-// Obtém todos os computadores do banco de dados
+// Obtém todos os computadores do inventário (inscrição aprovada)
 func getAllComputers() ([]map[string]interface{}, error) {
+	return getComputersByEnrollment(enrollmentApproved)
+}
+
+// getPendingComputers obtém os computadores que aguardam a aprovação da inscrição
+func getPendingComputers() ([]map[string]interface{}, error) {
+	return getComputersByEnrollment(enrollmentPending)
+}
+
+// getComputersByEnrollment obtém os computadores com a situação de inscrição informada
+func getComputersByEnrollment(status string) ([]map[string]interface{}, error) {
 	rows, err := db.Query(`
-		SELECT mac_address, hostname, ip_address, os_name, cpu_model, 
+		SELECT agent_id, COALESCE(mac_address, ''), COALESCE(numero_serie, ''), hostname, ip_address, os_name, cpu_model, 
 			   ram_total, agent_version, last_seen, first_seen,
-			   servidor_atualizacao, system_info_update_interval, update_check_interval
+			   servidor_atualizacao, system_info_update_interval, update_check_interval, COALESCE(chave_publica, '')
 		FROM computers
+		WHERE inscricao = ?
 		ORDER BY hostname
-	`)
+	`, status)
 	if err != nil {
 		return nil, fmt.Errorf("erro ao consultar computadores: %v", err)
 	}
@@ -338,19 +851,21 @@ func getAllComputers() ([]map[string]interface{}, error) {
 
 	var computers []map[string]interface{}
 	for rows.Next() {
-		var mac, hostname, ip, os, cpu, agentVersion, servidorAtualizacao string
+		var agentID, mac, serial, hostname, ip, os, cpu, agentVersion, servidorAtualizacao, publicKey string
 		var ramTotal float64
 		var lastSeen, firstSeen time.Time
 		var systemInfoUpdateInterval, updateCheckInterval int
 
-		err := rows.Scan(&mac, &hostname, &ip, &os, &cpu, &ramTotal, &agentVersion,
-			&lastSeen, &firstSeen, &servidorAtualizacao, &systemInfoUpdateInterval, &updateCheckInterval)
+		err := rows.Scan(&agentID, &mac, &serial, &hostname, &ip, &os, &cpu, &ramTotal, &agentVersion,
+			&lastSeen, &firstSeen, &servidorAtualizacao, &systemInfoUpdateInterval, &updateCheckInterval, &publicKey)
 		if err != nil {
 			return nil, fmt.Errorf("erro ao ler dados do computador: %v", err)
 		}
 
 		computer := map[string]interface{}{
+			"agent_id":                    agentID,
 			"mac_address":                 mac,
+			"numero_serie":                serial,
 			"hostname":                    hostname,
 			"ip_address":                  ip,
 			"os_name":                     os,
@@ -362,6 +877,7 @@ func getAllComputers() ([]map[string]interface{}, error) {
 			"servidor_atualizacao":        servidorAtualizacao,
 			"system_info_update_interval": systemInfoUpdateInterval,
 			"update_check_interval":       updateCheckInterval,
+			"chave_publica":               publicKey,
 		}
 
 		computers = append(computers, computer)
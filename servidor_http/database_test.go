@@ -0,0 +1,254 @@
+package main
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testAgentID = "0f8b6c1e-2d3a-4b5c-8d9e-0a1b2c3d4e5f"
+
+// openTestDatabase abre um banco de dados vazio em um diretório temporário e o usa como banco do servidor
+func openTestDatabase(t *testing.T) {
+	t.Helper()
+	database, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "computers.db"))
+	if err != nil {
+		t.Fatalf("erro ao abrir banco de dados: %v", err)
+	}
+	database.SetMaxOpenConns(1)
+	if err := createTables(database); err != nil {
+		database.Close()
+		t.Fatalf("erro ao criar tabelas: %v", err)
+	}
+
+	previous := db
+	db = database
+	t.Cleanup(func() {
+		db = previous
+		database.Close()
+	})
+}
+
+// insertTestComputer insere um computador com o seu último snapshot
+func insertTestComputer(t *testing.T, agentID, serial, mac, status, publicKey string, firstSeen time.Time) {
+	t.Helper()
+	_, err := db.Exec(`
+		INSERT INTO computers (agent_id, mac_address, numero_serie, hostname, first_seen, last_seen, inscricao, chave_publica)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, agentID, mac, serial, "host-"+agentID, firstSeen, firstSeen, status, publicKey)
+	if err != nil {
+		t.Fatalf("erro ao inserir computador %s: %v", agentID, err)
+	}
+	_, err = db.Exec("INSERT INTO computer_data (agent_id, data_json, timestamp) VALUES (?, ?, ?)",
+		agentID, `{"origem":"`+agentID+`"}`, firstSeen)
+	if err != nil {
+		t.Fatalf("erro ao inserir dados do computador %s: %v", agentID, err)
+	}
+}
+
+// claimInTransaction executa claimLegacyComputer em uma transação confirmada
+func claimInTransaction(t *testing.T, agentID, serial, mac, publicKey string, confirmed bool) {
+	t.Helper()
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("erro ao iniciar transação: %v", err)
+	}
+	defer tx.Rollback()
+	if err := claimLegacyComputer(tx, agentID, serial, mac, publicKey, confirmed); err != nil {
+		t.Fatalf("erro ao associar registros antigos: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("erro ao confirmar transação: %v", err)
+	}
+}
+
+// countRows conta os registros de uma tabela com o agent_id informado
+func countRows(t *testing.T, table, agentID string) int {
+	t.Helper()
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM "+table+" WHERE agent_id = ?", agentID).Scan(&count); err != nil {
+		t.Fatalf("erro ao contar registros de %s: %v", table, err)
+	}
+	return count
+}
+
+// TestClaimLegacyComputerRenamesConfirmedRecord verifica que, confirmado, o registro provisório passa a usar
+// o UUID do agente junto com os seus dados, sem manter a situação da inscrição
+func TestClaimLegacyComputerRenamesConfirmedRecord(t *testing.T) {
+	openTestDatabase(t)
+	legacyID := legacyComputerID("SN123", "")
+	insertTestComputer(t, legacyID, "SN123", "aa:bb:cc:dd:ee:ff", enrollmentApproved, "", time.Now())
+
+	claimInTransaction(t, testAgentID, "SN123", "aa:bb:cc:dd:ee:ff", "chave", true)
+
+	if n := countRows(t, "computers", legacyID); n != 0 {
+		t.Errorf("registro provisório ainda existe (%d)", n)
+	}
+	var status, key string
+	if err := db.QueryRow("SELECT inscricao, chave_publica FROM computers WHERE agent_id = ?", testAgentID).Scan(&status, &key); err != nil {
+		t.Fatalf("registro provisório não associado ao agente: %v", err)
+	}
+	if status != enrollmentPending || key != "chave" {
+		t.Errorf("registro associado = %s %q, esperado %s com a chave do agente", status, key, enrollmentPending)
+	}
+	var data string
+	if err := db.QueryRow("SELECT data_json FROM computer_data WHERE agent_id = ?", testAgentID).Scan(&data); err != nil {
+		t.Fatalf("dados do registro provisório não associados ao agente: %v", err)
+	}
+	if data != `{"origem":"`+legacyID+`"}` {
+		t.Errorf("dados do agente = %s, esperado o snapshot do registro provisório", data)
+	}
+}
+
+// TestClaimLegacyComputerArchivesMergedRecord verifica que o registro provisório unido a um agente que já tem
+// registro é arquivado com os seus dados, mantendo a primeira vez em que o computador foi visto
+func TestClaimLegacyComputerArchivesMergedRecord(t *testing.T) {
+	openTestDatabase(t)
+	legacyID := legacyComputerID("", "aa:bb:cc:dd:ee:ff")
+	legacySeen := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	insertTestComputer(t, legacyID, "", "aa:bb:cc:dd:ee:ff", enrollmentApproved, "", legacySeen)
+	insertTestComputer(t, testAgentID, "", "aa:bb:cc:dd:ee:ff", enrollmentPending, "chave", time.Now())
+
+	claimInTransaction(t, testAgentID, "", "aa:bb:cc:dd:ee:ff", "chave", true)
+
+	if n := countRows(t, "computers", legacyID); n != 0 {
+		t.Errorf("registro provisório ainda existe (%d)", n)
+	}
+	var archivedID, archivedData, archivedStatus string
+	err := db.QueryRow("SELECT legacy_id, data_json, inscricao FROM computers_arquivados WHERE agent_id = ?", testAgentID).
+		Scan(&archivedID, &archivedData, &archivedStatus)
+	if err != nil {
+		t.Fatalf("registro provisório não arquivado: %v", err)
+	}
+	if archivedID != legacyID || archivedData != `{"origem":"`+legacyID+`"}` {
+		t.Errorf("arquivo = %s %s, esperado o registro %s com o seu snapshot", archivedID, archivedData, legacyID)
+	}
+
+	var status string
+	var firstSeen time.Time
+	if err := db.QueryRow("SELECT inscricao, first_seen FROM computers WHERE agent_id = ?", testAgentID).Scan(&status, &firstSeen); err != nil {
+		t.Fatalf("erro ao consultar agente: %v", err)
+	}
+	if status != enrollmentPending {
+		t.Errorf("inscrição do agente = %s, esperado %s (situação do registro provisório copiada?)", status, enrollmentPending)
+	}
+	if !firstSeen.Equal(legacySeen) {
+		t.Errorf("first_seen do agente = %v, esperado %v", firstSeen, legacySeen)
+	}
+}
+
+// TestClaimLegacyComputerRequiresAuthenticatedLink verifica que número de série e MAC coincidentes não bastam
+// para associar um registro provisório sem a confirmação do administrador ou a mesma chave pública
+func TestClaimLegacyComputerRequiresAuthenticatedLink(t *testing.T) {
+	openTestDatabase(t)
+	legacyID := legacyComputerID("SN123", "")
+	insertTestComputer(t, legacyID, "SN123", "", enrollmentApproved, "", time.Now())
+	keyedID := legacyComputerID("", "aa:bb:cc:dd:ee:ff")
+	insertTestComputer(t, keyedID, "", "aa:bb:cc:dd:ee:ff", enrollmentApproved, "outra-chave", time.Now())
+
+	claimInTransaction(t, testAgentID, "SN123", "aa:bb:cc:dd:ee:ff", "chave", false)
+
+	if n := countRows(t, "computers", legacyID); n != 1 {
+		t.Errorf("registro provisório sem chave associado sem confirmação")
+	}
+	if n := countRows(t, "computers", keyedID); n != 1 {
+		t.Errorf("registro provisório com outra chave associado sem confirmação")
+	}
+	if n := countRows(t, "computers", testAgentID); n != 0 {
+		t.Errorf("registros do agente = %d, esperado 0", n)
+	}
+}
+
+// TestApproveComputerClaimsLegacyRecords verifica que a aprovação pelo administrador une ao agente os registros
+// antigos do mesmo computador
+func TestApproveComputerClaimsLegacyRecords(t *testing.T) {
+	openTestDatabase(t)
+	legacyID := legacyComputerID("SN123", "")
+	insertTestComputer(t, legacyID, "SN123", "", enrollmentApproved, "", time.Now().Add(-time.Hour))
+	insertTestComputer(t, testAgentID, "SN123", "aa:bb:cc:dd:ee:ff", enrollmentPending, "chave", time.Now())
+
+	if err := approveComputer(testAgentID); err != nil {
+		t.Fatalf("erro ao aprovar computador: %v", err)
+	}
+
+	if n := countRows(t, "computers", legacyID); n != 0 {
+		t.Errorf("registro provisório ainda existe (%d)", n)
+	}
+	if n := countRows(t, "computers_arquivados", testAgentID); n != 1 {
+		t.Errorf("registros arquivados = %d, esperado 1", n)
+	}
+	var status string
+	if err := db.QueryRow("SELECT inscricao FROM computers WHERE agent_id = ?", testAgentID).Scan(&status); err != nil {
+		t.Fatalf("erro ao consultar agente: %v", err)
+	}
+	if status != enrollmentApproved {
+		t.Errorf("inscrição do agente = %s, esperado %s", status, enrollmentApproved)
+	}
+}
+
+// testSnapshot monta um snapshot mínimo do agente com UUID, número de série e token de inscrição
+func testSnapshot(agentID, serial, publicKey, token string) map[string]interface{} {
+	return map[string]interface{}{
+		"agente": map[string]interface{}{
+			"agente_id":       agentID,
+			"numero_serie":    serial,
+			"chave_publica":   publicKey,
+			"token_inscricao": token,
+		},
+	}
+}
+
+// TestSaveComputerInfoKeepsNewAgentPending verifica que um novo UUID com o mesmo número de série de um
+// registro antigo aprovado, sem token, fica pendente e não assume o registro antigo
+func TestSaveComputerInfoKeepsNewAgentPending(t *testing.T) {
+	for _, legacyKey := range []string{"", "chave"} {
+		openTestDatabase(t)
+		legacyID := legacyComputerID("SN123", "")
+		insertTestComputer(t, legacyID, "SN123", "", enrollmentApproved, legacyKey, time.Now())
+
+		status, err := saveComputerInfo(testSnapshot(testAgentID, "SN123", "chave", ""), "10.0.0.1", "", true)
+		if err != nil {
+			t.Fatalf("erro ao salvar computador: %v", err)
+		}
+		if status != enrollmentPending {
+			t.Errorf("chave do registro antigo %q: inscrição = %s, esperado %s", legacyKey, status, enrollmentPending)
+		}
+		var stored string
+		if err := db.QueryRow("SELECT inscricao FROM computers WHERE agent_id = ?", testAgentID).Scan(&stored); err != nil {
+			t.Fatalf("erro ao consultar agente: %v", err)
+		}
+		if stored != enrollmentPending {
+			t.Errorf("chave do registro antigo %q: inscrição gravada = %s, esperado %s", legacyKey, stored, enrollmentPending)
+		}
+		if n := countRows(t, "computers", legacyID); n != 1 {
+			t.Errorf("chave do registro antigo %q: registro antigo assumido por agente pendente", legacyKey)
+		}
+	}
+}
+
+// TestSaveComputerInfoClaimsAfterEnrollment verifica que o agente inscrito com token assume o registro antigo
+// com a mesma chave pública
+func TestSaveComputerInfoClaimsAfterEnrollment(t *testing.T) {
+	openTestDatabase(t)
+	legacyID := legacyComputerID("SN123", "")
+	insertTestComputer(t, legacyID, "SN123", "", enrollmentPending, "chave", time.Now())
+	token, _, err := createEnrollmentToken("teste", time.Hour)
+	if err != nil {
+		t.Fatalf("erro ao gerar token: %v", err)
+	}
+
+	status, err := saveComputerInfo(testSnapshot(testAgentID, "SN123", "chave", token), "10.0.0.1", "", true)
+	if err != nil {
+		t.Fatalf("erro ao salvar computador: %v", err)
+	}
+	if status != enrollmentApproved {
+		t.Errorf("inscrição = %s, esperado %s", status, enrollmentApproved)
+	}
+	if n := countRows(t, "computers", legacyID); n != 0 {
+		t.Errorf("registro antigo não assumido pelo agente inscrito")
+	}
+	if n := countRows(t, "computers", testAgentID); n != 1 {
+		t.Errorf("registros do agente = %d, esperado 1", n)
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Tamanho máximo aceito de um snapshot enviado por um agente (criptografado e em base64)
+const maxIngestBodySize = 16 * 1024 * 1024
+
+// Último envio recebido de cada IP, usado pela varredura para não consultar novamente agentes que enviaram há pouco
+var (
+	ultimosEnvios      = make(map[string]time.Time)
+	ultimosEnviosMutex sync.Mutex
+)
+
+// iniciarServidorIngestao inicia o listener HTTP que recebe os snapshots enviados pelos agentes
+//
+//	POST /agent/snapshot  snapshot criptografado (mesmo formato da resposta do agente), com o ETag no cabeçalho;
+//	                      a resposta informa a situação da inscrição no cabeçalho X-Agente-Inscricao
+//	POST /agent/checkin   apenas o cabeçalho If-Match com o ETag: o agente continua ativo e sem alterações
+//	POST /agent/event     evento criptografado (início do agente, término de jobs, ...)
+func iniciarServidorIngestao(port int) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/agent/snapshot", snapshotIngestHandler)
+	mux.HandleFunc("/agent/checkin", checkinIngestHandler)
+	mux.HandleFunc("/agent/event", eventIngestHandler)
+
+	server := &http.Server{
+		Addr:              fmt.Sprintf(":%d", port),
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       60 * time.Second,
+		WriteTimeout:      30 * time.Second,
+	}
+
+	go func() {
+		fmt.Printf("Recebendo snapshots dos agentes na porta %d\n", port)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			fmt.Printf("ERRO: Servidor de ingestão encerrado: %v\n", err)
+		}
+	}()
+}
+
+// snapshotIngestHandler recebe o snapshot completo de um agente e o salva no banco de dados
+func snapshotIngestHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Método não permitido", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIngestBodySize))
+	if err != nil {
+		http.Error(w, "Erro ao ler snapshot", http.StatusBadRequest)
+		return
+	}
+
+	// Apenas snapshots criptografados são aceitos (o envio não passa pela varredura)
+	info, err := decryptData(body)
+	if err != nil {
+		fmt.Printf("Snapshot inválido recebido de %s: %v\n", r.RemoteAddr, err)
+		http.Error(w, "Snapshot inválido", http.StatusBadRequest)
+		return
+	}
+
+	// Verificar a assinatura do agente (com a chave registrada ou, no primeiro envio, com a chave apresentada)
+	ip := remoteIP(r)
+	agentID, _, _, err := identifyComputer(info)
+	if err != nil {
+		fmt.Printf("Snapshot inválido recebido de %s: %v\n", ip, err)
+		http.Error(w, "Snapshot inválido", http.StatusBadRequest)
+		return
+	}
+	etag := r.Header.Get("ETag")
+	verified, ok := authorizeAgentPush(w, r, agentID, extractAgentPublicKey(info), etag, body)
+	if !ok {
+		return
+	}
+
+	status, err := saveComputerInfo(info, ip, etag, verified)
+	if err != nil {
+		fmt.Printf("Erro ao salvar snapshot recebido de %s: %v\n", ip, err)
+		http.Error(w, "Erro ao salvar snapshot", http.StatusInternalServerError)
+		return
+	}
+	registrarEnvio(ip)
+
+	// Informar ao agente a situação da inscrição (aprovado, o agente deixa de apresentar o token)
+	w.Header().Set(enrollmentHeader, status)
+	if status == enrollmentPending {
+		fmt.Printf("Snapshot recebido de %s (inscrição pendente de aprovação)\n", ip)
+	} else {
+		fmt.Printf("Snapshot recebido de %s\n", ip)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// checkinIngestHandler registra que o agente continua ativo com o snapshot já recebido
+// Responde 412 se o ETag não é conhecido, para que o agente envie o snapshot completo
+func checkinIngestHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Método não permitido", http.StatusMethodNotAllowed)
+		return
+	}
+
+	etag := r.Header.Get("If-Match")
+	if etag == "" {
+		http.Error(w, "Cabeçalho If-Match não fornecido", http.StatusBadRequest)
+		return
+	}
+
+	// O check-in não tem corpo: a assinatura cobre o ETag, o horário de emissão e o nonce
+	agentID := r.Header.Get(agentIDHeader)
+	verified, ok := authorizeAgentPush(w, r, agentID, "", etag, nil)
+	if !ok {
+		return
+	}
+
+	ip := remoteIP(r)
+	found, err := touchComputerByETag(etag, ip, agentID, verified)
+	if err != nil {
+		fmt.Printf("Erro ao registrar check-in de %s: %v\n", ip, err)
+		http.Error(w, "Erro ao registrar check-in", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Snapshot desconhecido", http.StatusPreconditionFailed)
+		return
+	}
+	registrarEnvio(ip)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// eventIngestHandler recebe um evento de um agente (entregue em ordem pela fila de envio do agente)
+func eventIngestHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Método não permitido", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIngestBodySize))
+	if err != nil {
+		http.Error(w, "Erro ao ler evento", http.StatusBadRequest)
+		return
+	}
+
+	event, err := decryptData(body)
+	if err != nil {
+		fmt.Printf("Evento inválido recebido de %s: %v\n", r.RemoteAddr, err)
+		http.Error(w, "Evento inválido", http.StatusBadRequest)
+		return
+	}
+
+	tipo, _ := event["tipo"].(string)
+	if tipo == "" {
+		http.Error(w, "Tipo do evento não informado", http.StatusBadRequest)
+		return
+	}
+	// O identificador coberto pela assinatura é o do cabeçalho; o informado no evento precisa ser o mesmo
+	agentID := r.Header.Get(agentIDHeader)
+	if eventAgentID, _ := event["agente_id"].(string); eventAgentID != "" && eventAgentID != agentID {
+		fmt.Printf("Evento recebido de %s com identificador diferente do agente: %s\n", remoteIP(r), eventAgentID)
+		http.Error(w, "Identificador do agente não confere", http.StatusForbidden)
+		return
+	}
+	if _, ok := authorizeAgentPush(w, r, agentID, "", "", body); !ok {
+		return
+	}
+
+	// Horário em que o evento ocorreu no agente (pode ser anterior ao recebimento, se o servidor estava fora do ar)
+	ocorridoEm := time.Now()
+	if value, ok := event["ocorrido_em"].(string); ok {
+		if parsed, err := time.Parse(time.RFC3339, value); err == nil {
+			ocorridoEm = parsed
+		}
+	}
+
+	ip := remoteIP(r)
+	if err := saveAgentEvent(agentID, ip, tipo, event["dados"], ocorridoEm); err != nil {
+		fmt.Printf("Erro ao salvar evento recebido de %s: %v\n", ip, err)
+		http.Error(w, "Erro ao salvar evento", http.StatusInternalServerError)
+		return
+	}
+
+	fmt.Printf("Evento %s recebido de %s (ocorrido em %s)\n", tipo, ip, ocorridoEm.Format(time.RFC3339))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// authorizeAgentPush verifica a assinatura, o horário de emissão e o nonce do envio do agente
+// Responde 403 se o agente foi revogado, a assinatura não confere ou o envio é uma repetição, e 500 se a
+// verificação falhou. Retorna se o envio foi assinado (verified) e se foi aceito (ok)
+func authorizeAgentPush(w http.ResponseWriter, r *http.Request, agentID, presentedKey, etag string, body []byte) (verified, ok bool) {
+	verified, err := authenticateAgentPush(r, agentID, presentedKey, etag, body)
+	if err == nil {
+		return verified, true
+	}
+
+	fmt.Printf("Envio do agente %s (%s) recusado: %v\n", agentID, remoteIP(r), err)
+	if isAgentAuthError(err) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+	} else {
+		http.Error(w, "Erro ao verificar assinatura do agente", http.StatusInternalServerError)
+	}
+	return false, false
+}
+
+// remoteIP retorna o IP de origem da requisição, sem a porta
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// registrarEnvio guarda o horário do último envio recebido do IP
+func registrarEnvio(ip string) {
+	ultimosEnviosMutex.Lock()
+	defer ultimosEnviosMutex.Unlock()
+	ultimosEnvios[ip] = time.Now()
+}
+
+// envioRecente verifica se o IP enviou um snapshot ou check-in dentro da janela informada
+func envioRecente(ip string, janela time.Duration) bool {
+	ultimosEnviosMutex.Lock()
+	defer ultimosEnviosMutex.Unlock()
+	ultimo, ok := ultimosEnvios[ip]
+	return ok && time.Since(ultimo) < janela
+}
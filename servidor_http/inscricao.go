@@ -0,0 +1,313 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Cabeçalho com a situação da inscrição, enviado ao agente na resposta aos snapshots
+const enrollmentHeader = "X-Agente-Inscricao"
+
+// Situações da inscrição de um computador: apenas os aprovados fazem parte do inventário
+// (revogado: o agente consta na lista de revogação e seus envios são recusados)
+const (
+	enrollmentApproved = "aprovado"
+	enrollmentPending  = "pendente"
+	enrollmentRevoked  = "revogado"
+)
+
+// Motivos de recusa de um token de inscrição
+var (
+	errTokenNotFound = errors.New("token de inscrição desconhecido")
+	errTokenExpired  = errors.New("token de inscrição expirado")
+	errTokenUsed     = errors.New("token de inscrição já utilizado por outro agente")
+)
+
+// Tabela dos tokens de inscrição; apenas o hash SHA-256 do token é guardado
+const createEnrollmentTokensTable = `
+	CREATE TABLE IF NOT EXISTS enrollment_tokens (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		token_hash TEXT UNIQUE,
+		descricao TEXT,
+		criado_em TIMESTAMP,
+		expira_em TIMESTAMP,
+		usado_em TIMESTAMP,
+		agent_id TEXT
+	)
+`
+
+// hashEnrollmentToken retorna o hash guardado no banco para o token
+func hashEnrollmentToken(token string) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(token)))
+	return hex.EncodeToString(sum[:])
+}
+
+// createEnrollmentToken gera um token de inscrição de uso único, válido pelo período informado
+// O token só é exibido neste momento: o banco guarda apenas o hash
+func createEnrollmentToken(descricao string, validade time.Duration) (string, time.Time, error) {
+	randomBytes := make([]byte, 16)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return "", time.Time{}, fmt.Errorf("erro ao gerar token de inscrição: %v", err)
+	}
+	token := hex.EncodeToString(randomBytes)
+
+	now := time.Now()
+	expiresAt := now.Add(validade)
+	_, err := db.Exec(`
+		INSERT INTO enrollment_tokens (token_hash, descricao, criado_em, expira_em)
+		VALUES (?, ?, ?, ?)
+	`, hashEnrollmentToken(token), descricao, now, expiresAt)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("erro ao salvar token de inscrição: %v", err)
+	}
+	return token, expiresAt, nil
+}
+
+// redeemEnrollmentToken consome o token apresentado pelo agente, associando-o ao agente
+// Um token já consumido pelo mesmo agente continua aceito (o agente reapresenta o token até saber que foi aprovado)
+func redeemEnrollmentToken(tx *sql.Tx, token, agentID string) error {
+	var id int64
+	var expiresAt time.Time
+	var usedAt sql.NullTime
+	var usedBy sql.NullString
+	err := tx.QueryRow(`
+		SELECT id, expira_em, usado_em, agent_id FROM enrollment_tokens WHERE token_hash = ?
+	`, hashEnrollmentToken(token)).Scan(&id, &expiresAt, &usedAt, &usedBy)
+	if err == sql.ErrNoRows {
+		return errTokenNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("erro ao consultar token de inscrição: %v", err)
+	}
+
+	if usedAt.Valid {
+		if usedBy.String == agentID {
+			return nil
+		}
+		return errTokenUsed
+	}
+	if time.Now().After(expiresAt) {
+		return errTokenExpired
+	}
+
+	_, err = tx.Exec("UPDATE enrollment_tokens SET usado_em = ?, agent_id = ? WHERE id = ?", time.Now(), agentID, id)
+	if err != nil {
+		return fmt.Errorf("erro ao consumir token de inscrição: %v", err)
+	}
+	return nil
+}
+
+// resolveEnrollment determina a situação da inscrição do computador ao receber um snapshot
+// Computadores já aprovados continuam aprovados; os demais são aprovados se apresentarem um token válido
+// (apenas agentes com UUID: os antigos precisam ser aprovados pelo administrador com -aprovar)
+func resolveEnrollment(tx *sql.Tx, agentID, token string) (string, error) {
+	var status sql.NullString
+	err := tx.QueryRow("SELECT inscricao FROM computers WHERE agent_id = ?", agentID).Scan(&status)
+	if err != nil && err != sql.ErrNoRows {
+		return "", fmt.Errorf("erro ao consultar inscrição do computador: %v", err)
+	}
+	if status.String == enrollmentApproved || status.String == enrollmentRevoked {
+		return status.String, nil
+	}
+
+	if token == "" || !isAgentUUID(agentID) {
+		return enrollmentPending, nil
+	}
+
+	err = redeemEnrollmentToken(tx, token, agentID)
+	if errors.Is(err, errTokenNotFound) || errors.Is(err, errTokenExpired) || errors.Is(err, errTokenUsed) {
+		fmt.Printf("Inscrição do agente %s recusada: %v\n", agentID, err)
+		return enrollmentPending, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	fmt.Printf("Agente %s inscrito com token\n", agentID)
+	return enrollmentApproved, nil
+}
+
+// extractEnrollmentToken retira do snapshot o token de inscrição apresentado pelo agente,
+// para que não seja guardado junto com os dados do computador
+func extractEnrollmentToken(info map[string]interface{}) string {
+	agente, ok := info["agente"].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	token, _ := agente["token_inscricao"].(string)
+	delete(agente, "token_inscricao")
+	return strings.TrimSpace(token)
+}
+
+// approveComputer aprova manualmente a inscrição de um computador pendente e une a ele os registros antigos
+// do mesmo computador
+func approveComputer(agentID string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("erro ao iniciar transação: %v", err)
+	}
+	defer tx.Rollback()
+
+	var mac, serial, publicKey sql.NullString
+	err = tx.QueryRow("SELECT mac_address, numero_serie, chave_publica FROM computers WHERE agent_id = ?", agentID).
+		Scan(&mac, &serial, &publicKey)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("computador não encontrado: %s", agentID)
+	}
+	if err != nil {
+		return fmt.Errorf("erro ao aprovar computador: %v", err)
+	}
+
+	if _, err := tx.Exec("UPDATE computers SET inscricao = ? WHERE agent_id = ?", enrollmentApproved, agentID); err != nil {
+		return fmt.Errorf("erro ao aprovar computador: %v", err)
+	}
+
+	// A aprovação confirma que o agente é o computador que informa: os registros antigos do mesmo número de série
+	// ou MAC são unidos a ele
+	if isAgentUUID(agentID) {
+		if err := claimLegacyComputer(tx, agentID, serial.String, mac.String, publicKey.String, true); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("erro ao confirmar aprovação: %v", err)
+	}
+	return nil
+}
+
+// EnrollmentToken descreve um token de inscrição (sem o valor do token)
+type EnrollmentToken struct {
+	ID        int64
+	Descricao string
+	CriadoEm  time.Time
+	ExpiraEm  time.Time
+	UsadoEm   sql.NullTime
+	AgentID   string
+}
+
+// listEnrollmentTokens lista os tokens de inscrição, do mais recente ao mais antigo
+func listEnrollmentTokens() ([]EnrollmentToken, error) {
+	rows, err := db.Query(`
+		SELECT id, COALESCE(descricao, ''), criado_em, expira_em, usado_em, COALESCE(agent_id, '')
+		FROM enrollment_tokens
+		ORDER BY id DESC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao consultar tokens de inscrição: %v", err)
+	}
+	defer rows.Close()
+
+	var tokens []EnrollmentToken
+	for rows.Next() {
+		var token EnrollmentToken
+		if err := rows.Scan(&token.ID, &token.Descricao, &token.CriadoEm, &token.ExpiraEm, &token.UsadoEm, &token.AgentID); err != nil {
+			return nil, fmt.Errorf("erro ao ler token de inscrição: %v", err)
+		}
+		tokens = append(tokens, token)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("erro ao iterar tokens de inscrição: %v", err)
+	}
+	return tokens, nil
+}
+
+// adminCommand reúne os comandos de administração da inscrição e da revogação dos agentes
+// (-gerar-token, -tokens, -pendentes, -aprovar, -revogar e -revogados)
+type adminCommand struct {
+	gerarToken      bool
+	tokenDescricao  string
+	tokenValidade   time.Duration
+	listarTokens    bool
+	listarPendentes bool
+	aprovar         string
+	revogar         string
+	motivo          string
+	listarRevogados bool
+}
+
+// requested verifica se algum comando de administração foi solicitado
+func (c adminCommand) requested() bool {
+	return c.gerarToken || c.listarTokens || c.listarPendentes || c.aprovar != "" || c.revogar != "" || c.listarRevogados
+}
+
+// runAdminCommand executa o comando de administração solicitado
+func runAdminCommand(c adminCommand) error {
+	if err := initDatabase(); err != nil {
+		return fmt.Errorf("erro ao inicializar banco de dados: %v", err)
+	}
+	defer closeDatabase()
+
+	switch {
+	case c.gerarToken:
+		if c.tokenValidade <= 0 {
+			return fmt.Errorf("validade do token inválida: %s", c.tokenValidade)
+		}
+		token, expiresAt, err := createEnrollmentToken(c.tokenDescricao, c.tokenValidade)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Token de inscrição: %s\n", token)
+		fmt.Printf("Válido até %s, para um único agente (token_inscricao no agente.json, -token-inscricao ou AGENTE_TOKEN_INSCRICAO)\n",
+			expiresAt.Format("2006-01-02 15:04:05"))
+
+	case c.listarTokens:
+		tokens, err := listEnrollmentTokens()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Tokens de inscrição: %d\n", len(tokens))
+		for _, token := range tokens {
+			situacao := "disponível"
+			if token.UsadoEm.Valid {
+				situacao = fmt.Sprintf("usado em %s pelo agente %s", token.UsadoEm.Time.Format("2006-01-02 15:04:05"), token.AgentID)
+			} else if time.Now().After(token.ExpiraEm) {
+				situacao = "expirado"
+			}
+			fmt.Printf("  %d  %-30s  criado em %s, válido até %s  %s\n", token.ID, token.Descricao,
+				token.CriadoEm.Format("2006-01-02 15:04:05"), token.ExpiraEm.Format("2006-01-02 15:04:05"), situacao)
+		}
+
+	case c.listarPendentes:
+		computers, err := getPendingComputers()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Computadores pendentes de aprovação: %d\n", len(computers))
+		for _, computer := range computers {
+			fmt.Printf("  %s  %-20v  %-15v  MAC %v  série %v  chave %s  visto em %v\n", computer["agent_id"], computer["hostname"],
+				computer["ip_address"], computer["mac_address"], computer["numero_serie"],
+				agentKeyFingerprint(computer["chave_publica"].(string)), computer["last_seen"])
+		}
+
+	case c.aprovar != "":
+		if err := approveComputer(strings.TrimSpace(c.aprovar)); err != nil {
+			return err
+		}
+		fmt.Printf("Computador %s aprovado\n", c.aprovar)
+
+	case c.revogar != "":
+		if err := revokeAgent(strings.TrimSpace(c.revogar), c.motivo); err != nil {
+			return err
+		}
+		fmt.Printf("Agente %s revogado: seus envios e respostas não são mais aceitos\n", c.revogar)
+
+	case c.listarRevogados:
+		revocations, err := listAgentRevocations()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Agentes revogados: %d\n", len(revocations))
+		for _, revocation := range revocations {
+			fmt.Printf("  %s  chave %s  revogado em %s  %s\n", revocation.AgentID, agentKeyFingerprint(revocation.ChavePublica),
+				revocation.RevogadoEm.Format("2006-01-02 15:04:05"), revocation.Motivo)
+		}
+	}
+	return nil
+}
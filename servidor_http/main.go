@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"net"
 	"os"
@@ -10,6 +11,40 @@ import (
 )
 
 func main() {
+	portaIngestao := flag.Int("porta-ingestao", 0, "Porta que recebe os snapshots enviados pelos agentes, ex: 9990 (padrão: 0, recebimento desativado)")
+	varredura := flag.Bool("varredura", true, "Varrer as redes consultando os agentes (use -varredura=false para receber apenas os envios)")
+	janelaEnvio := flag.Duration("janela-envio", 40*time.Minute, "Agentes que enviaram snapshot neste período não são consultados pela varredura")
+	gerarToken := flag.Bool("gerar-token", false, "Gerar um token de inscrição de uso único para um novo agente e sair")
+	tokenDescricao := flag.String("token-descricao", "", "Descrição do token gerado com -gerar-token (ex: nome do computador)")
+	tokenValidade := flag.Duration("token-validade", 72*time.Hour, "Validade do token gerado com -gerar-token")
+	listarTokens := flag.Bool("tokens", false, "Listar os tokens de inscrição e sair")
+	listarPendentes := flag.Bool("pendentes", false, "Listar os computadores pendentes de aprovação e sair")
+	aprovar := flag.String("aprovar", "", "Aprovar a inscrição do computador pendente com o identificador informado e sair")
+	revogar := flag.String("revogar", "", "Revogar o agente com o identificador informado (e sua chave) e sair")
+	motivo := flag.String("motivo", "", "Motivo da revogação com -revogar")
+	listarRevogados := flag.Bool("revogados", false, "Listar os agentes revogados e sair")
+	flag.BoolVar(&acceptLegacyAgents, "aceitar-agentes-sem-chave", false, "Aceitar, sem assinatura, snapshots e respostas de agentes antigos que ainda não têm chave própria")
+	flag.Parse()
+
+	admin := adminCommand{
+		gerarToken:      *gerarToken,
+		tokenDescricao:  *tokenDescricao,
+		tokenValidade:   *tokenValidade,
+		listarTokens:    *listarTokens,
+		listarPendentes: *listarPendentes,
+		aprovar:         *aprovar,
+		revogar:         *revogar,
+		motivo:          *motivo,
+		listarRevogados: *listarRevogados,
+	}
+	if admin.requested() {
+		if err := runAdminCommand(admin); err != nil {
+			fmt.Printf("ERRO: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Configurações
 	// Obtendo múltiplas redes
 	redes, err := getMultipleNetworks()
@@ -24,7 +59,11 @@ func main() {
 	maxWorkers := 25
 
 	fmt.Println("=== Servidor de Monitoramento HTTP ===")
-	fmt.Printf("Monitorando as redes: %s\n", strings.Join(redes, ", "))
+	if *varredura {
+		fmt.Printf("Monitorando as redes: %s\n", strings.Join(redes, ", "))
+	} else {
+		fmt.Println("Varredura desativada: apenas os snapshots enviados pelos agentes serão recebidos")
+	}
 	fmt.Printf("Intervalo de consulta: %s\n", intervaloConsulta)
 
 	// Verificando se o diretório de chaves existe
@@ -58,30 +97,53 @@ func main() {
 	defer closeDatabase()
 	fmt.Println("Banco de dados inicializado com sucesso.")
 
+	// Receber os snapshots enviados pelos agentes
+	if *portaIngestao > 0 {
+		iniciarServidorIngestao(*portaIngestao)
+	} else if !*varredura {
+		fmt.Println("ERRO: Varredura e recebimento de snapshots desativados ao mesmo tempo")
+		return
+	}
+
 	for {
-		fmt.Println("\nIniciando descoberta de agentes...")
 		inicio := time.Now()
 
 		// Descobrir agentes em todas as redes
-		agentes := make(map[string]map[string]interface{})
-		for _, rede := range redes {
-			fmt.Printf("\nEscaneando rede: %s\n", rede)
-			agentesRede := descobrirAgentes(rede, port, maxWorkers)
-
-			// Adicionar ao mapa principal
-			for ip, info := range agentesRede {
-				agentes[ip] = info
+		agentes := make(map[string]*respostaAgente)
+		if *varredura {
+			fmt.Println("\nIniciando descoberta de agentes...")
+			for _, rede := range redes {
+				fmt.Printf("\nEscaneando rede: %s\n", rede)
+				agentesRede := descobrirAgentes(rede, port, maxWorkers, *janelaEnvio)
+
+				// Adicionar ao mapa principal
+				for ip, info := range agentesRede {
+					agentes[ip] = info
+				}
 			}
+
+			fmt.Printf("\nTotal de agentes encontrados: %d\n", len(agentes))
 		}
+		semAlteracoes := 0
+		for ip, resposta := range agentes {
+			// Snapshot inalterado: apenas registrar que o computador foi visto
+			if resposta.semAlteracoes {
+				semAlteracoes++
+				if err := touchComputer(resposta.agenteID); err != nil {
+					fmt.Printf("Erro ao atualizar computador %s: %v\n", resposta.agenteID, err)
+				}
+				continue
+			}
 
-		fmt.Printf("\nTotal de agentes encontrados: %d\n", len(agentes))
-		for ip, info := range agentes {
+			info := resposta.info
 			fmt.Printf("\nIP: %s\n", ip)
 
 			// Salvar informações no banco de dados
-			err := saveComputerInfo(info, ip)
+			status, err := saveComputerInfo(info, ip, resposta.etag, resposta.verificado)
 			if err != nil {
 				fmt.Printf("Erro ao salvar informações no banco de dados: %v\n", err)
+			} else if status == enrollmentPending {
+				fmt.Printf("Informações salvas no banco de dados (inscrição pendente de aprovação).\n")
 			} else {
 				fmt.Printf("Informações salvas no banco de dados com sucesso.\n")
 			}
@@ -150,6 +212,10 @@ func main() {
 			}
 		}
 
+		if semAlteracoes > 0 {
+			fmt.Printf("\nAgentes sem alterações desde a última consulta: %d\n", semAlteracoes)
+		}
+
 		// Exibir estatísticas do banco de dados
 		computers, err := getAllComputers()
 		if err != nil {
@@ -157,6 +223,9 @@ func main() {
 		} else {
 			fmt.Printf("\nTotal de computadores no banco de dados: %d\n", len(computers))
 		}
+		if pendentes, err := getPendingComputers(); err == nil && len(pendentes) > 0 {
+			fmt.Printf("Computadores pendentes de aprovação: %d (liste com -pendentes e aprove com -aprovar <id>)\n", len(pendentes))
+		}
 
 		tempoExecucao := time.Since(inicio)
 		fmt.Printf("\nTempo de execução: %.2f segundos\n", tempoExecucao.Seconds())
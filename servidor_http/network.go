@@ -10,8 +10,25 @@ import (
 	"time"
 )
 
+// respostaAgente é o resultado da consulta a um agente
+// Quando o snapshot não mudou desde a última consulta (304), info é nil e semAlteracoes é true
+type respostaAgente struct {
+	info          map[string]interface{}
+	etag          string // ETag do snapshot recebido
+	agenteID      string // Identificador do computador conhecido para o IP (usado quando não há alterações)
+	semAlteracoes bool
+	verificado    bool // Resposta com a assinatura do agente verificada
+}
+
 // Função para consultar um agente HTTP
-func consultarAgente(ip string, port int, timeout time.Duration, retries int) (map[string]interface{}, error) {
+// Envia o ETag do último snapshot conhecido para o IP; se o agente responder 304, o snapshot não é baixado novamente
+func consultarAgente(ip string, port int, timeout time.Duration, retries int) (*respostaAgente, error) {
+	// ETag do último snapshot salvo do computador neste IP
+	agenteConhecido, etagConhecido, err := getComputerETagByIP(ip)
+	if err != nil {
+		fmt.Printf("Aviso: %v\n", err)
+	}
+
 	for attempt := 0; attempt <= retries; attempt++ {
 		// Verificando se o host está online com um timeout menor
 		conn, err := net.DialTimeout("tcp", fmt.Sprintf("%s:%d", ip, port), timeout/2)
@@ -29,8 +46,25 @@ func consultarAgente(ip string, port int, timeout time.Duration, retries int) (m
 			Timeout: timeout,
 		}
 		
-		// Consultando o agente (sem parâmetro encrypt=true)
-		resp, err := client.Get(fmt.Sprintf("http://%s:%d", ip, port))
+		// Consultando o agente (sem parâmetro encrypt=true), preferindo o formato de criptografia híbrido e a compressão gzip
+		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://%s:%d", ip, port), nil)
+		if err != nil {
+			return nil, fmt.Errorf("erro ao criar requisição: %v", err)
+		}
+		req.Header.Set(encryptionHeader, acceptedEncryptionFormats)
+		req.Header.Set(keyIDHeader, acceptedKeyIDs())
+		req.Header.Set("Accept-Encoding", acceptedPayloadEncodings)
+		// Desafio incluído pelo agente na assinatura: uma resposta capturada não serve para outra consulta
+		desafio, err := newAgentChallenge()
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set(agentChallengeHeader, desafio)
+		if etagConhecido != "" {
+			req.Header.Set("If-None-Match", etagConhecido)
+		}
+
+		resp, err := client.Do(req)
 		if err != nil {
 			if attempt < retries {
 				fmt.Printf("Erro de conexão com %s. Tentando novamente (%d/%d)...\n", ip, attempt+1, retries)
@@ -41,6 +75,16 @@ func consultarAgente(ip string, port int, timeout time.Duration, retries int) (m
 		}
 		defer resp.Body.Close()
 		
+		// Snapshot inalterado desde a última consulta: a assinatura cobre o ETag
+		if resp.StatusCode == http.StatusNotModified && agenteConhecido != "" {
+			dados := agentResponseSignedData(desafio, agenteConhecido, []byte(etagConhecido))
+			verificado, err := authenticateAgent(agenteConhecido, "", dados, resp.Header.Get(agentSignatureHeader))
+			if err != nil {
+				return nil, fmt.Errorf("resposta do agente %s recusada: %v", agenteConhecido, err)
+			}
+			return &respostaAgente{etag: etagConhecido, agenteID: agenteConhecido, semAlteracoes: true, verificado: verificado}, nil
+		}
+		
 		if resp.StatusCode != http.StatusOK {
 			if attempt < retries {
 				fmt.Printf("Resposta inválida de %s (código %d). Tentando novamente (%d/%d)...\n", 
@@ -74,15 +118,28 @@ func consultarAgente(ip string, port int, timeout time.Duration, retries int) (m
 			}
 			return nil, fmt.Errorf("erro ao processar dados: %v", err)
 		}
+
+		// Verificar a assinatura do agente sobre a resposta e o desafio (com a chave registrada ou a apresentada
+		// na inscrição); respostas que não identificam o agente ou não podem ser verificadas são recusadas
+		agentID, _, _, err := identifyComputer(info)
+		if err != nil {
+			return nil, fmt.Errorf("resposta sem identificação do agente: %v", err)
+		}
+		dados := agentResponseSignedData(desafio, agentID, body)
+		verificado, err := authenticateAgent(agentID, extractAgentPublicKey(info), dados, resp.Header.Get(agentSignatureHeader))
+		if err != nil {
+			return nil, fmt.Errorf("resposta do agente %s recusada: %v", agentID, err)
+		}
 		
-		return info, nil
+		return &respostaAgente{info: info, etag: resp.Header.Get("ETag"), verificado: verificado}, nil
 	}
 	
 	return nil, fmt.Errorf("falha após %d tentativas", retries)
 }
 
 // Função para descobrir agentes na rede
-func descobrirAgentes(rede string, port int, maxWorkers int) map[string]map[string]interface{} {
+// IPs que enviaram snapshot ou check-in dentro de janelaEnvio não são consultados
+func descobrirAgentes(rede string, port int, maxWorkers int, janelaEnvio time.Duration) map[string]*respostaAgente {
 	fmt.Printf("Descobrindo agentes na rede %s...\n", rede)
 	
 	// Gerando lista de IPs da rede
@@ -90,9 +147,21 @@ func descobrirAgentes(rede string, port int, maxWorkers int) map[string]map[stri
 	if err != nil {
 		fmt.Printf("Erro ao processar a rede %s: %v\n", rede, err)
 		fmt.Println("Formato correto: 192.168.1.0/24")
-		return make(map[string]map[string]interface{})
+		return make(map[string]*respostaAgente)
 	}
 	
+	// Agentes no modo de envio, com snapshot recente, não precisam ser consultados
+	consultar := ips[:0]
+	for _, ip := range ips {
+		if !envioRecente(ip, janelaEnvio) {
+			consultar = append(consultar, ip)
+		}
+	}
+	if ignorados := len(ips) - len(consultar); ignorados > 0 {
+		fmt.Printf("Ignorando %d agentes que enviaram snapshot recentemente\n", ignorados)
+	}
+	ips = consultar
+
 	totalIPs := len(ips)
 	fmt.Printf("Escaneando %d endereços IP...\n", totalIPs)
 	
@@ -102,7 +171,7 @@ func descobrirAgentes(rede string, port int, maxWorkers int) map[string]map[stri
 		maxWorkers = 100 // Aumentando para 100 conexões simultâneas
 	}
 	
-	resultados := make(map[string]map[string]interface{})
+	resultados := make(map[string]*respostaAgente)
 	var mutex sync.Mutex
 	var wg sync.WaitGroup
 	
@@ -122,7 +191,7 @@ func descobrirAgentes(rede string, port int, maxWorkers int) map[string]map[stri
 			// Cada worker processa IPs do canal até que esteja vazio
 			for ip := range ipChan {
 				// Usando timeout menor para acelerar a verificação
-				info, err := consultarAgente(ip, port, 2*time.Second, 0)
+				resposta, err := consultarAgente(ip, port, 2*time.Second, 0)
 				
 				countMutex.Lock()
 				ipsProcessados++
@@ -134,10 +203,14 @@ func descobrirAgentes(rede string, port int, maxWorkers int) map[string]map[stri
 				}
 				countMutex.Unlock()
 				
-				if err == nil && info != nil {
-					fmt.Printf("Agente encontrado: %s\n", ip)
+				if err == nil && resposta != nil {
+					if resposta.semAlteracoes {
+						fmt.Printf("Agente encontrado: %s (sem alterações)\n", ip)
+					} else {
+						fmt.Printf("Agente encontrado: %s\n", ip)
+					}
 					mutex.Lock()
-					resultados[ip] = info
+					resultados[ip] = resposta
 					mutex.Unlock()
 				}
 			}